@@ -1,6 +1,9 @@
 package gocql
 
-import "net"
+import (
+	"net"
+	"strconv"
+)
 
 // AddressTranslator provides a way to translate node addresses (and ports) that are
 // discovered or received as a node event. This can be useful in an ec2 environment,
@@ -24,3 +27,48 @@ func IdentityTranslator() AddressTranslator {
 		return addr, port
 	})
 }
+
+// HostAddressTranslator is implemented by AddressTranslators which translate the
+// address of a host knowing its topology, such as its datacenter, rack and host
+// ID, for example to map the addresses of each datacenter differently. If the
+// ClusterConfig.AddressTranslator implements it, TranslateHost is called instead
+// of Translate for the hosts discovered from the system tables.
+type HostAddressTranslator interface {
+	AddressTranslator
+
+	// TranslateHost returns the addresses to connect to host, tried in order
+	// until a connection is established, see HostInfo.ConnectAddresses. The
+	// addresses must be TCP addresses with an IP, such as *net.TCPAddr, others
+	// are ignored. If no address is returned, the address of host is used.
+	TranslateHost(host *HostInfo) []net.Addr
+}
+
+// HostAddressTranslatorFunc is a HostAddressTranslator calling the function for
+// TranslateHost, its Translate method returns the address and port unchanged.
+type HostAddressTranslatorFunc func(host *HostInfo) []net.Addr
+
+func (fn HostAddressTranslatorFunc) Translate(addr net.IP, port int) (net.IP, int) {
+	return addr, port
+}
+
+func (fn HostAddressTranslatorFunc) TranslateHost(host *HostInfo) []net.Addr {
+	return fn(host)
+}
+
+// splitTCPAddr returns the IP and port of addr, ok is false if addr is not a TCP
+// address with an IP and a port.
+func splitTCPAddr(addr net.Addr) (ip net.IP, port int, ok bool) {
+	if tcpAddr, isTCP := addr.(*net.TCPAddr); isTCP {
+		ip, port = tcpAddr.IP, tcpAddr.Port
+	} else if addr != nil {
+		host, portStr, err := net.SplitHostPort(addr.String())
+		if err != nil {
+			return nil, 0, false
+		}
+		ip = net.ParseIP(host)
+		if port, err = strconv.Atoi(portStr); err != nil {
+			return nil, 0, false
+		}
+	}
+	return ip, port, validIpAddr(ip) && port > 0
+}
@@ -1,6 +1,7 @@
 package gocql
 
 import (
+	"context"
 	"net"
 	"testing"
 )
@@ -32,3 +33,70 @@ func TestIdentityAddressTranslator_HostProvided(t *testing.T) {
 	}
 	assertEqual(t, "translated port", 9042, port)
 }
+
+func TestHostAddressTranslator(t *testing.T) {
+	cfg := NewCluster()
+	cfg.Logger = &testLogger{}
+	cfg.AddressTranslator = HostAddressTranslatorFunc(func(host *HostInfo) []net.Addr {
+		if host.DataCenter() != "dc2" {
+			return nil
+		}
+		return []net.Addr{
+			&net.UnixAddr{Name: "/tmp/ignored", Net: "unix"},
+			&net.TCPAddr{IP: net.ParseIP("192.168.2.1"), Port: 19042},
+			&net.TCPAddr{IP: net.ParseIP("192.168.2.2"), Port: 19042},
+		}
+	})
+
+	host := &HostInfo{connectAddress: net.ParseIP("10.0.0.1"), port: 9042, dataCenter: "dc1"}
+	cfg.translateHost(host)
+	assertEqual(t, "untranslated address", "10.0.0.1:9042", host.ConnectAddressAndPort())
+
+	host = &HostInfo{connectAddress: net.ParseIP("10.0.0.2"), port: 9042, dataCenter: "dc2"}
+	cfg.translateHost(host)
+	assertEqual(t, "translated address", "192.168.2.1:19042", host.ConnectAddressAndPort())
+	addrs := host.ConnectAddresses()
+	if len(addrs) != 2 || addrs[1].String() != "192.168.2.2:19042" {
+		t.Fatalf("expected the valid translated addresses, got %v", addrs)
+	}
+
+	// a plain AddressTranslator is still given the address and port
+	cfg.AddressTranslator = staticAddressTranslator(net.ParseIP("10.10.10.10"), 5432)
+	host = &HostInfo{connectAddress: net.ParseIP("10.0.0.3"), port: 9042, dataCenter: "dc2"}
+	cfg.translateHost(host)
+	assertEqual(t, "translated address", "10.10.10.10:5432", host.ConnectAddressAndPort())
+}
+
+func TestDialHostTranslatedAddresses(t *testing.T) {
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().(*net.TCPAddr)
+	closed.Close()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	addr := ln.Addr().(*net.TCPAddr)
+
+	host := &HostInfo{
+		connectAddress:   closedAddr.IP,
+		port:             closedAddr.Port,
+		connectAddresses: []*net.TCPAddr{closedAddr, addr},
+	}
+	dialer := &defaultHostDialer{dialer: &net.Dialer{}}
+	dialed, err := dialer.DialHost(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Conn.Close()
+	assertEqual(t, "dialed address", addr.String(), dialed.Conn.RemoteAddr().String())
+}
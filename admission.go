@@ -0,0 +1,145 @@
+package gocql
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// AdmissionStats is a snapshot of the queries admitted by the session when
+// ClusterConfig.MaxConcurrentQueries is set.
+type AdmissionStats struct {
+	// Running is the number of queries currently executing.
+	Running int
+	// Queued is the number of queries waiting to execute, by priority.
+	Queued map[int]int
+}
+
+type admissionWaiter struct {
+	priority int
+	enqueued time.Time
+	ready    chan struct{}
+}
+
+// admissionController limits the number of queries executing concurrently.
+// Waiting queries are admitted by priority, the effective priority of a query
+// is raised by one for every agingInterval it waited so that low priority
+// queries are not starved.
+type admissionController struct {
+	limit         int
+	agingInterval time.Duration
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	// queues holds a FIFO queue of waiters per priority.
+	queues map[int][]*admissionWaiter
+}
+
+func newAdmissionController(limit int, agingInterval time.Duration) *admissionController {
+	return &admissionController{
+		limit:         limit,
+		agingInterval: agingInterval,
+		queues:        make(map[int][]*admissionWaiter),
+	}
+}
+
+// acquire blocks until the query may execute or ctx is done. Every successful
+// acquire must be followed by a release.
+func (a *admissionController) acquire(ctx context.Context, priority int) error {
+	a.mu.Lock()
+	if a.running < a.limit && a.queued == 0 {
+		a.running++
+		a.mu.Unlock()
+		return nil
+	}
+
+	w := &admissionWaiter{
+		priority: priority,
+		enqueued: time.Now(),
+		ready:    make(chan struct{}),
+	}
+	a.queues[priority] = append(a.queues[priority], w)
+	a.queued++
+	a.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return nil
+	case <-ctx.Done():
+		a.mu.Lock()
+		removed := a.remove(w)
+		a.mu.Unlock()
+		if !removed {
+			// admitted concurrently, hand the slot to the next waiter
+			a.release()
+		}
+		return ctx.Err()
+	}
+}
+
+func (a *admissionController) release() {
+	a.mu.Lock()
+	if w := a.next(time.Now()); w != nil {
+		close(w.ready)
+	} else {
+		a.running--
+	}
+	a.mu.Unlock()
+}
+
+// next dequeues the waiter with the highest effective priority. Within a
+// priority waiters are queued in order, so only the head of each queue needs
+// to be considered. Must be called with mu held.
+func (a *admissionController) next(now time.Time) *admissionWaiter {
+	var (
+		best      *admissionWaiter
+		bestScore int64
+	)
+	for _, queue := range a.queues {
+		w := queue[0]
+		score := int64(w.priority)
+		if a.agingInterval > 0 {
+			score += int64(now.Sub(w.enqueued) / a.agingInterval)
+		}
+		if best == nil || score > bestScore || (score == bestScore && w.enqueued.Before(best.enqueued)) {
+			best, bestScore = w, score
+		}
+	}
+	if best != nil {
+		a.remove(best)
+	}
+	return best
+}
+
+// remove removes w from its queue, it returns false if w is not queued. Must be
+// called with mu held.
+func (a *admissionController) remove(w *admissionWaiter) bool {
+	queue := a.queues[w.priority]
+	for i, qw := range queue {
+		if qw != w {
+			continue
+		}
+		if len(queue) == 1 {
+			delete(a.queues, w.priority)
+		} else {
+			a.queues[w.priority] = append(queue[:i], queue[i+1:]...)
+		}
+		a.queued--
+		return true
+	}
+	return false
+}
+
+func (a *admissionController) stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	stats := AdmissionStats{
+		Running: a.running,
+		Queued:  make(map[int]int, len(a.queues)),
+	}
+	for priority, queue := range a.queues {
+		stats.Queued[priority] = len(queue)
+	}
+	return stats
+}
@@ -0,0 +1,123 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func waitQueued(t *testing.T, a *admissionController, n int) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		a.mu.Lock()
+		queued := a.queued
+		a.mu.Unlock()
+		if queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %d queued queries, got %d", n, queued)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAdmissionPriority(t *testing.T) {
+	a := newAdmissionController(1, 0)
+	if err := a.acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan int, 3)
+	for i, priority := range []int{0, 10, 5} {
+		go func(priority int) {
+			if err := a.acquire(context.Background(), priority); err != nil {
+				t.Error(err)
+				return
+			}
+			admitted <- priority
+		}(priority)
+		waitQueued(t, a, i+1)
+	}
+
+	stats := a.stats()
+	if stats.Running != 1 || stats.Queued[0] != 1 || stats.Queued[5] != 1 || stats.Queued[10] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	for _, expected := range []int{10, 5, 0} {
+		a.release()
+		if priority := <-admitted; priority != expected {
+			t.Fatalf("expected priority %d to be admitted, got %d", expected, priority)
+		}
+	}
+	a.release()
+
+	if stats := a.stats(); stats.Running != 0 || len(stats.Queued) != 0 {
+		t.Fatalf("expected no running or queued queries, got %+v", stats)
+	}
+}
+
+func TestAdmissionAging(t *testing.T) {
+	a := newAdmissionController(1, time.Millisecond)
+	if err := a.acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan int, 2)
+	enqueue := func(priority, queued int) {
+		go func() {
+			if err := a.acquire(context.Background(), priority); err != nil {
+				t.Error(err)
+				return
+			}
+			admitted <- priority
+		}()
+		waitQueued(t, a, queued)
+	}
+
+	enqueue(0, 1)
+	// the low priority query aged past the high priority one
+	time.Sleep(50 * time.Millisecond)
+	enqueue(5, 2)
+
+	a.release()
+	if priority := <-admitted; priority != 0 {
+		t.Fatalf("expected the aged query to be admitted first, got priority %d", priority)
+	}
+	a.release()
+	<-admitted
+	a.release()
+}
+
+func TestAdmissionContextCancel(t *testing.T) {
+	a := newAdmissionController(1, 0)
+	if err := a.acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- a.acquire(ctx, 1)
+	}()
+	waitQueued(t, a, 1)
+	cancel()
+
+	if err := <-errCh; err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if stats := a.stats(); stats.Running != 1 || len(stats.Queued) != 0 {
+		t.Fatalf("expected the canceled query to be dequeued, got %+v", stats)
+	}
+
+	a.release()
+	if err := a.acquire(context.Background(), 0); err != nil {
+		t.Fatal(err)
+	}
+	a.release()
+}
@@ -60,3 +60,43 @@ func TestBatch_WithTimestamp(t *testing.T) {
 		t.Errorf("got ts %d, expected %d", storedTs, micros)
 	}
 }
+
+func TestBatch_AddStmtWithTimestamp(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if session.cfg.ProtoVersion < protoVersion3 {
+		t.Skip("Batch timestamps are only available on protocol >= 3")
+	}
+
+	if err := createTable(session, `CREATE TABLE gocql_test.batch_stmt_ts (id int primary key, val text)`); err != nil {
+		t.Fatal(err)
+	}
+
+	micros := time.Now().UnixNano()/1e3 - 1000
+
+	// the timestamp of a statement takes precedence over the batch timestamp
+	b := session.NewBatch(UnloggedBatch)
+	b.WithTimestamp(micros)
+	b.Query("INSERT INTO batch_stmt_ts (id, val) VALUES (?, ?)", 1, "val")
+	if err := b.AddStmtWithTimestamp("INSERT INTO batch_stmt_ts (id, val) VALUES (?, ?)", micros-10, 2, "val"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddStmtWithTimestamp("UPDATE batch_stmt_ts SET val = ? WHERE id = ?", micros-20, "val", 3); err != nil {
+		t.Fatal(err)
+	}
+	if err := session.ExecuteBatch(b); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[int]int64{1: micros, 2: micros - 10, 3: micros - 20}
+	for id, ts := range expected {
+		var storedTs int64
+		if err := session.Query(`SELECT writetime(val) FROM batch_stmt_ts WHERE id = ?`, id).Scan(&storedTs); err != nil {
+			t.Fatal(err)
+		}
+		if storedTs != ts {
+			t.Errorf("id %d: got ts %d, expected %d", id, storedTs, ts)
+		}
+	}
+}
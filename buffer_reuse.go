@@ -0,0 +1,33 @@
+package gocql
+
+import "unsafe"
+
+// scanColumnAlias sets dest to a view of p if dest is a *string or *[]byte and
+// col is a text or blob column, see Iter.EnableBufferReuse. It reports whether
+// it did.
+func scanColumnAlias(p []byte, col ColumnInfo, dest interface{}) bool {
+	if _, ok := col.TypeInfo.(UnknownTypeInfo); ok {
+		return false
+	}
+	switch col.TypeInfo.Type() {
+	case TypeVarchar, TypeAscii, TypeBlob, TypeText:
+	default:
+		return false
+	}
+
+	switch v := dest.(type) {
+	case *string:
+		if len(p) == 0 {
+			*v = ""
+		} else {
+			*v = *(*string)(unsafe.Pointer(&p))
+		}
+		return true
+	case *[]byte:
+		// limit the capacity so that appending to the value does not
+		// overwrite the next values of the buffer
+		*v = p[:len(p):len(p)]
+		return true
+	}
+	return false
+}
@@ -0,0 +1,190 @@
+package gocql
+
+import (
+	"context"
+	"sort"
+	"sync"
+)
+
+const defaultBulkConcurrency = 16
+
+// BulkOptions configures Session.BulkInsert.
+type BulkOptions struct {
+	// Concurrency is the number of inserts or batches executed concurrently.
+	// Default: 16
+	Concurrency int
+
+	// BatchSize, if greater than 1, groups rows of the same partition into
+	// unlogged batches of up to BatchSize rows. Rows of different partitions are
+	// never batched together, so that every batch is sent to a replica of its
+	// partition. Otherwise every row is inserted on its own.
+	BatchSize int
+
+	// RetryPolicy is the retry policy of every insert or batch, the retry
+	// policy of the session is used if nil.
+	RetryPolicy RetryPolicy
+
+	// Idempotent marks the inserts as idempotent, see Query.Idempotent.
+	Idempotent bool
+}
+
+// BulkRowError is the error of a row which could not be inserted.
+type BulkRowError struct {
+	// Index is the index of the row in the rows passed to BulkInsert.
+	Index int
+	// Values are the values of the row.
+	Values []interface{}
+	Err    error
+}
+
+// BulkResult reports the outcome of Session.BulkInsert.
+type BulkResult struct {
+	// Succeeded is the number of rows inserted.
+	Succeeded int
+	// Failed is the number of rows which could not be inserted.
+	Failed int
+	// Errors holds the rows which could not be inserted, ordered by index.
+	Errors []BulkRowError
+}
+
+// BulkInsert executes stmt once for every row of rows, the values of a row are
+// bound to stmt. Inserts are executed concurrently, routed to a replica of
+// their partition when the session uses a token aware host selection policy,
+// and retried according to opts.RetryPolicy.
+//
+// A row failing does not stop the other rows from being inserted, the rows
+// which could not be inserted are reported in BulkResult.Errors. If ctx is
+// done before every row was attempted, the rows which were not attempted fail
+// with the context error, which is returned along with the result.
+//
+// Example:
+//
+//	res, err := session.BulkInsert(ctx, `INSERT INTO events (id, ts, payload) VALUES (?, ?, ?)`, rows,
+//		gocql.BulkOptions{Concurrency: 32, RetryPolicy: &gocql.SimpleRetryPolicy{NumRetries: 3}})
+//	if err != nil {
+//		return err
+//	}
+//	for _, failed := range res.Errors {
+//		log.Printf("row %d: %v", failed.Index, failed.Err)
+//	}
+func (s *Session) BulkInsert(ctx context.Context, stmt string, rows [][]interface{}, opts BulkOptions) (*BulkResult, error) {
+	if s.Closed() {
+		return nil, ErrSessionClosed
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultBulkConcurrency
+	}
+
+	var (
+		mu     sync.Mutex
+		result BulkResult
+	)
+	record := func(group []int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err == nil {
+			result.Succeeded += len(group)
+			return
+		}
+		result.Failed += len(group)
+		for _, i := range group {
+			result.Errors = append(result.Errors, BulkRowError{Index: i, Values: rows[i], Err: err})
+		}
+	}
+
+	groups := s.bulkGroups(ctx, stmt, rows, opts.BatchSize)
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(groups); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range work {
+				record(group, s.bulkExec(ctx, stmt, rows, group, opts))
+			}
+		}()
+	}
+
+	sent := 0
+feed:
+	for _, group := range groups {
+		if ctx.Err() != nil {
+			break
+		}
+		select {
+		case work <- group:
+			sent++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+
+	for _, group := range groups[sent:] {
+		record(group, ctx.Err())
+	}
+	sort.Slice(result.Errors, func(i, j int) bool {
+		return result.Errors[i].Index < result.Errors[j].Index
+	})
+	if sent < len(groups) {
+		return &result, ctx.Err()
+	}
+	return &result, nil
+}
+
+// bulkGroups returns the indexes of rows grouped by insert or batch.
+func (s *Session) bulkGroups(ctx context.Context, stmt string, rows [][]interface{}, batchSize int) [][]int {
+	groups := make([][]int, 0, len(rows))
+	if batchSize <= 1 {
+		for i := range rows {
+			groups = append(groups, []int{i})
+		}
+		return groups
+	}
+
+	// the index in groups of the batch being filled for each partition
+	partitions := make(map[string]int)
+	for i, row := range rows {
+		qry := s.Query(stmt, row...).WithContext(ctx)
+		key, err := qry.GetRoutingKey()
+		qry.Release()
+		if err != nil || key == nil {
+			// the row fails or can't be routed on its own
+			groups = append(groups, []int{i})
+			continue
+		}
+
+		if g, ok := partitions[string(key)]; ok && len(groups[g]) < batchSize {
+			groups[g] = append(groups[g], i)
+			continue
+		}
+		partitions[string(key)] = len(groups)
+		groups = append(groups, []int{i})
+	}
+	return groups
+}
+
+// bulkExec inserts the rows of group, in an unlogged batch if there are many.
+func (s *Session) bulkExec(ctx context.Context, stmt string, rows [][]interface{}, group []int, opts BulkOptions) error {
+	if len(group) == 1 {
+		qry := s.Query(stmt, rows[group[0]]...).WithContext(ctx).Idempotent(opts.Idempotent)
+		if opts.RetryPolicy != nil {
+			qry.RetryPolicy(opts.RetryPolicy)
+		}
+		err := qry.Exec()
+		qry.Release()
+		return err
+	}
+
+	batch := s.NewBatch(UnloggedBatch).WithContext(ctx)
+	for _, i := range group {
+		batch.Entries = append(batch.Entries, BatchEntry{Stmt: stmt, Args: rows[i], Idempotent: opts.Idempotent})
+	}
+	if opts.RetryPolicy != nil {
+		batch.RetryPolicy(opts.RetryPolicy)
+	}
+	return s.ExecuteBatch(batch)
+}
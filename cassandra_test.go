@@ -97,6 +97,40 @@ func TestInvalidKeyspace(t *testing.T) {
 	}
 }
 
+func TestVerifyKeyspaceOnConnect(t *testing.T) {
+	cluster := createCluster()
+	cluster.Keyspace = "invalidKeyspace"
+	cluster.VerifyKeyspaceOnConnect = true
+	session, err := cluster.CreateSession()
+	if err == nil {
+		session.Close()
+		t.Fatal("expected err, got nil.")
+	}
+
+	var notFound *ErrKeyspaceNotFound
+	if !errors.As(err, &notFound) {
+		t.Fatalf("expected ErrKeyspaceNotFound but got %v", err)
+	}
+	if !errors.Is(err, ErrKeyspaceDoesNotExist) {
+		t.Fatalf("expected %v to match ErrKeyspaceDoesNotExist", err)
+	}
+
+	found := false
+	for _, ks := range notFound.Available {
+		if ks == "system" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected system keyspace to be listed as available, got %v", notFound.Available)
+	}
+
+	session = createSession(t, func(cfg *ClusterConfig) {
+		cfg.VerifyKeyspaceOnConnect = true
+	})
+	session.Close()
+}
+
 func TestTracing(t *testing.T) {
 	session := createSession(t)
 	defer session.Close()
@@ -574,6 +608,119 @@ func TestMapScanCAS(t *testing.T) {
 
 }
 
+func TestExecCAS(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if session.cfg.ProtoVersion == 1 {
+		t.Skip("lightweight transactions not supported. Please use Cassandra >= 2.0")
+	}
+
+	if err := createTable(session, `CREATE TABLE gocql_test.cas_table3 (
+			title         varchar,
+			revid   	  timeuuid,
+			last_modified timestamp,
+			PRIMARY KEY (title, revid)
+		)`); err != nil {
+		t.Fatal("create:", err)
+	}
+
+	title, revid, modified := "baz", TimeUUID(), time.Now()
+	insert := `INSERT INTO cas_table3 (title, revid, last_modified) VALUES (?, ?, ?) IF NOT EXISTS`
+
+	if applied, err := session.Query(insert, title, revid, modified).ExecCAS(); err != nil {
+		t.Fatal("insert:", err)
+	} else if !applied {
+		t.Fatal("insert should have been applied")
+	}
+
+	// the previous row is returned and must be discarded
+	if applied, err := session.Query(insert, title, revid, modified).ExecCAS(); err != nil {
+		t.Fatal("insert:", err)
+	} else if applied {
+		t.Fatal("insert should not have been applied")
+	}
+
+	if applied, err := session.Query(`UPDATE cas_table3 SET last_modified = ? WHERE title = ? AND revid = ? IF last_modified = ?`,
+		time.Now(), title, revid, modified).ExecCAS(); err != nil {
+		t.Fatal("update:", err)
+	} else if !applied {
+		t.Fatal("update should have been applied")
+	}
+
+	// the connection must still be usable after discarding the result
+	var count int
+	if err := session.Query(`SELECT COUNT(*) FROM cas_table3`).Scan(&count); err != nil {
+		t.Fatal("select count:", err)
+	} else if count != 1 {
+		t.Fatalf("count: expected 1, got %d", count)
+	}
+}
+
+func TestWriteThenRead(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if err := createTable(session, `CREATE TABLE gocql_test.write_then_read (id int, value text, PRIMARY KEY (id))`); err != nil {
+		t.Fatal("create table:", err)
+	}
+
+	iter, err := session.WriteThenRead(context.Background(),
+		session.Query(`INSERT INTO write_then_read (id, value) VALUES (?, ?)`, 1, "a").Consistency(One),
+		session.Query(`SELECT value FROM write_then_read WHERE id = ?`, 1).Consistency(One))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value string
+	if !iter.Scan(&value) {
+		t.Fatal("expected the written row to be read")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if value != "a" {
+		t.Fatalf("expected value %q, got %q", "a", value)
+	}
+
+	_, err = session.WriteThenRead(context.Background(),
+		session.Query(`INSERT INTO write_then_read (id, value) VALUES (?, ?)`, 1, "a"),
+		session.Query(`SELECT value FROM write_then_read WHERE id = ?`, 2))
+	if err == nil {
+		t.Fatal("expected an error for queries targeting different partitions")
+	}
+}
+
+func TestQueryNowInSeconds(t *testing.T) {
+	session := createSession(t)
+	defer session.Close()
+
+	if session.cfg.ProtoVersion < protoVersion5 {
+		t.Skip("now in seconds requires protocol 5")
+	}
+
+	if err := createTable(session, `CREATE TABLE gocql_test.now_in_seconds (id int, value text, PRIMARY KEY (id))`); err != nil {
+		t.Fatal("create table:", err)
+	}
+	if err := session.Query(`INSERT INTO now_in_seconds (id, value) VALUES (?, ?) USING TTL 60`, 1, "a").Exec(); err != nil {
+		t.Fatal("insert:", err)
+	}
+
+	now := int(time.Now().Unix())
+	var value string
+	if err := session.Query(`SELECT value FROM now_in_seconds WHERE id = ?`, 1).NowInSeconds(now).Scan(&value); err != nil {
+		t.Fatal("select:", err)
+	}
+	if value != "a" {
+		t.Fatalf("expected value %q, got %q", "a", value)
+	}
+
+	// the TTL expired two minutes from now
+	err := session.Query(`SELECT value FROM now_in_seconds WHERE id = ?`, 1).NowInSeconds(now + 120).Scan(&value)
+	if err != ErrNotFound {
+		t.Fatalf("expected the row to be expired, got %v", err)
+	}
+}
+
 func TestBatch(t *testing.T) {
 	session := createSession(t)
 	defer session.Close()
@@ -7,6 +7,7 @@ package gocql
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"time"
 )
@@ -26,6 +27,23 @@ func (p PoolConfig) buildPool(session *Session) *policyConnPool {
 	return newPolicyConnPool(session)
 }
 
+// ProtoVersionRange is an inclusive range of native protocol versions.
+type ProtoVersionRange struct {
+	Min int
+	Max int
+}
+
+func (r ProtoVersionRange) isSet() bool {
+	return r.Min != 0 || r.Max != 0
+}
+
+func (r ProtoVersionRange) validate() error {
+	if r.Min < protoVersion1 || r.Max > protoVersion5 || r.Min > r.Max {
+		return fmt.Errorf("invalid protocol version range [%d, %d]", r.Min, r.Max)
+	}
+	return nil
+}
+
 // ClusterConfig is a struct to configure the default cluster implementation
 // of gocql. It has a variety of attributes that can be used to modify the
 // behavior to fit the most common use cases. Applications that require a
@@ -39,6 +57,13 @@ type ClusterConfig struct {
 	// the same host, and will not mark the node being down or up from events.
 	Hosts []string
 
+	// ControlConnectionSeedStrategy is the order in which Hosts are tried to
+	// discover the protocol version, if ProtoVersion is 0, and to open the
+	// control connection. All of them are tried before failing with a
+	// *ControlConnError holding the error of each host.
+	// Default: SeedStrategyRandom
+	ControlConnectionSeedStrategy ControlConnectionSeedStrategy
+
 	// CQL version (default: 3.0.0)
 	CQLVersion string
 
@@ -51,6 +76,14 @@ type ClusterConfig struct {
 	// versions the protocol selected is not defined (ie, it can be any of the supported in the cluster)
 	ProtoVersion int
 
+	// ProtoVersionRange limits the protocol versions tried when ProtoVersion is 0.
+	// The driver starts negotiating at Max and steps down towards Min whenever a
+	// node rejects the version, failing only if no version in the range is accepted.
+	// The negotiated version is available from Session.ProtocolVersion.
+	//
+	// Default: unset, which tries versions 4 down to 1.
+	ProtoVersionRange ProtoVersionRange
+
 	// Timeout limits the time spent on the client side while executing a query.
 	// Specifically, query or batch execution will return an error if the client does not receive a response
 	// from the server within the Timeout period.
@@ -82,10 +115,69 @@ type ClusterConfig struct {
 	// Initial keyspace. Optional.
 	Keyspace string
 
+	// VerifyKeyspaceOnConnect makes session creation fail with ErrKeyspaceNotFound
+	// when Keyspace is set but does not exist in the cluster's schema. This needs
+	// an extra schema query on connect and is ignored when Keyspace is empty.
+	// Default: false
+	VerifyKeyspaceOnConnect bool
+
 	// Number of connections per host.
 	// Default: 2
 	NumConns int
 
+	// MaxSpilloverConns is the number of extra connections per host that may be
+	// opened when every connection to the host is running low on stream IDs, so
+	// that new queries spill over to a fresh connection instead of failing with
+	// ErrNoStreams. Spillover connections are not replaced once they are closed,
+	// and are closed once idle for SpilloverIdleTimeout.
+	// Default: 0 (disabled)
+	MaxSpilloverConns int
+
+	// SpilloverIdleTimeout is the time after which a spillover connection
+	// which executed no queries is closed, see MaxSpilloverConns.
+	// Default: 1 minute
+	SpilloverIdleTimeout time.Duration
+
+	// ConnectionPools are named pools of connections opened to every host on top
+	// of the NumConns connections of the default pool, mapped to their number of
+	// connections per host. Queries and batches run on a named pool with
+	// WithConnectionPool, so that heavy traffic such as bulk loads or scans does
+	// not starve the connections used by interactive queries.
+	// Default: nil
+	ConnectionPools map[string]int
+
+	// MaxFrameSize is the maximum size in bytes of the body of a frame received
+	// from a host. A connection receiving a larger frame is closed and its
+	// requests fail with ErrFrameTooBig, before the body is read or any
+	// buffer is allocated for it. It can not exceed 256 MiB, the maximum frame
+	// size of the protocol, which is also used if it is not set.
+	// Default: 256 MiB
+	MaxFrameSize int
+
+	// UnknownTypePolicy is how values of columns of CQL types unknown to gocql,
+	// such as types added by a newer server or custom types, are handled.
+	// UnknownTypeError fails to scan them, UnknownTypeRawBytes scans them as
+	// []byte, the type ID and class name of custom types are kept in the
+	// UnknownTypeInfo of the column.
+	// Default: UnknownTypeError
+	UnknownTypePolicy UnknownTypePolicy
+
+	// SchemaRefreshPolicy is how the keyspace metadata cached by the session,
+	// see Session.KeyspaceMetadata, is refreshed on schema change events. With
+	// SchemaRefreshIncremental only the changed table, user type or keyspace
+	// options are read again, falling back to reading the whole keyspace if
+	// that fails. SchemaRefreshFull always reads the whole keyspace.
+	// Default: SchemaRefreshIncremental
+	SchemaRefreshPolicy SchemaRefreshPolicy
+
+	// MaxQueueTimePerConn is how long a request may wait for its turn to be
+	// written to a saturated connection. If the write does not start in time
+	// the request fails with ErrConnectionBusy, so that callers can shed load
+	// instead of piling up goroutines. Like ErrNoStreams, ErrConnectionBusy is
+	// passed to the retry policy, which may try another host.
+	// Default: 0 (wait until the query context is done)
+	MaxQueueTimePerConn time.Duration
+
 	// Default consistency level.
 	// Default: Quorum
 	Consistency Consistency
@@ -116,14 +208,86 @@ type ClusterConfig struct {
 	// SocketKeepalive is used to set up the default dialer and is ignored if Dialer or HostDialer is provided.
 	SocketKeepalive time.Duration
 
+	// DisableTCPNoDelay enables Nagle's algorithm on connections, trading latency for
+	// fewer packets. By default TCP_NODELAY is set, as is the default in Go.
+	// DisableTCPNoDelay is ignored if Dialer or HostDialer is provided.
+	DisableTCPNoDelay bool
+
+	// TCPUserTimeout sets TCP_USER_TIMEOUT on connections if > 0 (default: 0), the
+	// maximum time transmitted data may remain unacknowledged before the connection
+	// is closed. It detects dead connections, e.g. dropped by a stateful firewall,
+	// much faster than keepalives alone. Only supported on Linux, ignored elsewhere.
+	// TCPUserTimeout is ignored if Dialer or HostDialer is provided.
+	TCPUserTimeout time.Duration
+
 	// Maximum cache size for prepared statements globally for gocql.
 	// Default: 1000
 	MaxPreparedStmts int
 
+	// PreparedCache, if set, stores the statements prepared by the session in
+	// addition to its own cache of MaxPreparedStmts statements. Sharing a
+	// PreparedCache, eg. one returned by NewPreparedCache, between sessions
+	// connected to the same cluster avoids preparing the same statements in
+	// every session. Statements are cached per host, hosts which are not
+	// discovered from the cluster (see DisableInitialHostLookup) get a random
+	// id in every session and don't benefit from sharing.
+	PreparedCache PreparedCache
+
+	// DisablePreparedStatementNormalization makes the prepared statement cache
+	// use the exact text of statements as keys. By default statements which only
+	// differ by whitespace, comments or the case of keywords and unquoted
+	// identifiers share the same prepared statement. The statement sent to the
+	// server is never modified.
+	// Default: false
+	DisablePreparedStatementNormalization bool
+
+	// PrepareOnAllHosts makes the session prepare a statement on every host in
+	// the background once it was prepared on the first one, instead of
+	// preparing it on each host the first time it is executed there.
+	// Default: false
+	PrepareOnAllHosts bool
+
+	// PrepareOnAllHostsConcurrency is the maximum number of PREPARE requests
+	// sent concurrently because of PrepareOnAllHosts, so that deploying many
+	// new statements does not flood the cluster. Session.PreparesSent returns
+	// the number of PREPARE requests sent.
+	// Default: 4
+	PrepareOnAllHostsConcurrency int
+
+	// AutoPrepareThreshold is the number of times a statement without bound values
+	// has to be executed before it is prepared, so that one-shot statements do not
+	// pollute the prepared statement cache. Statements with bound values are always
+	// prepared, and Query.Prepared overrides this per query.
+	// Default: 0 (statements are prepared on first execution)
+	AutoPrepareThreshold int
+
+	// MaxConcurrentQueries limits the number of queries and batches executing
+	// concurrently in the session if > 0 (default: 0). Further queries wait to be
+	// admitted in order of Query.Priority.
+	MaxConcurrentQueries int
+
+	// QueryPriorityAging raises the priority of a query waiting to be admitted by
+	// one for every QueryPriorityAging it waited, so that low priority queries
+	// are not starved when MaxConcurrentQueries is reached. Zero disables aging.
+	// Default: 100 milliseconds
+	QueryPriorityAging time.Duration
+
+	// ConnEventLogSize is the number of recent connection lifecycle events kept
+	// in memory and returned by Session.RecentConnectionEvents. Zero disables it.
+	// Default: 128
+	ConnEventLogSize int
+
 	// Maximum cache size for query info about statements for each session.
 	// Default: 1000
 	MaxRoutingKeyInfo int
 
+	// TimestampPrecision controls how the sub-millisecond part of time.Time values
+	// bound to timestamp columns is handled, as CQL timestamps only have millisecond
+	// precision. It can be overridden per query and batch. Values read from timestamp
+	// columns are exact and not affected.
+	// Default: TimestampTruncate
+	TimestampPrecision TimestampPrecision
+
 	// Default page size to use for created sessions.
 	// Default: 5000
 	PageSize int
@@ -147,17 +311,80 @@ type ClusterConfig struct {
 	// If not zero, gocql attempt to reconnect known DOWN nodes in every ReconnectInterval.
 	ReconnectInterval time.Duration
 
+	// DisableHostLocationUpdates keeps the datacenter and rack a host was first
+	// seen in. Otherwise when a ring refresh finds that a known host reports
+	// another datacenter or rack, the host is moved there in the host selection
+	// policy and the token ring.
+	// Default: false
+	DisableHostLocationUpdates bool
+
+	// MetadataRefreshDebounce, if not zero, coalesces the rebuilds of the token
+	// ring and of the replicas of the keyspaces caused by hosts being added or
+	// removed, for example by the bursts of events of a rolling restart. The
+	// token ring is rebuilt once no host was added or removed for
+	// MetadataRefreshDebounce, and at the latest 10 times
+	// MetadataRefreshDebounce after the first change, until then queries are
+	// routed with the previous token ring. See Session.MetadataRefreshStats.
+	// Default: 0 (the token ring is rebuilt on every change)
+	MetadataRefreshDebounce time.Duration
+
+	// ReconnectionStaggerMax, if not zero, delays reconnecting to a host which
+	// is reported up, or to a down host every ReconnectInterval, by a random
+	// duration up to ReconnectionStaggerMax times the share of known hosts which
+	// are down. After a correlated outage, such as a whole datacenter going down
+	// and coming back, reconnections are then spread over ReconnectionStaggerMax
+	// rather than all made at once, while a single host coming back is
+	// reconnected to almost immediately.
+	// Default: 0 (disabled)
+	ReconnectionStaggerMax time.Duration
+
+	// If not zero, gocql re-resolves the hostnames in Hosts every DNSRefreshInterval.
+	// The resolved addresses replace the contact points used to reconnect the
+	// control connection. When hosts are not discovered from the cluster
+	// (DisableInitialHostLookup) hosts for new addresses are added and hosts for
+	// addresses that are gone are removed, otherwise the hosts are refreshed from
+	// the cluster when the addresses changed.
+	// Default: 0 (disabled)
+	DNSRefreshInterval time.Duration
+
+	// HeartbeatInterval is how long a connection may go without receiving a
+	// response before an OPTIONS request is sent to check that it is alive.
+	// Default: 5s
+	HeartbeatInterval time.Duration
+
+	// If not zero, a connection is closed as soon as a heartbeat gets no response
+	// within HeartbeatTimeout, and the pool reconnects. This detects half-open
+	// connections, eg. behind a load balancer which failed over, without waiting
+	// for queries to time out. Otherwise a connection is closed after several
+	// heartbeats failed, each waiting up to Timeout.
+	// Default: 0 (disabled)
+	HeartbeatTimeout time.Duration
+
 	// The maximum amount of time to wait for schema agreement in a cluster after
 	// receiving a schema change frame. (default: 60s)
 	MaxWaitSchemaAgreement time.Duration
 
+	// If not zero, CreateSession waits up to MaxSchemaAgreementWait for all
+	// nodes to report the same schema version before the session is returned,
+	// unlike MaxWaitSchemaAgreement which applies after schema changes. This
+	// requires the control connection.
+	// Default: 0 (don't wait)
+	MaxSchemaAgreementWait time.Duration
+
+	// If RequireSchemaAgreement is true CreateSession fails if the schema
+	// versions don't agree within MaxSchemaAgreementWait, otherwise the
+	// disagreement is logged and the session is returned.
+	RequireSchemaAgreement bool
+
 	// HostFilter will filter all incoming events for host, any which don't pass
 	// the filter will be ignored. If set will take precedence over any options set
 	// via Discovery
 	HostFilter HostFilter
 
 	// AddressTranslator will translate addresses found on peer discovery and/or
-	// node change events.
+	// node change events. It may implement HostAddressTranslator to translate
+	// the addresses depending on the datacenter, rack or ID of the host, and to
+	// return several addresses tried in order.
 	AddressTranslator AddressTranslator
 
 	// If IgnorePeerAddr is true and the address in system.peers does not match
@@ -194,6 +421,19 @@ type ClusterConfig struct {
 	// See https://issues.apache.org/jira/browse/CASSANDRA-10786
 	DisableSkipMetadata bool
 
+	// WarnOnFullTableAggregate logs a warning before executing a SELECT of an
+	// aggregate function (COUNT, SUM, AVG, MIN, MAX) which has no WHERE clause
+	// or uses ALLOW FILTERING, as these scan the whole table and commonly time
+	// out on large tables.
+	// Default: false
+	WarnOnFullTableAggregate bool
+
+	// TrackInFlightQueries tracks the queries and batches being executed by the
+	// session, see Session.InFlightQueries and Session.CancelAll. Tracking adds
+	// a context and a registration to every execution.
+	// Default: false
+	TrackInFlightQueries bool
+
 	// QueryObserver will set the provided query observer on all queries created from this session.
 	// Use it to collect metrics / stats from queries by providing an implementation of QueryObserver.
 	QueryObserver QueryObserver
@@ -210,13 +450,48 @@ type ClusterConfig struct {
 	// Use it to collect metrics / stats from frames by providing an implementation of FrameHeaderObserver.
 	FrameHeaderObserver FrameHeaderObserver
 
+	// FrameObserver will be notified of the raw bytes of every frame sent and received
+	// on connections created from this session. It is intended for protocol debugging only.
+	//
+	// Default: nil (disabled)
+	FrameObserver FrameObserver
+
 	// StreamObserver will be notified of stream state changes.
 	// This can be used to track in-flight protocol requests and responses.
 	StreamObserver StreamObserver
 
+	// PoolObserver will be notified when the connection pool of a host becomes
+	// saturated, that is every connection has all of its streams in flight, and
+	// when it stops being saturated.
+	//
+	// Default: nil (disabled)
+	PoolObserver PoolObserver
+
+	// PoolSaturationDebounce is how long a pool must stay saturated, or
+	// unsaturated, before PoolObserver is notified of the change, so that a pool
+	// hovering around saturation does not flood the observer.
+	// Default: 1s
+	PoolSaturationDebounce time.Duration
+
+	// PrepareObserver will be notified of every PREPARE request sent by the
+	// session, including the re-preparations after a host reported a statement
+	// as unprepared.
+	//
+	// Default: nil (disabled)
+	PrepareObserver PrepareObserver
+
 	// Default idempotence for queries
 	DefaultIdempotence bool
 
+	// BaseContext, if set, is called once when the session is created and
+	// returns the context of the queries and batches which are not given one
+	// with WithContext. The context is canceled when the session is closed, so
+	// that in flight queries are aborted and no query outlives the session.
+	// Canceling the returned context aborts the queries without a context.
+	// BaseContext must return a non-nil context.
+	// Default: nil, queries without a context are not canceled
+	BaseContext func() context.Context
+
 	// The time to wait for frames before flushing the frames connection to Cassandra.
 	// Can help reduce syscall overhead by making less calls to write. Set to 0 to
 	// disable.
@@ -237,6 +512,17 @@ type ClusterConfig struct {
 	// If not specified, defaults to the global gocql.Logger.
 	Logger StdLogger
 
+	// StructuredLogger receives the messages of the driver with their level
+	// and fields instead of Logger, if set. Use NewStdStructuredLogger to log
+	// them to a StdLogger. The text of the messages logged to Logger does not
+	// change when StructuredLogger is not set.
+	StructuredLogger StructuredLogger
+
+	// LogLevel is the minimum level of the messages logged, those below it are
+	// dropped before being formatted. Defaults to LogLevelDebug, logging every
+	// message.
+	LogLevel LogLevel
+
 	// internal config for testing
 	disableControlConn bool
 }
@@ -262,6 +548,8 @@ func NewCluster(hosts ...string) *ClusterConfig {
 		ConnectTimeout:         11 * time.Second,
 		Port:                   9042,
 		NumConns:               2,
+		SpilloverIdleTimeout:   time.Minute,
+		MaxFrameSize:           maxFrameSize,
 		Consistency:            Quorum,
 		MaxPreparedStmts:       defaultMaxPreparedStmts,
 		MaxRoutingKeyInfo:      1000,
@@ -269,18 +557,30 @@ func NewCluster(hosts ...string) *ClusterConfig {
 		DefaultTimestamp:       true,
 		MaxWaitSchemaAgreement: 60 * time.Second,
 		ReconnectInterval:      60 * time.Second,
+		QueryPriorityAging:     100 * time.Millisecond,
+		ConnEventLogSize:       128,
 		ConvictionPolicy:       &SimpleConvictionPolicy{},
 		ReconnectionPolicy:     &ConstantReconnectionPolicy{MaxRetries: 3, Interval: 1 * time.Second},
 		WriteCoalesceWaitTime:  200 * time.Microsecond,
+		PoolSaturationDebounce: time.Second,
 	}
 	return cfg
 }
 
 func (cfg *ClusterConfig) logger() StdLogger {
-	if cfg.Logger == nil {
-		return Logger
+	var logger StdLogger
+	switch {
+	case cfg.StructuredLogger != nil:
+		logger = structuredStdLogger{cfg.StructuredLogger}
+	case cfg.Logger == nil:
+		logger = Logger
+	default:
+		logger = cfg.Logger
 	}
-	return cfg.Logger
+	if cfg.LogLevel > LogLevelDebug {
+		return leveledLogger{StdLogger: logger, level: cfg.LogLevel}
+	}
+	return logger
 }
 
 // CreateSession initializes the cluster based on this config and returns a
@@ -299,11 +599,41 @@ func (cfg *ClusterConfig) translateAddressPort(addr net.IP, port int) (net.IP, i
 	}
 	newAddr, newPort := cfg.AddressTranslator.Translate(addr, port)
 	if gocqlDebug {
-		cfg.logger().Printf("gocql: translating address '%v:%d' to '%v:%d'", addr, port, newAddr, newPort)
+		logf(cfg.logger(), LogLevelDebug, "gocql: translating address '%v:%d' to '%v:%d'", addr, port, newAddr, newPort)
 	}
 	return newAddr, newPort
 }
 
+// translateHost translates the connect address and port of host, which must not
+// be shared yet, with the AddressTranslator if defined, see
+// HostAddressTranslator.
+func (cfg *ClusterConfig) translateHost(host *HostInfo) {
+	tr, ok := cfg.AddressTranslator.(HostAddressTranslator)
+	if !ok {
+		host.connectAddress, host.port = cfg.translateAddressPort(host.ConnectAddress(), host.port)
+		return
+	}
+
+	var addrs []*net.TCPAddr
+	for _, addr := range tr.TranslateHost(host) {
+		ip, port, ok := splitTCPAddr(addr)
+		if !ok {
+			logf(cfg.logger(), LogLevelWarn, "gocql: ignoring translated address %v of host %s, it is not a TCP address", addr, host.HostID())
+			continue
+		}
+		addrs = append(addrs, &net.TCPAddr{IP: ip, Port: port})
+	}
+	if len(addrs) == 0 {
+		return
+	}
+	if gocqlDebug {
+		logf(cfg.logger(), LogLevelDebug, "gocql: translating address '%v:%d' of host %s to %v", host.connectAddress, host.port, host.HostID(), addrs)
+	}
+	host.connectAddress = addrs[0].IP
+	host.port = addrs[0].Port
+	host.connectAddresses = addrs
+}
+
 func (cfg *ClusterConfig) filterHost(host *HostInfo) bool {
 	return !(cfg.HostFilter == nil || cfg.HostFilter.Accept(host))
 }
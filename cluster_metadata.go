@@ -3,6 +3,7 @@ package gocql
 import (
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 // ClusterMetadata holds metadata about cluster topology.
@@ -27,6 +28,19 @@ func (m *ClusterMetadata) TokenRing() *TokenRing {
 	return m.tokenRing
 }
 
+// TokensPerHost returns the number of tokens owned by each host in the token
+// ring, by host ID. It returns nil if the token ring is not available.
+func (m *ClusterMetadata) TokensPerHost() map[string]int {
+	if m == nil || m.tokenRing == nil {
+		return nil
+	}
+	tokensPerHost := make(map[string]int, len(m.tokenRing.tokensPerHost))
+	for hostID, n := range m.tokenRing.tokensPerHost {
+		tokensPerHost[hostID] = n
+	}
+	return tokensPerHost
+}
+
 // resetTokenRing creates a new TokenRing.
 // It must be called with t.mu locked.
 func (m *ClusterMetadata) resetTokenRing(partitioner string, hosts []*HostInfo, logger StdLogger) {
@@ -38,7 +52,8 @@ func (m *ClusterMetadata) resetTokenRing(partitioner string, hosts []*HostInfo,
 	// create a new Token ring
 	tokenRing, err := newTokenRing(partitioner, hosts)
 	if err != nil {
-		logger.Printf("Unable to update the token ring due to error: %s", err)
+		logEvent(logger, LogLevelError, "unable to update the token ring", []LogField{{"error", err}},
+			"Unable to update the token ring due to error: %s", err)
 		return
 	}
 
@@ -57,10 +72,56 @@ type clusterMetadataManager struct {
 	hosts       cowHostList
 	partitioner string
 	metadata    atomic.Value // *ClusterMetadata
+	// routingKeyspaces are the keyspaces other than the session keyspace which
+	// queries were routed to, see Query.WithRoutingKeyspace. Their replicas are
+	// kept up to date along with the session keyspace's. It is protected by mu
+	// and holds at most maxRoutingKeyspaces keyspaces.
+	routingKeyspaces map[string]struct{}
+	// numRoutingKeyspaces is len(routingKeyspaces), accessed atomically.
+	numRoutingKeyspaces int32
+	// addingKeyspaces are the routing keyspaces whose replicas are being computed.
+	addingKeyspaces sync.Map // map[string]struct{}
+	// failedKeyspaces are the routing keyspaces whose metadata could not be
+	// read, mapped to the time until which it is not read again.
+	failedKeyspaces sync.Map // map[string]time.Time
+
+	// refreshDebounce is ClusterConfig.MetadataRefreshDebounce. refreshTimer
+	// rebuilds the token ring once it elapsed, it is nil unless a rebuild is
+	// pending since refreshPendingSince. No rebuild is scheduled once stopped.
+	refreshDebounce     time.Duration
+	refreshTimer        *time.Timer
+	refreshPendingSince time.Time
+	stopped             bool
+	refreshesApplied    uint64
+	refreshesCoalesced  uint64
 
 	logger StdLogger
 }
 
+// MetadataRefreshStats are the number of rebuilds of the token ring, see
+// ClusterConfig.MetadataRefreshDebounce.
+type MetadataRefreshStats struct {
+	// Applied is the number of times the token ring was rebuilt.
+	Applied uint64
+	// Coalesced is the number of changes of the hosts which did not cause a
+	// rebuild of their own because a rebuild was already pending.
+	Coalesced uint64
+}
+
+// maxRoutingKeyspaces is the number of routing keyspaces whose replicas are
+// kept up to date, queries routed to further keyspaces are sent to the primary
+// replica of their routing key.
+const maxRoutingKeyspaces = 64
+
+// routingKeyspaceRetryDelay is the time after which the metadata of a routing
+// keyspace which could not be read, for example because it does not exist, is
+// read again by the next query routed to it.
+const routingKeyspaceRetryDelay = 30 * time.Second
+
+// maxMetadataRefreshDelay is the number of MetadataRefreshDebounce a pending
+// rebuild of the token ring can be postponed by further changes.
+const maxMetadataRefreshDelay = 10
+
 func (m *clusterMetadataManager) init(s *Session) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -71,6 +132,7 @@ func (m *clusterMetadataManager) init(s *Session) {
 	}
 	m.getKeyspaceMetadata = s.KeyspaceMetadata
 	m.getKeyspaceName = func() string { return s.cfg.Keyspace }
+	m.refreshDebounce = s.cfg.MetadataRefreshDebounce
 	m.logger = s.logger
 }
 
@@ -88,10 +150,7 @@ func (m *clusterMetadataManager) setPartitioner(partitioner string) {
 
 	if m.partitioner != partitioner {
 		m.partitioner = partitioner
-		meta := m.getMetadataForUpdate()
-		meta.resetTokenRing(m.partitioner, m.hosts.get(), m.logger)
-		m.updateReplicas(meta, m.getKeyspaceName())
-		m.metadata.Store(meta)
+		m.rebuildTokenRing()
 	}
 }
 
@@ -100,10 +159,7 @@ func (m *clusterMetadataManager) addHost(host *HostInfo) {
 	defer m.mu.Unlock()
 
 	if m.hosts.add(host) {
-		meta := m.getMetadataForUpdate()
-		meta.resetTokenRing(m.partitioner, m.hosts.get(), m.logger)
-		m.updateReplicas(meta, m.getKeyspaceName())
-		m.metadata.Store(meta)
+		m.refreshTokenRing()
 	}
 }
 
@@ -115,21 +171,87 @@ func (m *clusterMetadataManager) addHosts(hosts []*HostInfo) {
 		m.hosts.add(host)
 	}
 
+	m.rebuildTokenRing()
+}
+
+func (m *clusterMetadataManager) removeHost(host *HostInfo) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.hosts.remove(host.ConnectAddress()) {
+		m.refreshTokenRing()
+	}
+}
+
+// refreshTokenRing rebuilds the token ring after a host was added or removed,
+// or schedules the rebuild if ClusterConfig.MetadataRefreshDebounce is set.
+// It must be called with t.mu mutex locked.
+func (m *clusterMetadataManager) refreshTokenRing() {
+	if m.refreshDebounce <= 0 || m.stopped {
+		m.rebuildTokenRing()
+		return
+	}
+
+	now := time.Now()
+	if m.refreshTimer == nil {
+		m.refreshPendingSince = now
+		m.refreshTimer = time.AfterFunc(m.refreshDebounce, m.debouncedRefresh)
+		return
+	}
+	atomic.AddUint64(&m.refreshesCoalesced, 1)
+	if now.Sub(m.refreshPendingSince) < maxMetadataRefreshDelay*m.refreshDebounce {
+		m.refreshTimer.Reset(m.refreshDebounce)
+	}
+}
+
+// stop cancels the pending rebuild of the token ring, if any, and keeps further
+// rebuilds from being scheduled.
+func (m *clusterMetadataManager) stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stopped = true
+	if m.refreshTimer != nil {
+		m.refreshTimer.Stop()
+		m.refreshTimer = nil
+	}
+}
+
+func (m *clusterMetadataManager) debouncedRefresh() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.refreshTimer != nil {
+		m.rebuildTokenRing()
+	}
+}
+
+// rebuildTokenRing rebuilds the token ring and the replicas, including the
+// changes of a pending rebuild.
+// It must be called with t.mu mutex locked.
+func (m *clusterMetadataManager) rebuildTokenRing() {
+	if m.refreshTimer != nil {
+		m.refreshTimer.Stop()
+		m.refreshTimer = nil
+	}
+	atomic.AddUint64(&m.refreshesApplied, 1)
+
 	meta := m.getMetadataForUpdate()
 	meta.resetTokenRing(m.partitioner, m.hosts.get(), m.logger)
-	m.updateReplicas(meta, m.getKeyspaceName())
+	m.updateRoutingReplicas(meta)
 	m.metadata.Store(meta)
 }
 
-func (m *clusterMetadataManager) removeHost(host *HostInfo) {
+// rebuild rebuilds the token ring and the replicas immediately, see
+// Session.RefreshMetadata.
+func (m *clusterMetadataManager) rebuild() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	m.rebuildTokenRing()
+}
 
-	if m.hosts.remove(host.ConnectAddress()) {
-		meta := m.getMetadataForUpdate()
-		meta.resetTokenRing(m.partitioner, m.hosts.get(), m.logger)
-		m.updateReplicas(meta, m.getKeyspaceName())
-		m.metadata.Store(meta)
+func (m *clusterMetadataManager) refreshStats() MetadataRefreshStats {
+	return MetadataRefreshStats{
+		Applied:   atomic.LoadUint64(&m.refreshesApplied),
+		Coalesced: atomic.LoadUint64(&m.refreshesCoalesced),
 	}
 }
 
@@ -154,10 +276,85 @@ func (m *clusterMetadataManager) getMetadataForUpdate() *ClusterMetadata {
 	return meta
 }
 
-// updateReplicas updates replicas in ClusterMetadata.
+// addRoutingKeyspace computes the replicas of keyspace in the background if it
+// is not the session keyspace, and keeps them up to date afterwards. It is
+// cheap to call when routing every query. The keyspace is only kept once its
+// replicas were computed, a failed lookup of its metadata is retried by the
+// first query routed to it after routingKeyspaceRetryDelay.
+func (m *clusterMetadataManager) addRoutingKeyspace(keyspace string) {
+	if keyspace == "" || keyspace == m.getKeyspaceName() {
+		return
+	}
+	if atomic.LoadInt32(&m.numRoutingKeyspaces) >= maxRoutingKeyspaces {
+		return
+	}
+	if until, ok := m.failedKeyspaces.Load(keyspace); ok && time.Now().Before(until.(time.Time)) {
+		return
+	}
+	if _, loaded := m.addingKeyspaces.LoadOrStore(keyspace, struct{}{}); loaded {
+		return
+	}
+
+	go func() {
+		defer m.addingKeyspaces.Delete(keyspace)
+
+		// read the metadata before locking, so that a keyspace which does not
+		// exist does not block the updates of the token ring
+		if _, err := m.getKeyspaceMetadata(keyspace); err != nil {
+			m.keyspaceFailed(keyspace)
+			return
+		}
+		m.failedKeyspaces.Delete(keyspace)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		_, ok := m.routingKeyspaces[keyspace]
+		if !ok && len(m.routingKeyspaces) >= maxRoutingKeyspaces {
+			return
+		}
+		meta := m.getMetadataForUpdate()
+		if !m.updateReplicas(meta, keyspace) {
+			return
+		}
+		m.metadata.Store(meta)
+		if m.routingKeyspaces == nil {
+			m.routingKeyspaces = make(map[string]struct{})
+		}
+		m.routingKeyspaces[keyspace] = struct{}{}
+		atomic.StoreInt32(&m.numRoutingKeyspaces, int32(len(m.routingKeyspaces)))
+	}()
+}
+
+// keyspaceFailed keeps keyspace from being looked up again for
+// routingKeyspaceRetryDelay, and forgets the other keyspaces whose delay
+// elapsed.
+func (m *clusterMetadataManager) keyspaceFailed(keyspace string) {
+	now := time.Now()
+	m.failedKeyspaces.Range(func(key, until interface{}) bool {
+		if now.After(until.(time.Time)) {
+			m.failedKeyspaces.Delete(key)
+		}
+		return true
+	})
+	m.failedKeyspaces.Store(keyspace, now.Add(routingKeyspaceRetryDelay))
+}
+
+// updateRoutingReplicas updates the replicas of the session keyspace and of
+// the routing keyspaces in ClusterMetadata, after the token ring changed.
+// It must be called with t.mu mutex locked.
+func (m *clusterMetadataManager) updateRoutingReplicas(meta *ClusterMetadata) {
+	m.updateReplicas(meta, m.getKeyspaceName())
+	for keyspace := range m.routingKeyspaces {
+		m.updateReplicas(meta, keyspace)
+	}
+}
+
+// updateReplicas updates replicas in ClusterMetadata, it returns whether the
+// replicas of keyspace could be computed.
 // It must be called with t.mu mutex locked.
 // meta must not be nil and it's replicas field will be updated.
-func (m *clusterMetadataManager) updateReplicas(meta *ClusterMetadata, keyspace string) {
+func (m *clusterMetadataManager) updateReplicas(meta *ClusterMetadata, keyspace string) bool {
 	newReplicas := make(map[string]tokenRingReplicas, len(meta.replicas))
 
 	ks, err := m.getKeyspaceMetadata(keyspace)
@@ -169,6 +366,7 @@ func (m *clusterMetadataManager) updateReplicas(meta *ClusterMetadata, keyspace
 			}
 		}
 	}
+	_, computed := newReplicas[keyspace]
 
 	for ks, replicas := range meta.replicas {
 		if ks != keyspace {
@@ -177,4 +375,5 @@ func (m *clusterMetadataManager) updateReplicas(meta *ClusterMetadata, keyspace
 	}
 
 	meta.replicas = newReplicas
+	return computed
 }
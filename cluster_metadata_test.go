@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"strconv"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 // Tests of the token-aware host selection policy implementation with a
@@ -54,6 +57,237 @@ func TestClusterMetadataManager_SimpleStrategy(t *testing.T) {
 	}, mngr.getMetadataReadOnly().replicas)
 }
 
+func TestClusterMetadataTokensPerHost(t *testing.T) {
+	var mngr clusterMetadataManager
+	mngr.getKeyspaceName = func() string { return "myKeyspace" }
+	mngr.getKeyspaceMetadata = func(ks string) (*KeyspaceMetadata, error) {
+		return nil, errors.New("not initialized")
+	}
+
+	if tokensPerHost := mngr.getMetadataReadOnly().TokensPerHost(); tokensPerHost != nil {
+		t.Fatalf("expected no tokens without a token ring, got %v", tokensPerHost)
+	}
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00", "30", "60"}},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"10"}},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	mngr.addHosts(hosts)
+	mngr.setPartitioner("OrderedPartitioner")
+
+	for i, expected := range []int{3, 1, 0} {
+		if n := hosts[i].NumTokens(); n != expected {
+			t.Errorf("expected host %d to own %d tokens, got %d", i, expected, n)
+		}
+	}
+
+	meta := mngr.getMetadataReadOnly()
+	tokensPerHost := meta.TokensPerHost()
+	assertDeepEqual(t, "tokens per host", map[string]int{"0": 3, "1": 1}, tokensPerHost)
+
+	// the result is a copy
+	tokensPerHost["0"] = 42
+	assertDeepEqual(t, "tokens per host", map[string]int{"0": 3, "1": 1}, meta.TokensPerHost())
+}
+
+func TestClusterMetadataManager_RoutingKeyspace(t *testing.T) {
+	const otherKeyspace = "other"
+	var (
+		mngr    clusterMetadataManager
+		lookups int32
+	)
+	mngr.getKeyspaceName = func() string { return "myKeyspace" }
+	mngr.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		if keyspaceName != otherKeyspace {
+			return nil, fmt.Errorf("unknown keyspace: %s", keyspaceName)
+		}
+		if atomic.AddInt32(&lookups, 1) == 1 {
+			return nil, errors.New("schema not available yet")
+		}
+		return &KeyspaceMetadata{
+			Name:          otherKeyspace,
+			StrategyClass: "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{
+				"class":              "SimpleStrategy",
+				"replication_factor": 1,
+			},
+		}, nil
+	}
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"50"}},
+	}
+	mngr.addHosts(hosts)
+	mngr.setPartitioner("OrderedPartitioner")
+
+	// the first lookup fails, the keyspace is not looked up again by the
+	// queries routed to it until routingKeyspaceRetryDelay elapsed
+	mngr.addRoutingKeyspace(otherKeyspace)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := mngr.failedKeyspaces.Load(otherKeyspace); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the lookup of the routing keyspace to fail")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		mngr.addRoutingKeyspace(otherKeyspace)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if n := atomic.LoadInt32(&lookups); n != 1 {
+		t.Fatalf("expected the failed lookup not to be retried yet, got %d lookups", n)
+	}
+
+	// then by the next query routed to it
+	mngr.failedKeyspaces.Store(otherKeyspace, time.Now())
+	for {
+		if _, ok := mngr.getMetadataReadOnly().replicas[otherKeyspace]; ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the replicas of the routing keyspace")
+		}
+		mngr.addRoutingKeyspace(otherKeyspace)
+		time.Sleep(time.Millisecond)
+	}
+	if _, ok := mngr.failedKeyspaces.Load(otherKeyspace); ok {
+		t.Fatal("expected the keyspace to be forgotten once its lookup succeeded")
+	}
+	assertDeepEqual(t, "replicas", tokenRingReplicas{
+		{orderedToken("00"), []*HostInfo{hosts[0]}},
+		{orderedToken("50"), []*HostInfo{hosts[1]}},
+	}, mngr.getMetadataReadOnly().replicas[otherKeyspace])
+
+	// the replicas of the routing keyspace follow the token ring
+	host := &HostInfo{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"25"}}
+	mngr.addHost(host)
+	assertDeepEqual(t, "replicas", tokenRingReplicas{
+		{orderedToken("00"), []*HostInfo{hosts[0]}},
+		{orderedToken("25"), []*HostInfo{host}},
+		{orderedToken("50"), []*HostInfo{hosts[1]}},
+	}, mngr.getMetadataReadOnly().replicas[otherKeyspace])
+}
+
+func TestClusterMetadataManager_MaxRoutingKeyspaces(t *testing.T) {
+	var mngr clusterMetadataManager
+	mngr.getKeyspaceName = func() string { return "myKeyspace" }
+	mngr.getKeyspaceMetadata = func(keyspaceName string) (*KeyspaceMetadata, error) {
+		return &KeyspaceMetadata{
+			Name:            keyspaceName,
+			StrategyClass:   "SimpleStrategy",
+			StrategyOptions: map[string]interface{}{"replication_factor": 1},
+		}, nil
+	}
+	mngr.addHosts([]*HostInfo{{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}}})
+	mngr.setPartitioner("OrderedPartitioner")
+
+	for i := 0; i < 2*maxRoutingKeyspaces; i++ {
+		mngr.addRoutingKeyspace("ks" + strconv.Itoa(i))
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&mngr.numRoutingKeyspaces) < maxRoutingKeyspaces {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the routing keyspaces")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	// let the lookups in flight finish
+	for {
+		adding := false
+		mngr.addingKeyspaces.Range(func(_, _ interface{}) bool {
+			adding = true
+			return false
+		})
+		if !adding {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the routing keyspaces")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	mngr.mu.Lock()
+	n := len(mngr.routingKeyspaces)
+	mngr.mu.Unlock()
+	if n != maxRoutingKeyspaces {
+		t.Fatalf("expected %d routing keyspaces, got %d", maxRoutingKeyspaces, n)
+	}
+	// and the session keyspace
+	if replicas := mngr.getMetadataReadOnly().replicas; len(replicas) != maxRoutingKeyspaces+1 {
+		t.Fatalf("expected the replicas of %d keyspaces, got %d", maxRoutingKeyspaces+1, len(replicas))
+	}
+}
+
+func TestQueryKeyspaceIgnoresRoutingKeyspace(t *testing.T) {
+	qry := &Query{routingInfo: &queryRoutingInfo{}, session: &Session{cfg: ClusterConfig{Keyspace: "ks"}}}
+	qry.WithRoutingKeyspace("other")
+	if ks := qry.Keyspace(); ks != "ks" {
+		t.Fatalf("expected the keyspace of the query to be ks, got %q", ks)
+	}
+	if ks := routingKeyspaceOf(qry); ks != "other" {
+		t.Fatalf("expected the query to be routed to other, got %q", ks)
+	}
+}
+
+func TestClusterMetadataManager_RefreshDebounce(t *testing.T) {
+	var mngr clusterMetadataManager
+	mngr.getKeyspaceName = func() string { return "myKeyspace" }
+	mngr.getKeyspaceMetadata = func(ks string) (*KeyspaceMetadata, error) {
+		return nil, errors.New("not initialized")
+	}
+	mngr.refreshDebounce = 50 * time.Millisecond
+
+	// the initial hosts are added at once
+	mngr.addHosts([]*HostInfo{{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"00"}}})
+	mngr.setPartitioner("OrderedPartitioner")
+	if n := len(mngr.getMetadataReadOnly().TokenRing().tokens); n != 1 {
+		t.Fatalf("expected the token ring to be built immediately, got %d tokens", n)
+	}
+	stats := mngr.refreshStats()
+
+	// a burst of changes is coalesced into one rebuild
+	for i := 1; i <= 5; i++ {
+		mngr.addHost(&HostInfo{hostId: strconv.Itoa(i), connectAddress: net.IPv4(10, 0, 0, byte(i+1)), tokens: []string{strconv.Itoa(i * 10)}})
+	}
+	mngr.removeHost(&HostInfo{connectAddress: net.IPv4(10, 0, 0, 6)})
+	if n := len(mngr.getMetadataReadOnly().TokenRing().tokens); n != 1 {
+		t.Fatalf("expected the token ring rebuild to be pending, got %d tokens", n)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(mngr.getMetadataReadOnly().TokenRing().tokens) != 5 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the token ring to be rebuilt")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	assertDeepEqual(t, "refresh stats", MetadataRefreshStats{
+		Applied:   stats.Applied + 1,
+		Coalesced: stats.Coalesced + 5,
+	}, mngr.refreshStats())
+
+	// stopping cancels the pending rebuild
+	mngr.addHost(&HostInfo{hostId: "6", connectAddress: net.IPv4(10, 0, 0, 7), tokens: []string{"60"}})
+	stats = mngr.refreshStats()
+	mngr.stop()
+	time.Sleep(2 * mngr.refreshDebounce)
+	if n := len(mngr.getMetadataReadOnly().TokenRing().tokens); n != 5 || mngr.refreshStats() != stats {
+		t.Fatalf("expected the pending rebuild to be cancelled, got %d tokens", n)
+	}
+	mngr.mu.Lock()
+	timer := mngr.refreshTimer
+	mngr.mu.Unlock()
+	if timer != nil {
+		t.Fatal("expected no rebuild to be scheduled once stopped")
+	}
+}
+
 func TestClusterMetadataManager_NilHostInfo(t *testing.T) {
 	var mngr clusterMetadataManager
 	mngr.getKeyspaceName = func() string { return "myKeyspace" }
@@ -56,3 +56,11 @@ func TestClusterConfig_translateAddressAndPort_Success(t *testing.T) {
 	assertTrue(t, "translated address", net.ParseIP("10.10.10.10").Equal(newAddr))
 	assertEqual(t, "translated port", 5432, newPort)
 }
+
+func TestProtoVersionRange_validate(t *testing.T) {
+	assertNil(t, "valid range", ProtoVersionRange{Min: 3, Max: 4}.validate())
+	assertNil(t, "single version", ProtoVersionRange{Min: 4, Max: 4}.validate())
+	assertTrue(t, "min above max", ProtoVersionRange{Min: 4, Max: 3}.validate() != nil)
+	assertTrue(t, "min below 1", ProtoVersionRange{Min: 0, Max: 3}.validate() != nil)
+	assertTrue(t, "max above 5", ProtoVersionRange{Min: 3, Max: 6}.validate() != nil)
+}
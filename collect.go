@@ -0,0 +1,63 @@
+//go:build go1.21
+// +build go1.21
+
+// The module targets an older language version, the build constraint above
+// enables type parameters in this file.
+
+package gocql
+
+// CollectAll calls scan for every row of iter, fetching additional pages as
+// needed, and returns the collected values. scan should scan the current row,
+// typically with a single call to iter.Scan, errors reported by iter.Scan are
+// returned by CollectAll so scan does not need to check them.
+//
+// CollectAll stops at the first error returned by scan or encountered by iter,
+// including the query context being canceled, and always closes iter.
+//
+// Example:
+//
+//	users, err := gocql.CollectAll(session.Query(`SELECT id, name FROM users`).Iter(),
+//		func(iter *gocql.Iter) (User, error) {
+//			var u User
+//			iter.Scan(&u.ID, &u.Name)
+//			return u, nil
+//		})
+func CollectAll[T any](iter *Iter, scan func(*Iter) (T, error)) ([]T, error) {
+	var values []T
+	for iter.nextRow() {
+		v, err := scan(iter)
+		if err != nil {
+			iter.Close()
+			return nil, err
+		}
+		if iter.err != nil {
+			break
+		}
+		values = append(values, v)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// nextRow reports whether there is a row left to scan, fetching the next page
+// if the current one is exhausted.
+func (iter *Iter) nextRow() bool {
+	for iter.err == nil {
+		if iter.next != nil {
+			if err := iter.next.qry.Context().Err(); err != nil {
+				iter.err = err
+				return false
+			}
+		}
+		if iter.pos < iter.numRows {
+			return true
+		}
+		if iter.next == nil {
+			return false
+		}
+		iter.nextPage()
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+//go:build (all || unit) && go1.21
+// +build all unit
+// +build go1.21
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testIntPages returns an iter over pages of rows with a single int column,
+// fetching a page completes immediately.
+func testIntPages(ctx context.Context, pages ...[]int32) *Iter {
+	var next *nextIter
+	for i := len(pages) - 1; i >= 0; i-- {
+		f := newFramer(nil, protoVersion4)
+		for _, v := range pages[i] {
+			f.writeBytes(encInt(v))
+		}
+		iter := &Iter{
+			meta: resultMetadata{
+				colCount:       1,
+				actualColCount: 1,
+				columns:        []ColumnInfo{{Name: "v", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}}},
+			},
+			numRows: len(pages[i]),
+			framer:  f,
+			next:    next,
+		}
+		next = &nextIter{qry: &Query{context: ctx}, next: iter}
+		next.once.Do(func() {})
+		next.oncea.Do(func() {})
+	}
+	return next.next
+}
+
+func scanInt(iter *Iter) (int, error) {
+	var v int
+	iter.Scan(&v)
+	return v, nil
+}
+
+func TestCollectAll(t *testing.T) {
+	values, err := CollectAll(testIntPages(context.Background(), []int32{1, 2}, nil, []int32{3}), scanInt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1, 2, 3}; !reflect.DeepEqual(values, expected) {
+		t.Fatalf("expected %v, got %v", expected, values)
+	}
+
+	values, err = CollectAll(testIntPages(context.Background(), nil), scanInt)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("expected no values, got %v and error %v", values, err)
+	}
+}
+
+func TestCollectAllErrors(t *testing.T) {
+	errScan := errors.New("scan failed")
+	_, err := CollectAll(testIntPages(context.Background(), []int32{1, 2}), func(iter *Iter) (int, error) {
+		return 0, errScan
+	})
+	if err != errScan {
+		t.Fatalf("expected %v, got %v", errScan, err)
+	}
+
+	_, err = CollectAll(testIntPages(context.Background(), []int32{1}), func(iter *Iter) (string, error) {
+		var v []int
+		iter.Scan(&v)
+		return "", nil
+	})
+	if _, ok := err.(UnmarshalError); !ok {
+		t.Fatalf("expected an unmarshal error, got %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = CollectAll(testIntPages(ctx, []int32{1}, []int32{2}), scanInt)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -117,7 +117,32 @@ type SslOptions struct {
 	//
 	// See SslOptions documentation to see how EnableHostVerification interacts with the provided tls.Config.
 	EnableHostVerification bool
-}
+
+	// PinnedCertFingerprints are the SHA-256 fingerprints of the DER encoding
+	// of the leaf certificates the servers are allowed to present. If not
+	// empty, the connections to servers presenting other certificates are
+	// rejected according to PinnedCertMode.
+	PinnedCertFingerprints [][32]byte
+
+	// PinnedCertMode is how pinned certificates combine with the verification
+	// of the certificates against the trusted CAs and host name, which is
+	// enabled by EnableHostVerification or the tls.Config.
+	// Default: PinnedCertAndCA
+	PinnedCertMode PinnedCertMode
+}
+
+// PinnedCertMode is how SslOptions.PinnedCertFingerprints combine with the
+// verification of the server certificates.
+type PinnedCertMode int
+
+const (
+	// PinnedCertAndCA accepts the certificates which are pinned and pass the
+	// verification, if enabled.
+	PinnedCertAndCA PinnedCertMode = iota
+	// PinnedCertOrCA accepts the certificates which are pinned, without
+	// verifying them, or pass the verification, if enabled.
+	PinnedCertOrCA
+)
 
 type ConnConfig struct {
 	ProtoVersion   int
@@ -132,6 +157,12 @@ type ConnConfig struct {
 	AuthProvider   func(h *HostInfo) (Authenticator, error)
 	Keepalive      time.Duration
 	Logger         StdLogger
+	// MaxFrameSize is the maximum size of received frame bodies, see
+	// ClusterConfig.MaxFrameSize.
+	MaxFrameSize int
+	// UnknownTypePolicy is the policy for types unknown to gocql, see
+	// ClusterConfig.UnknownTypePolicy.
+	UnknownTypePolicy UnknownTypePolicy
 
 	tlsConfig       *tls.Config
 	disableCoalesce bool
@@ -144,6 +175,20 @@ func (c *ConnConfig) logger() StdLogger {
 	return c.Logger
 }
 
+func (c *ConnConfig) maxFrameSize() int {
+	if c == nil || c.MaxFrameSize <= 0 || c.MaxFrameSize > maxFrameSize {
+		return maxFrameSize
+	}
+	return c.MaxFrameSize
+}
+
+func (c *ConnConfig) unknownTypePolicy() UnknownTypePolicy {
+	if c == nil {
+		return UnknownTypeError
+	}
+	return c.UnknownTypePolicy
+}
+
 type ConnErrorHandler interface {
 	HandleError(conn *Conn, err error, closed bool)
 }
@@ -170,11 +215,12 @@ type Conn struct {
 	r    *bufio.Reader
 	w    contextWriter
 
-	timeout        time.Duration
-	writeTimeout   time.Duration
-	cfg            *ConnConfig
-	frameObserver  FrameHeaderObserver
-	streamObserver StreamObserver
+	timeout          time.Duration
+	writeTimeout     time.Duration
+	cfg              *ConnConfig
+	frameObserver    FrameHeaderObserver
+	rawFrameObserver FrameObserver
+	streamObserver   StreamObserver
 
 	headerBuf [maxFrameHeaderSize]byte
 
@@ -189,11 +235,21 @@ type Conn struct {
 	compressor   Compressor
 	auth         Authenticator
 	addr         string
+	// remoteAddr is the address of the host, see DialedHost.RemoteAddr.
+	remoteAddr net.Addr
 
 	version         uint8
 	currentKeyspace string
-	host            *HostInfo
-	isSchemaV2      bool
+	// rateLimitErrCode is set during startup, see framer.rateLimitErrCode.
+	rateLimitErrCode int
+	host             *HostInfo
+	isSchemaV2       bool
+	// isScylla is set during startup if the server advertises Scylla
+	// protocol extensions.
+	isScylla bool
+	// sharding is the shard of the connection on a Scylla host, set during
+	// startup.
+	sharding scyllaSharding
 
 	session *Session
 
@@ -204,6 +260,15 @@ type Conn struct {
 	cancel context.CancelFunc
 
 	timeouts int64
+	// lastRecv is the time the last frame was received in unix nanoseconds.
+	lastRecv int64
+	// queries is the number of queries and batches executed on the connection.
+	queries uint64
+	created time.Time
+	// spillover is true for the connections opened on top of the size of the
+	// pool, see ClusterConfig.MaxSpilloverConns. It is protected by the mutex
+	// of the pool.
+	spillover bool
 
 	logger StdLogger
 }
@@ -222,6 +287,11 @@ func (s *Session) dial(ctx context.Context, host *HostInfo, connConfig *ConnConf
 	}
 
 	conn, err := s.dialWithoutObserver(ctx, host, connConfig, errorHandler)
+	if err != nil {
+		s.connEvents.record(host, ConnEventConnectFailed, err)
+	} else {
+		s.connEvents.record(host, ConnEventConnected, nil)
+	}
 
 	if s.connectObserver != nil {
 		obs.End = time.Now()
@@ -246,6 +316,11 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 		writeTimeout = cfg.WriteTimeout
 	}
 
+	remoteAddr := dialedHost.RemoteAddr
+	if remoteAddr == nil {
+		remoteAddr = dialedHost.Conn.RemoteAddr()
+	}
+
 	ctx, cancel := context.WithCancel(ctx)
 	c := &Conn{
 		conn:          dialedHost.Conn,
@@ -253,7 +328,8 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 		cfg:           cfg,
 		calls:         make(map[int]*callReq),
 		version:       uint8(cfg.ProtoVersion),
-		addr:          dialedHost.Conn.RemoteAddr().String(),
+		addr:          remoteAddr.String(),
+		remoteAddr:    remoteAddr,
 		errorHandler:  errorHandler,
 		compressor:    cfg.Compressor,
 		session:       s,
@@ -267,11 +343,13 @@ func (s *Session) dialWithoutObserver(ctx context.Context, host *HostInfo, cfg *
 			semaphore: make(chan struct{}, 1),
 			quit:      make(chan struct{}),
 		},
-		ctx:            ctx,
-		cancel:         cancel,
-		logger:         cfg.logger(),
-		streamObserver: s.streamObserver,
-		writeTimeout:   writeTimeout,
+		ctx:              ctx,
+		cancel:           cancel,
+		logger:           cfg.logger(),
+		streamObserver:   s.streamObserver,
+		rawFrameObserver: s.rawFrameObserver,
+		writeTimeout:     writeTimeout,
+		created:          time.Now(),
 	}
 
 	if err := c.init(ctx, dialedHost); err != nil {
@@ -442,9 +520,32 @@ func (s *startupCoordinator) startup(ctx context.Context, supported map[string][
 
 		if _, ok := m["COMPRESSION"]; !ok {
 			s.conn.compressor = nil
+			if s.conn.session != nil {
+				s.conn.session.compressionWarning.Do(func() {
+					if !logEnabled(s.conn.logger, LogLevelWarn) {
+						return
+					}
+					logEvent(s.conn.logger, LogLevelWarn, fmt.Sprintf("host does not support %s compression, connections to it are not compressed", name),
+						[]LogField{{"host", s.conn.host.ConnectAddress()}, {"compression", name}, {"supported", comp}},
+						"gocql: %v does not support %s compression, connections to it are not compressed (supported: %v)\n",
+						s.conn.host.ConnectAddress(), name, comp)
+				})
+			}
 		}
 	}
 
+	s.conn.isScylla = isScyllaSupported(supported)
+	s.conn.sharding = parseScyllaSharding(supported)
+	if s.conn.host != nil && s.conn.isScylla {
+		// read again on every connection, the number of shards of a host
+		// changes when it is restarted with more or less cores
+		s.conn.host.setScyllaShardCount(s.conn.sharding.nrShards)
+	}
+	if code, ok := scyllaRateLimitErrCode(supported); ok {
+		m[scyllaRateLimitErrorExt] = ""
+		s.conn.rateLimitErrCode = code
+	}
+
 	frame, err := s.write(ctx, &writeStartupFrame{opts: m})
 	if err != nil {
 		return err
@@ -462,6 +563,35 @@ func (s *startupCoordinator) startup(ctx context.Context, supported map[string][
 	}
 }
 
+const scyllaRateLimitErrorExt = "SCYLLA_RATE_LIMIT_ERROR"
+
+// isScyllaSupported reports whether the SUPPORTED options of a server list
+// Scylla protocol extensions.
+func isScyllaSupported(supported map[string][]string) bool {
+	for opt := range supported {
+		if strings.HasPrefix(opt, "SCYLLA_") {
+			return true
+		}
+	}
+	return false
+}
+
+// scyllaRateLimitErrCode returns the error code used for rate limit errors if
+// the server supports the SCYLLA_RATE_LIMIT_ERROR extension.
+func scyllaRateLimitErrCode(supported map[string][]string) (int, bool) {
+	for _, opt := range supported[scyllaRateLimitErrorExt] {
+		if !strings.HasPrefix(opt, "ERROR_CODE=") {
+			continue
+		}
+		code, err := strconv.ParseInt(strings.TrimPrefix(opt, "ERROR_CODE="), 0, 32)
+		if err != nil || code == 0 {
+			return 0, false
+		}
+		return int(code), true
+	}
+	return 0, false
+}
+
 func (s *startupCoordinator) authenticateHandshake(ctx context.Context, authFrame *authenticateFrame) error {
 	if s.conn.auth == nil {
 		return fmt.Errorf("authentication required (using %q)", authFrame.class)
@@ -541,6 +671,10 @@ func (c *Conn) closeWithError(err error) {
 		}
 	}
 
+	if c.session != nil {
+		c.session.connEvents.record(c.host, ConnEventClosed, err)
+	}
+
 	// if error was nil then unblock the quit channel
 	c.cancel()
 	cerr := c.close()
@@ -592,8 +726,19 @@ func (p *protocolError) Error() string {
 	return fmt.Sprintf("gocql: received unexpected frame on stream %d: %v", p.frame.Header().stream, p.frame)
 }
 
+const defaultHeartbeatInterval = 5 * time.Second
+
 func (c *Conn) heartBeat(ctx context.Context) {
+	interval := c.session.cfg.HeartbeatInterval
+	if interval <= 0 {
+		interval = defaultHeartbeatInterval
+	}
+	heartbeatTimeout := c.session.cfg.HeartbeatTimeout
+
 	sleepTime := 1 * time.Second
+	if interval < sleepTime {
+		sleepTime = interval
+	}
 	timer := time.NewTimer(sleepTime)
 	defer timer.Stop()
 
@@ -613,7 +758,18 @@ func (c *Conn) heartBeat(ctx context.Context) {
 		case <-timer.C:
 		}
 
-		framer, err := c.exec(context.Background(), &writeOptionsFrame{}, nil)
+		// only check connections which are idle
+		if idle := time.Since(time.Unix(0, atomic.LoadInt64(&c.lastRecv))); failures == 0 && idle < interval {
+			sleepTime = interval - idle
+			continue
+		}
+
+		framer, err := c.execHeartbeat(heartbeatTimeout)
+		if errors.Is(err, context.DeadlineExceeded) {
+			// the connection is likely half-open, dont wait for queries to find out
+			c.closeWithError(fmt.Errorf("gocql: no response to heartbeat within %v", heartbeatTimeout))
+			return
+		}
 		if err != nil {
 			failures++
 			continue
@@ -629,7 +785,7 @@ func (c *Conn) heartBeat(ctx context.Context) {
 		switch resp.(type) {
 		case *supportedFrame:
 			// Everything ok
-			sleepTime = 5 * time.Second
+			sleepTime = interval
 			failures = 0
 		case error:
 			// TODO: should we do something here?
@@ -639,6 +795,18 @@ func (c *Conn) heartBeat(ctx context.Context) {
 	}
 }
 
+// execHeartbeat sends an OPTIONS request, waiting up to timeout for the
+// response if it is not zero.
+func (c *Conn) execHeartbeat(timeout time.Duration) (*framer, error) {
+	ctx := context.Background()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	return c.exec(ctx, &writeOptionsFrame{}, nil)
+}
+
 func (c *Conn) recv(ctx context.Context) error {
 	// not safe for concurrent reads
 
@@ -655,6 +823,13 @@ func (c *Conn) recv(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt64(&c.lastRecv, headEndTime.UnixNano())
+
+	if max := c.cfg.maxFrameSize(); head.length > max {
+		// the connection can not be trusted anymore, close it without reading
+		// the body
+		return fmt.Errorf("%w: %d bytes from %v, the maximum is %d", ErrFrameTooBig, head.length, c.addr, max)
+	}
 
 	if c.frameObserver != nil {
 		c.frameObserver.ObserveFrameHeader(context.Background(), ObservedFrameHeader{
@@ -677,6 +852,7 @@ func (c *Conn) recv(ctx context.Context) error {
 		if err := framer.readFrame(c, &head); err != nil {
 			return err
 		}
+		c.observeReceivedFrame(&head, framer.buf)
 		go c.session.handleEvent(framer)
 		return nil
 	} else if head.stream <= 0 {
@@ -706,7 +882,7 @@ func (c *Conn) recv(ctx context.Context) error {
 	delete(c.calls, head.stream)
 	c.mu.Unlock()
 	if call == nil || !ok {
-		c.logger.Printf("gocql: received response for stream which has no handler: header=%v\n", head)
+		logf(c.logger, LogLevelWarn, "gocql: received response for stream which has no handler: header=%v\n", head)
 		return c.discardFrame(head)
 	} else if head.stream != call.streamID {
 		panic(fmt.Sprintf("call has incorrect streamID: got %d expected %d", call.streamID, head.stream))
@@ -721,6 +897,8 @@ func (c *Conn) recv(ctx context.Context) error {
 		if _, ok := err.(net.Error); ok {
 			return err
 		}
+	} else {
+		c.observeReceivedFrame(&head, framer.buf)
 	}
 
 	// we either, return a response to the caller, the caller timedout, or the
@@ -735,6 +913,38 @@ func (c *Conn) recv(ctx context.Context) error {
 	return nil
 }
 
+func (c *Conn) observeReceivedFrame(head *frameHeader, body []byte) {
+	if c.rawFrameObserver == nil {
+		return
+	}
+
+	c.rawFrameObserver.ObserveFrame(context.Background(), ObservedFrame{
+		Direction: FrameReceived,
+		Version:   head.version,
+		Flags:     head.flags,
+		Stream:    int16(head.stream),
+		Opcode:    head.op,
+		Body:      copyBytes(body),
+		Host:      c.host,
+	})
+}
+
+func (c *Conn) observeSentFrame(ctx context.Context, f *framer, stream int) {
+	if c.rawFrameObserver == nil {
+		return
+	}
+
+	c.rawFrameObserver.ObserveFrame(ctx, ObservedFrame{
+		Direction: FrameSent,
+		Version:   protoVersion(f.buf[0]),
+		Flags:     f.buf[1],
+		Stream:    int16(stream),
+		Opcode:    frameOp(f.buf[f.headSize-5]),
+		Body:      copyBytes(f.buf[f.headSize:]),
+		Host:      c.host,
+	})
+}
+
 func (c *Conn) releaseStream(call *callReq) {
 	if call.timer != nil {
 		call.timer.Stop()
@@ -1006,6 +1216,21 @@ func (c *Conn) addCall(call *callReq) error {
 	return nil
 }
 
+// writeQueued writes p to the connection, failing with ErrConnectionBusy if
+// MaxQueueTimePerConn is set and the write could not start within it.
+func (c *Conn) writeQueued(ctx context.Context, p []byte) (int, error) {
+	if c.session == nil || c.session.cfg.MaxQueueTimePerConn <= 0 {
+		return c.w.writeContext(ctx, p)
+	}
+	queueCtx, cancel := context.WithTimeout(ctx, c.session.cfg.MaxQueueTimePerConn)
+	defer cancel()
+	n, err := c.w.writeContext(queueCtx, p)
+	if n == 0 && err == context.DeadlineExceeded && ctx.Err() == nil {
+		return 0, ErrConnectionBusy
+	}
+	return n, err
+}
+
 func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*framer, error) {
 	if ctxErr := ctx.Err(); ctxErr != nil {
 		return nil, ctxErr
@@ -1066,13 +1291,13 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 		return nil, err
 	}
 
-	n, err := c.w.writeContext(ctx, framer.buf)
+	n, err := c.writeQueued(ctx, framer.buf)
 	if err != nil {
 		// closeWithError will block waiting for this stream to either receive a response
 		// or for us to timeout, close the timeout chan here. Im not entirely sure
 		// but we should not get a response after an error on the write side.
 		close(call.timeout)
-		if (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) && n == 0 {
+		if (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) || err == ErrConnectionBusy) && n == 0 {
 			// We have not started to write this frame.
 			// Release the stream as no response can come from the server on the stream.
 			c.mu.Lock()
@@ -1094,6 +1319,9 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 		return nil, err
 	}
 
+	sent := time.Now()
+	c.observeSentFrame(ctx, framer, stream)
+
 	var timeoutCh <-chan time.Time
 	if c.timeout > 0 {
 		if call.timer == nil {
@@ -1142,6 +1370,9 @@ func (c *Conn) exec(ctx context.Context, req frameBuilder, tracer Tracer) (*fram
 			return nil, NewErrProtocol("unexpected protocol version in response: got %d expected %d", v, c.version)
 		}
 
+		resp.framer.rateLimitErrCode = c.rateLimitErrCode
+		resp.framer.unknownTypes = c.cfg.unknownTypePolicy()
+		resp.framer.sent = sent
 		return resp.framer, nil
 	case <-timeoutCh:
 		close(call.timeout)
@@ -1203,23 +1434,41 @@ type StreamObserverContext interface {
 }
 
 type preparedStatment struct {
-	id       []byte
-	request  preparedMetadata
-	response resultMetadata
+	id []byte
+	// keyspace is the keyspace of the connection the statement was prepared on,
+	// the statement is bound to it.
+	keyspace string
+	// resultMetadataID identifies response, v5+
+	resultMetadataID []byte
+	request          preparedMetadata
+	response         resultMetadata
 }
 
 type inflightPrepare struct {
 	done chan struct{}
 	err  error
+	key  PreparedCacheKey
 
 	preparedStatment *preparedStatment
 }
 
 func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer) (*preparedStatment, error) {
+	return c.prepareStatementOnHost(ctx, stmt, tracer, c.session.cfg.PrepareOnAllHosts)
+}
+
+// prepareStatementOnHost prepares stmt on the host of the connection unless
+// it is cached, if fanOut is set a newly prepared statement is then prepared
+// on all other hosts in the background.
+func (c *Conn) prepareStatementOnHost(ctx context.Context, stmt string, tracer Tracer, fanOut bool) (*preparedStatment, error) {
 	stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
 	flight, ok := c.session.stmtsLRU.execIfMissing(stmtCacheKey, func(lru *lru.Cache) *inflightPrepare {
 		flight := &inflightPrepare{
 			done: make(chan struct{}),
+			key: PreparedCacheKey{
+				HostID:    c.host.HostID(),
+				Keyspace:  c.currentKeyspace,
+				Statement: c.session.stmtsLRU.cacheStatement(stmt),
+			},
 		}
 		lru.Add(stmtCacheKey, flight)
 		return flight
@@ -1227,7 +1476,20 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 
 	if !ok {
 		go func() {
-			defer close(flight.done)
+			// the observer is notified once the callers waiting for the
+			// statement are released
+			var observe func()
+			defer func() {
+				close(flight.done)
+				if observe != nil {
+					observe()
+				}
+			}()
+
+			if shared := c.session.stmtsLRU.loadShared(flight.key); shared != nil {
+				flight.preparedStatment = shared
+				return
+			}
 
 			prep := &writePrepareFrame{
 				statement: stmt,
@@ -1239,7 +1501,25 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 			// we won the race to do the load, if our context is canceled we shouldnt
 			// stop the load as other callers are waiting for it but this caller should get
 			// their context cancelled error.
+			atomic.AddUint64(&c.session.stmtsLRU.sent, 1)
+			var start, end time.Time
+			if observer := c.session.cfg.PrepareObserver; observer != nil {
+				reprepare := c.session.stmtsLRU.reprepared(stmtCacheKey)
+				observe = func() {
+					observer.ObservePrepare(ObservedPrepare{
+						Keyspace:  flight.key.Keyspace,
+						Statement: stmt,
+						Host:      c.host,
+						Start:     start,
+						End:       end,
+						Reprepare: reprepare,
+						Err:       flight.err,
+					})
+				}
+			}
+			start = time.Now()
 			framer, err := c.exec(c.ctx, prep, tracer)
+			end = time.Now()
 			if err != nil {
 				flight.err = err
 				c.session.stmtsLRU.remove(stmtCacheKey)
@@ -1264,7 +1544,9 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 				flight.preparedStatment = &preparedStatment{
 					// defensively copy as we will recycle the underlying buffer after we
 					// return.
-					id: copyBytes(x.preparedID),
+					id:               copyBytes(x.preparedID),
+					keyspace:         flight.key.Keyspace,
+					resultMetadataID: copyBytes(x.resultMetadataID),
 					// the type info's should _not_ have a reference to the framers read buffer,
 					// therefore we can just copy them directly.
 					request:  x.reqMeta,
@@ -1278,6 +1560,11 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 
 			if flight.err != nil {
 				c.session.stmtsLRU.remove(stmtCacheKey)
+			} else {
+				c.session.stmtsLRU.storeShared(flight.key, flight.preparedStatment)
+				if fanOut {
+					go c.session.prepareOnAllHosts(c.host, c.currentKeyspace, stmt)
+				}
 			}
 		}()
 	}
@@ -1290,13 +1577,18 @@ func (c *Conn) prepareStatement(ctx context.Context, stmt string, tracer Tracer)
 	}
 }
 
-func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error {
+func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues, precision TimestampPrecision) error {
 	if named, ok := value.(*namedValue); ok {
 		dst.name = named.name
 		value = named.value
 	}
 
 	if _, ok := value.(unsetColumn); !ok {
+		value, err := precision.adjust(typ, value)
+		if err != nil {
+			return err
+		}
+
 		val, err := Marshal(typ, value)
 		if err != nil {
 			return err
@@ -1311,6 +1603,13 @@ func marshalQueryValue(typ TypeInfo, value interface{}, dst *queryValues) error
 }
 
 func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
+	atomic.AddUint64(&c.queries, 1)
+	return c.executeQueryPrepared(ctx, qry, true)
+}
+
+// executeQueryPrepared executes qry, if reprepare is set and the host reports
+// the prepared statement as unprepared it is prepared and executed again once.
+func (c *Conn) executeQueryPrepared(ctx context.Context, qry *Query, reprepare bool) *Iter {
 	params := queryParams{
 		consistency: qry.cons,
 	}
@@ -1326,19 +1625,57 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 	if qry.pageSize > 0 {
 		params.pageSize = qry.pageSize
 	}
+	if qry.pageSizeBytes {
+		if c.version < protoVersion5 {
+			return &Iter{err: fmt.Errorf("gocql: page size in bytes requires protocol 5 or higher, the connection uses protocol %d", c.version)}
+		}
+		params.pageSizeBytes = true
+	}
 	if c.version > protoVersion4 {
 		params.keyspace = c.currentKeyspace
 	}
+	if qry.nowInSeconds {
+		if c.version < protoVersion5 {
+			return &Iter{err: fmt.Errorf("gocql: now in seconds requires protocol 5 or higher, the connection uses protocol %d", c.version)}
+		}
+		params.nowInSeconds = true
+		params.nowInSecondsValue = qry.nowInSecondsValue
+	}
+
+	stmt := qry.stmt
+	if qry.serverTimeout > 0 {
+		if c.isScylla {
+			var err error
+			if stmt, err = withTimeout(stmt, qry.serverTimeout); err != nil {
+				return &Iter{err: err}
+			}
+		} else {
+			c.session.serverTimeoutWarning.Do(func() {
+				logEvent(c.logger, LogLevelWarn, "the server timeout of queries is ignored by hosts which are not Scylla",
+					[]LogField{{"host", c.host.ConnectAddress()}},
+					"gocql: the server timeout of queries is ignored by %v which is not Scylla\n", c.host.ConnectAddress())
+			})
+		}
+	}
 
 	var (
 		frame frameBuilder
 		info  *preparedStatment
 	)
 
-	if !qry.skipPrepare && qry.shouldPrepare() {
+	if qry.prepared == prepareNever && (len(qry.values) > 0 || qry.binding != nil) {
+		return &Iter{err: errors.New("gocql: values can not be bound to a query which is not prepared")}
+	}
+
+	if c.shouldPrepare(qry) {
 		// Prepare all DML queries. Other queries can not be prepared.
 		var err error
-		info, err = c.prepareStatement(ctx, qry.stmt, qry.trace)
+		info, err = c.prepareStatement(ctx, stmt, qry.trace)
+		if err == nil && info.keyspace != c.currentKeyspace {
+			// the keyspace of the connection changed since the statement was
+			// prepared, the prepared ID is bound to the previous keyspace
+			info, err = c.prepareStatement(ctx, stmt, qry.trace)
+		}
 		if err != nil {
 			return &Iter{err: err}
 		}
@@ -1366,7 +1703,7 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 			v := &params.values[i]
 			value := values[i]
 			typ := info.request.columns[i].TypeInfo
-			if err := marshalQueryValue(typ, value, v); err != nil {
+			if err := marshalQueryValue(typ, value, v, qry.timestampPrecision); err != nil {
 				return &Iter{err: err}
 			}
 		}
@@ -1374,9 +1711,10 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		params.skipMeta = !(c.session.cfg.DisableSkipMetadata || qry.disableSkipMetadata)
 
 		frame = &writeExecuteFrame{
-			preparedID:    info.id,
-			params:        params,
-			customPayload: qry.customPayload,
+			preparedID:       info.id,
+			resultMetadataID: info.resultMetadataID,
+			params:           params,
+			customPayload:    qry.payload(c.version),
 		}
 
 		// Set "keyspace" and "table" property in the query if it is present in preparedMetadata
@@ -1386,16 +1724,18 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		qry.routingInfo.mu.Unlock()
 	} else {
 		frame = &writeQueryFrame{
-			statement:     qry.stmt,
+			statement:     stmt,
 			params:        params,
-			customPayload: qry.customPayload,
+			customPayload: qry.payload(c.version),
 		}
 	}
 
+	start := time.Now()
 	framer, err := c.exec(ctx, frame, qry.trace)
 	if err != nil {
 		return &Iter{err: err}
 	}
+	waited := time.Since(start)
 
 	resp, err := framer.parseFrame()
 	if err != nil {
@@ -1414,9 +1754,17 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 			meta:    x.meta,
 			framer:  framer,
 			numRows: x.numRows,
+			stats:   IterStats{Pages: 1, Rows: x.numRows, WaitTime: waited},
 		}
 
-		if params.skipMeta {
+		if x.meta.flags&flagMetaDataChanged == flagMetaDataChanged && info != nil {
+			// the result set of the prepared statement changed, eg. a column was
+			// added to the table, use the metadata sent along and update the cache
+			// so that the following executions send the new result metadata id.
+			iter.meta = x.meta
+			stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, stmt)
+			c.session.stmtsLRU.updateResultMetadata(stmtCacheKey, info.id, x.meta)
+		} else if params.skipMeta {
 			if info != nil {
 				iter.meta = info.response
 				iter.meta.pagingState = copyBytes(x.meta.pagingState)
@@ -1432,6 +1780,7 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 			*newQry = *qry
 			newQry.pageState = copyBytes(x.meta.pagingState)
 			newQry.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
+			newQry.page = qry.page + 1
 
 			iter.next = &nextIter{
 				qry: newQry,
@@ -1450,16 +1799,23 @@ func (c *Conn) executeQuery(ctx context.Context, qry *Query) *Iter {
 		iter := &Iter{framer: framer}
 		if err := c.awaitSchemaAgreement(ctx); err != nil {
 			// TODO: should have this behind a flag
-			c.logger.Println(err)
+			logf(c.logger, LogLevelWarn, "%v\n", err)
 		}
 		// dont return an error from this, might be a good idea to give a warning
 		// though. The impact of this returning an error would be that the cluster
 		// is not consistent with regards to its schema.
 		return iter
 	case *RequestErrUnprepared:
-		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), c.currentKeyspace, qry.stmt)
+		keyspace := c.currentKeyspace
+		if info != nil {
+			keyspace = info.keyspace
+		}
+		stmtCacheKey := c.session.stmtsLRU.keyFor(c.host.HostID(), keyspace, stmt)
 		c.session.stmtsLRU.evictPreparedID(stmtCacheKey, x.StatementId)
-		return c.executeQuery(ctx, qry)
+		if !reprepare {
+			return &Iter{err: x, framer: framer}
+		}
+		return c.executeQueryPrepared(ctx, qry, false)
 	case error:
 		return &Iter{err: x, framer: framer}
 	default:
@@ -1487,10 +1843,32 @@ func (c *Conn) Address() string {
 	return c.addr
 }
 
+// Compression returns the name of the compression algorithm negotiated with
+// the host, or "none" if the connection is not compressed because no
+// compressor is configured or the host does not support it.
+func (c *Conn) Compression() string {
+	if c.compressor == nil {
+		return "none"
+	}
+	return c.compressor.Name()
+}
+
 func (c *Conn) AvailableStreams() int {
 	return c.streams.Available()
 }
 
+// MaxStreams returns the number of streams which can be in flight on this
+// connection at the same time.
+func (c *Conn) MaxStreams() int {
+	// stream 0 is reserved
+	return c.streams.NumStreams - 1
+}
+
+// InFlightStreams returns the number of streams currently in use on this connection.
+func (c *Conn) InFlightStreams() int {
+	return c.streams.InUse()
+}
+
 func (c *Conn) UseKeyspace(keyspace string) error {
 	q := &writeQueryFrame{statement: `USE "` + keyspace + `"`}
 	q.params.consistency = c.session.cons
@@ -1523,6 +1901,7 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 		return &Iter{err: ErrUnsupported}
 	}
 
+	atomic.AddUint64(&c.queries, 1)
 	n := len(batch.Entries)
 	req := &writeBatchFrame{
 		typ:                   batch.Type,
@@ -1574,7 +1953,7 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 				v := &b.values[j]
 				value := values[j]
 				typ := info.request.columns[j].TypeInfo
-				if err := marshalQueryValue(typ, value, v); err != nil {
+				if err := marshalQueryValue(typ, value, v, batch.timestampPrecision); err != nil {
 					return &Iter{err: err}
 				}
 			}
@@ -1622,6 +2001,31 @@ func (c *Conn) executeBatch(ctx context.Context, batch *Batch) *Iter {
 	}
 }
 
+// shouldPrepare decides whether qry is executed as a prepared statement.
+func (c *Conn) shouldPrepare(qry *Query) bool {
+	if qry.skipPrepare {
+		return false
+	}
+
+	switch qry.prepared {
+	case prepareAlways:
+		return true
+	case prepareNever:
+		return false
+	}
+
+	if !qry.shouldPrepare() {
+		return false
+	}
+
+	threshold := c.session.cfg.AutoPrepareThreshold
+	if threshold <= 1 || len(qry.values) > 0 || qry.binding != nil {
+		return true
+	}
+
+	return c.session.stmtExecCounts.inc(qry.stmt) >= threshold
+}
+
 func (c *Conn) query(ctx context.Context, statement string, values ...interface{}) (iter *Iter) {
 	q := c.session.Query(statement, values...).Consistency(One).Trace(nil)
 	q.skipPrepare = true
@@ -1666,56 +2070,29 @@ func (c *Conn) querySystemLocal(ctx context.Context) *Iter {
 	return c.query(ctx, "SELECT * FROM system.local WHERE key='local'")
 }
 
-func (c *Conn) awaitSchemaAgreement(ctx context.Context) (err error) {
-	const localSchemas = "SELECT schema_version FROM system.local WHERE key='local'"
+func (c *Conn) awaitSchemaAgreement(ctx context.Context) error {
+	return c.awaitSchemaAgreementWithin(ctx, c.session.cfg.MaxWaitSchemaAgreement)
+}
 
-	var versions map[string]struct{}
-	var schemaVersion string
+// awaitSchemaAgreementWithin waits up to maxWait for all hosts to report the
+// same schema version.
+func (c *Conn) awaitSchemaAgreementWithin(ctx context.Context, maxWait time.Duration) error {
+	var (
+		versions []string
+		err      error
+	)
 
-	endDeadline := time.Now().Add(c.session.cfg.MaxWaitSchemaAgreement)
+	endDeadline := time.Now().Add(maxWait)
 
 	for time.Now().Before(endDeadline) {
-		iter := c.querySystemPeers(ctx, c.host.version)
-
-		versions = make(map[string]struct{})
-
-		rows, err := iter.SliceMap()
-		if err != nil {
-			goto cont
-		}
-
-		for _, row := range rows {
-			host, err := c.session.hostInfoFromMap(row, &HostInfo{connectAddress: c.host.ConnectAddress(), port: c.session.cfg.Port})
-			if err != nil {
-				goto cont
+		var v []string
+		if v, err = c.schemaVersions(ctx); err == nil {
+			versions = v
+			if len(versions) <= 1 {
+				return nil
 			}
-			if !isValidPeer(host) || host.schemaVersion == "" {
-				c.logger.Printf("invalid peer or peer with empty schema_version: peer=%q", host)
-				continue
-			}
-
-			versions[host.schemaVersion] = struct{}{}
-		}
-
-		if err = iter.Close(); err != nil {
-			goto cont
-		}
-
-		iter = c.query(ctx, localSchemas)
-		for iter.Scan(&schemaVersion) {
-			versions[schemaVersion] = struct{}{}
-			schemaVersion = ""
-		}
-
-		if err = iter.Close(); err != nil {
-			goto cont
 		}
 
-		if len(versions) <= 1 {
-			return nil
-		}
-
-	cont:
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
@@ -1727,13 +2104,55 @@ func (c *Conn) awaitSchemaAgreement(ctx context.Context) (err error) {
 		return err
 	}
 
+	// not exported
+	return fmt.Errorf("gocql: cluster schema versions not consistent: %+v", versions)
+}
+
+// schemaVersions returns the distinct schema versions reported by the hosts.
+func (c *Conn) schemaVersions(ctx context.Context) ([]string, error) {
+	const localSchemas = "SELECT schema_version FROM system.local WHERE key='local'"
+
+	versions := make(map[string]struct{})
+
+	iter := c.querySystemPeers(ctx, c.host.version)
+	rows, err := iter.SliceMap()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, row := range rows {
+		host, err := c.session.hostInfoFromMap(row, &HostInfo{connectAddress: c.host.ConnectAddress(), port: c.session.cfg.Port})
+		if err != nil {
+			return nil, err
+		}
+		if !isValidPeer(host) || host.schemaVersion == "" {
+			logf(c.logger, LogLevelWarn, "invalid peer or peer with empty schema_version: peer=%q", host)
+			continue
+		}
+
+		versions[host.schemaVersion] = struct{}{}
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	var schemaVersion string
+	iter = c.query(ctx, localSchemas)
+	for iter.Scan(&schemaVersion) {
+		versions[schemaVersion] = struct{}{}
+		schemaVersion = ""
+	}
+
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
 	schemas := make([]string, 0, len(versions))
 	for schema := range versions {
 		schemas = append(schemas, schema)
 	}
-
-	// not exported
-	return fmt.Errorf("gocql: cluster schema versions not consistent: %+v", schemas)
+	return schemas, nil
 }
 
 var (
@@ -1742,4 +2161,7 @@ var (
 	ErrTooManyTimeouts   = errors.New("gocql: too many query timeouts on the connection")
 	ErrConnectionClosed  = errors.New("gocql: connection closed waiting for response")
 	ErrNoStreams         = errors.New("gocql: no streams available on connection")
+	// ErrConnectionBusy is returned when a request could not be written to a
+	// connection within ClusterConfig.MaxQueueTimePerConn.
+	ErrConnectionBusy = errors.New("gocql: connection busy, request not sent within max queue time")
 )
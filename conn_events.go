@@ -0,0 +1,90 @@
+package gocql
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConnEventType is the type of a connection lifecycle event.
+type ConnEventType int
+
+const (
+	// ConnEventConnected is recorded when a connection was established.
+	ConnEventConnected ConnEventType = iota
+	// ConnEventConnectFailed is recorded when establishing a connection failed.
+	ConnEventConnectFailed
+	// ConnEventClosed is recorded when a connection was closed, Err is set if it
+	// was closed because of an error.
+	ConnEventClosed
+)
+
+func (t ConnEventType) String() string {
+	switch t {
+	case ConnEventConnected:
+		return "connected"
+	case ConnEventConnectFailed:
+		return "connect failed"
+	case ConnEventClosed:
+		return "closed"
+	default:
+		return fmt.Sprintf("unknown connection event %d", int(t))
+	}
+}
+
+// ConnEvent is a connection lifecycle event returned by Session.RecentConnectionEvents.
+type ConnEvent struct {
+	Host *HostInfo
+	Type ConnEventType
+	Time time.Time
+	Err  error
+}
+
+func (e ConnEvent) String() string {
+	s := fmt.Sprintf("%s %s:%d %s", e.Time.Format(time.RFC3339Nano), e.Host.ConnectAddress(), e.Host.Port(), e.Type)
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// connEventLog is a fixed size ring buffer of the most recent connection events.
+type connEventLog struct {
+	mu     sync.Mutex
+	events []ConnEvent
+	next   int
+	full   bool
+}
+
+func newConnEventLog(size int) *connEventLog {
+	return &connEventLog{events: make([]ConnEvent, size)}
+}
+
+func (l *connEventLog) record(host *HostInfo, typ ConnEventType, err error) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	l.events[l.next] = ConnEvent{Host: host, Type: typ, Time: time.Now(), Err: err}
+	l.next++
+	if l.next == len(l.events) {
+		l.next = 0
+		l.full = true
+	}
+	l.mu.Unlock()
+}
+
+// recent returns the recorded events, oldest first.
+func (l *connEventLog) recent() []ConnEvent {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.full {
+		return append([]ConnEvent(nil), l.events[:l.next]...)
+	}
+	events := make([]ConnEvent, 0, len(l.events))
+	events = append(events, l.events[l.next:]...)
+	return append(events, l.events[:l.next]...)
+}
@@ -0,0 +1,78 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConnEventLogWraps(t *testing.T) {
+	log := newConnEventLog(3)
+	host := &HostInfo{}
+	errs := make([]error, 5)
+	for i := range errs {
+		errs[i] = errors.New(string(rune('a' + i)))
+		log.record(host, ConnEventClosed, errs[i])
+	}
+
+	events := log.recent()
+	if len(events) != 3 {
+		t.Fatalf("expected 3 events, got %d", len(events))
+	}
+	for i, event := range events {
+		if event.Err != errs[i+2] {
+			t.Fatalf("expected event %d to have error %v, got %v", i, errs[i+2], event.Err)
+		}
+	}
+
+	var disabled *connEventLog
+	disabled.record(host, ConnEventConnected, nil)
+	if events := disabled.recent(); events != nil {
+		t.Fatalf("expected no events when disabled, got %v", events)
+	}
+}
+
+func TestRecentConnectionEvents(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	// the test server only closes the connection once it receives a frame
+	cluster.HeartbeatInterval = 100 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	// the connection is closed by the server
+	srv.Stop()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var connected, closed bool
+		for _, event := range db.RecentConnectionEvents() {
+			switch event.Type {
+			case ConnEventConnected:
+				connected = true
+			case ConnEventClosed:
+				closed = closed || event.Err != nil
+			}
+		}
+		if connected && closed {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected a connected and a closed event with an error, got %v", db.RecentConnectionEvents())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
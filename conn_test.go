@@ -16,15 +16,18 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math/big"
 	"math/rand"
 	"net"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/gocql/gocql/internal/lru"
 	"github.com/gocql/gocql/internal/streams"
 )
 
@@ -381,6 +384,113 @@ func TestQueryRetry(t *testing.T) {
 	}
 }
 
+func TestQueryNoRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv1 := NewTestServerWithAddress("127.0.0.1:0", t, defaultProto, ctx)
+	defer srv1.Stop()
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, ctx)
+	defer srv2.Stop()
+
+	db, err := newTestSession(defaultProto, srv1.Address, srv2.Address)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	rt := &SimpleRetryPolicy{NumRetries: 3}
+	sp := &SimpleSpeculativeExecution{NumAttempts: 2, TimeoutDelay: time.Millisecond}
+	qry := db.Query("kill").Idempotent(true).RetryPolicy(rt).SetSpeculativeExecutionPolicy(sp).NoRetry()
+	err = qry.Exec()
+	if reqErr, ok := err.(RequestError); !ok || reqErr.Code() != 0x1001 {
+		t.Fatalf("expected the error of the attempt, got %v", err)
+	}
+
+	requests := atomic.LoadInt64(&srv1.nKillReq) + atomic.LoadInt64(&srv2.nKillReq)
+	if requests != 1 {
+		t.Fatalf("expected a single request, got %d", requests)
+	}
+	if attempts := qry.Attempts(); attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts)
+	}
+
+	// nor is a query whose connection is dropped
+	qry = db.Query("drop").Idempotent(true).RetryPolicy(rt).NoRetry()
+	if err := qry.Exec(); err == nil {
+		t.Fatal("expected the error of the dropped connection")
+	}
+	drops := atomic.LoadInt64(&srv1.nDropReq) + atomic.LoadInt64(&srv2.nDropReq)
+	if drops != 1 {
+		t.Fatalf("expected a single request, got %d", drops)
+	}
+	if attempts := qry.Attempts(); attempts != 1 {
+		t.Fatalf("expected a single attempt, got %d", attempts)
+	}
+
+	// which is retried otherwise
+	if err := db.Query("drop").Idempotent(true).RetryPolicy(rt).Exec(); err == nil {
+		t.Fatal("expected the error of the dropped connection")
+	}
+	if retried := atomic.LoadInt64(&srv1.nDropReq) + atomic.LoadInt64(&srv2.nDropReq) - drops; retried < 2 {
+		t.Fatalf("expected the query to be retried, got %d requests", retried)
+	}
+}
+
+func TestSessionCoordinatorAffinity(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv1 := NewTestServerWithAddress("127.0.0.1:0", t, defaultProto, ctx)
+	defer srv1.Stop()
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, ctx)
+	defer srv2.Stop()
+
+	db, err := newTestSession(defaultProto, srv1.Address, srv2.Address)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	exec := func(ctx context.Context) *HostInfo {
+		t.Helper()
+		iter := db.Query("void").WithContext(ctx).Iter()
+		if err := iter.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return iter.Host()
+	}
+
+	affinityCtx := db.WithCoordinatorAffinity(ctx)
+	coordinator := exec(affinityCtx)
+	for i := 0; i < 10; i++ {
+		if host := exec(affinityCtx); host != coordinator {
+			t.Fatalf("query %d: expected coordinator %s, got %s", i, coordinator.ConnectAddress(), host.ConnectAddress())
+		}
+	}
+
+	// without affinity the queries are spread over the hosts
+	hosts := make(map[*HostInfo]bool)
+	for i := 0; i < 10; i++ {
+		hosts[exec(ctx)] = true
+	}
+	if len(hosts) != 2 {
+		t.Fatalf("expected the queries to be sent to both hosts, got %d", len(hosts))
+	}
+
+	// the queries are pinned to another coordinator once it is down
+	coordinator.setState(NodeDown)
+	defer coordinator.setState(NodeUp)
+	next := exec(affinityCtx)
+	if next == coordinator {
+		t.Fatal("expected the queries to be sent to another coordinator")
+	}
+	coordinator.setState(NodeUp)
+	if host := exec(affinityCtx); host != next {
+		t.Fatalf("expected the queries to stay on the new coordinator %s, got %s", next.ConnectAddress(), host.ConnectAddress())
+	}
+}
+
 func TestQueryMultinodeWithMetrics(t *testing.T) {
 	log := &testLogger{}
 	defer func() {
@@ -516,6 +626,250 @@ func TestSpeculativeExecution(t *testing.T) {
 	}
 }
 
+func TestDiscoverProtocolRange(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts, err := addrsToHosts([]string{srv.Address}, 9042, db.logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	control := createControlConn(db)
+
+	proto, err := control.discoverProtocol(hosts, ProtoVersionRange{Min: protoVersion1, Max: protoVersion4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if proto != defaultProto {
+		t.Fatalf("expected to negotiate protocol %d, got %d", defaultProto, proto)
+	}
+	if v := db.ProtocolVersion(); v != defaultProto {
+		t.Fatalf("expected session protocol version %d, got %d", defaultProto, v)
+	}
+
+	if _, err := control.discoverProtocol(hosts, ProtoVersionRange{Min: protoVersion3, Max: protoVersion4}); err == nil {
+		t.Fatal("expected an error when no version in the range is supported")
+	}
+
+	// the version negotiated when creating a session is logged, even without
+	// a configured range
+	log := &testLogger{}
+	cluster := NewCluster(srv.Address)
+	cluster.Logger = log
+	cluster.DisableInitialHostLookup = true
+	if db, err := cluster.CreateSession(); err == nil {
+		// the test server does not serve the system tables of the control
+		// connection, only the negotiation is checked
+		db.Close()
+	}
+	exp := fmt.Sprintf("gocql: negotiated protocol version %d from range [%d, %d]", defaultProto, protoVersion1, protoVersion4)
+	if !strings.Contains(log.String(), exp) {
+		t.Fatalf("expected %q to be logged, got %q", exp, log.String())
+	}
+}
+
+func TestStreamSpillover(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.MaxSpilloverConns = 1
+	cluster.SpilloverIdleTimeout = 50 * time.Millisecond
+
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts := db.ring.allHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host, got %d", len(hosts))
+	}
+	pool, ok := db.pool.getPool(hosts[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+
+	inFlight := func() int {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		n := 0
+		for _, conn := range pool.conns {
+			n += conn.InFlightStreams()
+		}
+		return n
+	}
+	waitFor := func(what string, cond func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	// more queries than a single protocol v2 connection has streams for
+	const perWave = 110
+	errs := make(chan error, 2*perWave)
+	var wg sync.WaitGroup
+	flood := func() {
+		for i := 0; i < perWave; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- db.Query("block").Exec()
+			}()
+		}
+	}
+
+	flood()
+	waitFor("first wave to be in flight", func() bool { return inFlight() == perWave })
+	waitFor("spillover connection", func() bool {
+		pool.Pick()
+		return pool.Size() == 2
+	})
+
+	flood()
+	waitFor("second wave to be in flight", func() bool { return inFlight() == 2*perWave })
+
+	pool.mu.RLock()
+	for _, conn := range pool.conns {
+		if conn.InFlightStreams() > conn.MaxStreams() {
+			t.Errorf("conn %s has %d streams in flight, limit is %d", conn.addr, conn.InFlightStreams(), conn.MaxStreams())
+		}
+	}
+	pool.mu.RUnlock()
+
+	if size := pool.Size(); size != 2 {
+		t.Fatalf("expected pool to be capped at 2 connections, got %d", size)
+	}
+	if n := db.SpilloverConns(); n != 1 {
+		t.Fatalf("expected 1 spillover connection, got %d", n)
+	}
+
+	close(srv.unblock)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("expected queries to spill over to another connection, got: %v", err)
+		}
+	}
+
+	// the spillover connection is closed once idle, without being replaced
+	waitFor("idle spillover connection to be closed", func() bool { return db.SpilloverConns() == 0 })
+	time.Sleep(100 * time.Millisecond)
+	if size := pool.Size(); size != 1 {
+		t.Fatalf("expected the pool to be back to 1 connection, got %d", size)
+	}
+}
+
+type recordingRetryPolicy struct {
+	SimpleRetryPolicy
+	errs []error
+}
+
+func (p *recordingRetryPolicy) AttemptWithError(q RetryableQuery, err error) bool {
+	p.errs = append(p.errs, err)
+	return len(p.errs) < 2
+}
+
+func TestControlQueryRetryPolicyWithError(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	host := db.ring.allHosts()[0]
+	pool, ok := db.pool.getPool(host)
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	control := createControlConn(db)
+	control.conn.Store(&connHost{conn: pool.Pick(), host: host})
+	retry := &recordingRetryPolicy{}
+	control.retry = retry
+
+	if err := control.query("kill").Close(); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+	if len(retry.errs) != 2 {
+		t.Fatalf("expected the retry policy to be asked with the error twice, got %v", retry.errs)
+	}
+	for _, err := range retry.errs {
+		if err == nil || !strings.Contains(err.Error(), "query killed") {
+			t.Fatalf("expected the error of the query, got %v", err)
+		}
+	}
+}
+
+func TestQueryMetricNameComputedOnce(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	var observed observedQueries
+	qry := db.Query("SELECT * FROM users WHERE id = 42").Prepared(false).Observer(&observed)
+	if err := qry.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	const exp = "SELECT * FROM users WHERE id = ?"
+	if qry.fingerprint != exp {
+		t.Fatalf("expected the fingerprint to be cached on the query, got %q", qry.fingerprint)
+	}
+	if len(observed) != 1 || observed[0].MetricName != exp {
+		t.Fatalf("expected the metric name %q to be observed, got %v", exp, observed)
+	}
+}
+
+func TestAwaitSchemaAgreementQueryError(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.ring.allHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	conn := pool.Pick()
+	if conn == nil {
+		t.Fatal("no connection")
+	}
+
+	if err := conn.awaitSchemaAgreementWithin(context.Background(), 300*time.Millisecond); err != nil {
+		t.Fatalf("expected the schema to agree, got %v", err)
+	}
+
+	atomic.StoreInt32(&srv.failSelects, 1)
+	err = conn.awaitSchemaAgreementWithin(context.Background(), 300*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "select failed") {
+		t.Fatalf("expected the error of the schema version queries, got %v", err)
+	}
+}
+
 // This tests that the policy connection pool handles SSL correctly
 func TestPolicyConnPoolSSL(t *testing.T) {
 	srv := NewSSLTestServer(t, defaultProto, context.Background())
@@ -981,301 +1335,2183 @@ func TestFrameHeaderObserver(t *testing.T) {
 	}
 }
 
-func NewTestServerWithAddress(addr string, t testing.TB, protocol uint8, ctx context.Context) *TestServer {
-	return newTestServerOpts{
-		addr:     addr,
-		protocol: protocol,
-	}.newServer(t, ctx)
+type recordingFrameObserver struct {
+	mu     sync.Mutex
+	frames []ObservedFrame
 }
 
-type newTestServerOpts struct {
-	addr     string
-	protocol uint8
-	recvHook func(*framer)
+func (r *recordingFrameObserver) ObserveFrame(ctx context.Context, frm ObservedFrame) {
+	r.mu.Lock()
+	r.frames = append(r.frames, frm)
+	r.mu.Unlock()
 }
 
-func (nts newTestServerOpts) newServer(t testing.TB, ctx context.Context) *TestServer {
-	laddr, err := net.ResolveTCPAddr("tcp", nts.addr)
+func (r *recordingFrameObserver) getFrames() []ObservedFrame {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.frames
+}
+
+func TestFrameObserver(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	observer := &recordingFrameObserver{}
+	cluster.FrameObserver = observer
+
+	db, err := cluster.CreateSession()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer db.Close()
 
-	listen, err := net.ListenTCP("tcp", laddr)
-	if err != nil {
+	if err := db.Query("void").Exec(); err != nil {
 		t.Fatal(err)
 	}
 
-	headerSize := 8
-	if nts.protocol > protoVersion2 {
-		headerSize = 9
+	frames := observer.getFrames()
+	exp := []struct {
+		dir FrameDirection
+		op  frameOp
+	}{
+		{FrameSent, opOptions},
+		{FrameReceived, opSupported},
+		{FrameSent, opStartup},
+		{FrameReceived, opReady},
+		{FrameSent, opQuery},
+		{FrameReceived, opResult},
+	}
+	if len(frames) != len(exp) {
+		t.Fatalf("expected to observe %d frames, instead observed %d: %v", len(exp), len(frames), frames)
+	}
+
+	for i, e := range exp {
+		if frames[i].Direction != e.dir || frames[i].Opcode != e.op {
+			t.Fatalf("expected frame %d to be %v %v got %v", i, e.dir, e.op, frames[i])
+		}
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	srv := &TestServer{
-		Address:    listen.Addr().String(),
-		listen:     listen,
-		t:          t,
-		protocol:   nts.protocol,
-		headerSize: headerSize,
-		ctx:        ctx,
-		cancel:     cancel,
-
-		onRecv: nts.recvHook,
+	query, result := frames[4], frames[5]
+	if query.Stream != result.Stream {
+		t.Fatalf("expected query and result on the same stream, got %d and %d", query.Stream, result.Stream)
+	}
+	if !bytes.Contains(query.Body, []byte("void")) {
+		t.Fatalf("expected query body to contain the statement, got %q", query.Body)
+	}
+	if len(result.Body) != 4 {
+		t.Fatalf("expected void result body of 4 bytes, got %d", len(result.Body))
 	}
-
-	go srv.closeWatch()
-	go srv.serve()
-
-	return srv
-}
-
-func NewTestServer(t testing.TB, protocol uint8, ctx context.Context) *TestServer {
-	return NewTestServerWithAddress("127.0.0.1:0", t, protocol, ctx)
 }
 
-func NewSSLTestServer(t testing.TB, protocol uint8, ctx context.Context) *TestServer {
-	pem, err := ioutil.ReadFile("testdata/pki/ca.crt")
-	certPool := x509.NewCertPool()
-	if !certPool.AppendCertsFromPEM(pem) {
-		t.Fatalf("Failed parsing or appending certs")
-	}
-	mycert, err := tls.LoadX509KeyPair("testdata/pki/cassandra.crt", "testdata/pki/cassandra.key")
-	if err != nil {
-		t.Fatalf("could not load cert")
+func TestStmtExecCounterNormalizes(t *testing.T) {
+	counter := &stmtExecCounter{lru: lru.New(10)}
+	for i, stmt := range []string{
+		"SELECT * FROM ks.users WHERE id = ?",
+		"select *\n\tfrom ks.users where id = ? -- by id",
+		"  SELECT * FROM ks.users /* again */ WHERE id = ?",
+	} {
+		if n := counter.inc(stmt); n != i+1 {
+			t.Fatalf("expected %q to be counted as execution %d, got %d", stmt, i+1, n)
+		}
 	}
-	config := &tls.Config{
-		Certificates: []tls.Certificate{mycert},
-		RootCAs:      certPool,
+	if n := counter.inc("SELECT * FROM ks.users WHERE id = 1"); n != 1 {
+		t.Fatalf("expected a statement with a different literal to be counted separately, got %d", n)
 	}
-	listen, err := tls.Listen("tcp", "127.0.0.1:0", config)
+}
+
+func TestAutoPrepareThreshold(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.AutoPrepareThreshold = 3
+	observer := &recordingFrameObserver{}
+	cluster.FrameObserver = observer
+
+	db, err := cluster.CreateSession()
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer db.Close()
 
-	headerSize := 8
-	if protocol > protoVersion2 {
-		headerSize = 9
+	countSent := func(op frameOp) int {
+		n := 0
+		for _, frame := range observer.getFrames() {
+			if frame.Direction == FrameSent && frame.Opcode == op {
+				n++
+			}
+		}
+		return n
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	srv := &TestServer{
-		Address:    listen.Addr().String(),
-		listen:     listen,
-		t:          t,
-		protocol:   protocol,
-		headerSize: headerSize,
-		ctx:        ctx,
-		cancel:     cancel,
+	const stmt = "select * from system.local"
+	for i := 0; i < 2; i++ {
+		if err := db.Query(stmt).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countSent(opPrepare); n != 0 {
+		t.Fatalf("expected no statement to be prepared below the threshold, got %d prepares", n)
 	}
 
-	go srv.closeWatch()
-	go srv.serve()
-	return srv
-}
-
-type TestServer struct {
-	Address          string
-	TimeoutOnStartup int32
-	t                testing.TB
-	listen           net.Listener
-	nKillReq         int64
-
-	protocol   byte
-	headerSize int
-	ctx        context.Context
-	cancel     context.CancelFunc
+	// the test server does not support preparing statements
+	if err := db.Query(stmt).Exec(); err == nil {
+		t.Fatal("expected the statement to be prepared once the threshold is reached")
+	}
+	if n := countSent(opPrepare); n != 1 {
+		t.Fatalf("expected 1 prepare, got %d", n)
+	}
 
-	mu     sync.Mutex
-	closed bool
+	if err := db.Query(stmt).Prepared(false).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Query("void").Prepared(true).Exec(); err == nil {
+		t.Fatal("expected the statement to be prepared")
+	}
+	if n := countSent(opPrepare); n != 2 {
+		t.Fatalf("expected 2 prepares, got %d", n)
+	}
 
-	// onRecv is a hook point for tests, called in receive loop.
-	onRecv func(*framer)
+	if err := db.Query("void ?", 1).Prepared(false).Exec(); err == nil {
+		t.Fatal("expected an error when binding values to a query which is not prepared")
+	}
 }
 
-func (srv *TestServer) closeWatch() {
-	<-srv.ctx.Done()
+func TestHeartbeatTimeout(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
 
-	srv.mu.Lock()
-	defer srv.mu.Unlock()
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.HeartbeatInterval = 20 * time.Millisecond
+	cluster.HeartbeatTimeout = 50 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
 
-	srv.closeLocked()
-}
+	countEvents := func(typ ConnEventType) int {
+		n := 0
+		for _, event := range db.RecentConnectionEvents() {
+			if event.Type == typ {
+				n++
+			}
+		}
+		return n
+	}
+	waitEvents := func(typ ConnEventType, n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for countEvents(typ) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %d %q events, got %v", n, typ, db.RecentConnectionEvents())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
 
-func (srv *TestServer) serve() {
-	defer srv.listen.Close()
-	for !srv.isClosed() {
-		conn, err := srv.listen.Accept()
-		if err != nil {
-			break
+	// heartbeats are answered, the connection stays open
+	time.Sleep(200 * time.Millisecond)
+	if n := countEvents(ConnEventClosed); n != 0 {
+		t.Fatalf("expected the connection to stay open, got %v", db.RecentConnectionEvents())
+	}
+
+	// the connection goes half-open, the next heartbeat is not answered
+	atomic.StoreInt32(&srv.IgnoreOptions, 1)
+	waitEvents(ConnEventClosed, 1)
+	for _, event := range db.RecentConnectionEvents() {
+		if event.Type == ConnEventClosed && (event.Err == nil || !strings.Contains(event.Err.Error(), "heartbeat")) {
+			t.Fatalf("expected the connection to be closed by a heartbeat timeout, got %v", event)
 		}
+	}
 
-		go func(conn net.Conn) {
-			defer conn.Close()
-			for !srv.isClosed() {
-				framer, err := srv.readFrame(conn)
-				if err != nil {
-					if err == io.EOF {
-						return
-					}
-					srv.errorLocked(err)
-					return
-				}
+	waitEvents(ConnEventConnected, 2)
+}
 
-				if srv.onRecv != nil {
-					srv.onRecv(framer)
-				}
+func TestRateLimitError(t *testing.T) {
+	srv := newTestServerOpts{
+		addr:             "127.0.0.1:0",
+		protocol:         defaultProto,
+		rateLimitErrCode: 0xF000,
+	}.newServer(t, context.Background())
+	defer srv.Stop()
 
-				go srv.process(conn, framer)
-			}
-		}(conn)
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	defer db.Close()
 
-func (srv *TestServer) isClosed() bool {
-	srv.mu.Lock()
-	defer srv.mu.Unlock()
-	return srv.closed
+	err = db.Query("ratelimit").Exec()
+	rateLimitErr, ok := err.(*RequestErrRateLimitReached)
+	if !ok {
+		t.Fatalf("expected a rate limit error, got %T: %v", err, err)
+	}
+	if rateLimitErr.OpType != RateLimitOpWrite || !rateLimitErr.RejectedByCoordinator {
+		t.Fatalf("unexpected rate limit error %v", rateLimitErr)
+	}
 }
 
-func (srv *TestServer) closeLocked() {
-	if srv.closed {
-		return
-	}
+func TestQueryNowInSecondsProtocol(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
 
-	srv.closed = true
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
 
-	srv.listen.Close()
-	srv.cancel()
+	err = db.Query("void").NowInSeconds(1).Exec()
+	if err == nil || !strings.Contains(err.Error(), "protocol 5") {
+		t.Fatalf("expected an error requiring protocol 5, got %v", err)
+	}
 }
 
-func (srv *TestServer) Stop() {
-	srv.mu.Lock()
-	defer srv.mu.Unlock()
-	srv.closeLocked()
-}
+func TestQueryPageSizeBytesProtocol(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
 
-func (srv *TestServer) errorLocked(err interface{}) {
-	srv.mu.Lock()
-	defer srv.mu.Unlock()
-	if srv.closed {
-		return
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
 	}
-	srv.t.Error(err)
-}
+	defer db.Close()
 
-func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
-	head := reqFrame.header
-	if head == nil {
-		srv.errorLocked("process frame with a nil header")
-		return
+	err = db.Query("void").PageSizeBytes(1 << 20).Exec()
+	if err == nil || !strings.Contains(err.Error(), "protocol 5") {
+		t.Fatalf("expected an error requiring protocol 5, got %v", err)
 	}
-	respFrame := newFramer(nil, reqFrame.proto)
 
-	switch head.op {
-	case opStartup:
-		if atomic.LoadInt32(&srv.TimeoutOnStartup) > 0 {
-			// Do not respond to startup command
-			// wait until we get a cancel signal
-			select {
-			case <-srv.ctx.Done():
-				return
-			}
-		}
-		respFrame.writeHeader(0, opReady, head.stream)
-	case opOptions:
-		respFrame.writeHeader(0, opSupported, head.stream)
-		respFrame.writeShort(0)
-	case opQuery:
-		query := reqFrame.readLongString()
-		first := query
-		if n := strings.Index(query, " "); n > 0 {
-			first = first[:n]
+	// the page size in rows replaces it
+	if err := db.Query("void").PageSizeBytes(1 << 20).PageSize(100).Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedPreparedCache(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:      []byte("stmt"),
+		columns: []string{"a"},
+	})
+
+	cache := NewPreparedCache(10)
+	const stmt = "select * from ks.tbl"
+
+	newSession := func(observer FrameObserver) *Session {
+		t.Helper()
+		cluster := testCluster(protoVersion4, srv.Address)
+		cluster.NumConns = 1
+		cluster.PreparedCache = cache
+		cluster.FrameObserver = observer
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
 		}
-		switch strings.ToLower(first) {
-		case "kill":
-			atomic.AddInt64(&srv.nKillReq, 1)
-			respFrame.writeHeader(0, opError, head.stream)
-			respFrame.writeInt(0x1001)
-			respFrame.writeString("query killed")
-		case "use":
-			respFrame.writeInt(resultKindKeyspace)
-			respFrame.writeString(strings.TrimSpace(query[3:]))
-		case "void":
-			respFrame.writeHeader(0, opResult, head.stream)
-			respFrame.writeInt(resultKindVoid)
-		case "timeout":
-			<-srv.ctx.Done()
-			return
-		case "slow":
-			go func() {
-				respFrame.writeHeader(0, opResult, head.stream)
-				respFrame.writeInt(resultKindVoid)
-				respFrame.buf[0] = srv.protocol | 0x80
-				select {
-				case <-srv.ctx.Done():
-					return
-				case <-time.After(50 * time.Millisecond):
-					respFrame.finish()
-					respFrame.writeTo(conn)
-				}
-			}()
-			return
-		case "speculative":
-			atomic.AddInt64(&srv.nKillReq, 1)
-			if atomic.LoadInt64(&srv.nKillReq) > 3 {
-				respFrame.writeHeader(0, opResult, head.stream)
-				respFrame.writeInt(resultKindVoid)
-				respFrame.writeString("speculative query success on the node " + srv.Address)
-			} else {
-				respFrame.writeHeader(0, opError, head.stream)
-				respFrame.writeInt(0x1001)
-				respFrame.writeString("speculative error")
-				rand.Seed(time.Now().UnixNano())
-				<-time.After(time.Millisecond * 120)
+		return db
+	}
+	countPrepares := func(observer *recordingFrameObserver) int {
+		n := 0
+		for _, frame := range observer.getFrames() {
+			if frame.Direction == FrameSent && frame.Opcode == opPrepare {
+				n++
 			}
-		default:
-			respFrame.writeHeader(0, opResult, head.stream)
-			respFrame.writeInt(resultKindVoid)
 		}
-	case opError:
-		respFrame.writeHeader(0, opError, head.stream)
-		respFrame.buf = append(respFrame.buf, reqFrame.buf...)
-	default:
-		respFrame.writeHeader(0, opError, head.stream)
-		respFrame.writeInt(0)
-		respFrame.writeString("not supported")
+		return n
 	}
 
-	respFrame.buf[0] = srv.protocol | 0x80
+	observer1 := &recordingFrameObserver{}
+	db1 := newSession(observer1)
+	defer db1.Close()
+	if err := db1.Query(stmt).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countPrepares(observer1); n != 1 {
+		t.Fatalf("expected 1 prepare, got %d", n)
+	}
 
-	if err := respFrame.finish(); err != nil {
-		srv.errorLocked(err)
+	key1 := PreparedCacheKey{HostID: db1.ring.allHosts()[0].HostID(), Statement: stmt}
+	prepared, ok := cache.Get(key1)
+	if !ok || string(prepared.ID()) != "stmt" {
+		t.Fatalf("expected the prepared statement to be stored in the shared cache, got %v", prepared)
 	}
 
-	if err := respFrame.writeTo(conn); err != nil {
-		srv.errorLocked(err)
+	// hosts get a random id without the control connection, store the
+	// statement for the host of the second session.
+	observer2 := &recordingFrameObserver{}
+	db2 := newSession(observer2)
+	defer db2.Close()
+	cache.Put(PreparedCacheKey{HostID: db2.ring.allHosts()[0].HostID(), Statement: stmt}, prepared)
+
+	row := make(map[string]interface{})
+	if err := db2.Query(stmt).MapScan(row); err != nil {
+		t.Fatal(err)
+	}
+	if row["a"] != 1 {
+		t.Fatalf("unexpected row %v", row)
+	}
+	if n := countPrepares(observer2); n != 0 {
+		t.Fatalf("expected the statement to be loaded from the shared cache, got %d prepares", n)
 	}
 }
 
-func (srv *TestServer) readFrame(conn net.Conn) (*framer, error) {
-	buf := make([]byte, srv.headerSize)
-	head, err := readHeader(conn, buf)
-	if err != nil {
-		return nil, err
+func TestPrepareOnAllHosts(t *testing.T) {
+	const stmt = "select * from ks.tbl"
+	var addrs []string
+	for i := 0; i < 3; i++ {
+		srv := NewTestServer(t, protoVersion4, context.Background())
+		defer srv.Stop()
+		srv.setPrepared(&testPreparedStatement{
+			id:      []byte("stmt"),
+			columns: []string{"a"},
+		})
+		addrs = append(addrs, srv.Address)
+	}
+
+	newSession := func(eager bool) *Session {
+		t.Helper()
+		cluster := testCluster(protoVersion4, addrs...)
+		cluster.NumConns = 1
+		cluster.PrepareOnAllHosts = eager
+		cluster.PrepareOnAllHostsConcurrency = 1
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
 	}
-	framer := newFramer(nil, srv.protocol)
 
-	err = framer.readFrame(conn, &head)
-	if err != nil {
-		return nil, err
+	lazy := newSession(false)
+	defer lazy.Close()
+	if err := lazy.Query(stmt).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if n := lazy.PreparesSent(); n != 1 {
+		t.Fatalf("expected 1 prepare, got %d", n)
 	}
 
-	// should be a request frame
-	if head.version.response() {
-		return nil, fmt.Errorf("expected to read a request frame got version: %v", head.version)
-	} else if head.version.version() != srv.protocol {
-		return nil, fmt.Errorf("expected to read protocol version 0x%x got 0x%x", srv.protocol, head.version.version())
+	eager := newSession(true)
+	defer eager.Close()
+	if err := eager.Query(stmt).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for eager.PreparesSent() < 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := eager.PreparesSent(); n != 3 {
+		t.Fatalf("expected the statement to be prepared on all 3 hosts, got %d prepares", n)
 	}
 
-	return framer, nil
+	// the statement is cached for every host, executing it does not prepare it again
+	for i := 0; i < 3; i++ {
+		if err := eager.Query(stmt).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := eager.PreparesSent(); n != 3 {
+		t.Fatalf("expected no more prepares, got %d", n)
+	}
+}
+
+type recordingPrepareObserver struct {
+	mu       sync.Mutex
+	prepares []ObservedPrepare
+}
+
+func (o *recordingPrepareObserver) ObservePrepare(p ObservedPrepare) {
+	o.mu.Lock()
+	o.prepares = append(o.prepares, p)
+	o.mu.Unlock()
+}
+
+func (o *recordingPrepareObserver) observed() []ObservedPrepare {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]ObservedPrepare(nil), o.prepares...)
+}
+
+func TestPrepareObserver(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:      []byte("stmt"),
+		columns: []string{"a"},
+	})
+
+	observer := &recordingPrepareObserver{}
+	cluster := testCluster(protoVersion4, srv.Address)
+	cluster.NumConns = 1
+	cluster.PrepareObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const stmt = "select * from ks.tbl"
+	// the second execution is cached and not observed
+	for i := 0; i < 2; i++ {
+		if err := db.Query(stmt).Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prepares := observer.observed()
+	if len(prepares) != 1 {
+		t.Fatalf("expected 1 observed prepare, got %d", len(prepares))
+	}
+	p := prepares[0]
+	if p.Statement != stmt || p.Host == nil || p.Reprepare || p.Err != nil || p.End.Before(p.Start) {
+		t.Fatalf("unexpected observed prepare %+v", p)
+	}
+
+	// the host forgot the statement, it is prepared again
+	atomic.StoreInt32(&srv.unprepareExecutes, 1)
+	if err := db.Query(stmt).Exec(); err != nil {
+		t.Fatal(err)
+	}
+	prepares = observer.observed()
+	if len(prepares) != 2 {
+		t.Fatalf("expected 2 observed prepares, got %d", len(prepares))
+	}
+	if p := prepares[1]; !p.Reprepare || p.Err != nil {
+		t.Fatalf("expected a successful re-preparation, got %+v", p)
+	}
+
+	// a failed prepare is observed with its error
+	srv.setPrepared(nil)
+	if err := db.Query("select a from ks.tbl").Exec(); err == nil {
+		t.Fatal("expected the prepare to fail")
+	}
+	prepares = observer.observed()
+	if len(prepares) != 3 || prepares[2].Err == nil {
+		t.Fatalf("expected the failed prepare to be observed, got %+v", prepares)
+	}
+}
+
+type blockingPrepareObserver struct {
+	release  chan struct{}
+	observed chan ObservedPrepare
+}
+
+func (o *blockingPrepareObserver) ObservePrepare(p ObservedPrepare) {
+	<-o.release
+	o.observed <- p
+}
+
+func TestPrepareObserverAfterPrepare(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:      []byte("stmt"),
+		columns: []string{"a"},
+	})
+
+	observer := &blockingPrepareObserver{release: make(chan struct{}), observed: make(chan ObservedPrepare, 1)}
+	cluster := testCluster(protoVersion4, srv.Address)
+	cluster.NumConns = 1
+	cluster.PrepareObserver = observer
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the query is executed while the observer is still blocked
+	errs := make(chan error, 1)
+	go func() {
+		errs <- db.Query("select * from ks.tbl").Exec()
+	}()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		close(observer.release)
+		t.Fatal("expected the query to be executed before the prepare is observed")
+	}
+	executed := time.Now()
+	close(observer.release)
+
+	select {
+	case p := <-observer.observed:
+		if p.End.Before(p.Start) || p.End.After(executed) {
+			t.Fatalf("expected the prepare to end before the execution, got %+v", p)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the prepare to be observed")
+	}
+}
+
+func TestUnpreparedStatementsBounded(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 2, PrepareObserver: &recordingPrepareObserver{}})
+	done := make(chan struct{})
+	close(done)
+	for _, key := range []string{"a", "b", "c"} {
+		p.add(key, &inflightPrepare{done: done, preparedStatment: &preparedStatment{id: []byte(key)}})
+		p.evictPreparedID(key, []byte(key))
+	}
+	if n := p.unprepared.Len(); n != 2 {
+		t.Fatalf("expected 2 unprepared statements to be tracked, got %d", n)
+	}
+	if p.reprepared("a") || !p.reprepared("c") || p.reprepared("c") {
+		t.Fatal("expected the oldest unprepared statement to be forgotten")
+	}
+}
+
+// expectedShard computes the shard of token with the biased-token-round-robin
+// algorithm of Scylla, ignoring 12 most significant bits.
+func expectedShard(token int64, shards int) int {
+	biased := new(big.Int).Add(big.NewInt(token), new(big.Int).Lsh(big.NewInt(1), 63))
+	biased.Lsh(biased, 12)
+	biased.Mod(biased, new(big.Int).Lsh(big.NewInt(1), 64))
+	biased.Mul(biased, big.NewInt(int64(shards)))
+	return int(biased.Rsh(biased, 64).Int64())
+}
+
+func TestScyllaShardAwarePick(t *testing.T) {
+	servers := make(map[string]*TestServer)
+	var addrs []string
+	for _, shards := range []int32{2, 3} {
+		srv := NewTestServer(t, protoVersion4, context.Background())
+		defer srv.Stop()
+		srv.scyllaShards = shards
+		servers[srv.Address] = srv
+		addrs = append(addrs, srv.Address)
+	}
+
+	cluster := testCluster(protoVersion4, addrs...)
+	cluster.NumConns = 3
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts := db.ring.allHosts()
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+	for _, host := range hosts {
+		srv := servers[net.JoinHostPort(host.ConnectAddress().String(), strconv.Itoa(host.Port()))]
+		shards := int(srv.scyllaShards)
+		if n := host.ScyllaShardCount(); n != shards {
+			t.Fatalf("expected host %s to have %d shards, got %d", host.ConnectAddress(), shards, n)
+		}
+
+		pool, ok := db.pool.getPool(host)
+		if !ok {
+			t.Fatalf("no pool for host %s", host.ConnectAddress())
+		}
+		deadline := time.Now().Add(5 * time.Second)
+		for pool.Size() < cluster.NumConns && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for i := 0; i < 50; i++ {
+			key := []byte(strconv.Itoa(i))
+			token := int64(murmur3Partitioner{}.Hash(key).(murmur3Token))
+			conn := pool.pickFor(db.Query("select * from ks.tbl").RoutingKey(key))
+			if conn == nil {
+				t.Fatal("no connection picked")
+			}
+			if shard := expectedShard(token, shards); conn.sharding.shard != shard {
+				t.Fatalf("expected key %q to be sent to shard %d of %d on host %s, got shard %d",
+					key, shard, shards, host.ConnectAddress(), conn.sharding.shard)
+			}
+		}
+
+		// the routing key of a query is not computed to pick its shard, that
+		// would prepare it with host selection policies which aren't token aware
+		prepares := db.PreparesSent()
+		if conn := pool.pickFor(db.Query("select * from ks.tbl where a = ?", 1)); conn == nil {
+			t.Fatal("no connection picked")
+		}
+		if n := db.PreparesSent(); n != prepares {
+			t.Fatalf("expected picking a connection not to prepare the query, got %d prepares", n-prepares)
+		}
+
+		// the host is resized, the number of shards is read again when connecting
+		atomic.StoreInt32(&srv.scyllaShards, int32(shards+2))
+		conn, err := db.connect(context.Background(), host, connErrorHandlerFn(func(*Conn, error, bool) {}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		if n := host.ScyllaShardCount(); n != shards+2 {
+			t.Fatalf("expected host %s to have %d shards after reconnecting, got %d", host.ConnectAddress(), shards+2, n)
+		}
+	}
+}
+
+func TestPreparedStatementNormalization(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:      []byte("stmt"),
+		columns: []string{"a"},
+	})
+
+	stmts := []string{
+		"SELECT * FROM ks.tbl WHERE a = 'A'",
+		"select *\n\tfrom ks.tbl /* comment */ where a = 'A'",
+		"SELECT * FROM ks.tbl WHERE a = 'a'",
+	}
+	for _, disable := range []bool{false, true} {
+		cluster := testCluster(protoVersion4, srv.Address)
+		cluster.NumConns = 1
+		cluster.DisablePreparedStatementNormalization = disable
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, stmt := range stmts {
+			if err := db.Query(stmt).Exec(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		expected := uint64(2)
+		if disable {
+			expected = 3
+		}
+		if n := db.PreparesSent(); n != expected {
+			t.Errorf("expected %d prepares with normalization disabled %v, got %d", expected, disable, n)
+		}
+		db.Close()
+	}
+}
+
+func TestPreparedResultMetadataChanged(t *testing.T) {
+	srv := NewTestServer(t, protoVersion5, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:         []byte("stmt"),
+		metadataID: []byte("v1"),
+		columns:    []string{"a"},
+	})
+
+	cluster := testCluster(protoVersion5, srv.Address)
+	cluster.NumConns = 1
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const stmt = "select * from ks.tbl"
+	scan := func() map[string]interface{} {
+		t.Helper()
+		row := make(map[string]interface{})
+		if err := db.Query(stmt).MapScan(row); err != nil {
+			t.Fatal(err)
+		}
+		return row
+	}
+
+	if row := scan(); len(row) != 1 || row["a"] != 1 {
+		t.Fatalf("unexpected row %v", row)
+	}
+
+	// a column is added to the table, the statement id does not change but the
+	// result metadata id does.
+	srv.setPrepared(&testPreparedStatement{
+		id:         []byte("stmt"),
+		metadataID: []byte("v2"),
+		columns:    []string{"a", "b"},
+	})
+
+	for i := 0; i < 2; i++ {
+		if row := scan(); len(row) != 2 || row["a"] != 1 || row["b"] != 2 {
+			t.Fatalf("unexpected row %v", row)
+		}
+	}
+
+	host := db.ring.allHosts()[0]
+	flight, ok := db.stmtsLRU.lru.Get(db.stmtsLRU.keyFor(host.HostID(), "", stmt))
+	if !ok {
+		t.Fatal("expected the statement to be cached")
+	}
+	info := flight.(*inflightPrepare).preparedStatment
+	if string(info.resultMetadataID) != "v2" || len(info.response.columns) != 2 {
+		t.Fatalf("expected the cached result metadata to be updated, got id %q with %d columns",
+			info.resultMetadataID, len(info.response.columns))
+	}
+
+	// the host forgot the statement after the update, it is prepared again
+	sent := db.PreparesSent()
+	atomic.StoreInt32(&srv.unprepareExecutes, 1)
+	if row := scan(); len(row) != 2 {
+		t.Fatalf("unexpected row %v", row)
+	}
+	if n := db.PreparesSent() - sent; n != 1 {
+		t.Fatalf("expected the statement to be prepared again once, got %d prepares", n)
+	}
+}
+
+func TestUpdateResultMetadataKeepsStatement(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10})
+	done := make(chan struct{})
+	close(done)
+	prepared := &preparedStatment{
+		id:               []byte("stmt"),
+		keyspace:         "ks",
+		resultMetadataID: []byte("v1"),
+		request:          preparedMetadata{keyspace: "ks", table: "tbl"},
+	}
+	p.add("key", &inflightPrepare{done: done, preparedStatment: prepared})
+
+	p.updateResultMetadata("key", []byte("stmt"), resultMetadata{newMetadataID: []byte("v2"), colCount: 2})
+
+	val, _ := p.lru.Get("key")
+	updated := val.(*inflightPrepare).preparedStatment
+	if updated == prepared {
+		t.Fatal("expected the cached statement to be replaced")
+	}
+	if string(updated.id) != "stmt" || updated.keyspace != "ks" || updated.request.table != "tbl" {
+		t.Fatalf("expected the statement to be kept, got %+v", updated)
+	}
+	if string(updated.resultMetadataID) != "v2" || updated.response.colCount != 2 || updated.response.newMetadataID != nil {
+		t.Fatalf("expected the result metadata to be updated, got %+v", updated)
+	}
+}
+
+func TestUnpreparedRepreparedOnce(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:      []byte("stmt"),
+		columns: []string{"a"},
+	})
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the host keeps reporting the statement as unprepared
+	atomic.StoreInt32(&srv.unprepareExecutes, 10)
+	err = db.Query("select * from ks.tbl").Exec()
+	if _, ok := err.(*RequestErrUnprepared); !ok {
+		t.Fatalf("expected the unprepared error to be returned, got %v", err)
+	}
+	if n := atomic.LoadInt32(&srv.unprepareExecutes); n != 8 {
+		t.Fatalf("expected the statement to be executed twice, got %d executions", 10-n)
+	}
+}
+
+func TestMaxQueueTimePerConn(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.WriteCoalesceWaitTime = 0
+	cluster.MaxQueueTimePerConn = 20 * time.Millisecond
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	pool, ok := db.pool.getPool(db.ring.allHosts()[0])
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	w := pool.Pick().w.(*deadlineContextWriter)
+
+	// hold the write semaphore as if another write was stuck on the socket
+	w.semaphore <- struct{}{}
+	if err := db.Query("void").Exec(); err != ErrConnectionBusy {
+		t.Fatalf("expected %v, got %v", ErrConnectionBusy, err)
+	}
+	<-w.semaphore
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObservedQueryTiming(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	ctx := context.WithValue(context.Background(), observerCtxKey{}, "parent")
+	observer := &ctxQueryObserver{}
+	if err := db.Query("void").WithContext(ctx).Consistency(LocalOne).Observer(observer).Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(observer.observed) != 1 {
+		t.Fatalf("expected 1 observed query, got %d", len(observer.observed))
+	}
+	q := observer.observed[0]
+	if q.Sent.IsZero() || q.Sent.Before(q.Start) || q.End.Before(q.Sent) {
+		t.Fatalf("expected the request to be sent between %v and %v, got %v", q.Start, q.End, q.Sent)
+	}
+	if q.Consistency != LocalOne || q.Page != 0 {
+		t.Fatalf("expected consistency %v on page 0, got %v on page %d", LocalOne, q.Consistency, q.Page)
+	}
+	if observer.values[0] != "parent" {
+		t.Fatalf("expected the query context to be passed to the observer, got value %v", observer.values[0])
+	}
+}
+
+type observerCtxKey struct{}
+
+// ctxQueryObserver records the observed queries and the observerCtxKey value
+// of their context.
+type ctxQueryObserver struct {
+	observed observedQueries
+	values   []interface{}
+}
+
+func (o *ctxQueryObserver) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	o.observed.ObserveQuery(ctx, q)
+	o.values = append(o.values, ctx.Value(observerCtxKey{}))
+}
+
+func NewTestServerWithAddress(addr string, t testing.TB, protocol uint8, ctx context.Context) *TestServer {
+	return newTestServerOpts{
+		addr:     addr,
+		protocol: protocol,
+	}.newServer(t, ctx)
+}
+
+type newTestServerOpts struct {
+	addr             string
+	protocol         uint8
+	recvHook         func(*framer)
+	rateLimitErrCode int
+}
+
+func (nts newTestServerOpts) newServer(t testing.TB, ctx context.Context) *TestServer {
+	laddr, err := net.ResolveTCPAddr("tcp", nts.addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listen, err := net.ListenTCP("tcp", laddr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := 8
+	if nts.protocol > protoVersion2 {
+		headerSize = 9
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	srv := &TestServer{
+		Address:    listen.Addr().String(),
+		listen:     listen,
+		t:          t,
+		protocol:   nts.protocol,
+		headerSize: headerSize,
+		ctx:        ctx,
+		cancel:     cancel,
+		unblock:    make(chan struct{}),
+
+		onRecv:           nts.recvHook,
+		rateLimitErrCode: nts.rateLimitErrCode,
+	}
+
+	go srv.closeWatch()
+	go srv.serve()
+
+	return srv
+}
+
+func NewTestServer(t testing.TB, protocol uint8, ctx context.Context) *TestServer {
+	return NewTestServerWithAddress("127.0.0.1:0", t, protocol, ctx)
+}
+
+func NewSSLTestServer(t testing.TB, protocol uint8, ctx context.Context) *TestServer {
+	pem, err := ioutil.ReadFile("testdata/pki/ca.crt")
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(pem) {
+		t.Fatalf("Failed parsing or appending certs")
+	}
+	mycert, err := tls.LoadX509KeyPair("testdata/pki/cassandra.crt", "testdata/pki/cassandra.key")
+	if err != nil {
+		t.Fatalf("could not load cert")
+	}
+	config := &tls.Config{
+		Certificates: []tls.Certificate{mycert},
+		RootCAs:      certPool,
+	}
+	listen, err := tls.Listen("tcp", "127.0.0.1:0", config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	headerSize := 8
+	if protocol > protoVersion2 {
+		headerSize = 9
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	srv := &TestServer{
+		Address:    listen.Addr().String(),
+		listen:     listen,
+		t:          t,
+		protocol:   protocol,
+		headerSize: headerSize,
+		ctx:        ctx,
+		cancel:     cancel,
+		unblock:    make(chan struct{}),
+	}
+
+	go srv.closeWatch()
+	go srv.serve()
+	return srv
+}
+
+type TestServer struct {
+	Address          string
+	TimeoutOnStartup int32
+	// IgnoreOptions is the number of following OPTIONS requests which are not
+	// answered.
+	IgnoreOptions int32
+	// scyllaShards, if set, is the number of shards advertised by the server,
+	// the connections are assigned to the shards in turn.
+	scyllaShards int32
+	// connShards are the shards of the connections.
+	connShards map[net.Conn]int
+	// unprepareExecutes is the number of following EXECUTE requests answered
+	// with an Unprepared error.
+	unprepareExecutes int32
+	// failSelects, if set, answers SELECT queries with an error.
+	failSelects int32
+	// rateLimitErrCode, if set, is advertised for the SCYLLA_RATE_LIMIT_ERROR
+	// extension and returned by "ratelimit" queries.
+	rateLimitErrCode int
+	t                testing.TB
+	listen           net.Listener
+	nKillReq         int64
+	// nDropReq is the number of "drop" queries received, their connection is
+	// closed without answering.
+	nDropReq int64
+
+	protocol   byte
+	headerSize int
+	ctx        context.Context
+	cancel     context.CancelFunc
+
+	mu     sync.Mutex
+	closed bool
+
+	// onRecv is a hook point for tests, called in receive loop.
+	onRecv func(*framer)
+
+	// "block" queries are not answered until unblock is closed.
+	unblock chan struct{}
+
+	// prepared is the statement served in response to any PREPARE and EXECUTE
+	// request, if nil they are not supported.
+	prepared *testPreparedStatement
+
+	// payloads are the custom payloads of the requests received.
+	payloads []map[string][]byte
+	// statements are the statements of the QUERY requests received.
+	statements []string
+
+	// tables are the rows served in response to "SELECT * FROM <table>"
+	// queries, keyed by table.
+	tables map[string]*testRows
+}
+
+// testRows are the rows of a table served by the test server.
+type testRows struct {
+	columns []ColumnInfo
+	rows    [][]interface{}
+}
+
+func (r *testRows) write(t testing.TB, f *framer) {
+	f.writeInt(resultKindRows)
+	f.writeInt(int32(flagGlobalTableSpec))
+	f.writeInt(int32(len(r.columns)))
+	f.writeString("ks")
+	f.writeString("tbl")
+	for _, col := range r.columns {
+		f.writeString(col.Name)
+		f.writeShort(uint16(col.TypeInfo.Type()))
+		if coll, ok := col.TypeInfo.(CollectionType); ok {
+			f.writeShort(uint16(coll.Elem.Type()))
+		}
+	}
+	f.writeInt(int32(len(r.rows)))
+	for _, row := range r.rows {
+		for i, col := range r.columns {
+			b, err := Marshal(col.TypeInfo, row[i])
+			if err != nil {
+				t.Errorf("test server: marshal %s: %v", col.Name, err)
+			}
+			f.writeBytes(b)
+		}
+	}
+}
+
+// testPreparedStatement is a prepared statement with int bind markers which
+// returns a single row of int columns.
+type testPreparedStatement struct {
+	id         []byte
+	metadataID []byte
+	columns    []string
+	// markers are the names of the bind markers.
+	markers []string
+	// pkeyMarkers are the indexes of the partition key markers, proto v4+.
+	pkeyMarkers []int
+}
+
+// decrementIfPositive decrements n and reports whether it was positive.
+func decrementIfPositive(n *int32) bool {
+	for {
+		v := atomic.LoadInt32(n)
+		if v <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(n, v, v-1) {
+			return true
+		}
+	}
+}
+
+func (srv *TestServer) ignoreOption() bool {
+	for {
+		n := atomic.LoadInt32(&srv.IgnoreOptions)
+		if n <= 0 {
+			return false
+		}
+		if atomic.CompareAndSwapInt32(&srv.IgnoreOptions, n, n-1) {
+			return true
+		}
+	}
+}
+
+func (srv *TestServer) setTable(table string, rows *testRows) {
+	srv.mu.Lock()
+	if srv.tables == nil {
+		srv.tables = make(map[string]*testRows)
+	}
+	srv.tables[table] = rows
+	srv.mu.Unlock()
+}
+
+// tableRows returns the rows served for query, if it selects a table set by
+// setTable.
+func (srv *TestServer) tableRows(query string) *testRows {
+	const prefix = "SELECT * FROM "
+	if !strings.HasPrefix(query, prefix) {
+		return nil
+	}
+	table := strings.TrimPrefix(query, prefix)
+	if n := strings.Index(table, " "); n > 0 {
+		table = table[:n]
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.tables[table]
+}
+
+func (srv *TestServer) setPrepared(stmt *testPreparedStatement) {
+	srv.mu.Lock()
+	srv.prepared = stmt
+	srv.mu.Unlock()
+}
+
+func (stmt *testPreparedStatement) writeResultMetadata(f *framer, flags int) {
+	f.writeInt(int32(flags | flagGlobalTableSpec))
+	f.writeInt(int32(len(stmt.columns)))
+	if flags&flagMetaDataChanged == flagMetaDataChanged {
+		f.writeShortBytes(stmt.metadataID)
+	}
+	if flags&flagNoMetaData == flagNoMetaData {
+		return
+	}
+	f.writeString("ks")
+	f.writeString("tbl")
+	for _, col := range stmt.columns {
+		f.writeString(col)
+		f.writeShort(uint16(TypeInt))
+	}
+}
+
+func (srv *TestServer) closeWatch() {
+	<-srv.ctx.Done()
+
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+
+	srv.closeLocked()
+}
+
+func (srv *TestServer) serve() {
+	defer srv.listen.Close()
+	for !srv.isClosed() {
+		conn, err := srv.listen.Accept()
+		if err != nil {
+			break
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+			for !srv.isClosed() {
+				framer, err := srv.readFrame(conn)
+				if err != nil {
+					if err == io.EOF || err == errTestServerProtocolVersion {
+						return
+					}
+					srv.errorLocked(err)
+					return
+				}
+
+				if srv.onRecv != nil {
+					srv.onRecv(framer)
+				}
+
+				go srv.process(conn, framer)
+			}
+		}(conn)
+	}
+}
+
+func (srv *TestServer) isClosed() bool {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	return srv.closed
+}
+
+func (srv *TestServer) closeLocked() {
+	if srv.closed {
+		return
+	}
+
+	srv.closed = true
+
+	srv.listen.Close()
+	srv.cancel()
+}
+
+func (srv *TestServer) Stop() {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	srv.closeLocked()
+}
+
+func (srv *TestServer) errorLocked(err interface{}) {
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.closed {
+		return
+	}
+	srv.t.Error(err)
+}
+
+func (srv *TestServer) process(conn net.Conn, reqFrame *framer) {
+	head := reqFrame.header
+	if head == nil {
+		srv.errorLocked("process frame with a nil header")
+		return
+	}
+	respFrame := newFramer(nil, reqFrame.proto)
+
+	if head.flags&flagCustomPayload == flagCustomPayload {
+		payload := reqFrame.readBytesMap()
+		srv.mu.Lock()
+		srv.payloads = append(srv.payloads, payload)
+		srv.mu.Unlock()
+	}
+
+	switch head.op {
+	case opStartup:
+		if atomic.LoadInt32(&srv.TimeoutOnStartup) > 0 {
+			// Do not respond to startup command
+			// wait until we get a cancel signal
+			select {
+			case <-srv.ctx.Done():
+				return
+			}
+		}
+		respFrame.writeHeader(0, opReady, head.stream)
+	case opOptions:
+		if srv.ignoreOption() {
+			return
+		}
+		respFrame.writeHeader(0, opSupported, head.stream)
+		if shards := int(atomic.LoadInt32(&srv.scyllaShards)); shards > 0 {
+			srv.mu.Lock()
+			if srv.connShards == nil {
+				srv.connShards = make(map[net.Conn]int)
+			}
+			shard, ok := srv.connShards[conn]
+			if !ok {
+				shard = len(srv.connShards) % shards
+				srv.connShards[conn] = shard
+			}
+			srv.mu.Unlock()
+			options := [][2]string{
+				{"SCYLLA_SHARD", strconv.Itoa(shard)},
+				{"SCYLLA_NR_SHARDS", strconv.Itoa(shards)},
+				{"SCYLLA_PARTITIONER", scyllaMurmur3Partitioner},
+				{"SCYLLA_SHARDING_ALGORITHM", scyllaShardingAlgorithm},
+				{"SCYLLA_SHARDING_IGNORE_MSB", "12"},
+			}
+			respFrame.writeShort(uint16(len(options)))
+			for _, option := range options {
+				respFrame.writeString(option[0])
+				respFrame.writeStringList([]string{option[1]})
+			}
+		} else if srv.rateLimitErrCode != 0 {
+			respFrame.writeShort(1)
+			respFrame.writeString(scyllaRateLimitErrorExt)
+			respFrame.writeStringList([]string{fmt.Sprintf("ERROR_CODE=%d", srv.rateLimitErrCode)})
+		} else {
+			respFrame.writeShort(0)
+		}
+	case opQuery:
+		query := reqFrame.readLongString()
+		srv.mu.Lock()
+		srv.statements = append(srv.statements, query)
+		srv.mu.Unlock()
+		if rows := srv.tableRows(query); rows != nil {
+			respFrame.writeHeader(0, opResult, head.stream)
+			rows.write(srv.t, respFrame)
+			break
+		}
+		first := query
+		if n := strings.Index(query, " "); n > 0 {
+			first = first[:n]
+		}
+		switch strings.ToLower(first) {
+		case "kill":
+			atomic.AddInt64(&srv.nKillReq, 1)
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(0x1001)
+			respFrame.writeString("query killed")
+		case "drop":
+			// the client closes the connection once it reads EOF
+			atomic.AddInt64(&srv.nDropReq, 1)
+			conn.(*net.TCPConn).CloseWrite()
+			return
+		case "use":
+			respFrame.writeHeader(0, opResult, head.stream)
+			respFrame.writeInt(resultKindKeyspace)
+			respFrame.writeString(strings.TrimSpace(query[3:]))
+		case "void":
+			respFrame.writeHeader(0, opResult, head.stream)
+			respFrame.writeInt(resultKindVoid)
+		case "select":
+			if atomic.LoadInt32(&srv.failSelects) == 0 {
+				respFrame.writeHeader(0, opResult, head.stream)
+				respFrame.writeInt(resultKindVoid)
+				break
+			}
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(ErrCodeServer)
+			respFrame.writeString("select failed")
+		case "ratelimit":
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(int32(srv.rateLimitErrCode))
+			respFrame.writeString("per-partition rate limit reached")
+			respFrame.writeByte(byte(RateLimitOpWrite))
+			respFrame.writeByte(1)
+		case "timeout":
+			<-srv.ctx.Done()
+			return
+		case "block":
+			select {
+			case <-srv.ctx.Done():
+				return
+			case <-srv.unblock:
+			}
+			respFrame.writeHeader(0, opResult, head.stream)
+			respFrame.writeInt(resultKindVoid)
+		case "slow":
+			go func() {
+				respFrame.writeHeader(0, opResult, head.stream)
+				respFrame.writeInt(resultKindVoid)
+				respFrame.buf[0] = srv.protocol | 0x80
+				select {
+				case <-srv.ctx.Done():
+					return
+				case <-time.After(50 * time.Millisecond):
+					respFrame.finish()
+					respFrame.writeTo(conn)
+				}
+			}()
+			return
+		case "speculative":
+			atomic.AddInt64(&srv.nKillReq, 1)
+			if atomic.LoadInt64(&srv.nKillReq) > 3 {
+				respFrame.writeHeader(0, opResult, head.stream)
+				respFrame.writeInt(resultKindVoid)
+				respFrame.writeString("speculative query success on the node " + srv.Address)
+			} else {
+				respFrame.writeHeader(0, opError, head.stream)
+				respFrame.writeInt(0x1001)
+				respFrame.writeString("speculative error")
+				rand.Seed(time.Now().UnixNano())
+				<-time.After(time.Millisecond * 120)
+			}
+		default:
+			respFrame.writeHeader(0, opResult, head.stream)
+			respFrame.writeInt(resultKindVoid)
+		}
+	case opPrepare, opExecute:
+		srv.mu.Lock()
+		stmt := srv.prepared
+		srv.mu.Unlock()
+		if stmt == nil {
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(0)
+			respFrame.writeString("not supported")
+			break
+		}
+		if head.op == opExecute && decrementIfPositive(&srv.unprepareExecutes) {
+			respFrame.writeHeader(0, opError, head.stream)
+			respFrame.writeInt(ErrCodeUnprepared)
+			respFrame.writeString("unprepared")
+			respFrame.writeShortBytes(stmt.id)
+			break
+		}
+
+		respFrame.writeHeader(0, opResult, head.stream)
+		if head.op == opPrepare {
+			respFrame.writeInt(resultKindPrepared)
+			respFrame.writeShortBytes(stmt.id)
+			if reqFrame.proto > protoVersion4 {
+				respFrame.writeShortBytes(stmt.metadataID)
+			}
+			respFrame.writeInt(int32(flagGlobalTableSpec))
+			respFrame.writeInt(int32(len(stmt.markers)))
+			if reqFrame.proto >= protoVersion4 {
+				respFrame.writeInt(int32(len(stmt.pkeyMarkers)))
+				for _, idx := range stmt.pkeyMarkers {
+					respFrame.writeShort(uint16(idx))
+				}
+			}
+			respFrame.writeString("ks")
+			respFrame.writeString("tbl")
+			for _, marker := range stmt.markers {
+				respFrame.writeString(marker)
+				respFrame.writeShort(uint16(TypeInt))
+			}
+			stmt.writeResultMetadata(respFrame, 0)
+			break
+		}
+
+		reqFrame.readShortBytes()
+		var metadataID []byte
+		if reqFrame.proto > protoVersion4 {
+			metadataID = reqFrame.readShortBytes()
+		}
+		reqFrame.readConsistency()
+		var flags int
+		if reqFrame.proto > protoVersion4 {
+			flags = reqFrame.readInt()
+		} else {
+			flags = int(reqFrame.readByte())
+		}
+
+		var metaFlags int
+		if !bytes.Equal(metadataID, stmt.metadataID) {
+			metaFlags = flagMetaDataChanged
+		} else if flags&int(flagSkipMetaData) != 0 {
+			metaFlags = flagNoMetaData
+		}
+		respFrame.writeInt(resultKindRows)
+		stmt.writeResultMetadata(respFrame, metaFlags)
+		respFrame.writeInt(1)
+		for i := range stmt.columns {
+			respFrame.writeBytes(encInt(int32(i + 1)))
+		}
+	case opError:
+		respFrame.writeHeader(0, opError, head.stream)
+		respFrame.buf = append(respFrame.buf, reqFrame.buf...)
+	default:
+		respFrame.writeHeader(0, opError, head.stream)
+		respFrame.writeInt(0)
+		respFrame.writeString("not supported")
+	}
+
+	respFrame.buf[0] = srv.protocol | 0x80
+
+	if err := respFrame.finish(); err != nil {
+		srv.errorLocked(err)
+	}
+
+	if err := respFrame.writeTo(conn); err != nil {
+		srv.errorLocked(err)
+	}
+}
+
+var errTestServerProtocolVersion = errors.New("test server: unsupported protocol version")
+
+func (srv *TestServer) readFrame(conn net.Conn) (*framer, error) {
+	buf := make([]byte, maxFrameHeaderSize)
+	head, err := readHeader(conn, buf)
+	if err != nil {
+		return nil, err
+	}
+	framer := newFramer(nil, srv.protocol)
+
+	err = framer.readFrame(conn, &head)
+	if err != nil {
+		return nil, err
+	}
+
+	// should be a request frame
+	if head.version.response() {
+		return nil, fmt.Errorf("expected to read a request frame got version: %v", head.version)
+	} else if head.version.version() != srv.protocol {
+		// reply the way Cassandra does, so that clients can negotiate down
+		respFrame := newFramer(nil, srv.protocol)
+		respFrame.writeHeader(0, opError, 0)
+		respFrame.writeInt(ErrCodeProtocol)
+		respFrame.writeString(fmt.Sprintf("Invalid or unsupported protocol version (%d); the lowest supported version is %d and the greatest is %d",
+			head.version.version(), srv.protocol, srv.protocol))
+		respFrame.buf[0] = srv.protocol | 0x80
+		respFrame.finish()
+		respFrame.writeTo(conn)
+		return nil, errTestServerProtocolVersion
+	}
+
+	return framer, nil
+}
+
+// tunnelAddr is the address of a tunnel which doesn't preserve the address of
+// the host.
+type tunnelAddr string
+
+func (a tunnelAddr) Network() string { return "tunnel" }
+func (a tunnelAddr) String() string  { return string(a) }
+
+type tunnelConn struct {
+	net.Conn
+}
+
+func (c tunnelConn) RemoteAddr() net.Addr {
+	return tunnelAddr("tunnel:1")
+}
+
+type tunnelHostDialer struct {
+	addr string
+}
+
+func (d *tunnelHostDialer) DialHost(ctx context.Context, host *HostInfo) (*DialedHost, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", d.addr)
+	if err != nil {
+		return nil, err
+	}
+	return &DialedHost{
+		Conn:       tunnelConn{conn},
+		RemoteAddr: &net.TCPAddr{IP: host.ConnectAddress(), Port: host.Port()},
+	}, nil
+}
+
+func TestHostDialerRemoteAddr(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	// the cluster only knows the host by an address which is not reachable
+	// directly, every connection goes through the tunnel
+	cluster := testCluster(defaultProto, "127.0.0.1:9999")
+	cluster.HostDialer = &tunnelHostDialer{addr: srv.Address}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := db.getConn()
+	if conn == nil {
+		t.Fatal("no connection available")
+	}
+	if addr := conn.Address(); addr != "127.0.0.1:9999" {
+		t.Fatalf("expected the connection to be reported against the host address, got %q", addr)
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.AutoPrepareThreshold = 100
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// rows with values are prepared, which the test server does not support
+	const stmt = "insert into tbl (id) values (?)"
+	rows := [][]interface{}{{}, {1}, {}, {}, {2}}
+	res, err := db.BulkInsert(context.Background(), stmt, rows, BulkOptions{Concurrency: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Succeeded != 3 || res.Failed != 2 {
+		t.Fatalf("expected 3 rows inserted and 2 failed, got %d and %d", res.Succeeded, res.Failed)
+	}
+	if len(res.Errors) != 2 || res.Errors[0].Index != 1 || res.Errors[1].Index != 4 {
+		t.Fatalf("expected rows 1 and 4 to fail, got %v", res.Errors)
+	}
+	if res.Errors[1].Values[0] != 2 || res.Errors[1].Err == nil {
+		t.Fatalf("expected the values and error of the failed row, got %v", res.Errors[1])
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	res, err = db.BulkInsert(ctx, stmt, rows[:1], BulkOptions{})
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if res.Failed != 1 || res.Errors[0].Err != context.Canceled {
+		t.Fatalf("expected the row to fail with %v, got %v", context.Canceled, res.Errors)
+	}
+
+	// the context done once every row was inserted is not an error
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	db.queryObserver = cancelQueryObserver(cancel)
+	res, err = db.BulkInsert(ctx, stmt, rows[:1], BulkOptions{})
+	if err != nil {
+		t.Fatalf("expected no error once every row was inserted, got %v", err)
+	}
+	if res.Succeeded != 1 || ctx.Err() == nil {
+		t.Fatalf("expected the row to be inserted before the context was done, got %d", res.Succeeded)
+	}
+}
+
+// cancelQueryObserver cancels a context once a query was executed.
+type cancelQueryObserver context.CancelFunc
+
+func (o cancelQueryObserver) ObserveQuery(context.Context, ObservedQuery) {
+	o()
+}
+
+func TestSessionScatterRead(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, protoVersion4, ctx)
+	defer srv.Stop()
+	// every partition has the row id=1, val=2
+	srv.setPrepared(&testPreparedStatement{
+		id:          []byte("stmt"),
+		columns:     []string{"id", "val"},
+		markers:     []string{"bucket", "day"},
+		pkeyMarkers: []int{0, 1},
+	})
+
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const stmt = "SELECT id, val FROM tbl WHERE bucket = ? AND day = ?"
+	key := func(bucket, day int32) []byte {
+		k, err := createRoutingKey(&routingKeyInfo{
+			indexes: []int{0, 1},
+			types:   []TypeInfo{NativeType{proto: protoVersion4, typ: TypeInt}, NativeType{proto: protoVersion4, typ: TypeInt}},
+		}, []interface{}{bucket, day})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+	keys := [][]byte{key(1, 1), {0xff}, key(1, 2), key(2, 1)}
+
+	iter, err := db.ScatterRead(ctx, stmt, keys, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iter.NumRows() != 3 {
+		t.Fatalf("expected a row per partition, got %d", iter.NumRows())
+	}
+	row := make(map[string]interface{})
+	if !iter.MapScan(row) || row["id"] != 1 || row["val"] != 2 {
+		t.Fatalf("expected the row id=1 val=2, got %v", row)
+	}
+	if errs := iter.Errors(); len(errs) != 1 || errs[0].Index != 1 || iter.Close() != errs[0] {
+		t.Fatalf("expected the malformed routing key to fail, got %v", errs)
+	}
+
+	iter, err = db.ScatterRead(ctx, stmt, keys, func(row map[string]interface{}) string {
+		return fmt.Sprint(row["id"])
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iter.NumRows() != 1 {
+		t.Fatalf("expected the rows to be deduplicated, got %d", iter.NumRows())
+	}
+
+	canceled, cancelRead := context.WithCancel(ctx)
+	cancelRead()
+	iter, err = db.ScatterRead(canceled, stmt, keys[:1], nil)
+	if err != context.Canceled {
+		t.Fatalf("expected %v, got %v", context.Canceled, err)
+	}
+	if errs := iter.Errors(); len(errs) != 1 || !errors.Is(errs[0], context.Canceled) {
+		t.Fatalf("expected the partition to fail with %v, got %v", context.Canceled, errs)
+	}
+}
+
+func TestQueryRequestID(t *testing.T) {
+	var nodes []*TestServer
+	for _, ip := range []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"} {
+		srv := NewTestServerWithAddress(ip+":0", t, protoVersion4, context.Background())
+		defer srv.Stop()
+		nodes = append(nodes, srv)
+	}
+
+	db, err := newTestSession(protoVersion4, nodes[0].Address, nodes[1].Address, nodes[2].Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	custom := map[string][]byte{"tenant": []byte("a")}
+	qry := db.Query("kill").CustomPayload(custom).RequestID("req-1").RetryPolicy(&SimpleRetryPolicy{NumRetries: 2})
+	if err := qry.Exec(); err == nil {
+		t.Fatal("expected the query to fail")
+	}
+	if len(custom) != 1 {
+		t.Fatalf("expected the custom payload of the query to be left as is, got %v", custom)
+	}
+
+	var payloads []map[string][]byte
+	for _, srv := range nodes {
+		srv.mu.Lock()
+		payloads = append(payloads, srv.payloads...)
+		srv.mu.Unlock()
+	}
+	if len(payloads) != 3 {
+		t.Fatalf("expected the request ID to be sent with 3 attempts, got %d payloads", len(payloads))
+	}
+	for i, payload := range payloads {
+		if string(payload[RequestIDPayloadKey]) != "req-1" || string(payload["tenant"]) != "a" {
+			t.Fatalf("unexpected payload of attempt %d: %v", i, payload)
+		}
+	}
+}
+
+func TestQueryServerTimeout(t *testing.T) {
+	const stmt = "UPDATE t SET a = 1 WHERE id = 1"
+	exec := func(srv *TestServer) (string, string) {
+		t.Helper()
+		cluster := testCluster(defaultProto, srv.Address)
+		cluster.AutoPrepareThreshold = 100
+		log := &testLogger{}
+		cluster.Logger = log
+		db, err := cluster.CreateSession()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		if err := db.Query(stmt).ServerTimeout(1500 * time.Millisecond).Exec(); err != nil {
+			t.Fatal(err)
+		}
+		srv.mu.Lock()
+		defer srv.mu.Unlock()
+		for _, sent := range srv.statements {
+			if strings.HasPrefix(sent, "UPDATE") {
+				return sent, log.String()
+			}
+		}
+		t.Fatalf("the statement was not received, got %q", srv.statements)
+		return "", ""
+	}
+
+	scylla := newTestServerOpts{
+		addr:             "127.0.0.1:0",
+		protocol:         defaultProto,
+		rateLimitErrCode: 0xF000,
+	}.newServer(t, context.Background())
+	defer scylla.Stop()
+	if sent, _ := exec(scylla); sent != "UPDATE t USING TIMEOUT 1500ms SET a = 1 WHERE id = 1" {
+		t.Fatalf("expected the timeout to be added to the statement, got %q", sent)
+	}
+
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+	sent, log := exec(srv)
+	if sent != stmt {
+		t.Fatalf("expected the statement to be sent as is, got %q", sent)
+	}
+	if !strings.Contains(log, "server timeout of queries is ignored") {
+		t.Fatalf("expected a warning to be logged, got %q", log)
+	}
+}
+
+func TestConnectionPools(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 1
+	cluster.ConnectionPools = map[string]int{"bulk": 2}
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	poolStats := func() map[string][]ConnStat {
+		pools := make(map[string][]ConnStat)
+		for _, stat := range db.ConnectionStats() {
+			pools[stat.Pool] = append(pools[stat.Pool], stat)
+		}
+		return pools
+	}
+	for i := 0; len(poolStats()["bulk"]) < 2; i++ {
+		if i == 100 {
+			t.Fatalf("expected 2 connections in the bulk pool, got %v", poolStats())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for i := 0; i < 4; i++ {
+		if err := db.Query("void").WithConnectionPool("bulk").Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	pools := poolStats()
+	if len(pools[""]) != 1 || pools[""][0].Queries != 0 {
+		t.Fatalf("expected the default pool to be left alone, got %v", pools[""])
+	}
+	var queries uint64
+	for _, stat := range pools["bulk"] {
+		queries += stat.Queries
+	}
+	if queries != 4 {
+		t.Fatalf("expected 4 queries on the bulk pool, got %d", queries)
+	}
+
+	if err := db.Query("void").WithConnectionPool("other").Exec(); err == nil || !strings.Contains(err.Error(), "unknown connection pool") {
+		t.Fatalf("expected an unknown connection pool error, got %v", err)
+	}
+}
+
+func TestCompressionInUse(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	// the test server does not support any compression
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Compressor = SnappyCompressor{}
+	log := &testLogger{}
+	cluster.Logger = log
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	inUse := db.CompressionInUse()
+	if len(inUse) != 1 {
+		t.Fatalf("expected the compression of 1 host, got %v", inUse)
+	}
+	for hostID, algorithm := range inUse {
+		if algorithm != "none" {
+			t.Fatalf("expected host %s not to use compression, got %q", hostID, algorithm)
+		}
+	}
+	if !strings.Contains(log.String(), "does not support snappy compression") {
+		t.Fatalf("expected a warning to be logged, got %q", log.String())
+	}
+
+	if name := (&Conn{compressor: SnappyCompressor{}}).Compression(); name != "snappy" {
+		t.Fatalf("expected snappy compression, got %q", name)
+	}
+}
+
+func TestMaxFrameSize(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{id: []byte("id"), columns: []string{"a", "b", "c"}})
+
+	// large enough for the responses to the startup and void queries but not
+	// for the prepared statement
+	cluster := testCluster(protoVersion4, srv.Address)
+	cluster.MaxFrameSize = 16
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+	err = db.Query("SELECT a, b, c FROM tbl").Exec()
+	if !errors.Is(err, ErrFrameTooBig) {
+		t.Fatalf("expected %v, got %v", ErrFrameTooBig, err)
+	}
+
+	for _, test := range []struct {
+		configured, expected int
+	}{
+		{0, maxFrameSize},
+		{1024, 1024},
+		{2 * maxFrameSize, maxFrameSize},
+	} {
+		if max := (&ConnConfig{MaxFrameSize: test.configured}).maxFrameSize(); max != test.expected {
+			t.Errorf("expected a maximum frame size of %d for %d, got %d", test.expected, test.configured, max)
+		}
+	}
+}
+
+func TestSessionConnectionStats(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.NumConns = 2
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const numQueries = 10
+	for i := 0; i < numQueries; i++ {
+		if err := db.Query("void").Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := db.ConnectionStats()
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 connections, got %v", stats)
+	}
+	var queries uint64
+	for _, stat := range stats {
+		if stat.HostID != db.ring.allHosts()[0].HostID() || stat.RemoteAddr.String() != srv.Address {
+			t.Fatalf("expected a connection to %s, got %+v", srv.Address, stat)
+		}
+		if stat.LocalAddr == nil || stat.Age <= 0 || stat.InFlight != 0 {
+			t.Fatalf("unexpected connection stat %+v", stat)
+		}
+		queries += stat.Queries
+	}
+	if queries != numQueries {
+		t.Fatalf("expected %d queries, got %d", numQueries, queries)
+	}
+}
+
+func TestSessionBaseContext(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	base, cancel := context.WithCancel(context.WithValue(context.Background(), observerCtxKey{}, "base"))
+	defer cancel()
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.BaseContext = func() context.Context { return base }
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if v := db.Query("void").Context().Value(observerCtxKey{}); v != "base" {
+		t.Fatalf("expected the query context to derive from the base context, got value %v", v)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- db.Query("block").Exec()
+	}()
+	deadline := time.Now().Add(5 * time.Second)
+	for inFlight := 0; inFlight == 0; {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the query to be sent")
+		}
+		time.Sleep(10 * time.Millisecond)
+		for _, stat := range db.ConnectionStats() {
+			inFlight += stat.InFlight
+		}
+	}
+
+	// closing the session aborts the query
+	db.Close()
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Fatalf("expected %v, got %v", context.Canceled, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the query to be aborted when the session is closed")
+	}
+	if base.Err() != nil {
+		t.Fatal("expected the base context to be left as is")
+	}
+}
+
+func TestExecuteAfterKeyspaceChange(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{id: []byte("id"), columns: []string{"v"}})
+
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	conn := db.getConn()
+	if conn == nil {
+		t.Fatal("no connection")
+	}
+	exec := func(keyspace string) {
+		t.Helper()
+		if err := conn.UseKeyspace(keyspace); err != nil {
+			t.Fatal(err)
+		}
+		qry := db.Query("SELECT v FROM tbl")
+		defer qry.Release()
+		if err := conn.executeQuery(context.Background(), qry).Close(); err != nil {
+			t.Fatalf("%s: %v", keyspace, err)
+		}
+		key := db.stmtsLRU.keyFor(conn.host.HostID(), keyspace, qry.stmt)
+		db.stmtsLRU.mu.Lock()
+		val, ok := db.stmtsLRU.lru.Get(key)
+		db.stmtsLRU.mu.Unlock()
+		if !ok || val.(*inflightPrepare).preparedStatment.keyspace != keyspace {
+			t.Fatalf("expected the statement to be prepared in %s", keyspace)
+		}
+	}
+
+	exec("ks1")
+	exec("ks2")
+	if sent := atomic.LoadUint64(&db.stmtsLRU.sent); sent != 2 {
+		t.Fatalf("expected the statement to be prepared in both keyspaces, got %d prepares", sent)
+	}
+	exec("ks1")
+	if sent := atomic.LoadUint64(&db.stmtsLRU.sent); sent != 2 {
+		t.Fatalf("expected the statement prepared in ks1 to be reused, got %d prepares", sent)
+	}
+}
+
+func TestQueryValidateBindTypes(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{id: []byte("id"), columns: []string{"v"}, markers: []string{"a", "b"}})
+
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	qry := db.Query("SELECT v FROM tbl WHERE a = ? AND b = ?")
+	if err := qry.ValidateBindTypes(1, int32(2)); err != nil {
+		t.Fatal(err)
+	}
+	if err := qry.ValidateBindTypes(1); err == nil {
+		t.Fatal("expected an error for a missing value")
+	}
+	err = qry.ValidateBindTypes("one", 2.5)
+	if err == nil {
+		t.Fatal("expected an error for values which are not ints")
+	}
+	for _, detail := range []string{"value 0 (a int) of type string", "value 1 (b int) of type float64"} {
+		if !strings.Contains(err.Error(), detail) {
+			t.Fatalf("expected the error to contain %q, got %v", detail, err)
+		}
+	}
+}
+
+func TestQueryWithRoutingIndexes(t *testing.T) {
+	srv := NewTestServer(t, protoVersion4, context.Background())
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{id: []byte("id"), columns: []string{"v"}, markers: []string{"a", "b", "c"}})
+
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	stmt := "SELECT v FROM tbl WHERE a = ? AND b = token(?) AND c = ?"
+	qry := db.Query(stmt, 1, 2, 3).WithRoutingIndexes(2)
+	key, err := qry.GetRoutingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []byte{0, 0, 0, 3}; !bytes.Equal(key, expected) {
+		t.Fatalf("expected routing key %v, got %v", expected, key)
+	}
+
+	qry = db.Query(stmt, 1, 2, 3).WithRoutingIndexes(2, 0)
+	key, err = qry.GetRoutingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0, 4, 0, 0, 0, 3, 0, 0, 4, 0, 0, 0, 1, 0}
+	if !bytes.Equal(key, expected) {
+		t.Fatalf("expected composite routing key %v, got %v", expected, key)
+	}
+
+	if _, err := db.Query(stmt, 1, 2, 3).WithRoutingIndexes(3).GetRoutingKey(); err == nil || !strings.Contains(err.Error(), "out of the range") {
+		t.Fatalf("expected an error for an index out of range, got %v", err)
+	}
+	if _, err := db.Query(stmt, 1, 2, 3).WithRoutingIndexes(-1).GetRoutingKey(); err == nil {
+		t.Fatal("expected an error for a negative index")
+	}
+	_, err = db.Query(stmt, 1, "two", 3).WithRoutingIndexes(1).GetRoutingKey()
+	if err == nil || !strings.Contains(err.Error(), "routing value 1 (b int) of type string") {
+		t.Fatalf("expected an error for a value which can't be marshaled, got %v", err)
+	}
+}
+
+func TestConditionalBatchMultiPartition(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, protoVersion4, ctx)
+	defer srv.Stop()
+	srv.setPrepared(&testPreparedStatement{
+		id:          []byte("stmt"),
+		markers:     []string{"id", "val"},
+		pkeyMarkers: []int{0},
+	})
+
+	db, err := newTestSession(protoVersion4, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const (
+		insert = "INSERT INTO tbl (id, val) VALUES (?, ?) IF NOT EXISTS"
+		update = "UPDATE tbl SET val = ? WHERE id = ? IF val = 1"
+	)
+
+	batch := db.NewBatch(LoggedBatch)
+	batch.Query(insert, 1, 2)
+	batch.Query(insert, 2, 3)
+	if _, _, err := db.ExecuteBatchCAS(batch); err != ErrLWTBatchMultiPartition {
+		t.Fatalf("expected ErrLWTBatchMultiPartition, got %v", err)
+	}
+
+	// the same partition, and batches without conditions, are sent to the
+	// server, which doesn't support batches
+	batch = db.NewBatch(LoggedBatch)
+	batch.Query(insert, 1, 2)
+	batch.Query(insert, 1, 3)
+	if _, _, err := db.ExecuteBatchCAS(batch); err == nil || err == ErrLWTBatchMultiPartition {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+
+	batch = db.NewBatch(LoggedBatch)
+	batch.Query(strings.TrimSuffix(insert, " IF NOT EXISTS"), 1, 2)
+	batch.Query(strings.TrimSuffix(insert, " IF NOT EXISTS"), 2, 3)
+	if err := db.ExecuteBatch(batch); err == nil || err == ErrLWTBatchMultiPartition {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+	// each statement is only parsed once
+	if n := db.conditionalStmts.lru.Len(); n != 2 {
+		t.Fatalf("expected 2 statements to be cached, got %d", n)
+	}
+
+	// statements whose partition is unknown are not checked
+	batch = db.NewBatch(LoggedBatch)
+	batch.Query(insert, 1, 2)
+	batch.Bind(update, func(q *QueryInfo) ([]interface{}, error) {
+		return []interface{}{2, 3}, nil
+	})
+	if _, _, err := db.ExecuteBatchCAS(batch); err == nil || err == ErrLWTBatchMultiPartition {
+		t.Fatalf("expected the error of the server, got %v", err)
+	}
+}
+
+func TestSessionInFlightQueries(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := NewTestServer(t, defaultProto, ctx)
+	defer srv.Stop()
+
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.TrackInFlightQueries = true
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	if queries := db.InFlightQueries(); len(queries) != 0 {
+		t.Fatalf("expected no query in flight, got %+v", queries)
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- db.Query("timeout").Exec()
+	}()
+
+	var queries []InFlightQuery
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		queries = db.InFlightQueries()
+		if len(queries) == 1 && queries[0].Host != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for the query to be in flight, got %+v", queries)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if queries[0].Fingerprint != "timeout" || queries[0].Host.ConnectAddress().String() != "127.0.0.1" ||
+		queries[0].Start.IsZero() || queries[0].Context.Err() != nil {
+		t.Fatalf("unexpected query in flight: %+v", queries[0])
+	}
+
+	db.CancelAll()
+	select {
+	case err := <-errs:
+		if err != context.Canceled {
+			t.Fatalf("expected the query to be canceled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the query to be canceled")
+	}
+	if queries := db.InFlightQueries(); len(queries) != 0 {
+		t.Fatalf("expected no query in flight, got %+v", queries)
+	}
+
+	// queries are not tracked by default
+	db2, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db2.Close()
+	if db2.executor.inFlight != nil {
+		t.Fatal("expected queries not to be tracked")
+	}
 }
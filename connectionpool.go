@@ -5,6 +5,7 @@
 package gocql
 
 import (
+	"crypto/sha256"
 	"crypto/tls"
 	"crypto/x509"
 	"errors"
@@ -12,6 +13,7 @@ import (
 	"io/ioutil"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -73,9 +75,64 @@ func setupTLSConfig(sslOpts *SslOptions) (*tls.Config, error) {
 		tlsConfig.Certificates = append(tlsConfig.Certificates, mycert)
 	}
 
+	if len(sslOpts.PinnedCertFingerprints) > 0 {
+		pinCertificates(tlsConfig, sslOpts.PinnedCertFingerprints, sslOpts.PinnedCertMode)
+	}
+
 	return tlsConfig, nil
 }
 
+// pinCertificates makes tlsConfig only accept the leaf certificates with the
+// SHA-256 fingerprints of pinned, combined with the verification of the
+// certificates according to mode.
+func pinCertificates(tlsConfig *tls.Config, pinned [][32]byte, mode PinnedCertMode) {
+	isPinned := func(cert *x509.Certificate) bool {
+		fingerprint := sha256.Sum256(cert.Raw)
+		for _, p := range pinned {
+			if p == fingerprint {
+				return true
+			}
+		}
+		return false
+	}
+
+	verify := !tlsConfig.InsecureSkipVerify
+	if mode == PinnedCertOrCA {
+		// pinned certificates must not be rejected by the verification, which
+		// is done below for the other certificates
+		tlsConfig.InsecureSkipVerify = true
+	}
+	roots := tlsConfig.RootCAs
+	next := tlsConfig.VerifyConnection
+	tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return errors.New("gocql: the server presented no certificate")
+		}
+		leaf := cs.PeerCertificates[0]
+		switch {
+		case isPinned(leaf):
+		case mode == PinnedCertOrCA && verify:
+			opts := x509.VerifyOptions{
+				Roots:         roots,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, cert := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			if _, err := leaf.Verify(opts); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("gocql: the server certificate %q is not pinned", leaf.Subject)
+		}
+		if next != nil {
+			return next(cs)
+		}
+		return nil
+	}
+}
+
 type policyConnPool struct {
 	session *Session
 
@@ -113,28 +170,32 @@ func connConfig(cfg *ClusterConfig) (*ConnConfig, error) {
 			if cfg.SocketKeepalive > 0 {
 				d.KeepAlive = cfg.SocketKeepalive
 			}
+			d.Control = socketControl(cfg)
 			dialer = d
 		}
 
 		hostDialer = &defaultHostDialer{
-			dialer:    dialer,
-			tlsConfig: tlsConfig,
+			dialer:         dialer,
+			tlsConfig:      tlsConfig,
+			disableNoDelay: cfg.DisableTCPNoDelay && cfg.Dialer == nil,
 		}
 	}
 
 	return &ConnConfig{
-		ProtoVersion:   cfg.ProtoVersion,
-		CQLVersion:     cfg.CQLVersion,
-		Timeout:        cfg.Timeout,
-		WriteTimeout:   cfg.WriteTimeout,
-		ConnectTimeout: cfg.ConnectTimeout,
-		Dialer:         cfg.Dialer,
-		HostDialer:     hostDialer,
-		Compressor:     cfg.Compressor,
-		Authenticator:  cfg.Authenticator,
-		AuthProvider:   cfg.AuthProvider,
-		Keepalive:      cfg.SocketKeepalive,
-		Logger:         cfg.logger(),
+		ProtoVersion:      cfg.ProtoVersion,
+		CQLVersion:        cfg.CQLVersion,
+		Timeout:           cfg.Timeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		ConnectTimeout:    cfg.ConnectTimeout,
+		Dialer:            cfg.Dialer,
+		HostDialer:        hostDialer,
+		Compressor:        cfg.Compressor,
+		Authenticator:     cfg.Authenticator,
+		AuthProvider:      cfg.AuthProvider,
+		Keepalive:         cfg.SocketKeepalive,
+		Logger:            cfg.logger(),
+		MaxFrameSize:      cfg.MaxFrameSize,
+		UnknownTypePolicy: cfg.UnknownTypePolicy,
 	}, nil
 }
 
@@ -268,6 +329,81 @@ func (p *policyConnPool) removeHost(hostID string) {
 	go pool.Close()
 }
 
+// ConnStat is a snapshot of an open connection of the connection pool, see
+// Session.ConnectionStats.
+type ConnStat struct {
+	// HostID is the ID of the host the connection is open to.
+	HostID     string
+	LocalAddr  net.Addr
+	RemoteAddr net.Addr
+	// InFlight is the number of requests waiting for a response.
+	InFlight int
+	// Queries is the number of queries and batches executed on the connection.
+	Queries uint64
+	// Age is the time since the connection was opened.
+	Age time.Duration
+	// Pool is the name of the pool of ClusterConfig.ConnectionPools the
+	// connection belongs to, empty for the default pool.
+	Pool string
+	// Spillover is true if the connection was opened on top of the size of
+	// the pool, see ClusterConfig.MaxSpilloverConns.
+	Spillover bool
+}
+
+// connStats returns a snapshot of the connections of all host pools, ordered
+// by host ID.
+func (p *policyConnPool) connStats() []ConnStat {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	now := time.Now()
+	var stats []ConnStat
+	for _, hostPool := range p.hostConnPools {
+		for _, pool := range hostPool.pools() {
+			pool.mu.RLock()
+			for _, conn := range pool.conns {
+				stats = append(stats, ConnStat{
+					HostID:     pool.host.HostID(),
+					LocalAddr:  conn.conn.LocalAddr(),
+					RemoteAddr: conn.remoteAddr,
+					InFlight:   conn.InFlightStreams(),
+					Queries:    atomic.LoadUint64(&conn.queries),
+					Age:        now.Sub(conn.created),
+					Pool:       pool.name,
+					Spillover:  conn.spillover,
+				})
+			}
+			pool.mu.RUnlock()
+		}
+	}
+	sort.SliceStable(stats, func(i, j int) bool {
+		return stats[i].HostID < stats[j].HostID
+	})
+	return stats
+}
+
+// compression returns the compression algorithm of the connections to each
+// host, by host ID. Hosts with connections which are not compressed are
+// reported as "none".
+func (p *policyConnPool) compression() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	algorithms := make(map[string]string, len(p.hostConnPools))
+	for hostID, hostPool := range p.hostConnPools {
+		for _, pool := range hostPool.pools() {
+			pool.mu.RLock()
+			for _, conn := range pool.conns {
+				if algorithm, ok := algorithms[hostID]; !ok || algorithm != "none" {
+					algorithms[hostID] = conn.Compression()
+				}
+			}
+			pool.mu.RUnlock()
+		}
+	}
+	return algorithms
+}
+
 // hostConnPool is a connection pool for a single host.
 // Connection selection is based on a provided ConnSelectionPolicy
 type hostConnPool struct {
@@ -277,13 +413,52 @@ type hostConnPool struct {
 	size     int
 	keyspace string
 	// protection for conns, closed, filling
-	mu      sync.RWMutex
-	conns   []*Conn
-	closed  bool
-	filling bool
+	mu       sync.RWMutex
+	conns    []*Conn
+	closed   bool
+	filling  bool
+	spilling bool
 
 	pos    uint32
 	logger StdLogger
+
+	// name is the name of a pool of ClusterConfig.ConnectionPools, it is empty
+	// for the default pool of the host which owns the named pools in subPools.
+	// Only the default pool reports the host as connected or down.
+	name     string
+	subPools map[string]*hostConnPool
+
+	saturation poolSaturation
+}
+
+// poolSaturation tracks whether a pool is saturated to notify the
+// ClusterConfig.PoolObserver once a change lasted PoolSaturationDebounce.
+type poolSaturation struct {
+	mu        sync.Mutex
+	saturated bool
+	since     time.Time
+	// reported is the saturation the observer was last notified of.
+	reported bool
+}
+
+// update records whether the pool is saturated at now, it returns true when
+// the observer must be notified of the change which happened at since. pending
+// is true when a change not notified yet happened at now, it is notified once
+// it lasted debounce.
+func (s *poolSaturation) update(saturated bool, now time.Time, debounce time.Duration) (since time.Time, notify, pending bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if saturated != s.saturated {
+		s.saturated = saturated
+		s.since = now
+		pending = s.saturated != s.reported
+	}
+	if s.saturated == s.reported || now.Sub(s.since) < debounce {
+		return time.Time{}, false, pending
+	}
+	s.reported = s.saturated
+	return s.since, true, false
 }
 
 func (h *hostConnPool) String() string {
@@ -308,17 +483,69 @@ func newHostConnPool(session *Session, host *HostInfo, port, size int,
 		logger:   session.logger,
 	}
 
+	if len(session.cfg.ConnectionPools) > 0 {
+		pool.subPools = make(map[string]*hostConnPool, len(session.cfg.ConnectionPools))
+		for name, size := range session.cfg.ConnectionPools {
+			pool.subPools[name] = &hostConnPool{
+				session:  session,
+				host:     host,
+				port:     port,
+				size:     size,
+				keyspace: keyspace,
+				conns:    make([]*Conn, 0, size),
+				logger:   session.logger,
+				name:     name,
+			}
+		}
+	}
+
 	// the pool is not filled or connected
 	return pool
 }
 
+// named returns the pool of ClusterConfig.ConnectionPools called name, or
+// pool itself if name is empty.
+func (pool *hostConnPool) named(name string) (*hostConnPool, bool) {
+	if name == "" {
+		return pool, true
+	}
+	sub, ok := pool.subPools[name]
+	return sub, ok
+}
+
+// pools returns pool followed by its named pools.
+func (pool *hostConnPool) pools() []*hostConnPool {
+	pools := []*hostConnPool{pool}
+	for _, sub := range pool.subPools {
+		pools = append(pools, sub)
+	}
+	return pools
+}
+
 // Pick a connection from this connection pool for the given query.
 func (pool *hostConnPool) Pick() *Conn {
+	return pool.picked(pool.pick(0, false))
+}
+
+// picked notifies the PoolObserver of the saturation event of a pick, if any,
+// and returns the connection picked.
+func (pool *hostConnPool) picked(conn *Conn, event ObservedPoolSaturation, notify bool) *Conn {
+	if notify {
+		pool.session.cfg.PoolObserver.ObservePoolSaturation(event)
+	}
+	return conn
+}
+
+// pick returns the least busy connection of the pool, or if sharded a
+// connection to the Scylla shard owning token if it has streams available,
+// and the saturation event to notify the PoolObserver of, if any, which is
+// done once pool.mu is released.
+func (pool *hostConnPool) pick(token int64, sharded bool) (*Conn, ObservedPoolSaturation, bool) {
 	pool.mu.RLock()
 	defer pool.mu.RUnlock()
 
 	if pool.closed {
-		return nil
+		return nil, ObservedPoolSaturation{}, false
 	}
 
 	size := len(pool.conns)
@@ -327,7 +554,7 @@ func (pool *hostConnPool) Pick() *Conn {
 		go pool.fill()
 
 		if size == 0 {
-			return nil
+			return nil, ObservedPoolSaturation{}, false
 		}
 	}
 
@@ -336,18 +563,169 @@ func (pool *hostConnPool) Pick() *Conn {
 	var (
 		leastBusyConn    *Conn
 		streamsAvailable int
+		shardConn        *Conn
 	)
 
 	// find the conn which has the most available streams, this is racy
 	for i := 0; i < size; i++ {
 		conn := pool.conns[(pos+i)%size]
-		if streams := conn.AvailableStreams(); streams > streamsAvailable {
+		streams := conn.AvailableStreams()
+		if streams > streamsAvailable {
 			leastBusyConn = conn
 			streamsAvailable = streams
 		}
+		if sharded && shardConn == nil && streams > 0 && conn.sharding.owns(token) {
+			shardConn = conn
+		}
+	}
+
+	// even the least busy conn is close to running out of streams, open another
+	// one so that the following queries have somewhere to go
+	if leastBusyConn == nil || streamsAvailable < leastBusyConn.MaxStreams()/spilloverStreamsFraction {
+		if !pool.spilling && size < pool.size+pool.session.cfg.MaxSpilloverConns {
+			go pool.spillover()
+		}
+	}
+
+	conn := leastBusyConn
+	if shardConn != nil {
+		conn = shardConn
+	}
+	if pool.session.cfg.PoolObserver == nil {
+		return conn, ObservedPoolSaturation{}, false
+	}
+	event, notify := pool.saturationEvent(leastBusyConn == nil)
+	return conn, event, notify
+}
+
+// saturationEvent returns the event to notify the PoolObserver of if the pool
+// became saturated or stopped being saturated at least PoolSaturationDebounce
+// ago, it must be called with pool.mu held. A change which has to be debounced
+// is checked again once debounced, in case no connection is picked from the
+// pool until then.
+func (pool *hostConnPool) saturationEvent(saturated bool) (ObservedPoolSaturation, bool) {
+	debounce := pool.session.cfg.PoolSaturationDebounce
+	since, notify, pending := pool.saturation.update(saturated, time.Now(), debounce)
+	if pending && debounce > 0 {
+		time.AfterFunc(debounce, pool.checkSaturation)
+	}
+	if !notify {
+		return ObservedPoolSaturation{}, false
+	}
+
+	inFlight := 0
+	for _, conn := range pool.conns {
+		inFlight += conn.InFlightStreams()
+	}
+	return ObservedPoolSaturation{
+		Host:      pool.host,
+		HostID:    pool.host.HostID(),
+		Pool:      pool.name,
+		Saturated: saturated,
+		Since:     since,
+		Conns:     len(pool.conns),
+		InFlight:  inFlight,
+	}, true
+}
+
+// checkSaturation notifies the PoolObserver of a saturation change which was
+// debounced since the last connection was picked from the pool.
+func (pool *hostConnPool) checkSaturation() {
+	pool.mu.RLock()
+	if pool.closed || len(pool.conns) == 0 {
+		pool.mu.RUnlock()
+		return
+	}
+	saturated := true
+	for _, conn := range pool.conns {
+		if conn.AvailableStreams() > 0 {
+			saturated = false
+			break
+		}
 	}
+	event, notify := pool.saturationEvent(saturated)
+	pool.mu.RUnlock()
 
-	return leastBusyConn
+	if notify {
+		pool.session.cfg.PoolObserver.ObservePoolSaturation(event)
+	}
+}
+
+// the pool spills over to a new connection once the least busy connection has
+// less than 1/spilloverStreamsFraction of its streams available.
+const spilloverStreamsFraction = 4
+
+// spillover opens a single connection on top of the configured pool size.
+func (pool *hostConnPool) spillover() {
+	pool.mu.Lock()
+	if pool.closed || pool.filling || pool.spilling ||
+		len(pool.conns) >= pool.size+pool.session.cfg.MaxSpilloverConns {
+		pool.mu.Unlock()
+		return
+	}
+	pool.spilling = true
+	pool.mu.Unlock()
+
+	conn, err := pool.addConn(true)
+	pool.logConnectErr(err)
+
+	pool.mu.Lock()
+	pool.spilling = false
+	pool.mu.Unlock()
+
+	if conn != nil {
+		go pool.closeWhenIdle(conn)
+	}
+}
+
+// closeWhenIdle closes the spillover connection conn once it executed no
+// queries for SpilloverIdleTimeout.
+func (pool *hostConnPool) closeWhenIdle(conn *Conn) {
+	timeout := pool.session.cfg.SpilloverIdleTimeout
+	if timeout <= 0 {
+		timeout = time.Minute
+	}
+	ticker := time.NewTicker(timeout)
+	defer ticker.Stop()
+
+	queries := atomic.LoadUint64(&conn.queries)
+	for {
+		select {
+		case <-ticker.C:
+		case <-pool.session.ctx.Done():
+			return
+		}
+		if conn.Closed() {
+			return
+		}
+		last := queries
+		queries = atomic.LoadUint64(&conn.queries)
+		if queries != last || conn.InFlightStreams() > 0 {
+			continue
+		}
+
+		pool.mu.Lock()
+		removed := pool.removeConnLocked(conn)
+		pool.mu.Unlock()
+		if removed {
+			// removed first so that the pool is not filled again
+			conn.Close()
+		}
+		return
+	}
+}
+
+// removeConnLocked removes conn from the pool, it must be called with pool.mu
+// held.
+func (pool *hostConnPool) removeConnLocked(conn *Conn) bool {
+	for i, candidate := range pool.conns {
+		if candidate == conn {
+			// remove the connection, not preserving order
+			pool.conns[i], pool.conns = pool.conns[len(pool.conns)-1], pool.conns[:len(pool.conns)-1]
+			return true
+		}
+	}
+	return false
 }
 
 // Size returns the number of connections currently active in the pool
@@ -387,6 +765,10 @@ func (pool *hostConnPool) Close() {
 	for _, conn := range conns {
 		conn.Close()
 	}
+
+	for _, sub := range pool.subPools {
+		sub.Close()
+	}
 }
 
 // Fill the connection pool
@@ -441,8 +823,16 @@ func (pool *hostConnPool) fill() {
 			pool.fillingStopped(err)
 			return
 		}
-		// notify the session that this node is connected
-		go pool.session.handleNodeConnected(pool.host)
+		if pool.name == "" {
+			// notify the session that this node is connected
+			go pool.session.handleNodeConnected(pool.host)
+
+			// the named pools of the host get their first connection
+			// before queries are sent to it
+			for _, sub := range pool.subPools {
+				sub.fill()
+			}
+		}
 
 		// filled one
 		fillCount--
@@ -455,7 +845,7 @@ func (pool *hostConnPool) fill() {
 		// mark the end of filling
 		pool.fillingStopped(err)
 
-		if err == nil && startCount > 0 {
+		if err == nil && startCount > 0 && pool.name == "" {
 			// notify the session that this node is connected again
 			go pool.session.handleNodeConnected(pool.host)
 		}
@@ -467,11 +857,13 @@ func (pool *hostConnPool) logConnectErr(err error) {
 		// connection refused
 		// these are typical during a node outage so avoid log spam.
 		if gocqlDebug {
-			pool.logger.Printf("gocql: unable to dial %q: %v\n", pool.host, err)
+			logEvent(pool.logger, LogLevelDebug, "unable to dial", []LogField{{"host", pool.host.ConnectAddress()}, {"host_id", pool.host.HostID()}, {"error", err}},
+				"gocql: unable to dial %q: %v\n", pool.host, err)
 		}
 	} else if err != nil {
 		// unexpected error
-		pool.logger.Printf("error: failed to connect to %q due to error: %v", pool.host, err)
+		logEvent(pool.logger, LogLevelError, "failed to connect", []LogField{{"host", pool.host.ConnectAddress()}, {"host_id", pool.host.HostID()}, {"error", err}},
+			"error: failed to connect to %q due to error: %v", pool.host, err)
 	}
 }
 
@@ -479,7 +871,8 @@ func (pool *hostConnPool) logConnectErr(err error) {
 func (pool *hostConnPool) fillingStopped(err error) {
 	if err != nil {
 		if gocqlDebug {
-			pool.logger.Printf("gocql: filling stopped %q: %v\n", pool.host.ConnectAddress(), err)
+			logEvent(pool.logger, LogLevelDebug, "filling stopped", []LogField{{"host", pool.host.ConnectAddress()}, {"error", err}},
+				"gocql: filling stopped %q: %v\n", pool.host.ConnectAddress(), err)
 		}
 		// wait for some time to avoid back-to-back filling
 		// this provides some time between failed attempts
@@ -497,9 +890,9 @@ func (pool *hostConnPool) fillingStopped(err error) {
 	// if we errored and the size is now zero, make sure the host is marked as down
 	// see https://github.com/gocql/gocql/issues/1614
 	if gocqlDebug {
-		pool.logger.Printf("gocql: conns of pool after stopped %q: %v\n", host.ConnectAddress(), count)
+		logf(pool.logger, LogLevelDebug, "gocql: conns of pool after stopped %q: %v\n", host.ConnectAddress(), count)
 	}
-	if err != nil && count == 0 {
+	if err != nil && count == 0 && pool.name == "" {
 		if pool.session.cfg.ConvictionPolicy.AddFailure(err, host) {
 			pool.session.handleNodeDown(host.ConnectAddress(), port)
 		}
@@ -536,7 +929,14 @@ func (pool *hostConnPool) connectMany(count int) error {
 }
 
 // create a new connection to the host and add it to the pool
-func (pool *hostConnPool) connect() (err error) {
+func (pool *hostConnPool) connect() error {
+	_, err := pool.addConn(false)
+	return err
+}
+
+// addConn opens a connection and adds it to the pool, it returns nil if the
+// pool was closed meanwhile.
+func (pool *hostConnPool) addConn(spillover bool) (_ *Conn, err error) {
 	// TODO: provide a more robust connection retry mechanism, we should also
 	// be able to detect hosts that come up by trying to connect to downed ones.
 	// try to connect
@@ -554,22 +954,23 @@ func (pool *hostConnPool) connect() (err error) {
 				break
 			}
 		}
-		if gocqlDebug {
-			pool.logger.Printf("gocql: connection failed %q: %v, reconnecting with %T\n",
-				pool.host.ConnectAddress(), err, reconnectionPolicy)
+		if gocqlDebug && logEnabled(pool.logger, LogLevelDebug) {
+			logEvent(pool.logger, LogLevelDebug, "connection failed, reconnecting",
+				[]LogField{{"host", pool.host.ConnectAddress()}, {"error", err}, {"reconnection_policy", fmt.Sprintf("%T", reconnectionPolicy)}},
+				"gocql: connection failed %q: %v, reconnecting with %T\n", pool.host.ConnectAddress(), err, reconnectionPolicy)
 		}
 		time.Sleep(reconnectionPolicy.GetInterval(i))
 	}
 
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if pool.keyspace != "" {
 		// set the keyspace
 		if err = conn.UseKeyspace(pool.keyspace); err != nil {
 			conn.Close()
-			return err
+			return nil, err
 		}
 	}
 
@@ -579,12 +980,13 @@ func (pool *hostConnPool) connect() (err error) {
 
 	if pool.closed {
 		conn.Close()
-		return nil
+		return nil, nil
 	}
 
+	conn.spillover = spillover
 	pool.conns = append(pool.conns, conn)
 
-	return nil
+	return conn, nil
 }
 
 // handle any error from a Conn
@@ -605,18 +1007,12 @@ func (pool *hostConnPool) HandleError(conn *Conn, err error, closed bool) {
 	}
 
 	if gocqlDebug {
-		pool.logger.Printf("gocql: pool connection error %q: %v\n", conn.addr, err)
+		logEvent(pool.logger, LogLevelDebug, "pool connection error", []LogField{{"host", conn.addr}, {"error", err}},
+			"gocql: pool connection error %q: %v\n", conn.addr, err)
 	}
 
-	// find the connection index
-	for i, candidate := range pool.conns {
-		if candidate == conn {
-			// remove the connection, not preserving order
-			pool.conns[i], pool.conns = pool.conns[len(pool.conns)-1], pool.conns[:len(pool.conns)-1]
-
-			// lost a connection, so fill the pool
-			go pool.fill()
-			break
-		}
+	if pool.removeConnLocked(conn) {
+		// lost a connection, so fill the pool
+		go pool.fill()
 	}
 }
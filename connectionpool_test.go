@@ -4,8 +4,20 @@
 package gocql
 
 import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
 	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
 	"testing"
+	"time"
+
+	"github.com/gocql/gocql/internal/streams"
 )
 
 func TestSetupTLSConfig(t *testing.T) {
@@ -83,3 +95,263 @@ func TestSetupTLSConfig(t *testing.T) {
 		})
 	}
 }
+
+type recordingPoolObserver []ObservedPoolSaturation
+
+func (o *recordingPoolObserver) ObservePoolSaturation(s ObservedPoolSaturation) {
+	*o = append(*o, s)
+}
+
+func TestHostConnPoolSaturation(t *testing.T) {
+	var observer recordingPoolObserver
+	session := &Session{cfg: ClusterConfig{PoolObserver: &observer}}
+	host := &HostInfo{hostId: "host-1"}
+	conns := []*Conn{{streams: streams.New(protoVersion2)}, {streams: streams.New(protoVersion2)}}
+	pool := &hostConnPool{session: session, host: host, size: len(conns), conns: conns}
+
+	if conn := pool.Pick(); conn == nil {
+		t.Fatal("expected a connection to be picked")
+	}
+	if len(observer) != 0 {
+		t.Fatalf("expected no saturation change to be observed, got %+v", observer)
+	}
+
+	var ids [][]int
+	for _, conn := range conns {
+		var connIDs []int
+		for {
+			id, ok := conn.streams.GetStream()
+			if !ok {
+				break
+			}
+			connIDs = append(connIDs, id)
+		}
+		ids = append(ids, connIDs)
+	}
+
+	if conn := pool.Pick(); conn != nil {
+		t.Fatal("expected no connection to be picked from a saturated pool")
+	}
+	pool.Pick()
+	if len(observer) != 1 {
+		t.Fatalf("expected 1 saturation change to be observed, got %+v", observer)
+	}
+	got := observer[0]
+	if !got.Saturated || got.Host != host || got.HostID != "host-1" || got.Conns != 2 ||
+		got.InFlight != 2*conns[0].MaxStreams() || got.Since.IsZero() {
+		t.Fatalf("unexpected saturation observed: %+v", got)
+	}
+
+	conns[1].streams.Clear(ids[1][0])
+	pool.Pick()
+	if len(observer) != 2 || observer[1].Saturated || observer[1].InFlight != 2*conns[0].MaxStreams()-1 {
+		t.Fatalf("expected the pool to be observed unsaturated, got %+v", observer)
+	}
+}
+
+func TestHostConnPoolPickForSaturation(t *testing.T) {
+	var observer recordingPoolObserver
+	session := &Session{cfg: ClusterConfig{PoolObserver: &observer}}
+	host := &HostInfo{hostId: "host-1", scyllaShards: 2}
+	conns := []*Conn{
+		{streams: streams.New(protoVersion2), sharding: scyllaSharding{shard: 0, nrShards: 2}},
+		{streams: streams.New(protoVersion2), sharding: scyllaSharding{shard: 1, nrShards: 2}},
+	}
+	pool := &hostConnPool{session: session, host: host, size: len(conns), conns: conns}
+
+	key := []byte("key")
+	token := int64(murmur3Partitioner{}.Hash(key).(murmur3Token))
+	owner := conns[0]
+	if !owner.sharding.owns(token) {
+		owner = conns[1]
+	}
+	qry := &Query{routingKey: key, routingInfo: &queryRoutingInfo{}}
+	if conn := pool.pickFor(qry); conn != owner {
+		t.Fatalf("expected the connection to shard %d to be picked, got %+v", owner.sharding.shard, conn)
+	}
+
+	// a saturated shard spills over to the least busy connection
+	for {
+		if _, ok := owner.streams.GetStream(); !ok {
+			break
+		}
+	}
+	if conn := pool.pickFor(qry); conn == nil || conn == owner {
+		t.Fatalf("expected the pick to spill over from the saturated shard %d, got %+v", owner.sharding.shard, conn)
+	}
+	for _, conn := range conns {
+		for {
+			if _, ok := conn.streams.GetStream(); !ok {
+				break
+			}
+		}
+	}
+	if conn := pool.pickFor(qry); conn != nil {
+		t.Fatal("expected no connection to be picked from a saturated pool")
+	}
+	pool.pickFor(qry)
+	if len(observer) != 1 || !observer[0].Saturated {
+		t.Fatalf("expected the saturation of the pool to be observed, got %+v", observer)
+	}
+}
+
+func TestPoolSaturationDebounce(t *testing.T) {
+	var s poolSaturation
+	start := time.Now()
+	debounce := time.Second
+
+	if _, notify, _ := s.update(true, start, debounce); notify {
+		t.Fatal("expected saturation not to be notified before the debounce")
+	}
+	// flapping back before the debounce is never notified
+	if _, notify, _ := s.update(false, start.Add(debounce/2), debounce); notify {
+		t.Fatal("expected no notification of an unchanged state")
+	}
+	if _, notify, _ := s.update(true, start.Add(debounce), debounce); notify {
+		t.Fatal("expected saturation not to be notified before the debounce")
+	}
+	since, notify, _ := s.update(true, start.Add(2*debounce), debounce)
+	if !notify || !since.Equal(start.Add(debounce)) {
+		t.Fatalf("expected saturation since %v to be notified, got %v %v", start.Add(debounce), since, notify)
+	}
+	if _, notify, _ := s.update(true, start.Add(3*debounce), debounce); notify {
+		t.Fatal("expected saturation to be notified once")
+	}
+}
+
+type lockingPoolObserver struct {
+	pool     *hostConnPool
+	observed chan ObservedPoolSaturation
+}
+
+func (o *lockingPoolObserver) ObservePoolSaturation(s ObservedPoolSaturation) {
+	// deadlocks if the observer is called with the lock of the pool held
+	o.pool.mu.Lock()
+	o.pool.mu.Unlock()
+	o.observed <- s
+}
+
+func TestPoolSaturationObservedOnceDebounced(t *testing.T) {
+	observer := &lockingPoolObserver{observed: make(chan ObservedPoolSaturation, 1)}
+	session := &Session{cfg: ClusterConfig{PoolObserver: observer, PoolSaturationDebounce: 50 * time.Millisecond}}
+	conn := &Conn{streams: streams.New(protoVersion2)}
+	pool := &hostConnPool{session: session, host: &HostInfo{hostId: "host-1"}, size: 1, conns: []*Conn{conn}}
+	observer.pool = pool
+
+	for {
+		if _, ok := conn.streams.GetStream(); !ok {
+			break
+		}
+	}
+	// the pool is only picked from once, the change is notified once debounced
+	if c := pool.Pick(); c != nil {
+		t.Fatal("expected no connection to be picked from a saturated pool")
+	}
+	select {
+	case got := <-observer.observed:
+		if !got.Saturated || got.Conns != 1 {
+			t.Fatalf("unexpected saturation observed: %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the saturation to be observed")
+	}
+}
+
+// newTestCert returns a certificate for 127.0.0.1 signed by parent, or self
+// signed if parent is nil.
+func newTestCert(t *testing.T, parent *tls.Certificate, isCA bool) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: "gocql test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := tmpl, interface{}(key)
+	if parent != nil {
+		signer, signerKey = parent.Leaf, parent.PrivateKey
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}
+}
+
+func TestSetupTLSConfigPinnedCerts(t *testing.T) {
+	ca := newTestCert(t, nil, true)
+	cert := newTestCert(t, &ca, false)
+	other := newTestCert(t, nil, false)
+	trusted := x509.NewCertPool()
+	trusted.AddCert(ca.Leaf)
+
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{Certificates: []tls.Certificate{cert}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+
+	tests := []struct {
+		name   string
+		pinned *tls.Certificate
+		mode   PinnedCertMode
+		roots  *x509.CertPool
+		ok     bool
+	}{
+		{name: "pinned and trusted", pinned: &cert, mode: PinnedCertAndCA, roots: trusted, ok: true},
+		{name: "not pinned and trusted", pinned: &other, mode: PinnedCertAndCA, roots: trusted, ok: false},
+		{name: "pinned and not trusted", pinned: &cert, mode: PinnedCertAndCA, roots: x509.NewCertPool(), ok: false},
+		{name: "pinned or trusted, pinned", pinned: &cert, mode: PinnedCertOrCA, roots: x509.NewCertPool(), ok: true},
+		{name: "pinned or trusted, trusted", pinned: &other, mode: PinnedCertOrCA, roots: trusted, ok: true},
+		{name: "pinned or trusted, neither", pinned: &other, mode: PinnedCertOrCA, roots: x509.NewCertPool(), ok: false},
+	}
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			tlsConfig, err := setupTLSConfig(&SslOptions{
+				Config:                 &tls.Config{RootCAs: test.roots},
+				EnableHostVerification: true,
+				PinnedCertFingerprints: [][32]byte{sha256.Sum256(test.pinned.Certificate[0])},
+				PinnedCertMode:         test.mode,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			conn, err := net.Dial("tcp", ln.Addr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			dialed, err := WrapTLS(context.Background(), conn, ln.Addr().String(), tlsConfig)
+			if err == nil {
+				dialed.Conn.Close()
+			}
+			if ok := err == nil; ok != test.ok {
+				t.Fatalf("expected the handshake to succeed %v, got %v", test.ok, err)
+			}
+		})
+	}
+}
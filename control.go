@@ -5,11 +5,13 @@ import (
 	crand "crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"math/rand"
 	"net"
 	"os"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -154,6 +156,90 @@ func hostInfo(addr string, defaultPort int) ([]*HostInfo, error) {
 	return hosts, nil
 }
 
+// ControlConnectionSeedStrategy is the order in which the initial hosts are
+// tried to open the control connection when creating a session, see
+// ClusterConfig.ControlConnectionSeedStrategy. Every host is tried before
+// failing.
+type ControlConnectionSeedStrategy int
+
+const (
+	// SeedStrategyRandom tries the initial hosts in a random order, so that
+	// the clients do not all connect to the same host.
+	SeedStrategyRandom ControlConnectionSeedStrategy = iota
+	// SeedStrategyInOrder tries the initial hosts in the order of
+	// ClusterConfig.Hosts.
+	SeedStrategyInOrder
+	// SeedStrategyRoundRobin tries the initial hosts in the order of
+	// ClusterConfig.Hosts, wrapping around at the end. Each session created by
+	// the process starts one host further than the previous one, so that the
+	// sessions of a process spread their control connections over the hosts.
+	SeedStrategyRoundRobin
+)
+
+func (s ControlConnectionSeedStrategy) String() string {
+	switch s {
+	case SeedStrategyRandom:
+		return "Random"
+	case SeedStrategyInOrder:
+		return "InOrder"
+	case SeedStrategyRoundRobin:
+		return "RoundRobin"
+	default:
+		return fmt.Sprintf("ControlConnectionSeedStrategy(%d)", int(s))
+	}
+}
+
+// seedRoundRobinOffset counts the sessions that used SeedStrategyRoundRobin.
+// Modulo the number of hosts, it is the index of the host the next one starts
+// from.
+var seedRoundRobinOffset uint32
+
+func (s ControlConnectionSeedStrategy) order(hosts []*HostInfo) []*HostInfo {
+	switch s {
+	case SeedStrategyInOrder:
+		return hosts
+	case SeedStrategyRoundRobin:
+		offset := int((atomic.AddUint32(&seedRoundRobinOffset, 1) - 1) % uint32(len(hosts)))
+		ordered := make([]*HostInfo, 0, len(hosts))
+		ordered = append(ordered, hosts[offset:]...)
+		return append(ordered, hosts[:offset]...)
+	default:
+		return shuffleHosts(hosts)
+	}
+}
+
+// SeedError is the error opening the control connection to an initial host.
+type SeedError struct {
+	Host *HostInfo
+	Err  error
+}
+
+// ControlConnError is returned when creating a session if the control
+// connection could not be opened to any of the initial hosts. It holds the
+// error of each host in the order they were tried and unwraps to the last one.
+type ControlConnError struct {
+	Errors []SeedError
+}
+
+func (e *ControlConnError) Error() string {
+	var buf strings.Builder
+	buf.WriteString("unable to connect to initial hosts: ")
+	for i, seedErr := range e.Errors {
+		if i > 0 {
+			buf.WriteString("; ")
+		}
+		fmt.Fprintf(&buf, "%s: %v", seedErr.Host.ConnectAddressAndPort(), seedErr.Err)
+	}
+	return buf.String()
+}
+
+func (e *ControlConnError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1].Err
+}
+
 func shuffleHosts(hosts []*HostInfo) []*HostInfo {
 	shuffled := make([]*HostInfo, len(hosts))
 	copy(shuffled, hosts)
@@ -188,11 +274,32 @@ func parseProtocolFromError(err error) int {
 	return max
 }
 
-func (c *controlConn) discoverProtocol(hosts []*HostInfo) (int, error) {
-	hosts = shuffleHosts(hosts)
+// isProtocolVersionError reports whether err is a node rejecting the protocol
+// version used to connect to it. Some nodes reply with a protocol error, older
+// ones just close the connection.
+func isProtocolVersionError(err error) bool {
+	switch v := err.(type) {
+	case *protocolError, ErrProtocol:
+		return true
+	case RequestError:
+		return v.Code() == ErrCodeProtocol ||
+			strings.Contains(strings.ToLower(v.Message()), "protocol version")
+	}
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// discoverProtocol returns the highest protocol version in versions that is
+// accepted by one of the hosts, tried in order. When a host rejects a version,
+// the next attempt uses the greatest version the host reported to support, or
+// the version right below the rejected one if it did not say. If no host
+// accepts any version, the error is a *ControlConnError holding the error of
+// each host.
+func (c *controlConn) discoverProtocol(hosts []*HostInfo, versions ProtoVersionRange) (int, error) {
+	if len(hosts) == 0 {
+		return 0, errors.New("control: no endpoints specified")
+	}
 
 	connCfg := *c.session.connCfg
-	connCfg.ProtoVersion = 4 // TODO: define maxProtocol
 
 	handler := connErrorHandlerFn(func(c *Conn, err error, closed bool) {
 		// we should never get here, but if we do it means we connected to a
@@ -202,56 +309,79 @@ func (c *controlConn) discoverProtocol(hosts []*HostInfo) (int, error) {
 		}
 	})
 
-	var err error
+	connErr := &ControlConnError{}
 	for _, host := range hosts {
-		var conn *Conn
-		conn, err = c.session.dial(c.session.ctx, host, &connCfg, handler)
-		if conn != nil {
-			conn.Close()
-		}
+		var err error
+		proto := versions.Max
+		for proto >= versions.Min {
+			connCfg.ProtoVersion = proto
+
+			var conn *Conn
+			conn, err = c.session.dial(c.session.ctx, host, &connCfg, handler)
+			if conn != nil {
+				conn.Close()
+			}
 
-		if err == nil {
-			return connCfg.ProtoVersion, nil
+			if err == nil {
+				return proto, nil
+			}
+
+			if !isProtocolVersionError(err) {
+				break
+			}
+
+			next := proto - 1
+			if supported := parseProtocolFromError(err); supported > 0 && supported < proto {
+				next = supported
+			}
+			proto = next
 		}
 
-		if proto := parseProtocolFromError(err); proto > 0 {
-			return proto, nil
+		if proto < versions.Min {
+			err = fmt.Errorf("no protocol version in range [%d, %d] is supported by %v: %w",
+				versions.Min, versions.Max, host.ConnectAddress(), err)
 		}
+		connErr.Errors = append(connErr.Errors, SeedError{Host: host, Err: err})
 	}
 
-	return 0, err
+	return 0, connErr
 }
 
+// connect opens the control connection to the first of hosts, tried in order,
+// which accepts it.
 func (c *controlConn) connect(hosts []*HostInfo) error {
 	if len(hosts) == 0 {
 		return errors.New("control: no endpoints specified")
 	}
 
-	// shuffle endpoints so not all drivers will connect to the same initial
-	// node.
-	hosts = shuffleHosts(hosts)
-
 	cfg := *c.session.connCfg
 	cfg.disableCoalesce = true
 
 	var conn *Conn
-	var err error
+	connErr := &ControlConnError{}
 	for _, host := range hosts {
+		var err error
 		conn, err = c.session.dial(c.session.ctx, host, &cfg, c)
 		if err != nil {
-			c.session.logger.Printf("gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			logEvent(c.session.logger, LogLevelWarn, "unable to dial control conn",
+				[]LogField{{"host", host.ConnectAddress()}, {"port", host.Port()}, {"error", err}},
+				"gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			connErr.Errors = append(connErr.Errors, SeedError{Host: host, Err: err})
 			continue
 		}
 		err = c.setupConn(conn)
 		if err == nil {
 			break
 		}
-		c.session.logger.Printf("gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+		logEvent(c.session.logger, LogLevelWarn, "unable setup control conn",
+			[]LogField{{"host", host.ConnectAddress()}, {"port", host.Port()}, {"error", err}},
+			"gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+		connErr.Errors = append(connErr.Errors, SeedError{Host: host, Err: err})
 		conn.Close()
 		conn = nil
 	}
 	if conn == nil {
-		return fmt.Errorf("unable to connect to initial hosts: %v", err)
+		return connErr
 	}
 
 	// we could fetch the initial ring here and update initial host data. So that
@@ -270,7 +400,11 @@ type connHost struct {
 func (c *controlConn) setupConn(conn *Conn) error {
 	// we need up-to-date host info for the filterHost call below
 	iter := conn.querySystemLocal(context.TODO())
-	host, err := c.session.hostInfoFromIter(iter, conn.host.connectAddress, conn.conn.RemoteAddr().(*net.TCPAddr).Port)
+	port := conn.host.Port()
+	if addr, ok := conn.remoteAddr.(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+	host, err := c.session.hostInfoFromIter(iter, conn.host.connectAddress, port)
 	if err != nil {
 		return err
 	}
@@ -291,6 +425,9 @@ func (c *controlConn) setupConn(conn *Conn) error {
 	}
 
 	c.conn.Store(ch)
+	if o, ok := c.session.policy.(controlHostObserver); ok {
+		o.controlHostChanged(host)
+	}
 	if c.session.initialized() {
 		// We connected to control conn, so add the connect the host in pool as well.
 		// Notify session we can start trying to connect to the node.
@@ -350,13 +487,15 @@ func (c *controlConn) reconnect() {
 	conn, err := c.attemptReconnect()
 
 	if conn == nil {
-		c.session.logger.Printf("gocql: unable to reconnect control connection: %v\n", err)
+		logEvent(c.session.logger, LogLevelError, "unable to reconnect control connection", []LogField{{"error", err}},
+			"gocql: unable to reconnect control connection: %v\n", err)
 		return
 	}
 
 	err = c.session.refreshRing()
 	if err != nil {
-		c.session.logger.Printf("gocql: unable to refresh ring: %v\n", err)
+		logEvent(c.session.logger, LogLevelWarn, "unable to refresh ring", []LogField{{"error", err}},
+			"gocql: unable to refresh ring: %v\n", err)
 	}
 }
 
@@ -383,8 +522,10 @@ func (c *controlConn) attemptReconnect() (*Conn, error) {
 		return conn, err
 	}
 
-	c.session.logger.Printf("gocql: unable to connect to any ring node: %v\n", err)
-	c.session.logger.Printf("gocql: control falling back to initial contact points.\n")
+	logEvent(c.session.logger, LogLevelWarn, "unable to connect to any ring node", []LogField{{"error", err}},
+		"gocql: unable to connect to any ring node: %v\n", err)
+	logEvent(c.session.logger, LogLevelWarn, "control falling back to initial contact points", nil,
+		"gocql: control falling back to initial contact points.\n")
 	// Fallback to initial contact points, as it may be the case that all known initialHosts
 	// changed their IPs while keeping the same hostname(s).
 	initialHosts, resolvErr := addrsToHosts(c.session.cfg.Hosts, c.session.cfg.Port, c.session.logger)
@@ -401,14 +542,18 @@ func (c *controlConn) attemptReconnectToAnyOfHosts(hosts []*HostInfo) (*Conn, er
 	for _, host := range hosts {
 		conn, err = c.session.connect(c.session.ctx, host, c)
 		if err != nil {
-			c.session.logger.Printf("gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+			logEvent(c.session.logger, LogLevelWarn, "unable to dial control conn",
+				[]LogField{{"host", host.ConnectAddress()}, {"port", host.Port()}, {"error", err}},
+				"gocql: unable to dial control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
 			continue
 		}
 		err = c.setupConn(conn)
 		if err == nil {
 			break
 		}
-		c.session.logger.Printf("gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
+		logEvent(c.session.logger, LogLevelWarn, "unable setup control conn",
+			[]LogField{{"host", host.ConnectAddress()}, {"port", host.Port()}, {"error", err}},
+			"gocql: unable setup control conn %v:%v: %v\n", host.ConnectAddress(), host.Port(), err)
 		conn.Close()
 		conn = nil
 	}
@@ -490,11 +635,11 @@ func (c *controlConn) query(statement string, values ...interface{}) (iter *Iter
 		})
 
 		if gocqlDebug && iter.err != nil {
-			c.session.logger.Printf("control: error executing %q: %v\n", statement, iter.err)
+			logf(c.session.logger, LogLevelWarn, "control: error executing %q: %v\n", statement, iter.err)
 		}
 
 		q.AddAttempts(1, c.getConn().host)
-		if iter.err == nil || !c.retry.Attempt(q) {
+		if iter.err == nil || !attemptRetry(c.retry, q, iter.err) {
 			break
 		}
 	}
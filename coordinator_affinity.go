@@ -0,0 +1,68 @@
+package gocql
+
+import (
+	"context"
+	"sync"
+)
+
+// coordinatorAffinity is the coordinator shared by the queries executed with a
+// context returned by Session.WithCoordinatorAffinity.
+type coordinatorAffinity struct {
+	session *Session
+
+	mu   sync.Mutex
+	host *HostInfo
+}
+
+type coordinatorAffinityKey struct{}
+
+// WithCoordinatorAffinity returns a context derived from ctx which pins the
+// queries and batches of the session executed with it to the same coordinator,
+// for example so that a sequence of dependent lightweight transactions is
+// coordinated by a single host, avoiding Paxos contention between
+// coordinators.
+//
+// The coordinator is the host which executed the first query, chosen by the
+// host selection policy. The following queries are only sent to it, without
+// retrying them on other hosts, and are routed by the host selection policy
+// again once it is down, the host which executes the query becoming the new
+// coordinator. Queries pinned to a host with Query.RoutingToHost are not
+// affected.
+func (s *Session) WithCoordinatorAffinity(ctx context.Context) context.Context {
+	return context.WithValue(ctx, coordinatorAffinityKey{}, &coordinatorAffinity{session: s})
+}
+
+// coordinatorAffinityFrom returns the coordinator affinity of ctx for s, if any.
+func coordinatorAffinityFrom(ctx context.Context, s *Session) *coordinatorAffinity {
+	a, ok := ctx.Value(coordinatorAffinityKey{}).(*coordinatorAffinity)
+	if !ok || a.session != s {
+		return nil
+	}
+	return a
+}
+
+// pinned returns the coordinator, or nil if none was chosen yet or it is down
+// or a is nil.
+func (a *coordinatorAffinity) pinned() *HostInfo {
+	if a == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.host == nil || !a.host.IsUp() {
+		return nil
+	}
+	return a.host
+}
+
+// executed records host as the coordinator if the previous one is down.
+func (a *coordinatorAffinity) executed(host *HostInfo) {
+	if host == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.host == nil || !a.host.IsUp() {
+		a.host = host
+	}
+}
@@ -0,0 +1,102 @@
+package gocql
+
+import (
+	"errors"
+	"math/big"
+)
+
+// Decimal is an exact representation of the CQL decimal type, the value is
+// Unscaled * 10^-Scale. A nil Unscaled is zero.
+type Decimal struct {
+	Unscaled *big.Int
+	Scale    int32
+}
+
+var bigTen = big.NewInt(10)
+
+var errInexactDecimal = errors.New("rational number has no exact decimal representation")
+
+// DecimalFromRat returns the decimal representation of r. It returns an error
+// if r can't be represented exactly, i.e. if its denominator has prime factors
+// other than 2 and 5.
+func DecimalFromRat(r *big.Rat) (Decimal, error) {
+	denom := new(big.Int).Set(r.Denom())
+
+	// denom = 2^twos * 5^fives * rest, the scale needed is max(twos, fives)
+	twos := denom.TrailingZeroBits()
+	denom.Rsh(denom, twos)
+	var fives uint
+	five := big.NewInt(5)
+	mod := new(big.Int)
+	for {
+		q, m := new(big.Int).QuoRem(denom, five, mod)
+		if m.Sign() != 0 {
+			break
+		}
+		denom = q
+		fives++
+	}
+	if denom.Cmp(bigOne) != 0 {
+		return Decimal{}, errInexactDecimal
+	}
+
+	scale := twos
+	if fives > scale {
+		scale = fives
+	}
+	unscaled := new(big.Int).Exp(bigTen, big.NewInt(int64(scale)), nil)
+	unscaled.Mul(unscaled, r.Num())
+	unscaled.Quo(unscaled, r.Denom())
+	return Decimal{Unscaled: unscaled, Scale: int32(scale)}, nil
+}
+
+// Rat returns d as a rational number.
+func (d Decimal) Rat() *big.Rat {
+	r := new(big.Rat)
+	if d.Unscaled == nil {
+		return r
+	}
+	r.SetInt(d.Unscaled)
+	pow := new(big.Int).Exp(bigTen, big.NewInt(int64(abs32(d.Scale))), nil)
+	if d.Scale > 0 {
+		return r.Quo(r, new(big.Rat).SetInt(pow))
+	}
+	return r.Mul(r, new(big.Rat).SetInt(pow))
+}
+
+// String returns d in plain decimal notation.
+func (d Decimal) String() string {
+	if d.Scale <= 0 {
+		return d.Rat().FloatString(0)
+	}
+	return d.Rat().FloatString(int(d.Scale))
+}
+
+func abs32(v int32) int64 {
+	if v < 0 {
+		return -int64(v)
+	}
+	return int64(v)
+}
+
+func (d Decimal) marshal() []byte {
+	unscaled := d.Unscaled
+	if unscaled == nil {
+		unscaled = new(big.Int)
+	}
+	b := encBigInt2C(unscaled)
+	buf := make([]byte, 4+len(b))
+	copy(buf[0:4], encInt(d.Scale))
+	copy(buf[4:], b)
+	return buf
+}
+
+func unmarshalDecimalValue(data []byte) (Decimal, error) {
+	if len(data) < 4 {
+		return Decimal{}, unmarshalErrorf("decimal needs at least 4 bytes, while value has only %d", len(data))
+	}
+	return Decimal{
+		Unscaled: decBigInt2C(data[4:], nil),
+		Scale:    decInt(data[0:4]),
+	}, nil
+}
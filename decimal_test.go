@@ -0,0 +1,132 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"math/big"
+	"testing"
+
+	"gopkg.in/inf.v0"
+)
+
+func TestDecimalRoundTrip(t *testing.T) {
+	info := NativeType{proto: 4, typ: TypeDecimal}
+
+	huge, _ := new(big.Int).SetString("-123456789012345678901234567890123456789", 10)
+	tests := []struct {
+		dec Decimal
+		str string
+	}{
+		{Decimal{Unscaled: big.NewInt(12345), Scale: 2}, "123.45"},
+		{Decimal{Unscaled: big.NewInt(-12345), Scale: 2}, "-123.45"},
+		{Decimal{Unscaled: big.NewInt(-1), Scale: 40}, "-0.0000000000000000000000000000000000000001"},
+		{Decimal{Unscaled: big.NewInt(7), Scale: -3}, "7000"},
+		{Decimal{Unscaled: huge, Scale: 1000}, ""},
+		{Decimal{}, "0"},
+	}
+
+	for _, test := range tests {
+		data, err := Marshal(info, test.dec)
+		if err != nil {
+			t.Fatalf("marshal %v: %v", test.dec, err)
+		}
+
+		var got Decimal
+		if err := Unmarshal(info, data, &got); err != nil {
+			t.Fatalf("unmarshal %v: %v", test.dec, err)
+		}
+		if got.Scale != test.dec.Scale || got.Rat().Cmp(test.dec.Rat()) != 0 {
+			t.Errorf("expected %v, got %v", test.dec, got)
+		}
+		if test.str != "" && got.String() != test.str {
+			t.Errorf("expected %q, got %q", test.str, got.String())
+		}
+
+		// inf.Dec reads the same bytes
+		var dec inf.Dec
+		if err := Unmarshal(info, data, &dec); err != nil {
+			t.Fatal(err)
+		}
+		if int32(dec.Scale()) != test.dec.Scale {
+			t.Errorf("expected inf.Dec scale %d, got %d", test.dec.Scale, dec.Scale())
+		}
+
+		var rat big.Rat
+		if err := Unmarshal(info, data, &rat); err != nil {
+			t.Fatal(err)
+		}
+		if rat.Cmp(test.dec.Rat()) != 0 {
+			t.Errorf("expected %v, got %v", test.dec.Rat(), &rat)
+		}
+	}
+}
+
+func TestMarshalRatDecimal(t *testing.T) {
+	info := NativeType{proto: 4, typ: TypeDecimal}
+
+	tests := []struct {
+		rat   *big.Rat
+		scale int32
+	}{
+		{big.NewRat(1, 8), 3},
+		{big.NewRat(-3, 25), 2},
+		{big.NewRat(1, 1000000), 6},
+		{big.NewRat(42, 1), 0},
+	}
+	for _, test := range tests {
+		data, err := Marshal(info, test.rat)
+		if err != nil {
+			t.Fatalf("marshal %v: %v", test.rat, err)
+		}
+		var got Decimal
+		if err := Unmarshal(info, data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Scale != test.scale || got.Rat().Cmp(test.rat) != 0 {
+			t.Errorf("expected %v with scale %d, got %v with scale %d", test.rat, test.scale, got.Rat(), got.Scale)
+		}
+	}
+
+	if _, err := Marshal(info, big.NewRat(1, 3)); err == nil {
+		t.Error("expected an error marshaling 1/3")
+	}
+}
+
+func TestVarintBigRoundTrip(t *testing.T) {
+	info := NativeType{proto: 4, typ: TypeVarint}
+
+	for _, s := range []string{
+		"0",
+		"-1",
+		"128",
+		"-129",
+		"170141183460469231731687303715884105727",
+		"-170141183460469231731687303715884105728",
+		"-99999999999999999999999999999999999999999999999999",
+	} {
+		n, _ := new(big.Int).SetString(s, 10)
+		data, err := Marshal(info, n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got big.Int
+		if err := Unmarshal(info, data, &got); err != nil {
+			t.Fatal(err)
+		} else if got.Cmp(n) != 0 {
+			t.Errorf("expected %s, got %s", n, &got)
+		}
+
+		// strings don't go through int64
+		strData, err := Marshal(info, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var str string
+		if err := Unmarshal(info, strData, &str); err != nil {
+			t.Fatal(err)
+		} else if str != s {
+			t.Errorf("expected %s, got %s", s, str)
+		}
+	}
+}
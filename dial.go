@@ -6,9 +6,13 @@ import (
 	"fmt"
 	"net"
 	"strings"
+	"syscall"
 )
 
-// HostDialer allows customizing connection to cluster nodes.
+// HostDialer allows customizing connection to cluster nodes, e.g. to connect
+// through a SOCKS proxy or a custom tunnel. If no HostDialer is configured,
+// connections are established over TCP using ClusterConfig.Dialer or a
+// net.Dialer.
 type HostDialer interface {
 	// DialHost establishes a connection to the host.
 	// The returned connection must be directly usable for CQL protocol,
@@ -27,12 +31,21 @@ type DialedHost struct {
 	// DisableCoalesce disables write coalescing for the Conn.
 	// If true, the effect is the same as if WriteCoalesceWaitTime was configured to 0.
 	DisableCoalesce bool
+
+	// RemoteAddr is the address of the host the connection is established to.
+	// If nil, Conn.RemoteAddr() is used. Set it when connecting through a proxy,
+	// tunnel or service mesh which doesn't preserve the original address, so that
+	// the connection is still reported against the right host.
+	RemoteAddr net.Addr
 }
 
 // defaultHostDialer dials host in a default way.
 type defaultHostDialer struct {
 	dialer    Dialer
 	tlsConfig *tls.Config
+
+	// disableNoDelay enables Nagle's algorithm on TCP connections.
+	disableNoDelay bool
 }
 
 func (hd *defaultHostDialer) DialHost(ctx context.Context, host *HostInfo) (*DialedHost, error) {
@@ -45,19 +58,52 @@ func (hd *defaultHostDialer) DialHost(ctx context.Context, host *HostInfo) (*Dia
 		return nil, fmt.Errorf("host missing port: %v", port)
 	}
 
-	connAddr := host.ConnectAddressAndPort()
-	conn, err := hd.dialer.DialContext(ctx, "tcp", connAddr)
+	// the translated addresses of the host are tried in order
+	var (
+		conn net.Conn
+		err  error
+	)
+	for _, addr := range host.ConnectAddresses() {
+		conn, err = hd.dialer.DialContext(ctx, "tcp", addr.String())
+		if err == nil || ctx.Err() != nil {
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	if hd.disableNoDelay {
+		// Go enables TCP_NODELAY after the dialer's Control hook runs, so
+		// it has to be disabled on the connected socket.
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			if err := tcpConn.SetNoDelay(false); err != nil {
+				conn.Close()
+				return nil, err
+			}
+		}
+	}
 	addr := host.HostnameAndPort()
 	return WrapTLS(ctx, conn, addr, hd.tlsConfig)
 }
 
+// socketControl returns a net.Dialer Control hook applying the socket options
+// configured in cfg, or nil if there are none.
+func socketControl(cfg *ClusterConfig) func(network, address string, c syscall.RawConn) error {
+	if cfg.TCPUserTimeout <= 0 {
+		return nil
+	}
+	timeout := cfg.TCPUserTimeout
+	return func(network, address string, c syscall.RawConn) error {
+		return setTCPUserTimeout(c, timeout)
+	}
+}
+
 func tlsConfigForAddr(tlsConfig *tls.Config, addr string) *tls.Config {
 	// the TLS config is safe to be reused by connections but it must not
 	// be modified after being used.
-	if !tlsConfig.InsecureSkipVerify && tlsConfig.ServerName == "" {
+	// the server name is also needed by VerifyConnection when it verifies the
+	// certificates itself, see SslOptions.PinnedCertMode.
+	if (!tlsConfig.InsecureSkipVerify || tlsConfig.VerifyConnection != nil) && tlsConfig.ServerName == "" {
 		colonPos := strings.LastIndex(addr, ":")
 		if colonPos == -1 {
 			colonPos = len(addr)
@@ -66,6 +112,15 @@ func tlsConfigForAddr(tlsConfig *tls.Config, addr string) *tls.Config {
 		// clone config to avoid modifying the shared one.
 		tlsConfig = tlsConfig.Clone()
 		tlsConfig.ServerName = hostname
+		if verify := tlsConfig.VerifyConnection; verify != nil {
+			// IP addresses are not sent as server name, pass it anyway
+			tlsConfig.VerifyConnection = func(cs tls.ConnectionState) error {
+				if cs.ServerName == "" {
+					cs.ServerName = hostname
+				}
+				return verify(cs)
+			}
+		}
 	}
 	return tlsConfig
 }
@@ -0,0 +1,21 @@
+package gocql
+
+import (
+	"syscall"
+	"time"
+)
+
+// tcpUserTimeout is TCP_USER_TIMEOUT from linux/tcp.h, it is not defined by
+// the syscall package.
+const tcpUserTimeout = 0x12
+
+func setTCPUserTimeout(c syscall.RawConn, timeout time.Duration) error {
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout, int(timeout/time.Millisecond))
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
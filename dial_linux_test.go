@@ -0,0 +1,68 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestDialSocketOptions(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err == nil {
+			defer conn.Close()
+			conn.Read(make([]byte, 1))
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	cluster := NewCluster(addr.String())
+	cluster.TCPUserTimeout = 1500 * time.Millisecond
+	cluster.DisableTCPNoDelay = true
+	connCfg, err := connConfig(cluster)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	host := &HostInfo{connectAddress: addr.IP, port: addr.Port}
+	dialed, err := connCfg.HostDialer.DialHost(context.Background(), host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Conn.Close()
+
+	raw, err := dialed.Conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var userTimeout, noDelay int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		userTimeout, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpUserTimeout)
+		if sockErr != nil {
+			return
+		}
+		noDelay, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY)
+	}); err != nil {
+		t.Fatal(err)
+	} else if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+
+	if userTimeout != 1500 {
+		t.Errorf("expected TCP_USER_TIMEOUT to be 1500ms, got %d", userTimeout)
+	}
+	if noDelay != 0 {
+		t.Errorf("expected TCP_NODELAY to be disabled, got %d", noDelay)
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package gocql
+
+import (
+	"syscall"
+	"time"
+)
+
+// setTCPUserTimeout is a no-op, TCP_USER_TIMEOUT is only supported on Linux.
+func setTCPUserTimeout(c syscall.RawConn, timeout time.Duration) error {
+	return nil
+}
@@ -328,6 +328,9 @@
 // is still executing. The two parallel executions of the query race to return a result, the first received result will
 // be returned.
 //
+// Query.NoRetry and Batch.NoRetry guarantee a single attempt regardless of the retry and speculative execution
+// policies, for statements which must never be executed twice.
+//
 // # User-defined types
 //
 // UDTs can be mapped (un)marshaled from/to map[string]interface{} a Go struct (or a type implementing
@@ -350,6 +353,7 @@
 //   - BatchObserver for monitoring batch queries.
 //   - ConnectObserver for monitoring new connections from the driver to the database.
 //   - FrameHeaderObserver for monitoring individual protocol frames.
+//   - FrameObserver for inspecting the raw bytes of protocol frames when debugging.
 //
 // CQL protocol also supports tracing of queries. When enabled, the database will write information about
 // internal events that happened during execution of the query. You can use Query.Trace to request tracing and receive
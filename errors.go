@@ -1,6 +1,9 @@
 package gocql
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // See CQL Binary Protocol v5, section 8 for more details.
 // https://github.com/apache/cassandra/blob/7337fc0/doc/native_protocol_v5.spec
@@ -196,3 +199,99 @@ type RequestErrCASWriteUnknown struct {
 	Received    int
 	BlockFor    int
 }
+
+// RateLimitOpType is the type of operation rejected by a rate limit.
+type RateLimitOpType byte
+
+const (
+	RateLimitOpRead  RateLimitOpType = 0
+	RateLimitOpWrite RateLimitOpType = 1
+)
+
+func (t RateLimitOpType) String() string {
+	switch t {
+	case RateLimitOpRead:
+		return "read"
+	case RateLimitOpWrite:
+		return "write"
+	default:
+		return fmt.Sprintf("unknown rate limit operation %d", byte(t))
+	}
+}
+
+// RequestErrRateLimitReached is returned by Scylla when the per-partition rate
+// limit of a table was exceeded. Retrying immediately only adds load to the
+// partition, the request should be retried with a backoff, eg. using
+// ExponentialBackoffRetryPolicy.
+//
+// The error is only reported if the server supports the SCYLLA_RATE_LIMIT_ERROR
+// protocol extension, which is negotiated when connecting.
+//
+// See https://github.com/scylladb/scylladb/blob/master/docs/dev/protocol-extensions.md
+type RequestErrRateLimitReached struct {
+	errorFrame
+	OpType                RateLimitOpType
+	RejectedByCoordinator bool
+}
+
+func (e *RequestErrRateLimitReached) String() string {
+	return fmt.Sprintf("[request_error_rate_limit_reached op_type=%s rejected_by_coordinator=%t]", e.OpType, e.RejectedByCoordinator)
+}
+
+// ReplicaResponses are the replicas which responded to a request before it
+// failed, as reported by the coordinator in the error, see
+// RequestErrReplicaResponses.
+type ReplicaResponses struct {
+	Consistency Consistency
+	// Received is the number of replicas which acknowledged the request.
+	Received int
+	// BlockFor is the number of acknowledgements required by Consistency.
+	BlockFor int
+	// Failures is the number of replicas which failed the request, it is
+	// only reported by the read and write failure errors.
+	Failures int
+}
+
+func (r ReplicaResponses) String() string {
+	return fmt.Sprintf("consistency=%s received=%d block_for=%d failures=%d", r.Consistency, r.Received, r.BlockFor, r.Failures)
+}
+
+// ReplicaResponses returns the replicas which responded before the read timed out.
+func (e *RequestErrReadTimeout) ReplicaResponses() ReplicaResponses {
+	return ReplicaResponses{Consistency: e.Consistency, Received: e.Received, BlockFor: e.BlockFor}
+}
+
+// ReplicaResponses returns the replicas which responded before the write timed out.
+func (e *RequestErrWriteTimeout) ReplicaResponses() ReplicaResponses {
+	return ReplicaResponses{Consistency: e.Consistency, Received: e.Received, BlockFor: e.BlockFor}
+}
+
+// ReplicaResponses returns the replicas which responded to the failed read.
+func (e *RequestErrReadFailure) ReplicaResponses() ReplicaResponses {
+	return ReplicaResponses{Consistency: e.Consistency, Received: e.Received, BlockFor: e.BlockFor, Failures: e.NumFailures}
+}
+
+// ReplicaResponses returns the replicas which responded to the failed write.
+func (e *RequestErrWriteFailure) ReplicaResponses() ReplicaResponses {
+	return ReplicaResponses{Consistency: e.Consistency, Received: e.Received, BlockFor: e.BlockFor, Failures: e.NumFailures}
+}
+
+// ReplicaResponses returns the replicas which responded to the Paxos round.
+func (e *RequestErrCASWriteUnknown) ReplicaResponses() ReplicaResponses {
+	return ReplicaResponses{Consistency: e.Consistency, Received: e.Received, BlockFor: e.BlockFor}
+}
+
+// RequestErrReplicaResponses returns the replicas which responded to the
+// request which failed with err, if err or an error it wraps is a read or
+// write timeout or failure, or a RequestErrCASWriteUnknown. Successful
+// responses don't report the replicas which responded, tracing does, see
+// Session.TraceSummary.
+func RequestErrReplicaResponses(err error) (ReplicaResponses, bool) {
+	var rerr interface {
+		ReplicaResponses() ReplicaResponses
+	}
+	if errors.As(err, &rerr) {
+		return rerr.ReplicaResponses(), true
+	}
+	return ReplicaResponses{}, false
+}
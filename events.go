@@ -76,7 +76,7 @@ func (e *eventDebouncer) debounce(frame frame) {
 	if len(e.events) < eventBufferSize {
 		e.events = append(e.events, frame)
 	} else {
-		e.logger.Printf("%s: buffer full, dropping event frame: %s", e.name, frame)
+		logf(e.logger, LogLevelWarn, "%s: buffer full, dropping event frame: %s", e.name, frame)
 	}
 
 	e.mu.Unlock()
@@ -85,12 +85,12 @@ func (e *eventDebouncer) debounce(frame frame) {
 func (s *Session) handleEvent(framer *framer) {
 	frame, err := framer.parseFrame()
 	if err != nil {
-		s.logger.Printf("gocql: unable to parse event frame: %v\n", err)
+		logf(s.logger, LogLevelWarn, "gocql: unable to parse event frame: %v\n", err)
 		return
 	}
 
 	if gocqlDebug {
-		s.logger.Printf("gocql: handling frame: %v\n", frame)
+		logf(s.logger, LogLevelDebug, "gocql: handling frame: %v\n", frame)
 	}
 
 	switch f := frame.(type) {
@@ -101,7 +101,7 @@ func (s *Session) handleEvent(framer *framer) {
 	case *topologyChangeEventFrame, *statusChangeEventFrame:
 		s.nodeEvents.debounce(frame)
 	default:
-		s.logger.Printf("gocql: invalid event frame (%T): %v\n", f, f)
+		logf(s.logger, LogLevelWarn, "gocql: invalid event frame (%T): %v\n", f, f)
 	}
 }
 
@@ -110,16 +110,16 @@ func (s *Session) handleSchemaEvent(frames []frame) {
 	for _, frame := range frames {
 		switch f := frame.(type) {
 		case *schemaChangeKeyspace:
-			s.schemaDescriber.clearSchema(f.keyspace)
+			s.schemaDescriber.keyspaceChanged(f.keyspace, f.change)
 			s.handleKeyspaceChange(f.keyspace, f.change)
 		case *schemaChangeTable:
-			s.schemaDescriber.clearSchema(f.keyspace)
+			s.schemaDescriber.tableChanged(f.keyspace, f.object, f.change)
 		case *schemaChangeAggregate:
 			s.schemaDescriber.clearSchema(f.keyspace)
 		case *schemaChangeFunction:
 			s.schemaDescriber.clearSchema(f.keyspace)
 		case *schemaChangeType:
-			s.schemaDescriber.clearSchema(f.keyspace)
+			s.schemaDescriber.typeChanged(f.keyspace, f.object, f.change)
 		}
 	}
 }
@@ -172,7 +172,7 @@ func (s *Session) handleNodeEvent(frames []frame) {
 
 	for _, f := range sEvents {
 		if gocqlDebug {
-			s.logger.Printf("gocql: dispatching status change event: %+v\n", f)
+			logf(s.logger, LogLevelDebug, "gocql: dispatching status change event: %+v\n", f)
 		}
 
 		// ignore events we received if they were disabled
@@ -192,7 +192,7 @@ func (s *Session) handleNodeEvent(frames []frame) {
 
 func (s *Session) handleNodeUp(eventIp net.IP, eventPort int) {
 	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeUp: %s:%d\n", eventIp.String(), eventPort)
+		logf(s.logger, LogLevelDebug, "gocql: Session.handleNodeUp: %s:%d\n", eventIp.String(), eventPort)
 	}
 
 	host, ok := s.ring.getHostByIP(eventIp.String())
@@ -208,7 +208,54 @@ func (s *Session) handleNodeUp(eventIp net.IP, eventPort int) {
 	if d := host.Version().nodeUpDelay(); d > 0 {
 		time.Sleep(d)
 	}
-	s.startPoolFill(host)
+	s.staggerReconnect(host, s.startPoolFill)
+}
+
+// staggerReconnect calls reconnect with host after the random delay of
+// reconnectionStagger, or right away if ReconnectionStaggerMax is not set.
+func (s *Session) staggerReconnect(host *HostInfo, reconnect func(*HostInfo)) {
+	hosts := s.ring.allHosts()
+	down := 0
+	for _, h := range hosts {
+		if !h.IsUp() {
+			down++
+		}
+	}
+	delay := reconnectionStagger(s.cfg.ReconnectionStaggerMax, down, len(hosts))
+	if delay <= 0 {
+		reconnect(host)
+		return
+	}
+
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			reconnect(host)
+		case <-s.ctx.Done():
+		}
+	}()
+}
+
+// reconnectionStagger returns a random delay before reconnecting to a host
+// when down of total hosts are down, up to staggerMax in proportion to the
+// share of hosts which are down.
+func reconnectionStagger(staggerMax time.Duration, down, total int) time.Duration {
+	if staggerMax <= 0 || down <= 0 || total <= 0 {
+		return 0
+	}
+	if down > total {
+		down = total
+	}
+	bound := int64(staggerMax) * int64(down) / int64(total)
+	if bound <= 0 {
+		return 0
+	}
+
+	mutRandr.Lock()
+	defer mutRandr.Unlock()
+	return time.Duration(randr.Int63n(bound))
 }
 
 func (s *Session) startPoolFill(host *HostInfo) {
@@ -220,7 +267,7 @@ func (s *Session) startPoolFill(host *HostInfo) {
 
 func (s *Session) handleNodeConnected(host *HostInfo) {
 	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeConnected: %s:%d\n", host.ConnectAddress(), host.Port())
+		logf(s.logger, LogLevelDebug, "gocql: Session.handleNodeConnected: %s:%d\n", host.ConnectAddress(), host.Port())
 	}
 
 	host.setState(NodeUp)
@@ -232,7 +279,7 @@ func (s *Session) handleNodeConnected(host *HostInfo) {
 
 func (s *Session) handleNodeDown(ip net.IP, port int) {
 	if gocqlDebug {
-		s.logger.Printf("gocql: Session.handleNodeDown: %s:%d\n", ip.String(), port)
+		logf(s.logger, LogLevelDebug, "gocql: Session.handleNodeDown: %s:%d\n", ip.String(), port)
 	}
 
 	host, ok := s.ring.getHostByIP(ip.String())
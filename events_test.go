@@ -1,9 +1,12 @@
 package gocql
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestEventDebounce(t *testing.T) {
@@ -31,3 +34,72 @@ func TestEventDebounce(t *testing.T) {
 		t.Fatalf("expected to see %d events but got %d", eventCount, eventsSeen)
 	}
 }
+
+func TestReconnectionStagger(t *testing.T) {
+	const staggerMax = time.Second
+	if d := reconnectionStagger(0, 100, 100); d != 0 {
+		t.Fatalf("expected no delay when disabled, got %v", d)
+	}
+	for i := 0; i < 100; i++ {
+		if d := reconnectionStagger(staggerMax, 1, 100); d < 0 || d >= staggerMax/100 {
+			t.Fatalf("expected a delay below %v with 1 of 100 hosts down, got %v", staggerMax/100, d)
+		}
+		if d := reconnectionStagger(staggerMax, 100, 100); d < 0 || d >= staggerMax {
+			t.Fatalf("expected a delay below %v with all hosts down, got %v", staggerMax, d)
+		}
+	}
+}
+
+func TestReconnectionStaggerSimulation(t *testing.T) {
+	const (
+		numHosts   = 100
+		staggerMax = 500 * time.Millisecond
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := &Session{ctx: ctx}
+	s.cfg.ReconnectionStaggerMax = staggerMax
+
+	// the whole cluster goes down
+	for i := 0; i < numHosts; i++ {
+		host := &HostInfo{hostId: fmt.Sprintf("host-%d", i), connectAddress: net.IPv4(10, 0, byte(i/250), byte(i%250+1))}
+		s.ring.addOrUpdate(host).setState(NodeDown)
+	}
+
+	// and comes back up all at once
+	start := time.Now()
+	reconnected := make(chan time.Duration, numHosts)
+	for _, host := range s.ring.allHosts() {
+		s.staggerReconnect(host, func(h *HostInfo) {
+			reconnected <- time.Since(start)
+		})
+	}
+
+	const buckets = 5
+	var counts [buckets]int
+	var last time.Duration
+	for i := 0; i < numHosts; i++ {
+		select {
+		case d := <-reconnected:
+			if d > last {
+				last = d
+			}
+			if b := int(d * buckets / staggerMax); b < buckets {
+				counts[b]++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for reconnections, got %d", i)
+		}
+	}
+
+	// reconnections are spread over staggerMax rather than all made at once,
+	// each fifth of it getting about 20 of them
+	for b, n := range counts {
+		if n > numHosts/2 {
+			t.Fatalf("expected reconnections to be staggered, got %d of %d in interval %d: %v", n, numHosts, b, counts)
+		}
+	}
+	if last < staggerMax/2 {
+		t.Fatalf("expected reconnections to be spread over %v, the last one was after %v", staggerMax, last)
+	}
+}
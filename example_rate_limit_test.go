@@ -0,0 +1,56 @@
+package gocql_test
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/gocql/gocql"
+)
+
+// rateLimitRetryPolicy retries only requests rejected by a per-partition rate
+// limit, backing off exponentially between attempts.
+type rateLimitRetryPolicy struct {
+	gocql.ExponentialBackoffRetryPolicy
+}
+
+func (p *rateLimitRetryPolicy) GetRetryType(err error) gocql.RetryType {
+	var rateLimitErr *gocql.RequestErrRateLimitReached
+	if errors.As(err, &rateLimitErr) {
+		// the limit applies to the partition, other replicas reject it as well
+		return gocql.Retry
+	}
+	return gocql.Rethrow
+}
+
+// ExampleRequestErrRateLimitReached demonstrates how to back off when Scylla
+// rejects a request because of a per-partition rate limit.
+func ExampleRequestErrRateLimitReached() {
+	/* The example assumes the following CQL was used to setup the keyspace:
+	create keyspace example with replication = { 'class' : 'SimpleStrategy', 'replication_factor' : 1 };
+	create table example.my_table(pk int, value text, PRIMARY KEY(pk))
+		with per_partition_rate_limit = {'max_writes_per_second': 100};
+	*/
+	cluster := gocql.NewCluster("localhost:9042")
+	cluster.Keyspace = "example"
+	cluster.RetryPolicy = &rateLimitRetryPolicy{gocql.ExponentialBackoffRetryPolicy{
+		NumRetries: 5,
+		Min:        50 * time.Millisecond,
+		Max:        2 * time.Second,
+	}}
+	session, err := cluster.CreateSession()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer session.Close()
+
+	err = session.Query("INSERT INTO example.my_table (pk, value) VALUES (?, ?)", 1, "a").Exec()
+	var rateLimitErr *gocql.RequestErrRateLimitReached
+	if errors.As(err, &rateLimitErr) {
+		log.Printf("%s rejected by the rate limit after retries", rateLimitErr.OpType)
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,204 @@
+package gocql
+
+import (
+	"strings"
+)
+
+// statementFingerprint returns stmt without comments and with whitespace
+// collapsed. If keepLiterals is set, unquoted identifiers and keywords, which
+// are case insensitive, are lowered so that statements with the same result
+// are the same statement; this is the text prepared statements are cached by.
+// Otherwise literals are replaced by ? and lists of values such as IN (1, 2, 3)
+// are collapsed to a single ?, so that statements only differing by the values
+// they embed have the same fingerprint.
+func statementFingerprint(stmt string, keepLiterals bool) string {
+	f := fingerprinter{keepLiterals: keepLiterals}
+	f.b.Grow(len(stmt))
+
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			f.space = true
+			i++
+		case strings.HasPrefix(stmt[i:], "--"), strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			f.space = true
+			i += end
+		case strings.HasPrefix(stmt[i:], "/*"):
+			i = skipPast(stmt, i+2, "*/")
+			f.space = true
+		case c == '\'':
+			end := skipQuoted(stmt, i, '\'')
+			f.value(stmt[i:end])
+			i = end
+		case strings.HasPrefix(stmt[i:], "$$"):
+			end := skipPast(stmt, i+2, "$$")
+			f.value(stmt[i:end])
+			i = end
+		case c == '"':
+			// quoted identifier, kept as is
+			end := skipQuoted(stmt, i, '"')
+			f.write(stmt[i:end])
+			i = end
+		case c == '?':
+			f.value("?")
+			i++
+		case c == ',' && f.placeholder && !f.comma:
+			f.comma = true
+			f.space = false
+			i++
+		case i+36 <= len(stmt) && isUUIDLiteral(stmt[i:i+36]) && (i+36 == len(stmt) || !isWordByte(stmt[i+36])):
+			f.value(stmt[i : i+36])
+			i += 36
+		case isDigit(c) || (c == '-' && i+1 < len(stmt) && isDigit(stmt[i+1]) && !f.afterOperand()):
+			end := skipNumber(stmt, i)
+			f.value(stmt[i:end])
+			i = end
+		case isWordByte(c):
+			end := i + 1
+			for end < len(stmt) && isWordByte(stmt[end]) {
+				end++
+			}
+			if f.keepLiterals {
+				f.write(strings.ToLower(stmt[i:end]))
+			} else {
+				f.write(stmt[i:end])
+			}
+			i = end
+		default:
+			f.write(stmt[i : i+1])
+			i++
+		}
+	}
+	if f.placeholder && f.comma {
+		f.b.WriteByte(',')
+	}
+	return f.b.String()
+}
+
+type fingerprinter struct {
+	b            strings.Builder
+	keepLiterals bool
+	// space is set when whitespace has to be written before the next token.
+	space bool
+	// placeholder is set while the output ends with a ?, comma if the ? was
+	// followed by a comma which is only written if no value follows.
+	placeholder, comma bool
+}
+
+// value writes the literal lit, or a ? if literals are not kept.
+func (f *fingerprinter) value(lit string) {
+	if f.keepLiterals {
+		f.write(lit)
+		return
+	}
+	if f.placeholder && f.comma {
+		// the value is part of a list, drop the comma
+		f.comma = false
+		f.space = false
+		return
+	}
+	if f.placeholder {
+		f.space = false
+		return
+	}
+	f.write("?")
+	f.placeholder = true
+}
+
+func (f *fingerprinter) write(s string) {
+	if f.placeholder && f.comma {
+		f.b.WriteByte(',')
+	}
+	if f.space && f.b.Len() > 0 {
+		f.b.WriteByte(' ')
+	}
+	f.space = false
+	f.placeholder, f.comma = false, false
+	f.b.WriteString(s)
+}
+
+// afterOperand reports whether a - following the output is a binary operator
+// rather than the sign of a number.
+func (f *fingerprinter) afterOperand() bool {
+	s := f.b.String()
+	if s == "" || f.comma {
+		return false
+	}
+	last := s[len(s)-1]
+	return isWordByte(last) || last == '?' || last == ')' || last == '"'
+}
+
+// skipPast returns the index following the first end in s at or after i.
+func skipPast(s string, i int, end string) int {
+	n := strings.Index(s[i:], end)
+	if n < 0 {
+		return len(s)
+	}
+	return i + n + len(end)
+}
+
+// skipQuoted returns the index following the string quoted with quote starting
+// at i, a quote is escaped by doubling it.
+func skipQuoted(s string, i int, quote byte) int {
+	for i++; i < len(s); i++ {
+		if s[i] != quote {
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == quote {
+			i++
+			continue
+		}
+		return i + 1
+	}
+	return len(s)
+}
+
+// skipNumber returns the index following the integer, float or blob literal
+// starting at i.
+func skipNumber(s string, i int) int {
+	if s[i] == '-' {
+		i++
+	}
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case isWordByte(c) || c == '.':
+			i++
+		case (c == '-' || c == '+') && (s[i-1] == 'e' || s[i-1] == 'E'):
+			i++
+		default:
+			return i
+		}
+	}
+	return i
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || c == '_'
+}
+
+func isUUIDLiteral(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch i {
+		case 8, 13, 18, 23:
+			if c != '-' {
+				return false
+			}
+		default:
+			if !isDigit(c) && !(c >= 'a' && c <= 'f') && !(c >= 'A' && c <= 'F') {
+				return false
+			}
+		}
+	}
+	return len(s) == 36
+}
@@ -0,0 +1,69 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import "testing"
+
+func TestStatementFingerprint(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+	}{
+		{"SELECT * FROM ks.tbl WHERE id = ?", "SELECT * FROM ks.tbl WHERE id = ?"},
+		{"SELECT  name\n\tFROM users WHERE id = 42", "SELECT name FROM users WHERE id = ?"},
+		{"SELECT * FROM t WHERE name = 'it''s' AND v = -1.5e-3", "SELECT * FROM t WHERE name = ? AND v = ?"},
+		{"SELECT * FROM t WHERE id IN (1, 2, 3)", "SELECT * FROM t WHERE id IN (?)"},
+		{"SELECT * FROM t WHERE id IN (?, ?,?)", "SELECT * FROM t WHERE id IN (?)"},
+		{"INSERT INTO t (a, b, c) VALUES (1, 'x', 0xcafe)", "INSERT INTO t (a, b, c) VALUES (?)"},
+		{"SELECT * FROM t WHERE id = 5f8e2b32-9c6a-11ee-8c90-0242ac120002", "SELECT * FROM t WHERE id = ?"},
+		{"SELECT * FROM t2 WHERE \"Col1\" = $$text$$", "SELECT * FROM t2 WHERE \"Col1\" = ?"},
+		{"UPDATE t SET c = c - 1 WHERE k = 2 -- decrement\n", "UPDATE t SET c = c - ? WHERE k = ?"},
+		{"SELECT /* hint */ v FROM t LIMIT 10", "SELECT v FROM t LIMIT ?"},
+		{"SELECT a, b FROM t WHERE m = {'k': 1}", "SELECT a, b FROM t WHERE m = {?: ?}"},
+	}
+
+	for _, test := range tests {
+		if got := statementFingerprint(test.stmt, false); got != test.expected {
+			t.Errorf("fingerprint of %q: expected %q, got %q", test.stmt, test.expected, got)
+		}
+	}
+}
+
+func TestNormalizeStatement(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+	}{
+		{"SELECT * FROM ks.tbl WHERE id = ?", "select * from ks.tbl where id = ?"},
+		{"select  *\n  FROM Ks.Tbl -- comment\n WHERE id = ?", "select * from ks.tbl where id = ?"},
+		{"SELECT \"Name\" FROM t WHERE v = 'It''s' AND n IN (1, 2)", "select \"Name\" from t where v = 'It''s' and n in (1, 2)"},
+		{"INSERT INTO t (k) VALUES (5F8E2B32-9C6A-11EE-8C90-0242AC120002) /* id */", "insert into t (k) values (5F8E2B32-9C6A-11EE-8C90-0242AC120002)"},
+		{"SELECT $$Text$$ FROM t", "select $$Text$$ from t"},
+	}
+
+	for _, test := range tests {
+		if got := statementFingerprint(test.stmt, true); got != test.expected {
+			t.Errorf("normalized %q: expected %q, got %q", test.stmt, test.expected, got)
+		}
+	}
+}
+
+func TestPreparedLRUCachesNormalizedStatements(t *testing.T) {
+	p := newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10})
+	stmt := "SELECT * FROM Ks.Tbl WHERE id = ?"
+	if got := p.keyFor("host", "ks", stmt); got != "hostks"+"select * from ks.tbl where id = ?" {
+		t.Fatalf("unexpected cache key %q", got)
+	}
+	if val, ok := p.normalized.lru.Get(stmt); !ok || val.(string) != "select * from ks.tbl where id = ?" {
+		t.Fatalf("expected the normalized statement to be cached, got %v", val)
+	}
+
+	p = newPreparedLRU(&ClusterConfig{MaxPreparedStmts: 10, DisablePreparedStatementNormalization: true})
+	if got := p.keyFor("host", "ks", stmt); got != "hostks"+stmt {
+		t.Fatalf("expected the statement to be used as is, got %q", got)
+	}
+	if p.normalized.lru.Len() != 0 {
+		t.Fatal("expected nothing to be normalized")
+	}
+}
@@ -148,6 +148,7 @@ const (
 	flagGlobalTableSpec int = 0x01
 	flagHasMorePages    int = 0x02
 	flagNoMetaData      int = 0x04
+	flagMetaDataChanged int = 0x08 // v5+
 
 	// query flags
 	flagValues                byte = 0x01
@@ -159,6 +160,11 @@ const (
 	flagWithNameValues        byte = 0x40
 	flagWithKeyspace          byte = 0x80
 
+	// v5+ query flags
+	flagWithNowInSeconds uint32 = 0x0100
+	// flagPageSizeBytes is the DSE extension of v5 for page sizes in bytes.
+	flagPageSizeBytes uint32 = 0x40000000
+
 	// prepare flags
 	flagWithPreparedKeyspace uint32 = 0x01
 
@@ -362,6 +368,57 @@ type FrameHeaderObserver interface {
 	ObserveFrameHeader(context.Context, ObservedFrameHeader)
 }
 
+// FrameDirection tells whether an observed frame was sent to or received from a host.
+type FrameDirection int
+
+const (
+	FrameSent FrameDirection = iota
+	FrameReceived
+)
+
+func (d FrameDirection) String() string {
+	switch d {
+	case FrameSent:
+		return "sent"
+	case FrameReceived:
+		return "received"
+	default:
+		return fmt.Sprintf("unknown_direction_%d", int(d))
+	}
+}
+
+type ObservedFrame struct {
+	Direction FrameDirection
+	Version   protoVersion
+	Flags     byte
+	Stream    int16
+	Opcode    frameOp
+
+	// Body is a copy of the frame body and can be retained by the observer.
+	// Received bodies are already decompressed, sent bodies are exactly what was
+	// written to the connection and are compressed if Flags has the compression bit set.
+	Body []byte
+
+	// Host is Host of the connection the frame was sent or received on.
+	Host *HostInfo
+}
+
+func (f ObservedFrame) String() string {
+	return fmt.Sprintf("[observed frame %s version=%s flags=0x%x stream=%d op=%s length=%d]",
+		f.Direction, f.Version, f.Flags, f.Stream, f.Opcode, len(f.Body))
+}
+
+// FrameObserver is the interface implemented by observers that want to see the raw
+// bytes of every frame sent and received on a connection. It is meant for debugging
+// protocol issues; it is very verbose and every observed frame body is copied, so it
+// should not be enabled on production systems.
+//
+// Experimental, this interface and use may change
+type FrameObserver interface {
+	// ObserveFrame gets called on every frame written to or read from a connection.
+	ObserveFrame(context.Context, ObservedFrame)
+}
+
 // a framer is responsible for reading, writing and parsing frames on a single stream
 type framer struct {
 	proto byte
@@ -382,6 +439,18 @@ type framer struct {
 	buf []byte
 
 	customPayload map[string][]byte
+
+	// rateLimitErrCode is the error code of RequestErrRateLimitReached if the
+	// SCYLLA_RATE_LIMIT_ERROR extension was negotiated, 0 otherwise.
+	rateLimitErrCode int
+
+	// sent is the time the request this frame responds to was written to the
+	// connection.
+	sent time.Time
+
+	// unknownTypes is the policy for types unknown to gocql read in result
+	// metadata, see ClusterConfig.UnknownTypePolicy.
+	unknownTypes UnknownTypePolicy
 }
 
 func newFramer(compressor Compressor, version byte) *framer {
@@ -580,6 +649,14 @@ func (f *framer) parseErrorFrame() frame {
 		message:     msg,
 	}
 
+	if f.rateLimitErrCode != 0 && code == f.rateLimitErrCode {
+		return &RequestErrRateLimitReached{
+			errorFrame:            errD,
+			OpType:                RateLimitOpType(f.readByte()),
+			RejectedByCoordinator: f.readByte() != 0,
+		}
+	}
+
 	switch code {
 	case ErrCodeUnavailable:
 		cl := f.readConsistency()
@@ -863,9 +940,17 @@ func (f *framer) readTypeInfo() TypeInfo {
 		simple.custom = f.readString()
 		if cassType := getApacheCassandraType(simple.custom); cassType != TypeCustom {
 			simple.typ = cassType
+		} else if f.unknownTypes == UnknownTypeRawBytes {
+			return UnknownTypeInfo{NativeType: simple}
 		}
 	}
 
+	if !simple.typ.known() && f.unknownTypes == UnknownTypeRawBytes {
+		// types with options can't be skipped, only the ones consisting of
+		// their ID can be read
+		return UnknownTypeInfo{NativeType: simple}
+	}
+
 	switch simple.typ {
 	case TypeTuple:
 		n := f.readShort()
@@ -990,6 +1075,9 @@ type resultMetadata struct {
 	// only if flagPageState
 	pagingState []byte
 
+	// only if flagMetaDataChanged
+	newMetadataID []byte
+
 	columns  []ColumnInfo
 	colCount int
 
@@ -1040,6 +1128,10 @@ func (f *framer) parseResultMetadata() resultMetadata {
 		meta.pagingState = copyBytes(f.readBytes())
 	}
 
+	if meta.flags&flagMetaDataChanged == flagMetaDataChanged {
+		meta.newMetadataID = copyBytes(f.readShortBytes())
+	}
+
 	if meta.flags&flagNoMetaData == flagNoMetaData {
 		return meta
 	}
@@ -1145,16 +1237,21 @@ type resultPreparedFrame struct {
 	frameHeader
 
 	preparedID []byte
-	reqMeta    preparedMetadata
-	respMeta   resultMetadata
+	// resultMetadataID identifies respMeta, v5+
+	resultMetadataID []byte
+	reqMeta          preparedMetadata
+	respMeta         resultMetadata
 }
 
 func (f *framer) parseResultPrepared() frame {
 	frame := &resultPreparedFrame{
 		frameHeader: *f.header,
 		preparedID:  f.readShortBytes(),
-		reqMeta:     f.parsePreparedMetadata(),
 	}
+	if f.proto > protoVersion4 {
+		frame.resultMetadataID = f.readShortBytes()
+	}
+	frame.reqMeta = f.parsePreparedMetadata()
 
 	if f.proto < protoVersion2 {
 		return frame
@@ -1437,12 +1534,15 @@ type queryParams struct {
 	defaultTimestamp      bool
 	defaultTimestampValue int64
 	// v5+
-	keyspace string
+	keyspace          string
+	nowInSeconds      bool
+	nowInSecondsValue int
+	pageSizeBytes     bool
 }
 
 func (q queryParams) String() string {
-	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v values=%v keyspace=%s]",
-		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.values, q.keyspace)
+	return fmt.Sprintf("[query_params consistency=%v skip_meta=%v page_size=%d paging_state=%q serial_consistency=%v default_timestamp=%v values=%v keyspace=%s now_in_seconds=%v]",
+		q.consistency, q.skipMeta, q.pageSize, q.pagingState, q.serialConsistency, q.defaultTimestamp, q.values, q.keyspace, q.nowInSeconds)
 }
 
 func (f *framer) writeQueryParams(opts *queryParams) {
@@ -1491,8 +1591,23 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 		}
 	}
 
+	if opts.nowInSeconds && f.proto <= protoVersion4 {
+		panic(fmt.Errorf("now in seconds can only be set with protocol 5 or higher"))
+	}
+
+	if opts.pageSizeBytes && f.proto <= protoVersion4 {
+		panic(fmt.Errorf("the page size can only be in bytes with protocol 5 or higher"))
+	}
+
 	if f.proto > protoVersion4 {
-		f.writeUint(uint32(flags))
+		v5flags := uint32(flags)
+		if opts.nowInSeconds {
+			v5flags |= flagWithNowInSeconds
+		}
+		if opts.pageSizeBytes && opts.pageSize > 0 {
+			v5flags |= flagPageSizeBytes
+		}
+		f.writeUint(v5flags)
 	} else {
 		f.writeByte(flags)
 	}
@@ -1538,6 +1653,10 @@ func (f *framer) writeQueryParams(opts *queryParams) {
 	if opts.keyspace != "" {
 		f.writeString(opts.keyspace)
 	}
+
+	if opts.nowInSeconds {
+		f.writeInt(int32(opts.nowInSecondsValue))
+	}
 }
 
 type writeQueryFrame struct {
@@ -1580,7 +1699,9 @@ func (f frameWriterFunc) buildFrame(framer *framer, streamID int) error {
 
 type writeExecuteFrame struct {
 	preparedID []byte
-	params     queryParams
+	// resultMetadataID is the id of the cached result metadata, v5+
+	resultMetadataID []byte
+	params           queryParams
 
 	// v4+
 	customPayload map[string][]byte
@@ -1591,16 +1712,19 @@ func (e *writeExecuteFrame) String() string {
 }
 
 func (e *writeExecuteFrame) buildFrame(fr *framer, streamID int) error {
-	return fr.writeExecuteFrame(streamID, e.preparedID, &e.params, &e.customPayload)
+	return fr.writeExecuteFrame(streamID, e.preparedID, e.resultMetadataID, &e.params, &e.customPayload)
 }
 
-func (f *framer) writeExecuteFrame(streamID int, preparedID []byte, params *queryParams, customPayload *map[string][]byte) error {
+func (f *framer) writeExecuteFrame(streamID int, preparedID, resultMetadataID []byte, params *queryParams, customPayload *map[string][]byte) error {
 	if len(*customPayload) > 0 {
 		f.payload()
 	}
 	f.writeHeader(f.flags, opExecute, streamID)
 	f.writeCustomPayload(customPayload)
 	f.writeShortBytes(preparedID)
+	if f.proto > protoVersion4 {
+		f.writeShortBytes(resultMetadataID)
+	}
 	if f.proto > protoVersion1 {
 		f.writeQueryParams(params)
 	} else {
@@ -2,6 +2,7 @@ package gocql
 
 import (
 	"bytes"
+	"encoding/binary"
 	"os"
 	"testing"
 )
@@ -103,3 +104,117 @@ func TestFrameReadTooLong(t *testing.T) {
 		t.Fatalf("expected to get header %v got %v", opReady, head.op)
 	}
 }
+
+func TestFrameWriteSkipMetadata(t *testing.T) {
+	for _, skipMeta := range []bool{true, false} {
+		f := newFramer(nil, protoVersion4)
+		f.writeQueryParams(&queryParams{consistency: One, skipMeta: skipMeta})
+
+		// [consistency short][flags byte]
+		flags := f.buf[2]
+		if got := flags&flagSkipMetaData != 0; got != skipMeta {
+			t.Errorf("skipMeta=%v: expected SKIP_METADATA flag to be %v, flags=0x%x", skipMeta, skipMeta, flags)
+		}
+	}
+}
+
+func TestFrameWriteNowInSeconds(t *testing.T) {
+	f := newFramer(nil, protoVersion5)
+	f.writeQueryParams(&queryParams{consistency: One, nowInSeconds: true, nowInSecondsValue: 1700000000})
+
+	// [consistency short][flags int][now_in_seconds int]
+	if len(f.buf) != 10 {
+		t.Fatalf("expected 10 bytes, got %d: %x", len(f.buf), f.buf)
+	}
+	if flags := binary.BigEndian.Uint32(f.buf[2:6]); flags != flagWithNowInSeconds {
+		t.Errorf("expected flags 0x%x, got 0x%x", flagWithNowInSeconds, flags)
+	}
+	if now := int32(binary.BigEndian.Uint32(f.buf[6:])); now != 1700000000 {
+		t.Errorf("expected now in seconds %d, got %d", 1700000000, now)
+	}
+}
+
+func TestFrameWritePageSizeBytes(t *testing.T) {
+	f := newFramer(nil, protoVersion5)
+	f.writeQueryParams(&queryParams{consistency: One, pageSize: 1 << 20, pageSizeBytes: true})
+
+	// [consistency short][flags int][page_size int]
+	if len(f.buf) != 10 {
+		t.Fatalf("expected 10 bytes, got %d: %x", len(f.buf), f.buf)
+	}
+	if flags, expected := binary.BigEndian.Uint32(f.buf[2:6]), uint32(flagPageSize)|flagPageSizeBytes; flags != expected {
+		t.Errorf("expected flags 0x%x, got 0x%x", expected, flags)
+	}
+	if size := int32(binary.BigEndian.Uint32(f.buf[6:])); size != 1<<20 {
+		t.Errorf("expected page size %d, got %d", 1<<20, size)
+	}
+}
+
+func TestFrameReadUnknownType(t *testing.T) {
+	const unknown = Type(0x0040)
+	const vectorClass = "org.example.VectorType"
+
+	write := func() *framer {
+		f := newFramer(nil, protoVersion4)
+		f.writeShort(uint16(unknown))
+		f.writeShort(uint16(TypeList))
+		f.writeShort(uint16(unknown))
+		f.writeShort(uint16(TypeCustom))
+		f.writeString(vectorClass)
+		f.writeShort(uint16(TypeInt))
+		return f
+	}
+
+	// the default policy keeps the types as they are, failing to unmarshal them
+	f := write()
+	info := f.readTypeInfo()
+	if _, ok := info.(UnknownTypeInfo); ok || info.Type() != unknown {
+		t.Fatalf("expected a native type with ID %d, got %#v", unknown, info)
+	}
+	var raw []byte
+	if err := Unmarshal(info, []byte{1, 2}, &raw); err == nil {
+		t.Error("expected an error unmarshaling an unknown type")
+	}
+
+	f = write()
+	f.unknownTypes = UnknownTypeRawBytes
+	info = f.readTypeInfo()
+	if _, ok := info.(UnknownTypeInfo); !ok || info.Type() != unknown {
+		t.Fatalf("expected an unknown type with ID %d, got %#v", unknown, info)
+	}
+	if err := Unmarshal(info, []byte{1, 2}, &raw); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(raw, []byte{1, 2}) {
+		t.Errorf("expected the raw bytes, got %v", raw)
+	}
+	if _, ok := info.New().(*[]byte); !ok {
+		t.Errorf("expected New to return *[]byte, got %T", info.New())
+	}
+	if data, err := Marshal(info, []byte{3}); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(data, []byte{3}) {
+		t.Errorf("expected the raw bytes to be marshaled, got %v", data)
+	}
+
+	list := f.readTypeInfo()
+	data, err := Marshal(list, [][]byte{{1}, {2, 3}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var elems [][]byte
+	if err := Unmarshal(list, data, &elems); err != nil {
+		t.Fatal(err)
+	} else if len(elems) != 2 || !bytes.Equal(elems[1], []byte{2, 3}) {
+		t.Errorf("unexpected list elements %v", elems)
+	}
+
+	custom := f.readTypeInfo()
+	if _, ok := custom.(UnknownTypeInfo); !ok || custom.Type() != TypeCustom || custom.Custom() != vectorClass {
+		t.Fatalf("expected an unknown custom type %s, got %#v", vectorClass, custom)
+	}
+
+	// the types after the unknown ones are read as usual
+	if next := f.readTypeInfo(); next.Type() != TypeInt {
+		t.Fatalf("expected int after the unknown types, got %s", next)
+	}
+}
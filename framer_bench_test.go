@@ -46,3 +46,69 @@ func BenchmarkParseRowsFrame(b *testing.B) {
 		}
 	}
 }
+
+// smallRowsResult returns the body of a rows result of a small-row workload,
+// with or without the result metadata the server skips for prepared
+// statements executed with the SKIP_METADATA flag.
+func smallRowsResult(withMetadata bool) []byte {
+	const rows = 10
+	columns := []string{"id", "name", "value"}
+
+	f := newFramer(nil, protoVersion4)
+	f.writeInt(resultKindRows)
+	if withMetadata {
+		f.writeInt(int32(flagGlobalTableSpec))
+	} else {
+		f.writeInt(int32(flagNoMetaData))
+	}
+	f.writeInt(int32(len(columns)))
+	if withMetadata {
+		f.writeString("gocql_test")
+		f.writeString("small_rows")
+		for _, col := range columns {
+			f.writeString(col)
+			if col == "name" {
+				f.writeShort(uint16(TypeVarchar))
+			} else {
+				f.writeShort(uint16(TypeInt))
+			}
+		}
+	}
+	f.writeInt(rows)
+	for i := 0; i < rows; i++ {
+		f.writeBytes(encInt(int32(i)))
+		f.writeBytes([]byte("name"))
+		f.writeBytes(encInt(int32(i)))
+	}
+	return f.buf
+}
+
+func benchmarkParseSmallRows(b *testing.B, withMetadata bool) {
+	data := smallRowsResult(withMetadata)
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		framer := &framer{
+			header: &frameHeader{
+				version: protoVersion4 | 0x80,
+				op:      opResult,
+				length:  len(data),
+			},
+			buf: data,
+		}
+
+		if _, err := framer.parseFrame(); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "frame-bytes")
+}
+
+func BenchmarkParseSmallRowsWithMetadata(b *testing.B) {
+	benchmarkParseSmallRows(b, true)
+}
+
+func BenchmarkParseSmallRowsSkipMetadata(b *testing.B) {
+	benchmarkParseSmallRows(b, false)
+}
@@ -0,0 +1,296 @@
+// Package gocqlarrow reads the results of gocql queries as Apache Arrow
+// records, one record per page of rows.
+//
+// The pages are read by column with gocql.Iter.NextColumns, which avoids
+// scanning the results row by row:
+//
+//	r, err := gocqlarrow.NewReader(session.Query(stmt).PageSize(10000).Iter(), memory.DefaultAllocator)
+//	if err != nil {
+//		return err
+//	}
+//	defer r.Release()
+//	for r.Next() {
+//		write(r.Record())
+//	}
+//	return r.Err()
+//
+// The CQL types are mapped to Arrow types as follows:
+//
+//	CQL type                            | Arrow type
+//	tinyint                             | int8
+//	smallint                            | int16
+//	int                                 | int32
+//	bigint, counter                     | int64
+//	float                               | float32
+//	double                              | float64
+//	boolean                             | bool
+//	varchar, ascii, text                | utf8
+//	inet, decimal, varint               | utf8, formatted as in CQL
+//	blob                                | binary
+//	timestamp                           | timestamp[ms, UTC]
+//	date                                | date32
+//	time                                | time64[ns]
+//	uuid, timeuuid                      | fixed_size_binary[16]
+//	list, set of the types above        | list
+//
+// Results with columns of other types are rejected by NewReader.
+package gocqlarrow
+
+import (
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gocql/gocql"
+)
+
+// Schema returns the Arrow schema of the records of the results with columns.
+func Schema(columns []gocql.ColumnInfo) (*arrow.Schema, error) {
+	fields := make([]arrow.Field, len(columns))
+	for i, col := range columns {
+		typ, err := arrowType(col.TypeInfo)
+		if err != nil {
+			return nil, fmt.Errorf("gocqlarrow: column %q: %w", col.Name, err)
+		}
+		fields[i] = arrow.Field{Name: col.Name, Type: typ, Nullable: true}
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+func arrowType(info gocql.TypeInfo) (arrow.DataType, error) {
+	switch info.Type() {
+	case gocql.TypeTinyInt:
+		return arrow.PrimitiveTypes.Int8, nil
+	case gocql.TypeSmallInt:
+		return arrow.PrimitiveTypes.Int16, nil
+	case gocql.TypeInt:
+		return arrow.PrimitiveTypes.Int32, nil
+	case gocql.TypeBigInt, gocql.TypeCounter:
+		return arrow.PrimitiveTypes.Int64, nil
+	case gocql.TypeFloat:
+		return arrow.PrimitiveTypes.Float32, nil
+	case gocql.TypeDouble:
+		return arrow.PrimitiveTypes.Float64, nil
+	case gocql.TypeBoolean:
+		return arrow.FixedWidthTypes.Boolean, nil
+	case gocql.TypeVarchar, gocql.TypeAscii, gocql.TypeText, gocql.TypeInet, gocql.TypeDecimal, gocql.TypeVarint:
+		return arrow.BinaryTypes.String, nil
+	case gocql.TypeBlob:
+		return arrow.BinaryTypes.Binary, nil
+	case gocql.TypeTimestamp:
+		return arrow.FixedWidthTypes.Timestamp_ms, nil
+	case gocql.TypeDate:
+		return arrow.FixedWidthTypes.Date32, nil
+	case gocql.TypeTime:
+		return arrow.FixedWidthTypes.Time64ns, nil
+	case gocql.TypeUUID, gocql.TypeTimeUUID:
+		return &arrow.FixedSizeBinaryType{ByteWidth: 16}, nil
+	case gocql.TypeList, gocql.TypeSet:
+		elem, err := arrowType(info.(gocql.CollectionType).Elem)
+		if err != nil {
+			return nil, err
+		}
+		return arrow.ListOf(elem), nil
+	}
+	return nil, fmt.Errorf("unsupported type %s", info)
+}
+
+// Reader reads the pages of an iterator as Arrow records.
+type Reader struct {
+	iter   *gocql.Iter
+	schema *arrow.Schema
+	b      *array.RecordBuilder
+	rec    arrow.Record
+	err    error
+}
+
+// NewReader returns a Reader of the results of iter, the record builders
+// allocate from mem. It fails if a column has no Arrow type, iter is closed in
+// that case.
+func NewReader(iter *gocql.Iter, mem memory.Allocator) (*Reader, error) {
+	schema, err := Schema(iter.Columns())
+	if err != nil {
+		iter.Close()
+		return nil, err
+	}
+	return &Reader{
+		iter:   iter,
+		schema: schema,
+		b:      array.NewRecordBuilder(mem, schema),
+	}, nil
+}
+
+// Schema returns the schema of the records.
+func (r *Reader) Schema() *arrow.Schema {
+	return r.schema
+}
+
+// Next reads the next page as a record, it returns false at the end of the
+// results or if an error occurred, see Err.
+func (r *Reader) Next() bool {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	if r.err != nil {
+		return false
+	}
+
+	cols, ok := r.iter.NextColumns()
+	if !ok {
+		r.err = r.iter.Close()
+		return false
+	}
+	for i, col := range cols {
+		if err := appendColumn(r.b.Field(i), col); err != nil {
+			r.err = fmt.Errorf("gocqlarrow: column %q: %w", col.Info.Name, err)
+			r.iter.Close()
+			return false
+		}
+	}
+	r.rec = r.b.NewRecord()
+	return true
+}
+
+// Record returns the record read by the last call to Next, it is only valid
+// until the next call to Next, use Retain to keep it longer.
+func (r *Reader) Record() arrow.Record {
+	return r.rec
+}
+
+// Err returns the error which stopped Next, if any.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// Release releases the current record and the builders of the reader and
+// closes the iterator.
+func (r *Reader) Release() {
+	if r.rec != nil {
+		r.rec.Release()
+		r.rec = nil
+	}
+	r.b.Release()
+	r.iter.Close()
+}
+
+// appendColumn appends the values of col to b, the types backed by a slice of
+// the same Go type are appended at once.
+func appendColumn(b array.Builder, col gocql.Column) error {
+	valid := make([]bool, len(col.Nulls))
+	for i, null := range col.Nulls {
+		valid[i] = !null
+	}
+
+	switch b := b.(type) {
+	case *array.Int8Builder:
+		if v, ok := col.Values.([]int8); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.Int16Builder:
+		if v, ok := col.Values.([]int16); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.Int32Builder:
+		if v, ok := col.Values.([]int32); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.Int64Builder:
+		if v, ok := col.Values.([]int64); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.Float32Builder:
+		if v, ok := col.Values.([]float32); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.Float64Builder:
+		if v, ok := col.Values.([]float64); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.BooleanBuilder:
+		if v, ok := col.Values.([]bool); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.StringBuilder:
+		if v, ok := col.Values.([]string); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	case *array.BinaryBuilder:
+		if v, ok := col.Values.([][]byte); ok {
+			b.AppendValues(v, valid)
+			return nil
+		}
+	}
+
+	values := reflect.ValueOf(col.Values)
+	for i := range valid {
+		if !valid[i] {
+			b.AppendNull()
+			continue
+		}
+		if err := appendValue(b, values.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendValue appends v, a value of the Go type gocql unmarshals the CQL type
+// of b to, see gocql.Column.
+func appendValue(b array.Builder, v reflect.Value) error {
+	switch b := b.(type) {
+	case *array.Int8Builder:
+		b.Append(int8(v.Int()))
+	case *array.Int16Builder:
+		b.Append(int16(v.Int()))
+	case *array.Int32Builder:
+		b.Append(int32(v.Int()))
+	case *array.Int64Builder:
+		b.Append(v.Int())
+	case *array.Float32Builder:
+		b.Append(float32(v.Float()))
+	case *array.Float64Builder:
+		b.Append(v.Float())
+	case *array.BooleanBuilder:
+		b.Append(v.Bool())
+	case *array.StringBuilder:
+		// inet, decimal and varint implement fmt.Stringer
+		b.Append(fmt.Sprint(v.Interface()))
+	case *array.BinaryBuilder:
+		b.Append(v.Bytes())
+	case *array.TimestampBuilder:
+		b.Append(arrow.Timestamp(v.Interface().(time.Time).UnixMilli()))
+	case *array.Date32Builder:
+		b.Append(arrow.Date32FromTime(v.Interface().(time.Time)))
+	case *array.Time64Builder:
+		b.Append(arrow.Time64(v.Int()))
+	case *array.FixedSizeBinaryBuilder:
+		u := v.Interface().(gocql.UUID)
+		b.Append(u[:])
+	case *array.ListBuilder:
+		if v.IsNil() {
+			b.AppendNull()
+			return nil
+		}
+		b.Append(true)
+		for i := 0; i < v.Len(); i++ {
+			if err := appendValue(b.ValueBuilder(), v.Index(i)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported builder %T", b)
+	}
+	return nil
+}
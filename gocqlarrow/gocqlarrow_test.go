@@ -0,0 +1,93 @@
+package gocqlarrow
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v14/arrow"
+	"github.com/apache/arrow/go/v14/arrow/array"
+	"github.com/apache/arrow/go/v14/arrow/memory"
+	"github.com/gocql/gocql"
+)
+
+func TestSchema(t *testing.T) {
+	columns := []gocql.ColumnInfo{
+		{Name: "id", TypeInfo: gocql.NewNativeType(4, gocql.TypeUUID, "")},
+		{Name: "n", TypeInfo: gocql.NewNativeType(4, gocql.TypeInt, "")},
+		{Name: "tags", TypeInfo: gocql.CollectionType{
+			NativeType: gocql.NewNativeType(4, gocql.TypeList, ""),
+			Elem:       gocql.NewNativeType(4, gocql.TypeText, ""),
+		}},
+	}
+	schema, err := Schema(columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: &arrow.FixedSizeBinaryType{ByteWidth: 16}, Nullable: true},
+		{Name: "n", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+	}, nil)
+	if !schema.Equal(expected) {
+		t.Fatalf("expected schema %v, got %v", expected, schema)
+	}
+
+	columns = append(columns, gocql.ColumnInfo{
+		Name: "m",
+		TypeInfo: gocql.CollectionType{
+			NativeType: gocql.NewNativeType(4, gocql.TypeMap, ""),
+			Key:        gocql.NewNativeType(4, gocql.TypeText, ""),
+			Elem:       gocql.NewNativeType(4, gocql.TypeInt, ""),
+		},
+	})
+	if _, err := Schema(columns); err == nil {
+		t.Fatal("expected the map column to be rejected")
+	}
+}
+
+func TestAppendColumn(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		typ  arrow.DataType
+		col  gocql.Column
+		want string
+	}{
+		{
+			arrow.PrimitiveTypes.Int32,
+			gocql.Column{Values: []int32{1, 0, 3}, Nulls: []bool{false, true, false}},
+			"[1 (null) 3]",
+		},
+		{
+			arrow.BinaryTypes.String,
+			gocql.Column{Values: []string{"a", "b"}, Nulls: []bool{false, false}},
+			`["a" "b"]`,
+		},
+		{
+			arrow.FixedWidthTypes.Timestamp_ms,
+			gocql.Column{Values: []time.Time{ts, {}}, Nulls: []bool{false, true}},
+			fmt.Sprintf("[%d (null)]", ts.UnixMilli()),
+		},
+		{
+			arrow.ListOf(arrow.PrimitiveTypes.Int64),
+			gocql.Column{Values: [][]int64{{1, 2}, nil}, Nulls: []bool{false, false}},
+			"[[1 2] (null)]",
+		},
+	}
+
+	for _, test := range tests {
+		b := array.NewBuilder(mem, test.typ)
+		if err := appendColumn(b, test.col); err != nil {
+			t.Fatalf("%s: %v", test.typ, err)
+		}
+		arr := b.NewArray()
+		if got := arr.String(); got != test.want {
+			t.Errorf("%s: expected %s, got %s", test.typ, test.want, got)
+		}
+		arr.Release()
+		b.Release()
+	}
+}
@@ -0,0 +1,127 @@
+// Package gocqlotel records the queries and batches executed by gocql as
+// OpenTelemetry spans.
+//
+// An Observer is used as the query and batch observer of a session, every
+// attempt at executing a query, including the fetch of each page, becomes a
+// client span. The span is a child of the span in the context of the query,
+// set with Query.WithContext:
+//
+//	observer := gocqlotel.NewObserver(nil)
+//	cluster.QueryObserver = observer
+//	cluster.BatchObserver = observer
+//
+//	err := session.Query(stmt, values...).WithContext(ctx).Exec()
+package gocqlotel
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/gocql/gocql/gocqlotel"
+
+// Attributes set on spans in addition to the semantic conventions for
+// Cassandra.
+const (
+	// StatementHashKey is the FNV-1a hash of the statement, the statement
+	// itself is not recorded as it may contain sensitive values.
+	StatementHashKey = attribute.Key("db.cassandra.statement_hash")
+	// AttemptKey is the index of the attempt, the first attempt is zero.
+	AttemptKey = attribute.Key("db.cassandra.attempt")
+	// PageKey is the index of the page fetched, the first page is zero.
+	PageKey = attribute.Key("db.cassandra.page")
+	// RowsKey is the number of rows returned in the page.
+	RowsKey = attribute.Key("db.cassandra.rows")
+	// BatchSizeKey is the number of statements in a batch.
+	BatchSizeKey = attribute.Key("db.cassandra.batch_size")
+)
+
+// SentEvent is the name of the span event recorded when the request was
+// written to the connection, the time before it is spent waiting for the
+// connection and the time after it waiting for the response.
+const SentEvent = "sent"
+
+// Observer implements gocql.QueryObserver and gocql.BatchObserver, creating a
+// span for each observed attempt.
+type Observer struct {
+	tracer trace.Tracer
+}
+
+// NewObserver returns an Observer creating spans with a tracer of tp, or of
+// the global tracer provider if tp is nil.
+func NewObserver(tp trace.TracerProvider) *Observer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return &Observer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// ObserveQuery implements gocql.QueryObserver.
+func (o *Observer) ObserveQuery(ctx context.Context, q gocql.ObservedQuery) {
+	attrs := []attribute.KeyValue{
+		StatementHashKey.String(statementHash(q.Statement)),
+		PageKey.Int(q.Page),
+		RowsKey.Int(q.Rows),
+	}
+	o.record(ctx, "gocql.query", q.Keyspace, q.Consistency, q.Host, q.Attempt, q.Err,
+		q.Start, q.Sent, q.End, attrs)
+}
+
+// ObserveBatch implements gocql.BatchObserver.
+func (o *Observer) ObserveBatch(ctx context.Context, b gocql.ObservedBatch) {
+	attrs := []attribute.KeyValue{
+		BatchSizeKey.Int(len(b.Statements)),
+	}
+	o.record(ctx, "gocql.batch", b.Keyspace, b.Consistency, b.Host, b.Attempt, b.Err,
+		b.Start, b.Sent, b.End, attrs)
+}
+
+func (o *Observer) record(ctx context.Context, name, keyspace string, cons gocql.Consistency,
+	host *gocql.HostInfo, attempt int, err error, start, sent, end time.Time, attrs []attribute.KeyValue) {
+	attrs = append(attrs,
+		semconv.DBSystemCassandra,
+		semconv.DBCassandraConsistencyLevelKey.String(strings.ToLower(cons.String())),
+		AttemptKey.Int(attempt),
+	)
+	if keyspace != "" {
+		attrs = append(attrs, semconv.DBName(keyspace))
+	}
+	if host != nil {
+		attrs = append(attrs,
+			semconv.ServerAddress(host.ConnectAddress().String()),
+			semconv.ServerPort(host.Port()),
+			semconv.DBCassandraCoordinatorID(host.HostID()),
+			semconv.DBCassandraCoordinatorDC(host.DataCenter()),
+		)
+	}
+
+	_, span := o.tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(start),
+		trace.WithAttributes(attrs...),
+	)
+	if !sent.IsZero() {
+		span.AddEvent(SentEvent, trace.WithTimestamp(sent))
+	}
+	if err != nil {
+		span.RecordError(err, trace.WithTimestamp(end))
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End(trace.WithTimestamp(end))
+}
+
+func statementHash(stmt string) string {
+	h := fnv.New64a()
+	h.Write([]byte(stmt))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
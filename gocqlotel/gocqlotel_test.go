@@ -0,0 +1,118 @@
+package gocqlotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gocql/gocql"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func newTestObserver() (*Observer, *tracetest.SpanRecorder, trace.Tracer) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	return NewObserver(tp), recorder, tp.Tracer("test")
+}
+
+func attributeValue(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+	return attribute.Value{}, false
+}
+
+func TestObserveQuery(t *testing.T) {
+	observer, recorder, tracer := newTestObserver()
+	ctx, parent := tracer.Start(context.Background(), "parent")
+
+	start := time.Now()
+	q := gocql.ObservedQuery{
+		Keyspace:    "ks",
+		Statement:   "SELECT * FROM tbl WHERE id = ?",
+		Start:       start,
+		Sent:        start.Add(time.Millisecond),
+		End:         start.Add(3 * time.Millisecond),
+		Rows:        10,
+		Page:        2,
+		Attempt:     1,
+		Consistency: gocql.LocalQuorum,
+	}
+	observer.ObserveQuery(ctx, q)
+	parent.End()
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "gocql.query" || span.SpanKind() != trace.SpanKindClient {
+		t.Fatalf("unexpected span %q of kind %v", span.Name(), span.SpanKind())
+	}
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Fatal("expected the span to be a child of the span of the query context")
+	}
+	if !span.StartTime().Equal(q.Start) || !span.EndTime().Equal(q.End) {
+		t.Fatalf("expected the span to last from %v to %v, got %v to %v", q.Start, q.End, span.StartTime(), span.EndTime())
+	}
+	if events := span.Events(); len(events) != 1 || events[0].Name != SentEvent || !events[0].Time.Equal(q.Sent) {
+		t.Fatalf("expected a %s event at %v, got %v", SentEvent, q.Sent, events)
+	}
+
+	expected := map[attribute.Key]attribute.Value{
+		"db.system":                      attribute.StringValue("cassandra"),
+		"db.name":                        attribute.StringValue("ks"),
+		"db.cassandra.consistency_level": attribute.StringValue("local_quorum"),
+		StatementHashKey:                 attribute.StringValue(statementHash(q.Statement)),
+		AttemptKey:                       attribute.IntValue(1),
+		PageKey:                          attribute.IntValue(2),
+		RowsKey:                          attribute.IntValue(10),
+	}
+	for key, value := range expected {
+		if got, ok := attributeValue(span, key); !ok || got != value {
+			t.Errorf("expected attribute %s=%v, got %v", key, value.Emit(), got.Emit())
+		}
+	}
+}
+
+func TestObserveBatchError(t *testing.T) {
+	observer, recorder, _ := newTestObserver()
+
+	errBatch := errors.New("batch failed")
+	start := time.Now()
+	observer.ObserveBatch(context.Background(), gocql.ObservedBatch{
+		Statements:  []string{"INSERT 1", "INSERT 2"},
+		Start:       start,
+		End:         start.Add(time.Millisecond),
+		Err:         errBatch,
+		Consistency: gocql.One,
+	})
+
+	spans := recorder.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("expected 1 span, got %d", len(spans))
+	}
+	span := spans[0]
+	if span.Name() != "gocql.batch" {
+		t.Fatalf("unexpected span %q", span.Name())
+	}
+	if span.Status().Code != codes.Error || span.Status().Description != errBatch.Error() {
+		t.Fatalf("expected an error status, got %v", span.Status())
+	}
+	if got, _ := attributeValue(span, BatchSizeKey); got != attribute.IntValue(2) {
+		t.Fatalf("expected batch size 2, got %v", got.Emit())
+	}
+	// the batch was not sent
+	for _, event := range span.Events() {
+		if event.Name == SentEvent {
+			t.Fatal("expected no sent event")
+		}
+	}
+}
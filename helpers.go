@@ -21,6 +21,10 @@ type RowData struct {
 }
 
 func goType(t TypeInfo) (reflect.Type, error) {
+	if _, ok := t.(UnknownTypeInfo); ok {
+		return reflect.TypeOf(*new([]byte)), nil
+	}
+
 	switch t.Type() {
 	case TypeVarchar, TypeAscii, TypeInet, TypeText:
 		return reflect.TypeOf(*new(string)), nil
@@ -158,7 +162,7 @@ func getCassandraType(name string, logger StdLogger) TypeInfo {
 	} else if strings.HasPrefix(name, "map<") {
 		names := splitCompositeTypes(strings.TrimPrefix(name[:len(name)-1], "map<"))
 		if len(names) != 2 {
-			logger.Printf("Error parsing map type, it has %d subelements, expecting 2\n", len(names))
+			logf(logger, LogLevelWarn, "Error parsing map type, it has %d subelements, expecting 2\n", len(names))
 			return NativeType{
 				typ: TypeCustom,
 			}
@@ -345,7 +349,7 @@ func (iter *Iter) rowMap() (map[string]interface{}, error) {
 	}
 
 	rowData, _ := iter.RowData()
-	iter.Scan(rowData.Values...)
+	iter.ScanCopy(rowData.Values...)
 	m := make(map[string]interface{}, len(rowData.Columns))
 	rowData.rowMap(m)
 	return m, nil
@@ -361,7 +365,7 @@ func (iter *Iter) SliceMap() ([]map[string]interface{}, error) {
 	// Not checking for the error because we just did
 	rowData, _ := iter.RowData()
 	dataToReturn := make([]map[string]interface{}, 0)
-	for iter.Scan(rowData.Values...) {
+	for iter.ScanCopy(rowData.Values...) {
 		m := make(map[string]interface{}, len(rowData.Columns))
 		rowData.rowMap(m)
 		dataToReturn = append(dataToReturn, m)
@@ -424,7 +428,7 @@ func (iter *Iter) MapScan(m map[string]interface{}) bool {
 		}
 	}
 
-	if iter.Scan(rowData.Values...) {
+	if iter.ScanCopy(rowData.Values...) {
 		rowData.rowMap(m)
 		return true
 	}
@@ -121,6 +121,9 @@ type HostInfo struct {
 	preferredIP      net.IP
 	connectAddress   net.IP
 	port             int
+	// connectAddresses are the addresses returned by a HostAddressTranslator,
+	// the first one is connectAddress and port.
+	connectAddresses []*net.TCPAddr
 	dataCenter       string
 	rack             string
 	hostId           string
@@ -133,6 +136,9 @@ type HostInfo struct {
 	state            nodeState
 	schemaVersion    string
 	tokens           []string
+	// scyllaShards is the number of shards reported by the last connection
+	// opened to the host, 0 if it isn't a Scylla host.
+	scyllaShards int
 }
 
 func (h *HostInfo) Equal(host *HostInfo) bool {
@@ -211,6 +217,7 @@ func (h *HostInfo) SetConnectAddress(address net.IP) *HostInfo {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 	h.connectAddress = address
+	h.connectAddresses = nil
 	return h
 }
 
@@ -306,6 +313,14 @@ func (h *HostInfo) State() nodeState {
 	return h.state
 }
 
+// setLocation sets the datacenter and rack of the host.
+func (h *HostInfo) setLocation(dataCenter, rack string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.dataCenter = dataCenter
+	h.rack = rack
+}
+
 func (h *HostInfo) setState(state nodeState) *HostInfo {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -319,6 +334,29 @@ func (h *HostInfo) Tokens() []string {
 	return h.tokens
 }
 
+// NumTokens returns the number of tokens owned by the host.
+func (h *HostInfo) NumTokens() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.tokens)
+}
+
+// ScyllaShardCount returns the number of shards of a Scylla host, as reported
+// by the last connection opened to it, or 0 if the host is not a Scylla host
+// or no connection was opened to it yet. The count may change when the host is
+// restarted, for example after it was resized.
+func (h *HostInfo) ScyllaShardCount() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.scyllaShards
+}
+
+func (h *HostInfo) setScyllaShardCount(n int) {
+	h.mu.Lock()
+	h.scyllaShards = n
+	h.mu.Unlock()
+}
+
 func (h *HostInfo) Port() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
@@ -355,6 +393,9 @@ func (h *HostInfo) update(from *HostInfo) {
 	if h.connectAddress == nil {
 		h.connectAddress = from.connectAddress
 	}
+	if h.connectAddresses == nil {
+		h.connectAddresses = from.connectAddresses
+	}
 	if h.port == 0 {
 		h.port = from.port
 	}
@@ -379,12 +420,17 @@ func (h *HostInfo) update(from *HostInfo) {
 	if h.clusterName == "" {
 		h.clusterName = from.clusterName
 	}
-	if h.version == (cassVersion{}) {
-		h.version = from.version
-	}
 	if h.tokens == nil {
 		h.tokens = from.tokens
 	}
+
+	// the versions change during rolling upgrades and schema changes
+	if from.version != (cassVersion{}) {
+		h.version = from.version
+	}
+	if from.schemaVersion != "" {
+		h.schemaVersion = from.schemaVersion
+	}
 }
 
 func (h *HostInfo) IsUp() bool {
@@ -401,6 +447,23 @@ func (h *HostInfo) HostnameAndPort() string {
 	return net.JoinHostPort(h.hostname, strconv.Itoa(h.port))
 }
 
+// ConnectAddresses returns the addresses to connect to the host, in the order
+// they are tried. They are the addresses returned by the TranslateHost method
+// of a HostAddressTranslator, or else the connect address and port of the host.
+func (h *HostInfo) ConnectAddresses() []net.Addr {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.connectAddresses) == 0 {
+		addr, _ := h.connectAddressLocked()
+		return []net.Addr{&net.TCPAddr{IP: addr, Port: h.port}}
+	}
+	addrs := make([]net.Addr, len(h.connectAddresses))
+	for i, addr := range h.connectAddresses {
+		addrs[i] = addr
+	}
+	return addrs
+}
+
 func (h *HostInfo) ConnectAddressAndPort() string {
 	h.mu.Lock()
 	defer h.mu.Unlock()
@@ -559,9 +622,7 @@ func (s *Session) hostInfoFromMap(row map[string]interface{}, host *HostInfo) (*
 		// Not sure what the port field will be called until the JIRA issue is complete
 	}
 
-	ip, port := s.cfg.translateAddressPort(host.ConnectAddress(), host.port)
-	host.connectAddress = ip
-	host.port = port
+	s.cfg.translateHost(host)
 
 	return host, nil
 }
@@ -633,7 +694,7 @@ func (r *ringDescriber) getClusterPeerInfo(localHost *HostInfo) ([]*HostInfo, er
 			return nil, err
 		} else if !isValidPeer(host) {
 			// If it's not a valid peer
-			r.session.logger.Printf("Found invalid peer '%s' "+
+			logf(r.session.logger, LogLevelWarn, "Found invalid peer '%s' "+
 				"Likely due to a gossip or snitch issue, this host will be ignored", host)
 			continue
 		}
@@ -716,6 +777,9 @@ func refreshRing(r *ringDescriber) error {
 			}
 			if h.connectAddress.Equal(existing.connectAddress) && h.nodeToNodeAddress().Equal(existing.nodeToNodeAddress()) {
 				// no host IP change
+				if !r.session.cfg.DisableHostLocationUpdates && (h.DataCenter() != host.DataCenter() || h.Rack() != host.Rack()) {
+					r.session.updateHostLocation(host, h.DataCenter(), h.Rack())
+				}
 				host.update(h)
 			} else {
 				// host IP has changed
@@ -740,6 +804,26 @@ func refreshRing(r *ringDescriber) error {
 	return nil
 }
 
+// updateHostLocation moves host to dataCenter and rack. The host is removed
+// from the host selection policy and the token ring, and added back at its new
+// location if it is up.
+func (s *Session) updateHostLocation(host *HostInfo, dataCenter, rack string) {
+	logEvent(s.logger, LogLevelInfo, "host moved to another datacenter or rack",
+		[]LogField{{"host", host.ConnectAddress()}, {"host_id", host.HostID()},
+			{"from_datacenter", host.DataCenter()}, {"from_rack", host.Rack()},
+			{"datacenter", dataCenter}, {"rack", rack}},
+		"gocql: host %s moved from datacenter %q rack %q to datacenter %q rack %q\n",
+		host.ConnectAddress(), host.DataCenter(), host.Rack(), dataCenter, rack)
+
+	s.policy.RemoveHost(host)
+	s.metaMngr.removeHost(host)
+	host.setLocation(dataCenter, rack)
+	if host.IsUp() {
+		s.metaMngr.addHost(host)
+		s.policy.AddHost(host)
+	}
+}
+
 const (
 	ringRefreshDebounceTime = 1 * time.Second
 )
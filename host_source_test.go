@@ -4,6 +4,7 @@
 package gocql
 
 import (
+	"context"
 	"errors"
 	"net"
 	"sync"
@@ -345,3 +346,185 @@ func TestErrorBroadcaster_StopWithoutBroadcast(t *testing.T) {
 		t.Errorf(loadedVal.(error).Error())
 	}
 }
+
+func TestUpdateHostLocation(t *testing.T) {
+	policy := RackAwareRoundRobinPolicy("dc1", "rack1")
+	s := &Session{policy: policy, logger: nopLogger{}}
+	s.metaMngr.init(s)
+
+	a := &HostInfo{hostId: "a", connectAddress: net.IPv4(10, 0, 0, 1), dataCenter: "dc1", rack: "rack1"}
+	b := &HostInfo{hostId: "b", connectAddress: net.IPv4(10, 0, 0, 2), dataCenter: "dc1", rack: "rack2"}
+	for _, host := range []*HostInfo{a, b} {
+		policy.AddHost(host)
+		s.metaMngr.addHost(host)
+	}
+	if host := policy.Pick(nil)(); host.Info() != a {
+		t.Fatalf("expected host a in the local rack to be picked first, got %v", host.Info())
+	}
+
+	// the hosts swap racks
+	s.updateHostLocation(a, "dc1", "rack2")
+	s.updateHostLocation(b, "dc1", "rack1")
+	if a.Rack() != "rack2" || b.Rack() != "rack1" {
+		t.Fatalf("expected the racks of the hosts to be updated, got %q and %q", a.Rack(), b.Rack())
+	}
+	for i := 0; i < 3; i++ {
+		if host := policy.Pick(nil)(); host.Info() != b {
+			t.Fatalf("expected host b now in the local rack to be picked first, got %v", host.Info())
+		}
+	}
+	if hosts := s.metaMngr.hosts.get(); len(hosts) != 2 {
+		t.Fatalf("expected both hosts to stay in the token ring, got %v", hosts)
+	}
+
+	// a down host is not added back to the policy
+	a.setState(NodeDown)
+	s.updateHostLocation(a, "dc1", "rack1")
+	for i := 0; i < 3; i++ {
+		if host := policy.Pick(nil)(); host.Info() != b {
+			t.Fatalf("expected the down host not to be picked, got %v", host.Info())
+		}
+	}
+}
+
+func TestRefreshRingUpdatesHostLocation(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	policy := RackAwareRoundRobinPolicy("dc1", "rack1").(*rackAwareRR)
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.PoolConfig.HostSelectionPolicy = policy
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	host := db.ring.allHosts()[0]
+	pool, ok := db.pool.getPool(host)
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	control := createControlConn(db)
+	control.conn.Store(&connHost{conn: pool.Pick(), host: host})
+	db.control = control
+	defer func() { db.control = nil }()
+
+	hostID, err := ParseUUID(host.HostID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	setLocal := func(dataCenter, rack string) {
+		srv.setTable("system.local", &testRows{
+			columns: []ColumnInfo{
+				{Name: "host_id", TypeInfo: NewNativeType(defaultProto, TypeUUID, "")},
+				{Name: "data_center", TypeInfo: NewNativeType(defaultProto, TypeVarchar, "")},
+				{Name: "rack", TypeInfo: NewNativeType(defaultProto, TypeVarchar, "")},
+				{Name: "release_version", TypeInfo: NewNativeType(defaultProto, TypeVarchar, "")},
+				{Name: "rpc_address", TypeInfo: NewNativeType(defaultProto, TypeInet, "")},
+				{Name: "tokens", TypeInfo: CollectionType{NativeType: NewNativeType(defaultProto, TypeSet, ""), Elem: NewNativeType(defaultProto, TypeVarchar, "")}},
+			},
+			rows: [][]interface{}{{hostID, dataCenter, rack, "3.11.4", host.ConnectAddress().String(), []string{"1"}}},
+		})
+	}
+	srv.setTable("system.peers", &testRows{columns: []ColumnInfo{{Name: "peer", TypeInfo: NewNativeType(defaultProto, TypeInet, "")}}})
+	inTier := func(tier uint) bool {
+		for _, h := range policy.hosts[tier].get() {
+			if h == host {
+				return true
+			}
+		}
+		return false
+	}
+
+	// the host moves to the local rack
+	setLocal("dc1", "rack1")
+	if err := refreshRing(db.hostSource); err != nil {
+		t.Fatal(err)
+	}
+	if host.DataCenter() != "dc1" || host.Rack() != "rack1" {
+		t.Fatalf("expected the host to move to dc1 rack1, got %s %s", host.DataCenter(), host.Rack())
+	}
+	if !inTier(0) || inTier(2) {
+		t.Fatal("expected the host to be added back to the policy in the local rack")
+	}
+	if hosts := db.ring.allHosts(); len(hosts) != 1 || hosts[0] != host {
+		t.Fatalf("expected the host to stay in the ring, got %v", hosts)
+	}
+
+	// then to another rack of the local datacenter
+	setLocal("dc1", "rack2")
+	if err := refreshRing(db.hostSource); err != nil {
+		t.Fatal(err)
+	}
+	if host.Rack() != "rack2" || inTier(0) || !inTier(1) {
+		t.Fatalf("expected the host to move to the remote rack tier, got rack %s", host.Rack())
+	}
+
+	// location updates can be disabled
+	db.cfg.DisableHostLocationUpdates = true
+	setLocal("dc1", "rack1")
+	if err := refreshRing(db.hostSource); err != nil {
+		t.Fatal(err)
+	}
+	if inTier(0) || !inTier(1) {
+		t.Fatal("expected the host to stay in the remote rack tier of the policy")
+	}
+}
+
+func TestSessionTopology(t *testing.T) {
+	s := &Session{}
+	a := &HostInfo{
+		hostId:         "a",
+		connectAddress: net.IPv4(10, 0, 0, 1),
+		port:           9042,
+		dataCenter:     "dc2",
+		rack:           "rack1",
+		tokens:         []string{"1", "2"},
+		clusterName:    "cluster",
+		partitioner:    "org.apache.cassandra.dht.Murmur3Partitioner",
+		version:        cassVersion{4, 0, 11},
+		schemaVersion:  "s1",
+	}
+	b := &HostInfo{hostId: "b", connectAddress: net.IPv4(10, 0, 0, 2), dataCenter: "dc1", rack: "rack1", version: cassVersion{3, 11, 4}, schemaVersion: "s1"}
+	c := &HostInfo{hostId: "c", connectAddress: net.IPv4(10, 0, 0, 3), dataCenter: "dc1", rack: "rack1", version: cassVersion{4, 0, 11}, schemaVersion: "s2"}
+	for _, host := range []*HostInfo{a, b, c} {
+		s.ring.addOrUpdate(host)
+	}
+	c.setState(NodeDown)
+
+	topology := s.Topology()
+	if topology.ClusterName != "cluster" || topology.Partitioner != a.partitioner {
+		t.Fatalf("unexpected cluster name %q and partitioner %q", topology.ClusterName, topology.Partitioner)
+	}
+	var ids []string
+	for _, host := range topology.Hosts {
+		ids = append(ids, host.HostID)
+	}
+	assertDeepEqual(t, "host IDs", []string{"b", "c", "a"}, ids)
+	assertDeepEqual(t, "host a", TopologyHost{
+		HostID:         "a",
+		ConnectAddress: net.IPv4(10, 0, 0, 1),
+		Port:           9042,
+		DataCenter:     "dc2",
+		Rack:           "rack1",
+		Tokens:         []string{"1", "2"},
+		Up:             true,
+		ReleaseVersion: "v4.0.11",
+		SchemaVersion:  "s1",
+	}, topology.Hosts[2])
+	if topology.Hosts[1].Up {
+		t.Fatal("expected host c to be down")
+	}
+	assertDeepEqual(t, "schema versions", map[string][]string{"s1": {"b", "a"}, "s2": {"c"}}, topology.SchemaVersions())
+	assertDeepEqual(t, "release versions", map[string][]string{"v3.11.4": {"b"}, "v4.0.11": {"c", "a"}}, topology.ReleaseVersions())
+
+	// the snapshot is not affected by later changes, the versions are updated
+	// by the next ring refresh
+	a.tokens[0] = "3"
+	s.ring.addOrUpdate(&HostInfo{hostId: "a", connectAddress: net.IPv4(10, 0, 0, 1), version: cassVersion{5, 0, 0}, schemaVersion: "s2"})
+	assertDeepEqual(t, "tokens", []string{"1", "2"}, topology.Hosts[2].Tokens)
+	if host := s.Topology().Hosts[2]; host.ReleaseVersion != "v5.0.0" || host.SchemaVersion != "s2" {
+		t.Fatalf("expected the versions to be updated, got %q and %q", host.ReleaseVersion, host.SchemaVersion)
+	}
+}
@@ -0,0 +1,149 @@
+package gocql
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// InFlightQuery describes a query or batch being executed, see
+// Session.InFlightQueries.
+type InFlightQuery struct {
+	// Fingerprint is the statement with its literals replaced by ?, the
+	// statements of a batch are separated by "; ".
+	Fingerprint string
+
+	// Host is the host of the current attempt, it is nil until a connection to
+	// a host was picked.
+	Host *HostInfo
+
+	// Start is when the execution started. The pages of a query are executed
+	// one at a time, Start is the start of the execution of the current page.
+	Start time.Time
+
+	// Context is the context of the execution, it is canceled once the
+	// execution finished or is canceled by Session.CancelAll.
+	Context context.Context
+}
+
+// inFlightQueries tracks the queries and batches being executed by a session.
+type inFlightQueries struct {
+	mu      sync.Mutex
+	nextID  uint64
+	queries map[uint64]*inFlightQuery
+}
+
+type inFlightQuery struct {
+	InFlightQuery
+	cancel context.CancelFunc
+	// qry is fingerprinted when a snapshot is taken.
+	qry ExecutableQuery
+	// host is the *HostInfo of the current attempt.
+	host atomic.Value
+}
+
+// inFlightQueryKey is the key of the *inFlightQuery in the context of an
+// execution, so that attempts can record their host.
+type inFlightQueryKey struct{}
+
+// add registers the execution of qry, it returns the context of the execution
+// derived from ctx and a function to call once the execution finished.
+func (f *inFlightQueries) add(ctx context.Context, qry ExecutableQuery) (context.Context, func()) {
+	q := &inFlightQuery{
+		InFlightQuery: InFlightQuery{Start: time.Now()},
+		qry:           qry,
+	}
+	ctx, q.cancel = context.WithCancel(context.WithValue(ctx, inFlightQueryKey{}, q))
+	q.Context = ctx
+
+	f.mu.Lock()
+	if f.queries == nil {
+		f.queries = make(map[uint64]*inFlightQuery)
+	}
+	id := f.nextID
+	f.nextID++
+	f.queries[id] = q
+	f.mu.Unlock()
+
+	return ctx, func() {
+		f.mu.Lock()
+		delete(f.queries, id)
+		f.mu.Unlock()
+		q.cancel()
+	}
+}
+
+// setHost records host as the host of the current attempt of the execution
+// whose context is ctx.
+func (f *inFlightQueries) setHost(ctx context.Context, host *HostInfo) {
+	if q, ok := ctx.Value(inFlightQueryKey{}).(*inFlightQuery); ok {
+		q.host.Store(host)
+	}
+}
+
+// snapshot returns the queries in flight, oldest first.
+func (f *inFlightQueries) snapshot() []InFlightQuery {
+	f.mu.Lock()
+	queries := make([]InFlightQuery, 0, len(f.queries))
+	for _, q := range f.queries {
+		// the query is not released while it is registered
+		query := q.InFlightQuery
+		query.Fingerprint = executableQueryFingerprint(q.qry)
+		query.Host, _ = q.host.Load().(*HostInfo)
+		queries = append(queries, query)
+	}
+	f.mu.Unlock()
+
+	sort.Slice(queries, func(i, j int) bool {
+		return queries[i].Start.Before(queries[j].Start)
+	})
+	return queries
+}
+
+// cancelAll cancels the context of every query in flight.
+func (f *inFlightQueries) cancelAll() {
+	f.mu.Lock()
+	cancels := make([]context.CancelFunc, 0, len(f.queries))
+	for _, q := range f.queries {
+		cancels = append(cancels, q.cancel)
+	}
+	f.mu.Unlock()
+
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
+
+func executableQueryFingerprint(qry ExecutableQuery) string {
+	switch qry := qry.(type) {
+	case *Query:
+		return statementFingerprint(qry.stmt, false)
+	case *Batch:
+		stmts := make([]string, len(qry.Entries))
+		for i, entry := range qry.Entries {
+			stmts[i] = statementFingerprint(entry.Stmt, false)
+		}
+		return strings.Join(stmts, "; ")
+	}
+	return ""
+}
+
+// InFlightQueries returns a snapshot of the queries and batches being executed
+// by the session, oldest first. It is meant to debug stuck queries, taking the
+// snapshot does not wait for the queries. It is always empty unless
+// ClusterConfig.TrackInFlightQueries is set.
+func (s *Session) InFlightQueries() []InFlightQuery {
+	return s.inFlight.snapshot()
+}
+
+// CancelAll cancels the context of every query and batch being executed by the
+// session, which then fail with context.Canceled. Queries executed afterwards
+// are not affected, for example to force the cleanup of stuck queries during
+// shutdown before closing the session. It does nothing unless
+// ClusterConfig.TrackInFlightQueries is set.
+func (s *Session) CancelAll() {
+	s.inFlight.cancelAll()
+}
@@ -232,6 +232,22 @@ func TestSessionAwaitSchemaAgreement(t *testing.T) {
 	}
 }
 
+func TestSessionSchemaAgreementOnConnect(t *testing.T) {
+	cluster := createCluster()
+	cluster.MaxSchemaAgreementWait = time.Minute
+	cluster.RequireSchemaAgreement = true
+	session := createSessionFromCluster(cluster, t)
+	defer session.Close()
+
+	agreed, err := session.SchemaAgreed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !agreed {
+		t.Fatal("expected the schema versions to agree")
+	}
+}
+
 func TestUDF(t *testing.T) {
 	session := createSession(t)
 	defer session.Close()
@@ -0,0 +1,154 @@
+package gocql
+
+import (
+	"reflect"
+	"time"
+)
+
+// Column holds the values of a column for the rows of a page, see
+// Iter.NextColumns.
+type Column struct {
+	Info ColumnInfo
+
+	// Values is a slice with one element per row, its element type depends on
+	// the CQL type of the column:
+	//
+	//	CQL type                   | Values
+	//	tinyint                    | []int8
+	//	smallint                   | []int16
+	//	int                        | []int32
+	//	bigint, counter            | []int64
+	//	float                      | []float32
+	//	double                     | []float64
+	//	boolean                    | []bool
+	//	varchar, ascii, text       | []string
+	//	blob                       | [][]byte
+	//	timestamp, date            | []time.Time
+	//	time                       | []time.Duration
+	//	uuid, timeuuid             | []UUID
+	//	custom types               | [][]byte, the raw values
+	//	other types                | slice of the Go type returned by TypeInfo.New
+	//
+	// The values of null rows are the zero value of the element type.
+	Values interface{}
+
+	// Nulls reports for each row whether the value of the column is null.
+	Nulls []bool
+}
+
+// columnType returns the element type of Column.Values for info.
+func columnType(info TypeInfo) reflect.Type {
+	switch info.Type() {
+	case TypeInt:
+		return reflect.TypeOf(int32(0))
+	case TypeCounter:
+		return reflect.TypeOf(int64(0))
+	case TypeDate:
+		return reflect.TypeOf(time.Time{})
+	}
+	v, err := info.NewWithError()
+	if err != nil {
+		return reflect.TypeOf([]byte(nil))
+	}
+	return reflect.TypeOf(v).Elem()
+}
+
+// NextColumns reads the rows of the current page left to scan by column,
+// fetching the next page first if the current one was entirely scanned. This
+// avoids the per row overhead of Scan when consuming whole pages, for example
+// to build columnar data. Rows can be scanned with Scan and by pages with
+// NextColumns on the same iterator, a column is returned for every column of
+// Columns.
+//
+// NextColumns returns false at the end of the results or if an error occurred,
+// see Close.
+func (iter *Iter) NextColumns() ([]Column, bool) {
+	if iter.err != nil {
+		return nil, false
+	}
+
+	for iter.pos >= iter.numRows {
+		if iter.next == nil {
+			return nil, false
+		}
+		iter.nextPage()
+		if iter.err != nil {
+			return nil, false
+		}
+	}
+
+	if iter.next != nil {
+		// the whole page is read, fetch the next one while decoding
+		iter.next.fetchAsync()
+	}
+
+	start := time.Now()
+	defer func() {
+		iter.stats.DecodeTime += time.Since(start)
+	}()
+
+	rows := iter.numRows - iter.pos
+	cols := make([]Column, len(iter.meta.columns))
+	values := make([]reflect.Value, len(cols))
+	for i, info := range iter.meta.columns {
+		values[i] = reflect.MakeSlice(reflect.SliceOf(columnType(info.TypeInfo)), rows, rows)
+		cols[i] = Column{
+			Info:   info,
+			Values: values[i].Interface(),
+			Nulls:  make([]bool, rows),
+		}
+	}
+
+	for row := 0; row < rows; row++ {
+		for i := range cols {
+			data, err := iter.readColumn()
+			if err != nil {
+				iter.err = err
+				return nil, false
+			}
+			if data == nil {
+				cols[i].Nulls[row] = true
+				continue
+			}
+			if err := unmarshalColumn(cols[i].Info.TypeInfo, data, cols[i].Values, values[i], row); err != nil {
+				iter.err = err
+				return nil, false
+			}
+		}
+	}
+
+	iter.pos = iter.numRows
+	iter.row = iter.row[:0]
+	return cols, true
+}
+
+// unmarshalColumn unmarshals data into the element at row of the values of a
+// Column, typed is the Values of the column and values its reflect.Value, which
+// is only used for the less common types.
+func unmarshalColumn(info TypeInfo, data []byte, typed interface{}, values reflect.Value, row int) error {
+	switch v := typed.(type) {
+	case []int32:
+		return Unmarshal(info, data, &v[row])
+	case []int64:
+		return Unmarshal(info, data, &v[row])
+	case []float32:
+		return Unmarshal(info, data, &v[row])
+	case []float64:
+		return Unmarshal(info, data, &v[row])
+	case []bool:
+		return Unmarshal(info, data, &v[row])
+	case []string:
+		return Unmarshal(info, data, &v[row])
+	case []time.Time:
+		return Unmarshal(info, data, &v[row])
+	case []UUID:
+		return Unmarshal(info, data, &v[row])
+	case [][]byte:
+		if info.Type() == TypeCustom {
+			v[row] = copyBytes(data)
+			return nil
+		}
+		return Unmarshal(info, data, &v[row])
+	}
+	return Unmarshal(info, data, values.Index(row).Addr().Interface())
+}
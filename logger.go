@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"fmt"
 	"log"
+	"strings"
 )
 
 type StdLogger interface {
@@ -12,6 +13,173 @@ type StdLogger interface {
 	Println(v ...interface{})
 }
 
+// LogLevel is the severity of a message logged by the driver, see
+// ClusterConfig.LogLevel and StructuredLogger. The messages are logged at:
+//
+//	LogLevelDebug: the events received, the translated addresses, the pool
+//	               connection errors and the ring, most only with the
+//	               gocql_debug build tag
+//	LogLevelInfo:  the negotiated protocol version, the local datacenter picked
+//	               from the control connection, the contact points added or
+//	               removed when resolved again and the hosts which moved
+//	LogLevelWarn:  the errors of the control connection and the metadata, the
+//	               invalid peers, schema types and events, and the features not
+//	               supported by the hosts
+//	LogLevelError: the failures to connect to hosts, to reconnect the control
+//	               connection and to update the token ring
+//
+// Messages logged to a StdLogger by other code paths are at LogLevelInfo.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogLevelDebug:
+		return "debug"
+	case LogLevelInfo:
+		return "info"
+	case LogLevelWarn:
+		return "warn"
+	case LogLevelError:
+		return "error"
+	default:
+		return fmt.Sprintf("LogLevel(%d)", int(l))
+	}
+}
+
+// LogField is a key and value logged along with a message, such as the address
+// or the ID of the host the message is about ("host", "host_id"), the keyspace
+// ("keyspace") or the error which occurred ("error").
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// StructuredLogger receives the messages logged by the driver with their level
+// and the values they are about as fields, rather than formatted in the
+// message, so that they can be forwarded to structured logging libraries, see
+// ClusterConfig.StructuredLogger.
+type StructuredLogger interface {
+	Log(level LogLevel, msg string, fields ...LogField)
+}
+
+// NewStdStructuredLogger returns a StructuredLogger which prints the messages
+// to logger, preceded by their level and followed by their fields formatted as
+// key=value, such as "gocql: [warn] unable to dial control conn host=10.0.0.1".
+func NewStdStructuredLogger(logger StdLogger) StructuredLogger {
+	return stdStructuredLogger{logger: logger}
+}
+
+type stdStructuredLogger struct {
+	logger StdLogger
+}
+
+func (l stdStructuredLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.logger.Print(formatLogMessage(level, msg, fields))
+}
+
+func formatLogMessage(level LogLevel, msg string, fields []LogField) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "gocql: [%s] ", level)
+	buf.WriteString(msg)
+	for _, field := range fields {
+		fmt.Fprintf(&buf, " %s=%v", field.Key, field.Value)
+	}
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+// structuredStdLogger is the StdLogger of the driver when a StructuredLogger is
+// configured, the messages which are not logged with logEvent are logged at
+// the info level, without fields.
+type structuredStdLogger struct {
+	StructuredLogger
+}
+
+func (l structuredStdLogger) log(msg string) {
+	msg = strings.TrimPrefix(strings.TrimSpace(msg), "gocql: ")
+	l.Log(LogLevelInfo, msg)
+}
+
+func (l structuredStdLogger) Print(v ...interface{}) { l.log(fmt.Sprint(v...)) }
+func (l structuredStdLogger) Printf(format string, v ...interface{}) {
+	l.log(fmt.Sprintf(format, v...))
+}
+func (l structuredStdLogger) Println(v ...interface{}) { l.log(fmt.Sprintln(v...)) }
+
+// leveledLogger is the logger of the driver when ClusterConfig.LogLevel is set,
+// it drops the messages below level before they are formatted.
+type leveledLogger struct {
+	StdLogger
+	level LogLevel
+}
+
+func (l leveledLogger) Print(v ...interface{}) {
+	if LogLevelInfo >= l.level {
+		l.StdLogger.Print(v...)
+	}
+}
+
+func (l leveledLogger) Printf(format string, v ...interface{}) {
+	if LogLevelInfo >= l.level {
+		l.StdLogger.Printf(format, v...)
+	}
+}
+
+func (l leveledLogger) Println(v ...interface{}) {
+	if LogLevelInfo >= l.level {
+		l.StdLogger.Println(v...)
+	}
+}
+
+// unwrapLogger returns the logger wrapped by leveledLogger and whether level
+// is enabled.
+func unwrapLogger(logger StdLogger, level LogLevel) (StdLogger, bool) {
+	if l, ok := logger.(leveledLogger); ok {
+		return l.StdLogger, level >= l.level
+	}
+	return logger, true
+}
+
+// logEnabled reports whether the messages at level are logged to logger, the
+// fields which are costly to build are only built if they are.
+func logEnabled(logger StdLogger, level LogLevel) bool {
+	_, ok := unwrapLogger(logger, level)
+	return ok
+}
+
+// logf logs a message formatted with format at level to logger.
+func logf(logger StdLogger, level LogLevel, format string, v ...interface{}) {
+	logger, ok := unwrapLogger(logger, level)
+	if !ok {
+		return
+	} else if l, ok := logger.(StructuredLogger); ok {
+		l.Log(level, strings.TrimPrefix(strings.TrimSpace(fmt.Sprintf(format, v...)), "gocql: "))
+		return
+	}
+	logger.Printf(format, v...)
+}
+
+// logEvent logs msg with its level and fields to logger if it is backed by a
+// StructuredLogger. Other loggers print format with v, the text the message
+// is logged with to a StdLogger.
+func logEvent(logger StdLogger, level LogLevel, msg string, fields []LogField, format string, v ...interface{}) {
+	logger, ok := unwrapLogger(logger, level)
+	if !ok {
+		return
+	} else if l, ok := logger.(StructuredLogger); ok {
+		l.Log(level, msg, fields...)
+		return
+	}
+	logger.Printf(format, v...)
+}
+
 type nopLogger struct{}
 
 func (n nopLogger) Print(_ ...interface{}) {}
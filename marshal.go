@@ -6,6 +6,8 @@ package gocql
 
 import (
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -22,8 +24,7 @@ import (
 )
 
 var (
-	bigOne     = big.NewInt(1)
-	emptyValue reflect.Value
+	bigOne = big.NewInt(1)
 )
 
 var (
@@ -47,7 +48,12 @@ type Unmarshaler interface {
 //
 // nil is serialized as CQL null.
 // If value implements Marshaler, its MarshalCQL method is called to marshal the data.
+// Otherwise, if value implements driver.Valuer, the value returned by its Value
+// method is marshaled.
 // If value is a pointer, the pointed-to value is marshaled.
+// Named types whose underlying type is a string, integer, float or bool type,
+// such as type Status string, are marshaled as that type, so typed constants
+// can be bound without converting them first.
 //
 // Supported conversions are as follows, other type combinations may be added in the future:
 //
@@ -62,8 +68,10 @@ type Unmarshaler interface {
 //	float                       | float32            |
 //	double                      | float64            |
 //	decimal                     | inf.Dec            |
+//	decimal                     | gocql.Decimal      |
+//	decimal                     | big.Rat            | must have an exact decimal representation
 //	time                        | int64              | nanoseconds since start of day
-//	time                        | time.Duration      | duration since start of day
+//	time                        | time.Duration      | duration since start of day, in [0, 24h)
 //	timestamp                   | int64              | milliseconds since Unix epoch
 //	timestamp                   | time.Time          |
 //	list, set                   | slice, array       |
@@ -73,11 +81,13 @@ type Unmarshaler interface {
 //	uuid, timeuuid              | [16]byte           | raw UUID bytes
 //	uuid, timeuuid              | []byte             | raw UUID bytes, length must be 16 bytes
 //	uuid, timeuuid              | string             | hex representation, see ParseUUID
+//	timeuuid                    | time.Time          | new version 1 UUID, see UUIDFromTime
 //	varint                      | integer types      |
 //	varint                      | big.Int            |
 //	varint                      | string             | value of number in decimal notation
 //	inet                        | net.IP             |
 //	inet                        | string             | IPv4 or IPv6 address string
+//	inet                        | netip.Addr         | go1.18+, addresses with a zone are rejected
 //	tuple                       | slice, array       |
 //	tuple                       | struct             | fields are marshaled in order of declaration
 //	user-defined type           | gocql.UDTMarshaler | MarshalUDT is called
@@ -95,11 +105,26 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 		panic("protocol version not set")
 	}
 
+	// fast path for the native Go types of tinyint and smallint, avoiding the
+	// reflection below on high volume inserts
+	switch v := value.(type) {
+	case int8:
+		if info.Type() == TypeTinyInt {
+			return []byte{byte(v)}, nil
+		}
+	case int16:
+		if info.Type() == TypeSmallInt {
+			return encShort(v), nil
+		}
+	}
+
 	if valueRef := reflect.ValueOf(value); valueRef.Kind() == reflect.Ptr {
 		if valueRef.IsNil() {
 			return nil, nil
 		} else if v, ok := value.(Marshaler); ok {
 			return v.MarshalCQL(info)
+		} else if v, ok := value.(driver.Valuer); ok {
+			return marshalValuer(info, v)
 		} else {
 			return Marshal(info, valueRef.Elem().Interface())
 		}
@@ -108,6 +133,12 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 	if v, ok := value.(Marshaler); ok {
 		return v.MarshalCQL(info)
 	}
+	if v, ok := value.(driver.Valuer); ok {
+		return marshalValuer(info, v)
+	}
+	if _, ok := info.(UnknownTypeInfo); ok {
+		return marshalVarchar(info, value)
+	}
 
 	switch info.Type() {
 	case TypeVarchar, TypeAscii, TypeBlob, TypeText:
@@ -167,8 +198,14 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 //
 // If value implements Unmarshaler, it's UnmarshalCQL method is called to
 // unmarshal the data.
+// Otherwise, if value implements sql.Scanner, its Scan method is called with
+// the data decoded into int64, float64, bool, string, []byte or time.Time
+// depending on the CQL type, or nil if the CQL value is null. CQL types with no
+// such equivalent are passed in the Go type returned by TypeInfo.New.
 // If value is a pointer to pointer, it is set to nil if the CQL value is
 // null. Otherwise, nulls are unmarshalled as zero value.
+// Named types whose underlying type is a string, integer, float or bool type
+// are unmarshaled into as that type.
 //
 // Supported conversions are as follows, other type combinations may be added in the future:
 //
@@ -182,11 +219,14 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 //	float                                   | *float32                |
 //	double                                  | *float64                |
 //	decimal                                 | *inf.Dec                |
+//	decimal                                 | *gocql.Decimal          |
+//	decimal                                 | *big.Rat                |
 //	time                                    | *int64                  | nanoseconds since start of day
-//	time                                    | *time.Duration          |
+//	time                                    | *time.Duration          | duration since start of day
 //	timestamp                               | *int64                  | milliseconds since Unix epoch
 //	timestamp                               | *time.Time              |
 //	list, set                               | *slice, *array          |
+//	set                                     | *map[X]struct{}         | duplicate elements are collapsed
 //	map                                     | *map[X]Y                |
 //	uuid, timeuuid                          | *string                 | see UUID.String
 //	uuid, timeuuid                          | *[]byte                 | raw UUID bytes
@@ -194,23 +234,53 @@ func Marshal(info TypeInfo, value interface{}) ([]byte, error) {
 //	timeuuid                                | *time.Time              | timestamp of the UUID
 //	inet                                    | *net.IP                 |
 //	inet                                    | *string                 | IPv4 or IPv6 address string
+//	inet                                    | *netip.Addr             | go1.18+, IPv4-mapped addresses are unmapped
 //	tuple                                   | *slice, *array          |
 //	tuple                                   | *struct                 | struct fields are set in order of declaration
+//	tuple                                   | *interface{}            | set to a []interface{}, nil if the tuple is null
 //	user-defined types                      | gocql.UDTUnmarshaler    | UnmarshalUDT is called
 //	user-defined types                      | *map[string]interface{} |
+//	user-defined types                      | *interface{}            | set to a map[string]interface{}, nil if the UDT is null
 //	user-defined types                      | *struct                 | cql tag is used to determine field name
 //	date                                    | *time.Time              | time of beginning of the day (in UTC)
 //	date                                    | *string                 | formatted with 2006-01-02 format
 //	duration                                | *gocql.Duration         |
 func Unmarshal(info TypeInfo, data []byte, value interface{}) error {
+	// fast path for the native Go types of tinyint and smallint, see Marshal
+	switch v := value.(type) {
+	case *int8:
+		if info.Type() == TypeTinyInt {
+			if len(data) > 1 {
+				return unmarshalErrorf("unmarshal tinyint: invalid length %d", len(data))
+			}
+			*v = decTiny(data)
+			return nil
+		}
+	case *int16:
+		if info.Type() == TypeSmallInt {
+			if x := len(data); x != 0 && x != 2 {
+				return unmarshalErrorf("unmarshal smallint: invalid length %d", x)
+			}
+			*v = decShort(data)
+			return nil
+		}
+	}
+
 	if v, ok := value.(Unmarshaler); ok {
 		return v.UnmarshalCQL(info, data)
 	}
+	if v, ok := value.(sql.Scanner); ok {
+		return unmarshalScanner(info, data, v)
+	}
 
 	if isNullableValue(value) {
 		return unmarshalNullable(info, data, value)
 	}
 
+	if _, ok := info.(UnknownTypeInfo); ok {
+		return unmarshalVarchar(info, data, value)
+	}
+
 	switch info.Type() {
 	case TypeVarchar, TypeAscii, TypeBlob, TypeText:
 		return unmarshalVarchar(info, data, value)
@@ -709,10 +779,16 @@ func unmarshalInt(info TypeInfo, data []byte, value interface{}) error {
 }
 
 func unmarshalSmallInt(info TypeInfo, data []byte, value interface{}) error {
+	if x := len(data); x != 0 && x != 2 {
+		return unmarshalErrorf("unmarshal smallint: invalid length %d", x)
+	}
 	return unmarshalIntlike(info, int64(decShort(data)), data, value)
 }
 
 func unmarshalTinyInt(info TypeInfo, data []byte, value interface{}) error {
+	if len(data) > 1 {
+		return unmarshalErrorf("unmarshal tinyint: invalid length %d", len(data))
+	}
 	return unmarshalIntlike(info, int64(decTiny(data)), data, value)
 }
 
@@ -720,6 +796,9 @@ func unmarshalVarint(info TypeInfo, data []byte, value interface{}) error {
 	switch v := value.(type) {
 	case *big.Int:
 		return unmarshalIntlike(info, 0, data, value)
+	case *string:
+		*v = decBigInt2C(data, nil).String()
+		return nil
 	case *uint64:
 		if len(data) == 9 && data[0] == 0 {
 			*v = bytesToUint64(data[1:])
@@ -747,6 +826,12 @@ func marshalVarint(info TypeInfo, value interface{}) ([]byte, error) {
 	switch v := value.(type) {
 	case unsetColumn:
 		return nil, nil
+	case string:
+		n, ok := new(big.Int).SetString(v, 10)
+		if !ok {
+			return nil, marshalErrorf("can not marshal string to varint: %q is not an integer", v)
+		}
+		retBytes = encBigInt2C(n)
 	case uint64:
 		if v > uint64(math.MaxInt64) {
 			retBytes = make([]byte, 9)
@@ -1162,6 +1247,14 @@ func marshalDecimal(info TypeInfo, value interface{}) ([]byte, error) {
 		copy(buf[0:4], encInt(int32(v.Scale())))
 		copy(buf[4:], unscaled)
 		return buf, nil
+	case Decimal:
+		return v.marshal(), nil
+	case big.Rat:
+		d, err := DecimalFromRat(&v)
+		if err != nil {
+			return nil, marshalErrorf("can not marshal %s into %s: %v", v.String(), info, err)
+		}
+		return d.marshal(), nil
 	}
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
@@ -1178,6 +1271,20 @@ func unmarshalDecimal(info TypeInfo, data []byte, value interface{}) error {
 		unscaled := decBigInt2C(data[4:], nil)
 		*v = *inf.NewDecBig(unscaled, inf.Scale(scale))
 		return nil
+	case *Decimal:
+		d, err := unmarshalDecimalValue(data)
+		if err != nil {
+			return err
+		}
+		*v = d
+		return nil
+	case *big.Rat:
+		d, err := unmarshalDecimalValue(data)
+		if err != nil {
+			return err
+		}
+		v.Set(d.Rat())
+		return nil
 	}
 	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
 }
@@ -1222,6 +1329,9 @@ func encBigInt2C(n *big.Int) []byte {
 	return nil
 }
 
+// maxTimeOfDay is the exclusive upper bound of the values of the time type.
+const maxTimeOfDay = 24 * time.Hour
+
 func marshalTime(info TypeInfo, value interface{}) ([]byte, error) {
 	switch v := value.(type) {
 	case Marshaler:
@@ -1231,6 +1341,9 @@ func marshalTime(info TypeInfo, value interface{}) ([]byte, error) {
 	case int64:
 		return encBigInt(v), nil
 	case time.Duration:
+		if v < 0 || v >= maxTimeOfDay {
+			return nil, marshalErrorf("can not marshal %s into %s: time of day must be in the range [0, 24h)", v, info)
+		}
 		return encBigInt(v.Nanoseconds()), nil
 	}
 
@@ -1274,6 +1387,65 @@ func marshalTimestamp(info TypeInfo, value interface{}) ([]byte, error) {
 	return nil, marshalErrorf("can not marshal %T into %s", value, info)
 }
 
+// TimestampPrecision determines how the sub-millisecond part of a time.Time is
+// handled when it is bound to a timestamp column of a query.
+type TimestampPrecision int
+
+const (
+	// TimestampTruncate drops the sub-millisecond part.
+	TimestampTruncate TimestampPrecision = iota
+	// TimestampRound rounds to the nearest millisecond, halfway values are rounded up.
+	TimestampRound
+	// TimestampStrict returns an error if the sub-millisecond part is not zero.
+	TimestampStrict
+)
+
+func (p TimestampPrecision) String() string {
+	switch p {
+	case TimestampTruncate:
+		return "truncate"
+	case TimestampRound:
+		return "round"
+	case TimestampStrict:
+		return "strict"
+	default:
+		return fmt.Sprintf("unknown_timestamp_precision_%d", int(p))
+	}
+}
+
+// adjust applies the precision to a time.Time bound to a timestamp column, any
+// other value is returned unchanged.
+func (p TimestampPrecision) adjust(info TypeInfo, value interface{}) (interface{}, error) {
+	if p == TimestampTruncate || info.Type() != TypeTimestamp {
+		return value, nil
+	}
+
+	switch v := value.(type) {
+	case time.Time:
+		return p.adjustTime(info, v)
+	case *time.Time:
+		if v == nil {
+			return value, nil
+		}
+		return p.adjustTime(info, *v)
+	}
+	return value, nil
+}
+
+func (p TimestampPrecision) adjustTime(info TypeInfo, t time.Time) (time.Time, error) {
+	if t.IsZero() || t.Nanosecond()%int(time.Millisecond) == 0 {
+		return t, nil
+	}
+
+	switch p {
+	case TimestampRound:
+		return t.Round(time.Millisecond), nil
+	case TimestampStrict:
+		return t, marshalErrorf("can not marshal %v into %s without losing sub-millisecond precision", t, info)
+	}
+	return t, nil
+}
+
 func unmarshalTime(info TypeInfo, data []byte, value interface{}) error {
 	switch v := value.(type) {
 	case Unmarshaler:
@@ -1282,7 +1454,11 @@ func unmarshalTime(info TypeInfo, data []byte, value interface{}) error {
 		*v = decBigInt(data)
 		return nil
 	case *time.Duration:
-		*v = time.Duration(decBigInt(data))
+		d := time.Duration(decBigInt(data))
+		if d < 0 || d >= maxTimeOfDay {
+			return unmarshalErrorf("can not unmarshal %s into %T: time of day %s is out of the range [0, 24h)", info, value, d)
+		}
+		*v = d
 		return nil
 	}
 
@@ -1687,6 +1863,48 @@ func unmarshalList(info TypeInfo, data []byte, value interface{}) error {
 			}
 		}
 		return nil
+	case reflect.Map:
+		// only sets can be unmarshaled into a map[X]struct{}, lists may contain
+		// duplicates which would be silently dropped
+		elem := t.Elem()
+		if listInfo.Type() != TypeSet || elem.Kind() != reflect.Struct || elem.NumField() != 0 {
+			break
+		}
+		if data == nil {
+			if rv.IsNil() {
+				return nil
+			}
+			rv.Set(reflect.Zero(t))
+			return nil
+		}
+		n, p, err := readCollectionSize(listInfo, data)
+		if err != nil {
+			return err
+		}
+		data = data[p:]
+		rv.Set(reflect.MakeMapWithSize(t, n))
+		empty := reflect.Zero(elem)
+		for i := 0; i < n; i++ {
+			m, p, err := readCollectionSize(listInfo, data)
+			if err != nil {
+				return err
+			}
+			data = data[p:]
+			var unmarshalData []byte
+			if m >= 0 {
+				if len(data) < m {
+					return unmarshalErrorf("unmarshal set: unexpected eof")
+				}
+				unmarshalData = data[:m]
+				data = data[m:]
+			}
+			key := reflect.New(t.Key())
+			if err := Unmarshal(listInfo.Elem, unmarshalData, key.Interface()); err != nil {
+				return err
+			}
+			rv.SetMapIndex(key.Elem(), empty)
+		}
+		return nil
 	}
 	return unmarshalErrorf("can not unmarshal %s into %T", info, value)
 }
@@ -1846,6 +2064,10 @@ func marshalUUID(info TypeInfo, value interface{}) ([]byte, error) {
 			return nil, err
 		}
 		return b[:], nil
+	case time.Time:
+		if info.Type() == TypeTimeUUID {
+			return UUIDFromTime(val).Bytes(), nil
+		}
 	}
 
 	if value == nil {
@@ -1905,6 +2127,10 @@ func unmarshalTimeUUID(info TypeInfo, data []byte, value interface{}) error {
 	case Unmarshaler:
 		return v.UnmarshalCQL(info, data)
 	case *time.Time:
+		if len(data) == 0 {
+			*v = time.Time{}
+			return nil
+		}
 		id, err := UUIDFromBytes(data)
 		if err != nil {
 			return err
@@ -1943,6 +2169,10 @@ func marshalInet(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, marshalErrorf("cannot marshal. invalid ip string %s", val)
 	}
 
+	if b, ok, err := marshalInetAddr(info, value); ok {
+		return b, err
+	}
+
 	if value == nil {
 		return nil, nil
 	}
@@ -1979,6 +2209,9 @@ func unmarshalInet(info TypeInfo, data []byte, value interface{}) error {
 		*v = ip.String()
 		return nil
 	}
+	if ok, err := unmarshalInetAddr(info, data, value); ok {
+		return err
+	}
 	return unmarshalErrorf("cannot unmarshal %s into %T", info, value)
 }
 
@@ -2100,12 +2333,29 @@ func unmarshalTuple(info TypeInfo, data []byte, value interface{}) error {
 			if len(data) >= 4 {
 				p, data = readBytes(data)
 			}
+			if v[i] == nil {
+				// the element is skipped
+				continue
+			}
 			err := Unmarshal(elem, p, v[i])
 			if err != nil {
 				return err
 			}
 		}
 
+		return nil
+	case *interface{}:
+		// decode the tuple from its metadata alone, the nested tuples and UDTs
+		// are decoded into []interface{} and map[string]interface{}
+		if data == nil {
+			*v = nil
+			return nil
+		}
+		var elems []interface{}
+		if err := unmarshalTuple(info, data, &elems); err != nil {
+			return err
+		}
+		*v = elems
 		return nil
 	}
 
@@ -2265,21 +2515,16 @@ func marshalUDT(info TypeInfo, value interface{}) ([]byte, error) {
 		return nil, marshalErrorf("cannot marshal %T into %s", value, info)
 	}
 
-	fields := make(map[string]reflect.Value)
-	t := reflect.TypeOf(value)
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
+	fields, err := udtStructFields(udt, k.Type())
+	if err != nil {
+		return nil, marshalErrorf("cannot marshal %T into %s: %v", value, info, err)
 	}
 
 	var buf []byte
 	for _, e := range udt.Elements {
-		f, ok := fields[e.Name]
-		if !ok {
-			f = k.FieldByName(e.Name)
+		var f reflect.Value
+		if index, ok := fields[e.Name]; ok {
+			f = k.FieldByIndex(index)
 		}
 
 		var data []byte
@@ -2365,6 +2610,19 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 			m[e.Name] = val.Elem().Interface()
 		}
 
+		return nil
+	case *interface{}:
+		// there is no Go type to decode the UDT into, decode it into a map keyed
+		// by field name using only the field names and types of its metadata
+		var m map[string]interface{}
+		if err := unmarshalUDT(info, data, &m); err != nil {
+			return err
+		}
+		if m == nil {
+			*v = nil
+		} else {
+			*v = m
+		}
 		return nil
 	}
 
@@ -2385,17 +2643,12 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 		return nil
 	}
 
-	t := k.Type()
-	fields := make(map[string]reflect.Value, t.NumField())
-	for i := 0; i < t.NumField(); i++ {
-		sf := t.Field(i)
-
-		if tag := sf.Tag.Get("cql"); tag != "" {
-			fields[tag] = k.Field(i)
-		}
+	udt := info.(UDTTypeInfo)
+	fields, err := udtStructFields(udt, k.Type())
+	if err != nil {
+		return unmarshalErrorf("cannot unmarshal %s into %T: %v", info, value, err)
 	}
 
-	udt := info.(UDTTypeInfo)
 	for id, e := range udt.Elements {
 		if len(data) == 0 {
 			return nil
@@ -2408,16 +2661,14 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 		var p []byte
 		p, data = readBytes(data)
 
-		f, ok := fields[e.Name]
+		index, ok := fields[e.Name]
 		if !ok {
-			f = k.FieldByName(e.Name)
-			if f == emptyValue {
-				// skip fields which exist in the UDT but not in
-				// the struct passed in
-				continue
-			}
+			// skip fields which exist in the UDT but not in
+			// the struct passed in
+			continue
 		}
 
+		f := k.FieldByIndex(index)
 		if !f.IsValid() || !f.CanAddr() {
 			return unmarshalErrorf("cannot unmarshal %s into %T: field %v is not valid", info, value, e.Name)
 		}
@@ -2431,6 +2682,73 @@ func unmarshalUDT(info TypeInfo, data []byte, value interface{}) error {
 	return nil
 }
 
+// StrictUDT is embedded in a struct marshaled to or unmarshaled from a UDT to
+// make fields of the UDT without a struct field, and struct fields with a cql
+// tag naming a field the UDT does not have, an error. By default the UDT
+// fields without a struct field are marshaled as null and left out when
+// unmarshaling, and the extra struct fields are ignored.
+//
+//	type Address struct {
+//		gocql.StrictUDT
+//		Street string `cql:"street"`
+//		City   string `cql:"city"`
+//	}
+type StrictUDT struct{}
+
+var strictUDTType = reflect.TypeOf(StrictUDT{})
+
+// udtStructFields returns the index of the field of the struct type t which
+// holds each field of udt. A struct field holds the UDT field named by its cql
+// tag, or else the UDT field with the same name as the struct field. A field
+// tagged cql:"-" holds no UDT field.
+func udtStructFields(udt UDTTypeInfo, t reflect.Type) (map[string][]int, error) {
+	var (
+		tagged  = make(map[string][]int, t.NumField())
+		ignored = make(map[string]bool)
+		strict  bool
+	)
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous && sf.Type == strictUDTType {
+			strict = true
+			continue
+		}
+
+		switch tag := sf.Tag.Get("cql"); tag {
+		case "":
+		case "-":
+			ignored[sf.Name] = true
+		default:
+			tagged[tag] = sf.Index
+		}
+	}
+
+	fields := make(map[string][]int, len(udt.Elements))
+	for _, e := range udt.Elements {
+		if index, ok := tagged[e.Name]; ok {
+			fields[e.Name] = index
+			continue
+		}
+		if sf, ok := t.FieldByName(e.Name); ok && !ignored[e.Name] {
+			fields[e.Name] = sf.Index
+			continue
+		}
+		if strict {
+			return nil, fmt.Errorf("no struct field for the UDT field %q", e.Name)
+		}
+	}
+	if strict {
+		for i := 0; i < t.NumField(); i++ {
+			if tag := t.Field(i).Tag.Get("cql"); tag != "" && tag != "-" {
+				if _, ok := fields[tag]; !ok {
+					return nil, fmt.Errorf("the UDT has no field %q", tag)
+				}
+			}
+		}
+	}
+	return fields, nil
+}
+
 // TypeInfo describes a Cassandra specific data type.
 type TypeInfo interface {
 	Type() Type
@@ -2499,6 +2817,36 @@ func (s NativeType) String() string {
 	}
 }
 
+// UnknownTypePolicy is how values of CQL types unknown to gocql are handled,
+// see ClusterConfig.UnknownTypePolicy.
+type UnknownTypePolicy int
+
+const (
+	// UnknownTypeError fails to marshal and unmarshal values of unknown types,
+	// unless they implement Marshaler or Unmarshaler.
+	UnknownTypeError UnknownTypePolicy = iota
+	// UnknownTypeRawBytes marshals and unmarshals values of unknown types as
+	// their raw bytes, see UnknownTypeInfo.
+	UnknownTypeRawBytes
+)
+
+// UnknownTypeInfo is the TypeInfo of columns of a type unknown to gocql, either
+// a type ID gocql doesn't know or a custom type, with the UnknownTypeRawBytes
+// policy. Type and Custom return the type ID and the class name of custom types
+// sent by the server. Values are marshaled from and unmarshaled into string and
+// []byte as they are, the Go type of TypeInfo.New is []byte.
+type UnknownTypeInfo struct {
+	NativeType
+}
+
+func (t UnknownTypeInfo) NewWithError() (interface{}, error) {
+	return new([]byte), nil
+}
+
+func (t UnknownTypeInfo) New() interface{} {
+	return new([]byte)
+}
+
 type CollectionType struct {
 	NativeType
 	Key  TypeInfo // only used for TypeMap
@@ -2708,6 +3056,11 @@ func (t Type) String() string {
 	}
 }
 
+// known reports whether t is a type ID gocql knows.
+func (t Type) known() bool {
+	return t <= TypeDuration || (t >= TypeList && t <= TypeSet) || t == TypeUDT || t == TypeTuple
+}
+
 type MarshalError string
 
 func (m MarshalError) Error() string {
@@ -0,0 +1,48 @@
+//go:build go1.18
+// +build go1.18
+
+package gocql
+
+import "net/netip"
+
+// marshalInetAddr marshals a netip.Addr into the 4 or 16 byte representation
+// of an inet. IPv4-mapped IPv6 addresses are sent as IPv4, matching net.IP.
+// Zones can not be represented in an inet and are rejected.
+func marshalInetAddr(info TypeInfo, value interface{}) ([]byte, bool, error) {
+	addr, ok := value.(netip.Addr)
+	if !ok {
+		return nil, false, nil
+	}
+	if !addr.IsValid() {
+		return nil, true, nil
+	}
+	if addr.Zone() != "" {
+		return nil, true, marshalErrorf("cannot marshal %s into %s: zones are not supported by inet", addr, info)
+	}
+	addr = addr.Unmap()
+	if addr.Is4() {
+		b := addr.As4()
+		return b[:], true, nil
+	}
+	b := addr.As16()
+	return b[:], true, nil
+}
+
+// unmarshalInetAddr unmarshals an inet into a *netip.Addr. IPv4-mapped IPv6
+// addresses are unmapped so that they compare equal to their IPv4 form.
+func unmarshalInetAddr(info TypeInfo, data []byte, value interface{}) (bool, error) {
+	v, ok := value.(*netip.Addr)
+	if !ok {
+		return false, nil
+	}
+	if len(data) == 0 {
+		*v = netip.Addr{}
+		return true, nil
+	}
+	addr, ok := netip.AddrFromSlice(data)
+	if !ok {
+		return true, unmarshalErrorf("cannot unmarshal %s into %T: invalid sized IP: got %d bytes not 4 or 16", info, value, len(data))
+	}
+	*v = addr.Unmap()
+	return true, nil
+}
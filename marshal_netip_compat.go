@@ -0,0 +1,12 @@
+//go:build !go1.18
+// +build !go1.18
+
+package gocql
+
+func marshalInetAddr(info TypeInfo, value interface{}) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+func unmarshalInetAddr(info TypeInfo, data []byte, value interface{}) (bool, error) {
+	return false, nil
+}
@@ -0,0 +1,59 @@
+//go:build (all || unit) && go1.18
+// +build all unit
+// +build go1.18
+
+package gocql
+
+import (
+	"bytes"
+	"net/netip"
+	"testing"
+)
+
+func TestMarshalInetAddr(t *testing.T) {
+	info := NativeType{proto: 2, typ: TypeInet}
+
+	tests := []struct {
+		addr netip.Addr
+		data []byte
+	}{
+		{netip.MustParseAddr("127.0.0.1"), []byte{127, 0, 0, 1}},
+		{netip.MustParseAddr("::ffff:127.0.0.1"), []byte{127, 0, 0, 1}},
+		{netip.MustParseAddr("fe80::1"), []byte{0xfe, 0x80, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+		{netip.Addr{}, nil},
+	}
+	for _, test := range tests {
+		data, err := Marshal(info, test.addr)
+		if err != nil {
+			t.Errorf("marshal %v: %v", test.addr, err)
+			continue
+		}
+		if !bytes.Equal(data, test.data) {
+			t.Errorf("marshal %v: expected %v, got %v", test.addr, test.data, data)
+		}
+
+		var addr netip.Addr
+		if err := Unmarshal(info, data, &addr); err != nil {
+			t.Errorf("unmarshal %v: %v", data, err)
+			continue
+		}
+		if want := test.addr.Unmap(); addr != want {
+			t.Errorf("unmarshal %v: expected %v, got %v", data, want, addr)
+		}
+	}
+
+	if _, err := Marshal(info, netip.MustParseAddr("fe80::1%eth0")); err == nil {
+		t.Error("expected marshaling an address with a zone to fail")
+	}
+
+	var addr netip.Addr
+	if err := Unmarshal(info, []byte{1, 2, 3}, &addr); err == nil {
+		t.Error("expected unmarshaling 3 bytes to fail")
+	}
+
+	// a *netip.Addr is dereferenced like any other pointer
+	ptr := netip.MustParseAddr("10.0.0.1")
+	if data, err := Marshal(info, &ptr); err != nil || !bytes.Equal(data, []byte{10, 0, 0, 1}) {
+		t.Errorf("marshal *netip.Addr: got %v, %v", data, err)
+	}
+}
@@ -0,0 +1,76 @@
+package gocql
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"math/big"
+	"net"
+	"reflect"
+	"time"
+
+	"gopkg.in/inf.v0"
+)
+
+// marshalValuer marshals the value returned by the Value method of v, values
+// implementing driver.Valuer but not Marshaler are marshaled this way.
+func marshalValuer(info TypeInfo, v driver.Valuer) ([]byte, error) {
+	value, err := v.Value()
+	if err != nil {
+		return nil, marshalErrorf("can not marshal %T into %s: %v", v, info, err)
+	}
+	return Marshal(info, value)
+}
+
+// unmarshalScanner unmarshals data into the Go type of its CQL type, converts
+// it to a driver.Value where possible and passes it to the Scan method of s:
+//
+//	CQL type                                | value passed to Scan
+//	null                                    | nil
+//	tinyint, smallint, int, bigint, counter | int64
+//	float, double                           | float64
+//	varchar, ascii, text                    | string
+//	blob                                    | []byte
+//	boolean                                 | bool
+//	timestamp, date                         | time.Time
+//	time                                    | int64, nanoseconds since start of day
+//	uuid, timeuuid, inet, decimal, varint   | string
+//	other types                             | the Go type of TypeInfo.New
+func unmarshalScanner(info TypeInfo, data []byte, s sql.Scanner) error {
+	if data == nil {
+		return s.Scan(nil)
+	}
+
+	ptr, err := info.NewWithError()
+	if err != nil {
+		// no Go type for the CQL type, pass the raw bytes
+		return s.Scan(copyBytes(data))
+	}
+	if err := Unmarshal(info, data, ptr); err != nil {
+		return err
+	}
+
+	var src interface{}
+	switch v := reflect.ValueOf(ptr).Elem().Interface().(type) {
+	case int8:
+		src = int64(v)
+	case int16:
+		src = int64(v)
+	case int:
+		src = int64(v)
+	case float32:
+		src = float64(v)
+	case time.Duration:
+		src = int64(v)
+	case UUID:
+		src = v.String()
+	case net.IP:
+		src = v.String()
+	case *inf.Dec:
+		src = v.String()
+	case *big.Int:
+		src = v.String()
+	default:
+		src = v
+	}
+	return s.Scan(src)
+}
@@ -5,7 +5,10 @@ package gocql
 
 import (
 	"bytes"
+	"database/sql"
+	"database/sql/driver"
 	"encoding/binary"
+	"errors"
 	"math"
 	"math/big"
 	"net"
@@ -417,6 +420,16 @@ var marshalTests = []struct {
 		nil,
 		nil,
 	},
+	{
+		CollectionType{
+			NativeType: NativeType{proto: 2, typ: TypeSet},
+			Elem:       NativeType{proto: 2, typ: TypeInt},
+		},
+		[]byte("\x00\x01\x00\x04\x00\x00\x00\x01"),
+		map[int]struct{}{1: {}},
+		nil,
+		nil,
+	},
 	{
 		CollectionType{
 			NativeType: NativeType{proto: 2, typ: TypeMap},
@@ -1368,6 +1381,41 @@ func TestMarshal_Decode(t *testing.T) {
 	}
 }
 
+func TestUnmarshalSetIntoMap(t *testing.T) {
+	set := CollectionType{
+		NativeType: NativeType{proto: 3, typ: TypeSet},
+		Elem:       NativeType{proto: 3, typ: TypeVarchar},
+	}
+	data, err := Marshal(set, []string{"a", "b", "c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]struct{}
+	if err := Unmarshal(set, data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]struct{}{"a": {}, "b": {}, "c": {}}) {
+		t.Fatalf("unexpected set %v", got)
+	}
+
+	// null resets the map
+	if err := Unmarshal(set, nil, &got); err != nil {
+		t.Fatal(err)
+	} else if got != nil {
+		t.Fatalf("expected a nil map, got %v", got)
+	}
+
+	// lists may hold duplicates so they can't be unmarshaled into a set
+	list := CollectionType{
+		NativeType: NativeType{proto: 3, typ: TypeList},
+		Elem:       NativeType{proto: 3, typ: TypeVarchar},
+	}
+	if err := Unmarshal(list, data, &got); err == nil {
+		t.Fatal("expected an error unmarshaling a list into a map[string]struct{}")
+	}
+}
+
 func TestMarshalVarint(t *testing.T) {
 	varintTests := []struct {
 		Value       interface{}
@@ -1739,6 +1787,77 @@ func TestMarshalTime(t *testing.T) {
 	}
 }
 
+func TestMarshalTimeOfDayRange(t *testing.T) {
+	info := NativeType{proto: 4, typ: TypeTime}
+	valid := []time.Duration{0, time.Nanosecond, 13*time.Hour + 30*time.Minute, 24*time.Hour - time.Nanosecond}
+	for _, d := range valid {
+		data, err := Marshal(info, d)
+		if err != nil {
+			t.Errorf("marshal %s: %v", d, err)
+			continue
+		}
+		var got time.Duration
+		if err := Unmarshal(info, data, &got); err != nil {
+			t.Errorf("unmarshal %s: %v", d, err)
+		} else if got != d {
+			t.Errorf("expected %s, got %s", d, got)
+		}
+	}
+
+	invalid := []time.Duration{-time.Nanosecond, -time.Hour, 24 * time.Hour, 36 * time.Hour}
+	for _, d := range invalid {
+		if _, err := Marshal(info, d); err == nil {
+			t.Errorf("expected an error marshaling %s", d)
+		} else if _, ok := err.(MarshalError); !ok {
+			t.Errorf("expected a MarshalError marshaling %s, got %T", d, err)
+		}
+		var got time.Duration
+		if err := Unmarshal(info, encBigInt(int64(d)), &got); err == nil {
+			t.Errorf("expected an error unmarshaling %s", d)
+		} else if _, ok := err.(UnmarshalError); !ok {
+			t.Errorf("expected an UnmarshalError unmarshaling %s, got %T", d, err)
+		}
+	}
+
+	// int64 values are not validated
+	if _, err := Marshal(info, int64(-1)); err != nil {
+		t.Errorf("marshal int64: %v", err)
+	}
+}
+
+func TestMarshalTimeUUIDTime(t *testing.T) {
+	date := time.Date(2013, time.August, 13, 9, 52, 3, 123456700, time.UTC)
+	info := NativeType{proto: 4, typ: TypeTimeUUID}
+
+	data, err := Marshal(info, date)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := UUIDFromBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Version() != 1 || u.Variant() != VariantIETF {
+		t.Fatalf("expected a version 1 UUID, got %v", u)
+	}
+
+	var got time.Time
+	if err := Unmarshal(info, data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !got.Equal(date) {
+		t.Fatalf("expected %v, got %v", date, got)
+	}
+
+	if err := Unmarshal(info, nil, &got); err != nil || !got.IsZero() {
+		t.Fatalf("expected a null timeuuid to unmarshal to the zero time, got %v and error %v", got, err)
+	}
+
+	if _, err := Marshal(NativeType{proto: 4, typ: TypeUUID}, date); err == nil {
+		t.Fatal("expected an error marshaling time.Time into uuid")
+	}
+}
+
 func TestMarshalTimestamp(t *testing.T) {
 	var marshalTimestampTests = []struct {
 		Info  TypeInfo
@@ -1805,6 +1924,59 @@ func TestMarshalTimestamp(t *testing.T) {
 	}
 }
 
+func TestTimestampPrecision(t *testing.T) {
+	info := NativeType{proto: 4, typ: TypeTimestamp}
+	exact := time.Date(2013, time.August, 13, 9, 52, 3, 123000000, time.UTC)
+	below := time.Date(2013, time.August, 13, 9, 52, 3, 123499999, time.UTC)
+	above := time.Date(2013, time.August, 13, 9, 52, 3, 123500000, time.UTC)
+
+	tests := []struct {
+		precision TimestampPrecision
+		value     interface{}
+		expected  int64
+		err       bool
+	}{
+		{TimestampTruncate, above, 1376387523123, false},
+		{TimestampRound, below, 1376387523123, false},
+		{TimestampRound, above, 1376387523124, false},
+		{TimestampRound, &above, 1376387523124, false},
+		{TimestampStrict, exact, 1376387523123, false},
+		{TimestampStrict, below, 0, true},
+		{TimestampStrict, int64(1376387523123), 1376387523123, false},
+		{TimestampStrict, time.Time{}, 0, false},
+	}
+
+	for i, test := range tests {
+		var v queryValues
+		err := marshalQueryValue(info, test.value, &v, test.precision)
+		if test.err {
+			if err == nil {
+				t.Errorf("%d: expected an error with precision %v for %v", i, test.precision, test.value)
+			}
+			continue
+		} else if err != nil {
+			t.Errorf("%d: %v", i, err)
+			continue
+		}
+
+		if len(v.value) == 0 {
+			if test.expected != 0 {
+				t.Errorf("%d: expected %d, got no value", i, test.expected)
+			}
+			continue
+		}
+		if got := decBigInt(v.value); got != test.expected {
+			t.Errorf("%d: expected %d with precision %v, got %d", i, test.expected, test.precision, got)
+		}
+	}
+
+	// other types are left alone
+	var v queryValues
+	if err := marshalQueryValue(NativeType{proto: 4, typ: TypeDate}, below, &v, TimestampStrict); err != nil {
+		t.Fatalf("expected date to be marshaled regardless of timestamp precision: %v", err)
+	}
+}
+
 func TestMarshalTuple(t *testing.T) {
 	info := TupleTypeInfo{
 		NativeType: NativeType{proto: 3, typ: TypeTuple},
@@ -2027,6 +2199,65 @@ func TestUnmarshalTuple(t *testing.T) {
 	})
 }
 
+func TestUnmarshalTupleUDTInterface(t *testing.T) {
+	pair := TupleTypeInfo{
+		NativeType: NativeType{proto: 4, typ: TypeTuple},
+		Elems: []TypeInfo{
+			NativeType{proto: 4, typ: TypeVarchar},
+			NativeType{proto: 4, typ: TypeInt},
+		},
+	}
+	udt := UDTTypeInfo{
+		NativeType: NativeType{proto: 4, typ: TypeUDT},
+		Name:       "result",
+		Elements: []UDTField{
+			{Name: "count", Type: NativeType{proto: 4, typ: TypeInt}},
+			{Name: "pair", Type: pair},
+		},
+	}
+	info := TupleTypeInfo{
+		NativeType: NativeType{proto: 4, typ: TypeTuple},
+		Elems:      []TypeInfo{NativeType{proto: 4, typ: TypeInt}, udt},
+	}
+
+	field := func(b []byte) []byte {
+		return append(encInt(int32(len(b))), b...)
+	}
+	udtData := append(field(encInt(2)), field(append(field([]byte("x")), field(encInt(3))...))...)
+	data := append(field(encInt(1)), field(udtData)...)
+
+	expected := []interface{}{
+		1,
+		map[string]interface{}{"count": 2, "pair": []interface{}{"x", 3}},
+	}
+
+	var value interface{}
+	if err := Unmarshal(info, data, &value); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, expected) {
+		t.Fatalf("expected %#v, got %#v", expected, value)
+	}
+
+	value = nil
+	if err := Unmarshal(udt, udtData, &value); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(value, expected[1]) {
+		t.Fatalf("expected %#v, got %#v", expected[1], value)
+	}
+
+	for _, typ := range []TypeInfo{info, udt} {
+		value = "not null"
+		if err := Unmarshal(typ, nil, &value); err != nil {
+			t.Fatal(err)
+		}
+		if value != nil {
+			t.Fatalf("expected a null %s to be nil, got %#v", typ, value)
+		}
+	}
+}
+
 func TestMarshalUDTMap(t *testing.T) {
 	typeInfo := UDTTypeInfo{NativeType{proto: 3, typ: TypeUDT}, "", "xyz", []UDTField{
 		{Name: "x", Type: NativeType{proto: 3, typ: TypeInt}},
@@ -2151,6 +2382,89 @@ func TestMarshalUDTStruct(t *testing.T) {
 	})
 }
 
+func TestUDTStructRoundTrip(t *testing.T) {
+	point := UDTTypeInfo{NativeType{proto: 3, typ: TypeUDT}, "", "point", []UDTField{
+		{Name: "x", Type: NativeType{proto: 3, typ: TypeInt}},
+		{Name: "y", Type: NativeType{proto: 3, typ: TypeInt}},
+	}}
+	shape := UDTTypeInfo{NativeType{proto: 3, typ: TypeUDT}, "", "shape", []UDTField{
+		{Name: "name", Type: NativeType{proto: 3, typ: TypeVarchar}},
+		{Name: "origin", Type: point},
+		{Name: "tags", Type: CollectionType{NativeType: NativeType{proto: 3, typ: TypeList}, Elem: NativeType{proto: 3, typ: TypeVarchar}}},
+	}}
+
+	type Point struct {
+		X int32 `cql:"x"`
+		Y int32 `cql:"y"`
+	}
+	type Shape struct {
+		Name   string   `cql:"name"`
+		Origin *Point   `cql:"origin"`
+		Tags   []string `cql:"tags"`
+		Cached string   `cql:"-"`
+	}
+
+	// nested UDTs and collections, from a pointer to the struct
+	in := &Shape{Name: "square", Origin: &Point{X: 1, Y: 2}, Tags: []string{"a", "b"}, Cached: "ignored"}
+	data, err := Marshal(shape, in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out Shape
+	if err := Unmarshal(shape, data, &out); err != nil {
+		t.Fatal(err)
+	}
+	in.Cached = ""
+	if !reflect.DeepEqual(&out, in) {
+		t.Fatalf("expected %+v, got %+v", in, out)
+	}
+
+	type PartialPoint struct {
+		X int32 `cql:"x"`
+		Z int32 `cql:"z"`
+	}
+	type StrictPoint struct {
+		StrictUDT
+		X int32 `cql:"x"`
+		Y int32 `cql:"y"`
+	}
+	type StrictPartialPoint struct {
+		StrictUDT
+		X int32 `cql:"x"`
+	}
+	type StrictExtraPoint struct {
+		StrictUDT
+		X int32 `cql:"x"`
+		Y int32 `cql:"y"`
+		Z int32 `cql:"z"`
+	}
+
+	// missing and extra fields are skipped unless StrictUDT is embedded
+	data, err = Marshal(point, PartialPoint{X: 1, Z: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var partial PartialPoint
+	if err := Unmarshal(point, data, &partial); err != nil || partial.X != 1 || partial.Z != 0 {
+		t.Fatalf("expected the partial point {1 0}, got %+v: %v", partial, err)
+	}
+
+	data, err = Marshal(point, StrictPoint{X: 1, Y: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var strict StrictPoint
+	if err := Unmarshal(point, data, &strict); err != nil || strict.X != 1 || strict.Y != 2 {
+		t.Fatalf("expected the point {1 2}, got %+v: %v", strict, err)
+	}
+	if _, err := Marshal(point, StrictPartialPoint{X: 1}); err == nil {
+		t.Fatal("expected an error marshaling a strict struct without a UDT field")
+	}
+	if err := Unmarshal(point, data, &StrictExtraPoint{}); err == nil {
+		t.Fatal("expected an error unmarshaling into a strict struct with a field the UDT does not have")
+	}
+}
+
 func TestMarshalNil(t *testing.T) {
 	types := []Type{
 		TypeAscii,
@@ -2327,6 +2641,119 @@ func BenchmarkUnmarshalVarchar(b *testing.B) {
 	}
 }
 
+func TestMarshalTinySmallIntNative(t *testing.T) {
+	tiny := NativeType{proto: 4, typ: TypeTinyInt}
+	small := NativeType{proto: 4, typ: TypeSmallInt}
+
+	for _, v := range []int8{math.MinInt8, -1, 0, 1, math.MaxInt8} {
+		data, err := Marshal(tiny, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int8
+		if err := Unmarshal(tiny, data, &got); err != nil {
+			t.Fatal(err)
+		} else if got != v {
+			t.Errorf("tinyint: expected %d, got %d", v, got)
+		}
+	}
+
+	for _, v := range []int16{math.MinInt16, -1, 0, 1, math.MaxInt16} {
+		data, err := Marshal(small, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got int16
+		if err := Unmarshal(small, data, &got); err != nil {
+			t.Fatal(err)
+		} else if got != v {
+			t.Errorf("smallint: expected %d, got %d", v, got)
+		}
+	}
+
+	// widening keeps the sign
+	var wide int16
+	if err := Unmarshal(tiny, []byte{0xff}, &wide); err != nil {
+		t.Fatal(err)
+	} else if wide != -1 {
+		t.Errorf("expected -1, got %d", wide)
+	}
+
+	// narrowing checks the range
+	var narrow int8
+	if err := Unmarshal(small, []byte{0x01, 0x00}, &narrow); err == nil {
+		t.Error("expected an error narrowing 256 into int8")
+	}
+	if _, err := Marshal(tiny, int16(128)); err == nil {
+		t.Error("expected an error marshaling 128 into tinyint")
+	}
+
+	var v8 int8
+	if err := Unmarshal(tiny, []byte{1, 2}, &v8); err == nil {
+		t.Error("expected an error unmarshaling 2 bytes into tinyint")
+	}
+	var v16 int16
+	if err := Unmarshal(small, []byte{1, 2, 3}, &v16); err == nil {
+		t.Error("expected an error unmarshaling 3 bytes into smallint")
+	}
+	var v int
+	if err := Unmarshal(small, []byte{1}, &v); err == nil {
+		t.Error("expected an error unmarshaling 1 byte into smallint")
+	}
+}
+
+func BenchmarkMarshalTinyInt(b *testing.B) {
+	b.ReportAllocs()
+	info := NativeType{proto: 4, typ: TypeTinyInt}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(info, int8(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkMarshalSmallInt(b *testing.B) {
+	b.ReportAllocs()
+	info := NativeType{proto: 4, typ: TypeSmallInt}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Marshal(info, int16(i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalTinyInt(b *testing.B) {
+	b.ReportAllocs()
+	info := NativeType{proto: 4, typ: TypeTinyInt}
+	src := []byte{0x80}
+	var dst int8
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(info, src, &dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalSmallInt(b *testing.B) {
+	b.ReportAllocs()
+	info := NativeType{proto: 4, typ: TypeSmallInt}
+	src := []byte{0x80, 0x01}
+	var dst int16
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := Unmarshal(info, src, &dst); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 func TestMarshalDuration(t *testing.T) {
 	durationS := "1h10m10s"
 	duration, _ := time.ParseDuration(durationS)
@@ -2372,6 +2799,70 @@ func TestMarshalDuration(t *testing.T) {
 	}
 }
 
+type upperValuer string
+
+func (u upperValuer) Value() (driver.Value, error) {
+	if u == "" {
+		return nil, errors.New("empty value")
+	}
+	return strings.ToUpper(string(u)), nil
+}
+
+func TestMarshalSQLValuerScanner(t *testing.T) {
+	text := NativeType{proto: 4, typ: TypeVarchar}
+	bigint := NativeType{proto: 4, typ: TypeBigInt}
+	integer := NativeType{proto: 4, typ: TypeInt}
+	uuid := NativeType{proto: 4, typ: TypeUUID}
+
+	data, err := Marshal(text, upperValuer("abc"))
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != "ABC" {
+		t.Errorf("expected ABC, got %q", data)
+	}
+	if _, err := Marshal(text, upperValuer("")); err == nil {
+		t.Error("expected the error of Value to be returned")
+	}
+
+	data, err = Marshal(bigint, sql.NullInt64{Int64: 42, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n sql.NullInt64
+	if err := Unmarshal(bigint, data, &n); err != nil {
+		t.Fatal(err)
+	} else if !n.Valid || n.Int64 != 42 {
+		t.Errorf("expected 42, got %+v", n)
+	}
+
+	// null values marshal to and unmarshal from CQL null
+	if data, err := Marshal(text, sql.NullString{}); err != nil {
+		t.Fatal(err)
+	} else if data != nil {
+		t.Errorf("expected null, got %q", data)
+	}
+	s := sql.NullString{String: "x", Valid: true}
+	if err := Unmarshal(text, nil, &s); err != nil {
+		t.Fatal(err)
+	} else if s.Valid {
+		t.Errorf("expected an invalid NullString, got %+v", s)
+	}
+
+	// narrower integers are passed to Scan as int64
+	if err := Unmarshal(integer, encInt(-7), &n); err != nil {
+		t.Fatal(err)
+	} else if !n.Valid || n.Int64 != -7 {
+		t.Errorf("expected -7, got %+v", n)
+	}
+
+	u := TimeUUID()
+	if err := Unmarshal(uuid, u.Bytes(), &s); err != nil {
+		t.Fatal(err)
+	} else if !s.Valid || s.String != u.String() {
+		t.Errorf("expected %s, got %+v", u, s)
+	}
+}
+
 func TestReadCollectionSize(t *testing.T) {
 	listV2 := CollectionType{
 		NativeType: NativeType{proto: 2, typ: TypeList},
@@ -2519,3 +3010,45 @@ func bytesWithLength(data ...[]byte) []byte {
 	}
 	return ret
 }
+
+func TestMarshalNamedTypes(t *testing.T) {
+	type status string
+	type level int16
+
+	for _, typ := range []Type{TypeVarchar, TypeText, TypeAscii} {
+		info := NativeType{proto: protoVersion4, typ: typ}
+		data, err := Marshal(info, status("active"))
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		var got status
+		if err := Unmarshal(info, data, &got); err != nil || got != "active" {
+			t.Fatalf("%s: expected active, got %q: %v", typ, got, err)
+		}
+	}
+
+	for _, typ := range []Type{TypeTinyInt, TypeSmallInt, TypeInt, TypeBigInt, TypeCounter, TypeVarint} {
+		info := NativeType{proto: protoVersion4, typ: typ}
+		data, err := Marshal(info, level(3))
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		var got level
+		if err := Unmarshal(info, data, &got); err != nil || got != 3 {
+			t.Fatalf("%s: expected 3, got %d: %v", typ, got, err)
+		}
+	}
+
+	listType := CollectionType{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeList},
+		Elem:       NativeType{proto: protoVersion4, typ: TypeVarchar},
+	}
+	data, err := Marshal(listType, []status{"active", "closed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []status
+	if err := Unmarshal(listType, data, &got); err != nil || !reflect.DeepEqual(got, []status{"active", "closed"}) {
+		t.Fatalf("expected [active closed], got %v: %v", got, err)
+	}
+}
@@ -5,8 +5,10 @@
 package gocql
 
 import (
+	"context"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
@@ -42,6 +44,26 @@ type TableMetadata struct {
 	ClusteringColumns []*ColumnMetadata
 	Columns           map[string]*ColumnMetadata
 	OrderedColumns    []string
+
+	// Options are the options of the table, such as its compaction, compression
+	// or caching, keyed by their name in system_schema.tables. They are only
+	// read from Cassandra 3.0+, and are nil if they could not be read.
+	Options map[string]interface{}
+	// Indexes are the secondary indexes of the table, keyed by name. They are
+	// only read from Cassandra 3.0+, and are nil if they could not be read.
+	Indexes map[string]*IndexMetadata
+}
+
+// IndexMetadata holds the metadata of a secondary index.
+type IndexMetadata struct {
+	Keyspace string
+	Table    string
+	Name     string
+	// Kind is KEYS, COMPOSITES or CUSTOM.
+	Kind string
+	// Options holds the target of the index, the indexed column, and the
+	// class_name of custom indexes along with their options.
+	Options map[string]string
 }
 
 // schema metadata for a column
@@ -68,6 +90,9 @@ type FunctionMetadata struct {
 	CalledOnNullInput bool
 	Language          string
 	ReturnType        TypeInfo
+
+	argumentTypeNames []string
+	returnTypeName    string
 }
 
 // AggregateMetadata holds metadata for aggregate constructs
@@ -83,6 +108,9 @@ type AggregateMetadata struct {
 
 	stateFunc string
 	finalFunc string
+
+	argumentTypeNames []string
+	stateTypeName     string
 }
 
 // ViewMetadata holds the metadata for views.
@@ -92,6 +120,8 @@ type ViewMetadata struct {
 	Name       string
 	FieldNames []string
 	FieldTypes []TypeInfo
+
+	fieldTypeNames []string
 }
 
 // MaterializedViewMetadata holds the metadata for materialized views.
@@ -117,8 +147,11 @@ type MaterializedViewMetadata struct {
 	MinIndexInterval        int
 	ReadRepairChance        float64
 	SpeculativeRetry        string
+	WhereClause             string
 
 	baseTableName string
+	// columns holds the columns and primary key of the view.
+	columns *TableMetadata
 }
 
 type UserTypeMetadata struct {
@@ -126,6 +159,8 @@ type UserTypeMetadata struct {
 	Name       string
 	FieldNames []string
 	FieldTypes []TypeInfo
+
+	fieldTypeNames []string
 }
 
 // the ordering of the column with regard to its comparator
@@ -288,10 +323,14 @@ func (s *schemaDescriber) refreshSchema(keyspaceName string) error {
 	if err != nil {
 		return err
 	}
+	indexes := getIndexesMetadata(s.session, keyspaceName, "")
+	options := getTablesOptions(s.session, keyspaceName, "")
 
 	// organize the schema data
 	compileMetadata(s.session.cfg.ProtoVersion, keyspace, tables, columns, functions, aggregates, views,
 		materializedViews, s.session.logger)
+	addIndexes(keyspace.Tables, indexes)
+	addTablesOptions(keyspace.Tables, options)
 
 	// update the cache
 	s.cache[keyspaceName] = keyspace
@@ -299,6 +338,209 @@ func (s *schemaDescriber) refreshSchema(keyspaceName string) error {
 	return nil
 }
 
+// refreshCached reads again the metadata of all the cached keyspaces, those
+// which no longer exist are removed from the cache.
+func (s *schemaDescriber) refreshCached(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for keyspaceName := range s.cache {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := s.refreshSchema(keyspaceName); err != nil {
+			// read it again when it is next requested
+			delete(s.cache, keyspaceName)
+			if !errors.Is(err, ErrKeyspaceDoesNotExist) {
+				return fmt.Errorf("gocql: refreshing the schema of keyspace %q: %w", keyspaceName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaRefreshPolicy is how the cached keyspace metadata is refreshed on
+// schema change events, see ClusterConfig.SchemaRefreshPolicy.
+type SchemaRefreshPolicy int
+
+const (
+	// SchemaRefreshIncremental reads again only the options of a changed
+	// keyspace, or the changed table or user type, and keeps the rest of the
+	// cached metadata of the keyspace. Other changes, and the changes of
+	// clusters without the system_schema keyspace (before Cassandra 3.0),
+	// refresh the whole keyspace, as do changes failing to be read.
+	SchemaRefreshIncremental SchemaRefreshPolicy = iota
+	// SchemaRefreshFull reads again all the metadata of the changed keyspace.
+	SchemaRefreshFull
+)
+
+// incremental reports whether changes of tables and types are refreshed
+// incrementally.
+func (s *schemaDescriber) incremental() bool {
+	return s.session.cfg.SchemaRefreshPolicy == SchemaRefreshIncremental && s.session.useSystemSchema
+}
+
+// update replaces the cached metadata of keyspaceName by the metadata returned
+// by fn for the cached metadata, which must not be modified. The keyspace is
+// cleared, to be read again entirely, if fn fails. Nothing is done if the
+// keyspace isn't cached.
+func (s *schemaDescriber) update(keyspaceName string, fn func(cached *KeyspaceMetadata) (*KeyspaceMetadata, error)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	cached, ok := s.cache[keyspaceName]
+	if !ok {
+		return
+	}
+	updated, err := fn(cached)
+	if err != nil {
+		logEvent(s.session.logger, LogLevelWarn, "unable to refresh the schema of keyspace incrementally, it will be read again entirely",
+			[]LogField{{"keyspace", keyspaceName}, {"error", err}},
+			"gocql: unable to refresh the schema of keyspace %q incrementally, it will be read again entirely: %v\n", keyspaceName, err)
+		delete(s.cache, keyspaceName)
+		return
+	}
+	s.cache[keyspaceName] = updated
+}
+
+// keyspaceChanged refreshes the cached metadata of keyspaceName after a
+// keyspace schema change event.
+func (s *schemaDescriber) keyspaceChanged(keyspaceName, change string) {
+	if change != "UPDATED" || s.session.cfg.SchemaRefreshPolicy != SchemaRefreshIncremental {
+		s.clearSchema(keyspaceName)
+		return
+	}
+	s.update(keyspaceName, func(cached *KeyspaceMetadata) (*KeyspaceMetadata, error) {
+		keyspace, err := getKeyspaceMetadata(s.session, keyspaceName)
+		if err != nil {
+			return nil, err
+		}
+		return cached.withOptions(keyspace), nil
+	})
+}
+
+// tableChanged refreshes the cached metadata of keyspaceName after a schema
+// change event of its table tableName.
+func (s *schemaDescriber) tableChanged(keyspaceName, tableName, change string) {
+	if !s.incremental() {
+		s.clearSchema(keyspaceName)
+		return
+	}
+	s.update(keyspaceName, func(cached *KeyspaceMetadata) (*KeyspaceMetadata, error) {
+		if _, ok := cached.MaterializedViews[tableName]; ok {
+			return nil, fmt.Errorf("%q is a materialized view", tableName)
+		}
+		if change == "DROPPED" {
+			return cached.withoutTable(tableName), nil
+		}
+		table, err := getSingleTableMetadata(s.session, keyspaceName, tableName)
+		if err != nil {
+			return nil, err
+		}
+		return cached.withTable(table), nil
+	})
+}
+
+// typeChanged refreshes the cached metadata of keyspaceName after a schema
+// change event of its user type typeName.
+func (s *schemaDescriber) typeChanged(keyspaceName, typeName, change string) {
+	if !s.incremental() {
+		s.clearSchema(keyspaceName)
+		return
+	}
+	s.update(keyspaceName, func(cached *KeyspaceMetadata) (*KeyspaceMetadata, error) {
+		if change == "DROPPED" {
+			return cached.withoutUserType(typeName), nil
+		}
+		views, err := queryViewsMetadata(s.session, keyspaceName, typeName)
+		if err != nil {
+			return nil, err
+		}
+		if len(views) != 1 {
+			return nil, fmt.Errorf("user type %q not found", typeName)
+		}
+		return cached.withUserType(&views[0]), nil
+	})
+}
+
+// withOptions returns a copy of k with the options of keyspace, such as its
+// replication strategy.
+func (k *KeyspaceMetadata) withOptions(keyspace *KeyspaceMetadata) *KeyspaceMetadata {
+	updated := *k
+	updated.DurableWrites = keyspace.DurableWrites
+	updated.StrategyClass = keyspace.StrategyClass
+	updated.StrategyOptions = keyspace.StrategyOptions
+	return &updated
+}
+
+// withTable returns a copy of k with table added, or replacing the table of the
+// same name, the materialized views of the table reference it.
+func (k *KeyspaceMetadata) withTable(table *TableMetadata) *KeyspaceMetadata {
+	updated := *k
+	updated.Tables = make(map[string]*TableMetadata, len(k.Tables)+1)
+	for name, t := range k.Tables {
+		updated.Tables[name] = t
+	}
+	updated.Tables[table.Name] = table
+
+	updated.MaterializedViews = make(map[string]*MaterializedViewMetadata, len(k.MaterializedViews))
+	for name, view := range k.MaterializedViews {
+		if view.baseTableName == table.Name {
+			v := *view
+			v.BaseTable = table
+			view = &v
+		}
+		updated.MaterializedViews[name] = view
+	}
+	return &updated
+}
+
+// withoutTable returns a copy of k without the table name.
+func (k *KeyspaceMetadata) withoutTable(name string) *KeyspaceMetadata {
+	updated := *k
+	updated.Tables = make(map[string]*TableMetadata, len(k.Tables))
+	for n, t := range k.Tables {
+		if n != name {
+			updated.Tables[n] = t
+		}
+	}
+	return &updated
+}
+
+// withUserType returns a copy of k with the user type of view added, or
+// replacing the type of the same name.
+func (k *KeyspaceMetadata) withUserType(view *ViewMetadata) *KeyspaceMetadata {
+	updated := k.withoutUserType(view.Name)
+	updated.Views[view.Name] = view
+	updated.UserTypes[view.Name] = &UserTypeMetadata{
+		Keyspace:   view.Keyspace,
+		Name:       view.Name,
+		FieldNames: view.FieldNames,
+		FieldTypes: view.FieldTypes,
+
+		fieldTypeNames: view.fieldTypeNames,
+	}
+	return updated
+}
+
+// withoutUserType returns a copy of k without the user type name.
+func (k *KeyspaceMetadata) withoutUserType(name string) *KeyspaceMetadata {
+	updated := *k
+	updated.Views = make(map[string]*ViewMetadata, len(k.Views)+1)
+	for n, v := range k.Views {
+		if n != name {
+			updated.Views[n] = v
+		}
+	}
+	updated.UserTypes = make(map[string]*UserTypeMetadata, len(k.UserTypes)+1)
+	for n, t := range k.UserTypes {
+		if n != name {
+			updated.UserTypes[n] = t
+		}
+	}
+	return &updated
+}
+
 // "compiles" derived information about keyspace, table, and column metadata
 // for a keyspace from the basic queried metadata objects returned by
 // getKeyspaceMetadata, getTableMetadata, and getColumnMetadata respectively;
@@ -327,8 +569,13 @@ func compileMetadata(
 	}
 	keyspace.Aggregates = make(map[string]*AggregateMetadata, len(aggregates))
 	for i, _ := range aggregates {
-		aggregates[i].FinalFunc = *keyspace.Functions[aggregates[i].finalFunc]
-		aggregates[i].StateFunc = *keyspace.Functions[aggregates[i].stateFunc]
+		// the final function is optional
+		if fn, ok := keyspace.Functions[aggregates[i].finalFunc]; ok {
+			aggregates[i].FinalFunc = *fn
+		}
+		if fn, ok := keyspace.Functions[aggregates[i].stateFunc]; ok {
+			aggregates[i].StateFunc = *fn
+		}
 		keyspace.Aggregates[aggregates[i].Name] = &aggregates[i]
 	}
 	keyspace.Views = make(map[string]*ViewMetadata, len(views))
@@ -343,6 +590,7 @@ func compileMetadata(
 		types[i].Name = views[i].Name
 		types[i].FieldNames = views[i].FieldNames
 		types[i].FieldTypes = views[i].FieldTypes
+		types[i].fieldTypeNames = views[i].fieldTypeNames
 	}
 	keyspace.UserTypes = make(map[string]*UserTypeMetadata, len(views))
 	for i := range types {
@@ -351,6 +599,7 @@ func compileMetadata(
 	keyspace.MaterializedViews = make(map[string]*MaterializedViewMetadata, len(materializedViews))
 	for i, _ := range materializedViews {
 		materializedViews[i].BaseTable = keyspace.Tables[materializedViews[i].baseTableName]
+		materializedViews[i].columns = keyspace.Tables[materializedViews[i].Name]
 		keyspace.MaterializedViews[materializedViews[i].Name] = &materializedViews[i]
 	}
 
@@ -542,6 +791,33 @@ func componentColumnCountOfType(columns map[string]*ColumnMetadata, kind ColumnK
 	return maxComponentIndex + 1
 }
 
+// query the names of all keyspaces from system_schema.keyspaces or system.schema_keyspaces
+func getKeyspaceNames(session *Session) ([]string, error) {
+	useSystemSchema, err := checkSystemSchema(session.control)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := `SELECT keyspace_name FROM system.schema_keyspaces`
+	if useSystemSchema { // Cassandra 3.x+
+		stmt = `SELECT keyspace_name FROM system_schema.keyspaces`
+	}
+
+	var (
+		names []string
+		name  string
+	)
+	iter := session.control.query(stmt)
+	for iter.Scan(&name) {
+		names = append(names, name)
+	}
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("error querying keyspace names: %v", err)
+	}
+
+	return names, nil
+}
+
 // query only for the keyspace metadata for the specified keyspace from system.schema_keyspace
 func getKeyspaceMetadata(session *Session, keyspaceName string) (*KeyspaceMetadata, error) {
 	keyspace := &KeyspaceMetadata{Name: keyspaceName}
@@ -602,6 +878,39 @@ func getKeyspaceMetadata(session *Session, keyspaceName string) (*KeyspaceMetada
 	return keyspace, nil
 }
 
+// getSingleTableMetadata queries the metadata of the table tableName of the
+// keyspace, including its columns, from system_schema.
+func getSingleTableMetadata(session *Session, keyspaceName, tableName string) (*TableMetadata, error) {
+	const stmt = `
+		SELECT table_name
+		FROM system_schema.tables
+		WHERE keyspace_name = ? AND table_name = ?`
+
+	iter := session.control.query(stmt, keyspaceName, tableName)
+	found := iter.NumRows() > 0
+	if err := iter.Close(); err != nil {
+		return nil, fmt.Errorf("error querying table schema: %v", err)
+	}
+	if !found {
+		// possibly a materialized view
+		return nil, fmt.Errorf("table %q not found", tableName)
+	}
+
+	columns, err := session.scanColumnMetadataSystem(keyspaceName, tableName)
+	if err != nil && err != ErrNotFound {
+		return nil, fmt.Errorf("error querying column schema: %v", err)
+	}
+	indexes := getIndexesMetadata(session, keyspaceName, tableName)
+	options := getTablesOptions(session, keyspaceName, tableName)
+
+	keyspace := &KeyspaceMetadata{Name: keyspaceName}
+	tables := []TableMetadata{{Keyspace: keyspaceName, Name: tableName}}
+	compileMetadata(session.cfg.ProtoVersion, keyspace, tables, columns, nil, nil, nil, nil, session.logger)
+	addIndexes(keyspace.Tables, indexes)
+	addTablesOptions(keyspace.Tables, options)
+	return keyspace.Tables[tableName], nil
+}
+
 // query for only the table metadata in the specified keyspace from system.schema_columnfamilies
 func getTableMetadata(session *Session, keyspaceName string) ([]TableMetadata, error) {
 
@@ -858,8 +1167,10 @@ func (s *Session) scanColumnMetadataV2(keyspace string) ([]ColumnMetadata, error
 
 }
 
-func (s *Session) scanColumnMetadataSystem(keyspace string) ([]ColumnMetadata, error) {
-	const stmt = `
+// scanColumnMetadataSystem queries the columns of keyspace, or only of its
+// table if not empty.
+func (s *Session) scanColumnMetadataSystem(keyspace, table string) ([]ColumnMetadata, error) {
+	stmt := `
 			SELECT
 				table_name,
 				column_name,
@@ -869,10 +1180,15 @@ func (s *Session) scanColumnMetadataSystem(keyspace string) ([]ColumnMetadata, e
 				position
 			FROM system_schema.columns
 			WHERE keyspace_name = ?`
+	values := []interface{}{keyspace}
+	if table != "" {
+		stmt += ` AND table_name = ?`
+		values = append(values, table)
+	}
 
 	var columns []ColumnMetadata
 
-	rows := s.control.query(stmt, keyspace).Scanner()
+	rows := s.control.query(stmt, values...).Scanner()
 	for rows.Next() {
 		column := ColumnMetadata{Keyspace: keyspace}
 
@@ -895,8 +1211,6 @@ func (s *Session) scanColumnMetadataSystem(keyspace string) ([]ColumnMetadata, e
 		return nil, err
 	}
 
-	// TODO(zariel): get column index info from system_schema.indexes
-
 	return columns, nil
 }
 
@@ -911,7 +1225,7 @@ func getColumnMetadata(session *Session, keyspaceName string) ([]ColumnMetadata,
 	if session.cfg.ProtoVersion == 1 {
 		columns, err = session.scanColumnMetadataV1(keyspaceName)
 	} else if session.useSystemSchema { // Cassandra 3.x+
-		columns, err = session.scanColumnMetadataSystem(keyspaceName)
+		columns, err = session.scanColumnMetadataSystem(keyspaceName, "")
 	} else {
 		columns, err = session.scanColumnMetadataV2(keyspaceName)
 	}
@@ -923,6 +1237,15 @@ func getColumnMetadata(session *Session, keyspaceName string) ([]ColumnMetadata,
 	return columns, nil
 }
 
+// cqlTypeName returns the CQL name of the type t, which is a class name before
+// Cassandra 3.0.
+func cqlTypeName(t string) string {
+	if strings.HasPrefix(t, apacheCassandraTypePrefix) {
+		return apacheToCassandraType(t)
+	}
+	return t
+}
+
 func getTypeInfo(t string, logger StdLogger) TypeInfo {
 	if strings.HasPrefix(t, apacheCassandraTypePrefix) {
 		t = apacheToCassandraType(t)
@@ -931,6 +1254,12 @@ func getTypeInfo(t string, logger StdLogger) TypeInfo {
 }
 
 func getViewsMetadata(session *Session, keyspaceName string) ([]ViewMetadata, error) {
+	return queryViewsMetadata(session, keyspaceName, "")
+}
+
+// queryViewsMetadata queries the user types of the keyspace, or only the type
+// typeName if not empty.
+func queryViewsMetadata(session *Session, keyspaceName, typeName string) ([]ViewMetadata, error) {
 	if session.cfg.ProtoVersion == protoVersion1 {
 		return nil, nil
 	}
@@ -947,10 +1276,15 @@ func getViewsMetadata(session *Session, keyspaceName string) ([]ViewMetadata, er
 			field_types
 		FROM %s
 		WHERE keyspace_name = ?`, tableName)
+	values := []interface{}{keyspaceName}
+	if typeName != "" {
+		stmt += ` AND type_name = ?`
+		values = append(values, typeName)
+	}
 
 	var views []ViewMetadata
 
-	rows := session.control.query(stmt, keyspaceName).Scanner()
+	rows := session.control.query(stmt, values...).Scanner()
 	for rows.Next() {
 		view := ViewMetadata{Keyspace: keyspaceName}
 		var argumentTypes []string
@@ -962,8 +1296,10 @@ func getViewsMetadata(session *Session, keyspaceName string) ([]ViewMetadata, er
 			return nil, err
 		}
 		view.FieldTypes = make([]TypeInfo, len(argumentTypes))
+		view.fieldTypeNames = make([]string, len(argumentTypes))
 		for i, argumentType := range argumentTypes {
 			view.FieldTypes[i] = getTypeInfo(argumentType, session.logger)
+			view.fieldTypeNames[i] = cqlTypeName(argumentType)
 		}
 		views = append(views, view)
 	}
@@ -1001,7 +1337,8 @@ func getMaterializedViewsMetadata(session *Session, keyspaceName string) ([]Mate
 			memtable_flush_period_in_ms,
 			min_index_interval,
 			read_repair_chance,
-			speculative_retry
+			speculative_retry,
+			where_clause
 		FROM %s
 		WHERE keyspace_name = ?`, tableName)
 
@@ -1030,6 +1367,7 @@ func getMaterializedViewsMetadata(session *Session, keyspaceName string) ([]Mate
 			&materializedView.MinIndexInterval,
 			&materializedView.ReadRepairChance,
 			&materializedView.SpeculativeRetry,
+			&materializedView.WhereClause,
 		)
 		if err != nil {
 			return nil, err
@@ -1044,6 +1382,143 @@ func getMaterializedViewsMetadata(session *Session, keyspaceName string) ([]Mate
 	return materializedViews, nil
 }
 
+// tableOptions returns the options of the table of row, read from
+// system_schema.tables.
+func tableOptions(row map[string]interface{}) map[string]interface{} {
+	options := make(map[string]interface{}, len(row))
+	for name, value := range row {
+		switch name {
+		case "keyspace_name", "table_name":
+		default:
+			options[name] = value
+		}
+	}
+	return options
+}
+
+// getTablesOptions queries the options of the tables of the keyspace, or only
+// of its table tableName if not empty, keyed by table. They are only used to
+// describe the tables, the error of the query is logged and no options are
+// returned.
+func getTablesOptions(session *Session, keyspaceName, tableName string) map[string]map[string]interface{} {
+	if !session.useSystemSchema {
+		return nil
+	}
+	stmt := `
+		SELECT *
+		FROM system_schema.tables
+		WHERE keyspace_name = ?`
+	values := []interface{}{keyspaceName}
+	if tableName != "" {
+		stmt += ` AND table_name = ?`
+		values = append(values, tableName)
+	}
+
+	options := make(map[string]map[string]interface{})
+	iter := session.control.query(stmt, values...)
+	for {
+		row := make(map[string]interface{})
+		if !iter.MapScan(row) {
+			break
+		}
+		name, _ := row["table_name"].(string)
+		options[name] = tableOptions(row)
+	}
+	if err := iter.Close(); err != nil && err != ErrNotFound {
+		logEvent(session.logger, LogLevelWarn, "unable to read the options of the tables",
+			[]LogField{{"keyspace", keyspaceName}, {"error", err}},
+			"gocql: unable to read the options of the tables of keyspace %q: %v\n", keyspaceName, err)
+		return nil
+	}
+	return options
+}
+
+// addTablesOptions sets the options of the tables of tables.
+func addTablesOptions(tables map[string]*TableMetadata, options map[string]map[string]interface{}) {
+	for name, table := range tables {
+		if opts, ok := options[name]; ok {
+			table.Options = opts
+		}
+	}
+}
+
+// getIndexesMetadata queries the secondary indexes of the keyspace, or only of
+// its table tableName if not empty. They are only used to describe the tables,
+// the error of the query is logged and no indexes are returned.
+func getIndexesMetadata(session *Session, keyspaceName, tableName string) []IndexMetadata {
+	if !session.useSystemSchema {
+		return nil
+	}
+	stmt := `
+		SELECT
+			table_name,
+			index_name,
+			kind,
+			options
+		FROM system_schema.indexes
+		WHERE keyspace_name = ?`
+	values := []interface{}{keyspaceName}
+	if tableName != "" {
+		stmt += ` AND table_name = ?`
+		values = append(values, tableName)
+	}
+
+	var indexes []IndexMetadata
+
+	rows := session.control.query(stmt, values...).Scanner()
+	for rows.Next() {
+		index := IndexMetadata{Keyspace: keyspaceName}
+		err := rows.Scan(&index.Table,
+			&index.Name,
+			&index.Kind,
+			&index.Options,
+		)
+		if err != nil {
+			rows.Err()
+			logIndexesError(session, keyspaceName, err)
+			return nil
+		}
+		indexes = append(indexes, index)
+	}
+
+	if err := rows.Err(); err != nil {
+		logIndexesError(session, keyspaceName, err)
+		return nil
+	}
+
+	return indexes
+}
+
+func logIndexesError(session *Session, keyspaceName string, err error) {
+	logEvent(session.logger, LogLevelWarn, "unable to read the secondary indexes",
+		[]LogField{{"keyspace", keyspaceName}, {"error", err}},
+		"gocql: unable to read the secondary indexes of keyspace %q: %v\n", keyspaceName, err)
+}
+
+// addIndexes adds the indexes to their table of tables, and sets the Index of
+// the columns they target.
+func addIndexes(tables map[string]*TableMetadata, indexes []IndexMetadata) {
+	for i := range indexes {
+		index := &indexes[i]
+		table, ok := tables[index.Table]
+		if !ok {
+			continue
+		}
+		if table.Indexes == nil {
+			table.Indexes = make(map[string]*IndexMetadata)
+		}
+		table.Indexes[index.Name] = index
+
+		if column, ok := table.Columns[unquoteIdentifier(index.Options["target"])]; ok {
+			options := make(map[string]interface{}, len(index.Options))
+			for k, v := range index.Options {
+				options[k] = v
+			}
+			column.Index = ColumnIndexMetadata{Name: index.Name, Type: index.Kind, Options: options}
+		}
+	}
+}
+
 func getFunctionsMetadata(session *Session, keyspaceName string) ([]FunctionMetadata, error) {
 	if session.cfg.ProtoVersion == protoVersion1 || !session.hasAggregatesAndFunctions {
 		return nil, nil
@@ -1085,9 +1560,12 @@ func getFunctionsMetadata(session *Session, keyspaceName string) ([]FunctionMeta
 			return nil, err
 		}
 		function.ReturnType = getTypeInfo(returnType, session.logger)
+		function.returnTypeName = cqlTypeName(returnType)
 		function.ArgumentTypes = make([]TypeInfo, len(argumentTypes))
+		function.argumentTypeNames = make([]string, len(argumentTypes))
 		for i, argumentType := range argumentTypes {
 			function.ArgumentTypes[i] = getTypeInfo(argumentType, session.logger)
+			function.argumentTypeNames[i] = cqlTypeName(argumentType)
 		}
 		functions = append(functions, function)
 	}
@@ -1143,9 +1621,12 @@ func getAggregatesMetadata(session *Session, keyspaceName string) ([]AggregateMe
 		}
 		aggregate.ReturnType = getTypeInfo(returnType, session.logger)
 		aggregate.StateType = getTypeInfo(stateType, session.logger)
+		aggregate.stateTypeName = cqlTypeName(stateType)
 		aggregate.ArgumentTypes = make([]TypeInfo, len(argumentTypes))
+		aggregate.argumentTypeNames = make([]string, len(argumentTypes))
 		for i, argumentType := range argumentTypes {
 			aggregate.ArgumentTypes[i] = getTypeInfo(argumentType, session.logger)
+			aggregate.argumentTypeNames[i] = cqlTypeName(argumentType)
 		}
 		aggregates = append(aggregates, aggregate)
 	}
@@ -1234,7 +1715,7 @@ func (t *typeParser) parse() typeParserResult {
 				var name string
 				decoded, err := hex.DecodeString(*param.name)
 				if err != nil {
-					t.logger.Printf(
+					logf(t.logger, LogLevelWarn,
 						"Error parsing type '%s', contains collection name '%s' with an invalid format: %v",
 						t.input,
 						*param.name,
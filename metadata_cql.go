@@ -0,0 +1,507 @@
+package gocql
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// reservedKeywords are the CQL keywords which can't be used as unquoted
+// identifiers.
+var reservedKeywords = map[string]bool{
+	"add": true, "allow": true, "alter": true, "and": true, "apply": true,
+	"asc": true, "authorize": true, "batch": true, "begin": true, "by": true,
+	"columnfamily": true, "create": true, "default": true, "delete": true,
+	"desc": true, "describe": true, "drop": true, "entries": true,
+	"execute": true, "from": true, "full": true, "grant": true, "if": true,
+	"in": true, "index": true, "infinity": true, "insert": true, "into": true,
+	"is": true, "keyspace": true, "limit": true, "materialized": true,
+	"mbean": true, "mbeans": true, "modify": true, "nan": true,
+	"norecursive": true, "not": true, "null": true, "of": true, "on": true,
+	"or": true, "order": true, "primary": true, "rename": true,
+	"replace": true, "revoke": true, "schema": true, "select": true,
+	"set": true, "table": true, "to": true, "token": true, "truncate": true,
+	"unlogged": true, "unset": true, "update": true, "use": true,
+	"using": true, "view": true, "where": true, "with": true,
+}
+
+var unquotedIdentifier = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// quoteIdentifier returns the CQL identifier of name, quoted if it is case
+// sensitive, contains other characters than letters, digits and underscores
+// or is a reserved keyword.
+func quoteIdentifier(name string) string {
+	if unquotedIdentifier.MatchString(name) && !reservedKeywords[name] {
+		return name
+	}
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// unquoteIdentifier returns the name of the CQL identifier ident.
+func unquoteIdentifier(ident string) string {
+	if len(ident) < 2 || ident[0] != '"' || ident[len(ident)-1] != '"' {
+		return ident
+	}
+	return strings.Replace(ident[1:len(ident)-1], `""`, `"`, -1)
+}
+
+// quoteString returns the CQL string literal of s.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// qualifiedName returns the CQL name of the object name of keyspace.
+func qualifiedName(keyspace, name string) string {
+	return quoteIdentifier(keyspace) + "." + quoteIdentifier(name)
+}
+
+// cqlLiteral returns the CQL literal of the option value v.
+func cqlLiteral(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return quoteString(v)
+	case float64:
+		s := strconv.FormatFloat(v, 'f', -1, 64)
+		if !strings.ContainsAny(s, ".eE") {
+			s += ".0"
+		}
+		return s
+	case float32:
+		return cqlLiteral(float64(v))
+	case []byte:
+		return "0x" + hex.EncodeToString(v)
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = quoteString(k) + ": " + quoteString(v[k])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case map[string][]byte:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, k := range keys {
+			entries[i] = quoteString(k) + ": " + cqlLiteral(v[k])
+		}
+		return "{" + strings.Join(entries, ", ") + "}"
+	case []string:
+		elems := make([]string, len(v))
+		for i, elem := range v {
+			elems[i] = quoteString(elem)
+		}
+		return "{" + strings.Join(elems, ", ") + "}"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// cqlTypeOf returns the CQL name of the type info, used when the name read
+// from the schema isn't known.
+func cqlTypeOf(info TypeInfo) string {
+	switch info := info.(type) {
+	case CollectionType:
+		switch info.typ {
+		case TypeMap:
+			return fmt.Sprintf("map<%s, %s>", cqlTypeOf(info.Key), cqlTypeOf(info.Elem))
+		case TypeList, TypeSet:
+			return fmt.Sprintf("%s<%s>", info.typ, cqlTypeOf(info.Elem))
+		}
+	case TupleTypeInfo:
+		elems := make([]string, len(info.Elems))
+		for i, elem := range info.Elems {
+			elems[i] = cqlTypeOf(elem)
+		}
+		return "frozen<tuple<" + strings.Join(elems, ", ") + ">>"
+	case UDTTypeInfo:
+		return "frozen<" + quoteIdentifier(info.Name) + ">"
+	}
+	if info.Type() == TypeCustom {
+		return quoteString(info.Custom())
+	}
+	return info.Type().String()
+}
+
+// cqlTypeNames returns the CQL names of the types, names if they were read
+// from the schema.
+func cqlTypeNames(names []string, types []TypeInfo) []string {
+	if len(names) == len(types) {
+		return names
+	}
+	names = make([]string, len(types))
+	for i, typ := range types {
+		names[i] = cqlTypeOf(typ)
+	}
+	return names
+}
+
+// cqlType returns the CQL name of the type of the column.
+func (c *ColumnMetadata) cqlType() string {
+	if c.Validator != "" && !strings.Contains(c.Validator, apacheCassandraTypePrefix) {
+		return c.Validator
+	}
+	return cqlTypeOf(c.Type)
+}
+
+// ToCQL returns the CQL statements creating the keyspace and all its user
+// types, tables, indexes, functions, aggregates and materialized views, like
+// the DESCRIBE KEYSPACE command of cqlsh. The statements are separated by an
+// empty line and ordered so that they can be executed in turn, the user types
+// after those they depend on.
+func (k *KeyspaceMetadata) ToCQL() string {
+	var buf bytes.Buffer
+	buf.WriteString(k.keyspaceCQL())
+
+	for _, name := range k.orderedUserTypes() {
+		buf.WriteString("\n\n")
+		buf.WriteString(k.UserTypes[name].ToCQL())
+	}
+
+	for _, name := range sortedKeys(k.Tables) {
+		if _, ok := k.MaterializedViews[name]; ok {
+			continue
+		}
+		table := k.Tables[name]
+		buf.WriteString("\n\n")
+		buf.WriteString(table.ToCQL())
+		for _, index := range sortedKeys(table.Indexes) {
+			buf.WriteString("\n\n")
+			buf.WriteString(table.Indexes[index].ToCQL())
+		}
+	}
+
+	for _, name := range sortedKeys(k.Functions) {
+		buf.WriteString("\n\n")
+		buf.WriteString(k.Functions[name].ToCQL())
+	}
+	for _, name := range sortedKeys(k.Aggregates) {
+		buf.WriteString("\n\n")
+		buf.WriteString(k.Aggregates[name].ToCQL())
+	}
+	for _, name := range sortedKeys(k.MaterializedViews) {
+		buf.WriteString("\n\n")
+		buf.WriteString(k.MaterializedViews[name].ToCQL())
+	}
+	buf.WriteString("\n")
+	return buf.String()
+}
+
+func (k *KeyspaceMetadata) keyspaceCQL() string {
+	replication := []string{"'class': " + quoteString(k.StrategyClass)}
+	for _, name := range sortedKeys(k.StrategyOptions) {
+		if name != "class" {
+			replication = append(replication, quoteString(name)+": "+quoteString(fmt.Sprint(k.StrategyOptions[name])))
+		}
+	}
+	return fmt.Sprintf("CREATE KEYSPACE %s WITH replication = {%s} AND durable_writes = %t;",
+		quoteIdentifier(k.Name), strings.Join(replication, ", "), k.DurableWrites)
+}
+
+// orderedUserTypes returns the names of the user types of k, ordered by name
+// except that the types used by the fields of a type come first.
+func (k *KeyspaceMetadata) orderedUserTypes() []string {
+	var (
+		names   []string
+		visited = make(map[string]bool, len(k.UserTypes))
+		visit   func(name string)
+	)
+	visit = func(name string) {
+		typ, ok := k.UserTypes[name]
+		if !ok || visited[name] {
+			return
+		}
+		visited[name] = true
+		for _, field := range cqlTypeNames(typ.fieldTypeNames, typ.FieldTypes) {
+			for _, dep := range typeIdentifiers(field) {
+				visit(dep)
+			}
+		}
+		names = append(names, name)
+	}
+	for _, name := range sortedKeys(k.UserTypes) {
+		visit(name)
+	}
+	return names
+}
+
+// typeIdentifiers returns the names of the identifiers of the CQL type typ.
+func typeIdentifiers(typ string) []string {
+	var (
+		names []string
+		ident strings.Builder
+	)
+	quoted := false
+	for i := 0; i < len(typ); i++ {
+		c := typ[i]
+		switch {
+		case c == '"' && quoted && i+1 < len(typ) && typ[i+1] == '"':
+			ident.WriteByte('"')
+			i++
+		case c == '"':
+			quoted = !quoted
+		case quoted || c != '<' && c != '>' && c != ',' && c != ' ':
+			ident.WriteByte(c)
+		default:
+			if ident.Len() > 0 {
+				names = append(names, ident.String())
+				ident.Reset()
+			}
+		}
+	}
+	if ident.Len() > 0 {
+		names = append(names, ident.String())
+	}
+	return names
+}
+
+// ToCQL returns the CQL statement creating the table with its options, not
+// including its indexes.
+func (t *TableMetadata) ToCQL() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE TABLE %s (\n", qualifiedName(t.Keyspace, t.Name))
+	for _, column := range t.orderedColumns() {
+		fmt.Fprintf(&buf, "    %s %s", quoteIdentifier(column.Name), column.cqlType())
+		if column.Kind == ColumnStatic {
+			buf.WriteString(" static")
+		}
+		buf.WriteString(",\n")
+	}
+	fmt.Fprintf(&buf, "    PRIMARY KEY (%s)\n)", t.primaryKeyCQL())
+
+	options := t.optionsCQL()
+	if len(options) > 0 {
+		buf.WriteString(" WITH ")
+		buf.WriteString(strings.Join(options, "\n    AND "))
+	}
+	buf.WriteString(";")
+	return buf.String()
+}
+
+// orderedColumns returns the columns of t, the partition key and clustering
+// columns first, and then the other columns ordered by name.
+func (t *TableMetadata) orderedColumns() []*ColumnMetadata {
+	columns := make([]*ColumnMetadata, 0, len(t.Columns))
+	columns = append(columns, t.PartitionKey...)
+	columns = append(columns, t.ClusteringColumns...)
+	for _, name := range sortedKeys(t.Columns) {
+		column := t.Columns[name]
+		if column.Kind != ColumnPartitionKey && column.Kind != ColumnClusteringKey {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+func (t *TableMetadata) primaryKeyCQL() string {
+	partitionKey := make([]string, len(t.PartitionKey))
+	for i, column := range t.PartitionKey {
+		partitionKey[i] = quoteIdentifier(column.Name)
+	}
+	key := []string{strings.Join(partitionKey, ", ")}
+	if len(partitionKey) > 1 {
+		key[0] = "(" + key[0] + ")"
+	}
+	for _, column := range t.ClusteringColumns {
+		key = append(key, quoteIdentifier(column.Name))
+	}
+	return strings.Join(key, ", ")
+}
+
+// clusteringOrderCQL returns the CLUSTERING ORDER BY option of the table, or
+// an empty string if it has no clustering columns.
+func (t *TableMetadata) clusteringOrderCQL() string {
+	if len(t.ClusteringColumns) == 0 {
+		return ""
+	}
+	order := make([]string, len(t.ClusteringColumns))
+	for i, column := range t.ClusteringColumns {
+		order[i] = quoteIdentifier(column.Name) + " ASC"
+		if column.Order == DESC {
+			order[i] = quoteIdentifier(column.Name) + " DESC"
+		}
+	}
+	return "CLUSTERING ORDER BY (" + strings.Join(order, ", ") + ")"
+}
+
+// optionsCQL returns the options of the WITH clause of the table.
+func (t *TableMetadata) optionsCQL() []string {
+	var options []string
+	if flags, ok := t.Options["flags"].([]string); ok && !containsString(flags, "compound") {
+		options = append(options, "COMPACT STORAGE")
+	}
+	if order := t.clusteringOrderCQL(); order != "" {
+		options = append(options, order)
+	}
+	for _, name := range sortedKeys(t.Options) {
+		value := t.Options[name]
+		switch name {
+		case "id", "flags":
+			continue
+		case "extensions":
+			if extensions, ok := value.(map[string][]byte); ok && len(extensions) == 0 {
+				continue
+			}
+		}
+		if value == nil {
+			continue
+		}
+		options = append(options, name+" = "+cqlLiteral(value))
+	}
+	return options
+}
+
+// ToCQL returns the CQL statement creating the index.
+func (i *IndexMetadata) ToCQL() string {
+	target := i.Options["target"]
+	if i.Kind != "CUSTOM" {
+		return fmt.Sprintf("CREATE INDEX %s ON %s (%s);", quoteIdentifier(i.Name), qualifiedName(i.Keyspace, i.Table), target)
+	}
+
+	stmt := fmt.Sprintf("CREATE CUSTOM INDEX %s ON %s (%s) USING %s", quoteIdentifier(i.Name),
+		qualifiedName(i.Keyspace, i.Table), target, quoteString(i.Options["class_name"]))
+	options := make(map[string]string, len(i.Options))
+	for name, value := range i.Options {
+		if name != "target" && name != "class_name" {
+			options[name] = value
+		}
+	}
+	if len(options) > 0 {
+		stmt += " WITH OPTIONS = " + cqlLiteral(options)
+	}
+	return stmt + ";"
+}
+
+// ToCQL returns the CQL statement creating the user type.
+func (u *UserTypeMetadata) ToCQL() string {
+	types := cqlTypeNames(u.fieldTypeNames, u.FieldTypes)
+	fields := make([]string, len(u.FieldNames))
+	for i, name := range u.FieldNames {
+		fields[i] = "    " + quoteIdentifier(name) + " " + types[i]
+	}
+	return fmt.Sprintf("CREATE TYPE %s (\n%s\n);", qualifiedName(u.Keyspace, u.Name), strings.Join(fields, ",\n"))
+}
+
+// ToCQL returns the CQL statement creating the function.
+func (f *FunctionMetadata) ToCQL() string {
+	types := cqlTypeNames(f.argumentTypeNames, f.ArgumentTypes)
+	args := make([]string, len(f.ArgumentNames))
+	for i, name := range f.ArgumentNames {
+		args[i] = quoteIdentifier(name) + " " + types[i]
+	}
+	onNull := "RETURNS NULL ON NULL INPUT"
+	if f.CalledOnNullInput {
+		onNull = "CALLED ON NULL INPUT"
+	}
+	returnType := f.returnTypeName
+	if returnType == "" {
+		returnType = cqlTypeOf(f.ReturnType)
+	}
+	return fmt.Sprintf("CREATE FUNCTION %s(%s)\n    %s\n    RETURNS %s\n    LANGUAGE %s\n    AS $$%s$$;",
+		qualifiedName(f.Keyspace, f.Name), strings.Join(args, ", "), onNull, returnType, f.Language, f.Body)
+}
+
+// ToCQL returns the CQL statement creating the aggregate.
+func (a *AggregateMetadata) ToCQL() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE AGGREGATE %s(%s)\n", qualifiedName(a.Keyspace, a.Name),
+		strings.Join(cqlTypeNames(a.argumentTypeNames, a.ArgumentTypes), ", "))
+
+	stateType := a.stateTypeName
+	if stateType == "" {
+		stateType = cqlTypeOf(a.StateType)
+	}
+	fmt.Fprintf(&buf, "    SFUNC %s\n    STYPE %s", quoteIdentifier(a.StateFunc.Name), stateType)
+	if a.FinalFunc.Name != "" {
+		fmt.Fprintf(&buf, "\n    FINALFUNC %s", quoteIdentifier(a.FinalFunc.Name))
+	}
+	if a.InitCond != "" {
+		fmt.Fprintf(&buf, "\n    INITCOND %s", a.InitCond)
+	}
+	buf.WriteString(";")
+	return buf.String()
+}
+
+// ToCQL returns the CQL statement creating the materialized view. The columns
+// and the primary key of the view are only known from the metadata of its
+// keyspace.
+func (m *MaterializedViewMetadata) ToCQL() string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "CREATE MATERIALIZED VIEW %s AS\n", qualifiedName(m.Keyspace, m.Name))
+
+	columns := "*"
+	if !m.IncludeAllColumns && m.columns != nil {
+		ordered := m.columns.orderedColumns()
+		names := make([]string, len(ordered))
+		for i, column := range ordered {
+			names[i] = quoteIdentifier(column.Name)
+		}
+		columns = strings.Join(names, ", ")
+	}
+	fmt.Fprintf(&buf, "    SELECT %s\n    FROM %s\n", columns, qualifiedName(m.Keyspace, m.baseTableName))
+	if m.WhereClause != "" {
+		fmt.Fprintf(&buf, "    WHERE %s\n", m.WhereClause)
+	}
+
+	var options []string
+	if m.columns != nil {
+		fmt.Fprintf(&buf, "    PRIMARY KEY (%s)\n", m.columns.primaryKeyCQL())
+		if order := m.columns.clusteringOrderCQL(); order != "" {
+			options = append(options, order)
+		}
+	}
+	options = append(options,
+		"bloom_filter_fp_chance = "+cqlLiteral(m.BloomFilterFpChance),
+		"caching = "+cqlLiteral(m.Caching),
+		"comment = "+cqlLiteral(m.Comment),
+		"compaction = "+cqlLiteral(m.Compaction),
+		"compression = "+cqlLiteral(m.Compression),
+		"crc_check_chance = "+cqlLiteral(m.CrcCheckChance),
+		"dclocal_read_repair_chance = "+cqlLiteral(m.DcLocalReadRepairChance),
+		"default_time_to_live = "+cqlLiteral(m.DefaultTimeToLive),
+	)
+	if len(m.Extensions) > 0 {
+		options = append(options, "extensions = "+cqlLiteral(m.Extensions))
+	}
+	options = append(options,
+		"gc_grace_seconds = "+cqlLiteral(m.GcGraceSeconds),
+		"max_index_interval = "+cqlLiteral(m.MaxIndexInterval),
+		"memtable_flush_period_in_ms = "+cqlLiteral(m.MemtableFlushPeriodInMs),
+		"min_index_interval = "+cqlLiteral(m.MinIndexInterval),
+		"read_repair_chance = "+cqlLiteral(m.ReadRepairChance),
+		"speculative_retry = "+cqlLiteral(m.SpeculativeRetry),
+	)
+	fmt.Fprintf(&buf, "    WITH %s;", strings.Join(options, "\n    AND "))
+	return buf.String()
+}
+
+// sortedKeys returns the keys of the map m, which has string keys, in order.
+func sortedKeys(m interface{}) []string {
+	v := reflect.ValueOf(m)
+	keys := make([]string, 0, v.Len())
+	for _, key := range v.MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(s []string, v string) bool {
+	for _, e := range s {
+		if e == v {
+			return true
+		}
+	}
+	return false
+}
@@ -816,3 +816,249 @@ func assertParseNonCompositeTypes(
 		}
 	}
 }
+
+func TestKeyspaceMetadataIncrementalUpdate(t *testing.T) {
+	users := &TableMetadata{Keyspace: "ks", Name: "users"}
+	events := &TableMetadata{Keyspace: "ks", Name: "events"}
+	cached := &KeyspaceMetadata{
+		Name:          "ks",
+		StrategyClass: "SimpleStrategy",
+		Tables:        map[string]*TableMetadata{"users": users, "events": events},
+		MaterializedViews: map[string]*MaterializedViewMetadata{
+			"users_by_name": {Keyspace: "ks", Name: "users_by_name", BaseTable: users, baseTableName: "users"},
+		},
+		Views:     map[string]*ViewMetadata{},
+		UserTypes: map[string]*UserTypeMetadata{},
+	}
+
+	newUsers := &TableMetadata{Keyspace: "ks", Name: "users", OrderedColumns: []string{"id"}}
+	updated := cached.withTable(newUsers)
+	if updated.Tables["users"] != newUsers || updated.Tables["events"] != events {
+		t.Errorf("expected the users table to be replaced, got %v", updated.Tables)
+	}
+	if updated.MaterializedViews["users_by_name"].BaseTable != newUsers {
+		t.Error("expected the view to reference the new users table")
+	}
+	// the cached metadata is not modified, it may be in use
+	if cached.Tables["users"] != users || cached.MaterializedViews["users_by_name"].BaseTable != users {
+		t.Error("expected the cached metadata to be unchanged")
+	}
+
+	updated = updated.withoutTable("events")
+	if _, ok := updated.Tables["events"]; ok || len(cached.Tables) != 2 {
+		t.Errorf("expected the events table to be removed from a copy, got %v", updated.Tables)
+	}
+
+	address := &ViewMetadata{Keyspace: "ks", Name: "address", FieldNames: []string{"street"}}
+	updated = updated.withUserType(address)
+	if updated.Views["address"] != address || updated.UserTypes["address"].FieldNames[0] != "street" {
+		t.Errorf("expected the address type to be added, got %v", updated.UserTypes)
+	}
+	if len(cached.UserTypes) != 0 {
+		t.Error("expected the cached user types to be unchanged")
+	}
+	if updated = updated.withoutUserType("address"); len(updated.UserTypes) != 0 || len(updated.Views) != 0 {
+		t.Errorf("expected the address type to be removed, got %v", updated.UserTypes)
+	}
+
+	updated = cached.withOptions(&KeyspaceMetadata{
+		StrategyClass:   "NetworkTopologyStrategy",
+		StrategyOptions: map[string]interface{}{"dc1": "3"},
+	})
+	if updated.StrategyClass != "NetworkTopologyStrategy" || updated.Tables["users"] != users {
+		t.Errorf("expected the options to change and the tables to be kept, got %+v", updated)
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"users":      "users",
+		"user_id2":   "user_id2",
+		"Users":      `"Users"`,
+		"2fa":        `"2fa"`,
+		"first name": `"first name"`,
+		"select":     `"select"`,
+		"say\"hi":    `"say""hi"`,
+		"ttl":        "ttl",
+	}
+	for name, expected := range tests {
+		if ident := quoteIdentifier(name); ident != expected {
+			t.Errorf("quoteIdentifier(%q) = %s, expected %s", name, ident, expected)
+		}
+		if unquoted := unquoteIdentifier(expected); unquoted != name {
+			t.Errorf("unquoteIdentifier(%s) = %q, expected %q", expected, unquoted, name)
+		}
+	}
+}
+
+func TestKeyspaceMetadataToCQL(t *testing.T) {
+	keyspace := &KeyspaceMetadata{
+		Name:            "Shop",
+		DurableWrites:   true,
+		StrategyClass:   "org.apache.cassandra.locator.NetworkTopologyStrategy",
+		StrategyOptions: map[string]interface{}{"dc2": "1", "dc1": "3"},
+	}
+	tables := []TableMetadata{
+		{
+			Keyspace: "Shop",
+			Name:     "orders",
+			Options: map[string]interface{}{
+				"bloom_filter_fp_chance": 0.01,
+				"caching":                map[string]string{"keys": "ALL", "rows_per_partition": "NONE"},
+				"comment":                "customer's orders",
+				"crc_check_chance":       1.0,
+				"extensions":             map[string][]byte{},
+				"flags":                  []string{"compound"},
+				"gc_grace_seconds":       864000,
+				"id":                     UUID{},
+			},
+		},
+		{Keyspace: "Shop", Name: "orders_by_status"},
+	}
+	columns := []ColumnMetadata{
+		{Keyspace: "Shop", Table: "orders", Name: "customer", Kind: ColumnPartitionKey, Validator: "uuid", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders", Name: "Placed", Kind: ColumnClusteringKey, Validator: "timestamp", ClusteringOrder: "desc"},
+		{Keyspace: "Shop", Table: "orders", Name: "status", Kind: ColumnRegular, Validator: "text", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders", Name: "select", Kind: ColumnRegular, Validator: "set<text>", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders", Name: "shipping", Kind: ColumnRegular, Validator: "frozen<address>", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders", Name: "region", Kind: ColumnStatic, Validator: "text", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders_by_status", Name: "status", Kind: ColumnPartitionKey, Validator: "text", ClusteringOrder: "none"},
+		{Keyspace: "Shop", Table: "orders_by_status", Name: "customer", Kind: ColumnClusteringKey, Validator: "uuid", ClusteringOrder: "asc"},
+		{Keyspace: "Shop", Table: "orders_by_status", Name: "Placed", Kind: ColumnClusteringKey, ComponentIndex: 1, Validator: "timestamp", ClusteringOrder: "desc"},
+	}
+	functions := []FunctionMetadata{
+		{
+			Keyspace:          "Shop",
+			Name:              "total",
+			ArgumentNames:     []string{"state", "value"},
+			ArgumentTypes:     []TypeInfo{NativeType{typ: TypeBigInt}, NativeType{typ: TypeInt}},
+			Body:              "return state + value;",
+			CalledOnNullInput: true,
+			Language:          "java",
+			ReturnType:        NativeType{typ: TypeBigInt},
+		},
+	}
+	aggregates := []AggregateMetadata{
+		{
+			Keyspace:      "Shop",
+			Name:          "sum_all",
+			ArgumentTypes: []TypeInfo{NativeType{typ: TypeInt}},
+			InitCond:      "0",
+			StateType:     NativeType{typ: TypeBigInt},
+			stateFunc:     "total",
+		},
+	}
+	views := []ViewMetadata{
+		{
+			Keyspace:       "Shop",
+			Name:           "address",
+			FieldNames:     []string{"street", "location"},
+			FieldTypes:     []TypeInfo{NativeType{typ: TypeText}, NativeType{typ: TypeCustom}},
+			fieldTypeNames: []string{"text", "frozen<point>"},
+		},
+		{
+			Keyspace:       "Shop",
+			Name:           "point",
+			FieldNames:     []string{"x", "y"},
+			FieldTypes:     []TypeInfo{NativeType{typ: TypeDouble}, NativeType{typ: TypeDouble}},
+			fieldTypeNames: []string{"double", "double"},
+		},
+	}
+	materializedViews := []MaterializedViewMetadata{
+		{
+			Keyspace:            "Shop",
+			Name:                "orders_by_status",
+			BloomFilterFpChance: 0.01,
+			Caching:             map[string]string{"keys": "ALL"},
+			Compaction:          map[string]string{"class": "SizeTieredCompactionStrategy"},
+			Compression:         map[string]string{"chunk_length_in_kb": "64"},
+			CrcCheckChance:      1,
+			GcGraceSeconds:      864000,
+			MaxIndexInterval:    2048,
+			MinIndexInterval:    128,
+			SpeculativeRetry:    "99PERCENTILE",
+			WhereClause:         `status IS NOT NULL AND customer IS NOT NULL AND "Placed" IS NOT NULL`,
+			baseTableName:       "orders",
+		},
+	}
+	compileMetadata(protoVersion4, keyspace, tables, columns, functions, aggregates, views, materializedViews, &defaultLogger{})
+	addIndexes(keyspace.Tables, []IndexMetadata{
+		{Keyspace: "Shop", Table: "orders", Name: "orders_status", Kind: "COMPOSITES", Options: map[string]string{"target": "status"}},
+		{Keyspace: "Shop", Table: "orders", Name: "orders_select", Kind: "CUSTOM", Options: map[string]string{
+			"target":     `"select"`,
+			"class_name": "org.apache.cassandra.index.sasi.SASIIndex",
+			"mode":       "CONTAINS",
+		}},
+	})
+
+	if index := keyspace.Tables["orders"].Columns["select"].Index; index.Name != "orders_select" || index.Type != "CUSTOM" {
+		t.Errorf("expected the index of column select to be orders_select, got %+v", index)
+	}
+
+	expected := `CREATE KEYSPACE "Shop" WITH replication = {'class': 'org.apache.cassandra.locator.NetworkTopologyStrategy', 'dc1': '3', 'dc2': '1'} AND durable_writes = true;
+
+CREATE TYPE "Shop".point (
+    x double,
+    y double
+);
+
+CREATE TYPE "Shop".address (
+    street text,
+    location frozen<point>
+);
+
+CREATE TABLE "Shop".orders (
+    customer uuid,
+    "Placed" timestamp,
+    region text static,
+    "select" set<text>,
+    shipping frozen<address>,
+    status text,
+    PRIMARY KEY (customer, "Placed")
+) WITH CLUSTERING ORDER BY ("Placed" DESC)
+    AND bloom_filter_fp_chance = 0.01
+    AND caching = {'keys': 'ALL', 'rows_per_partition': 'NONE'}
+    AND comment = 'customer''s orders'
+    AND crc_check_chance = 1.0
+    AND gc_grace_seconds = 864000;
+
+CREATE CUSTOM INDEX orders_select ON "Shop".orders ("select") USING 'org.apache.cassandra.index.sasi.SASIIndex' WITH OPTIONS = {'mode': 'CONTAINS'};
+
+CREATE INDEX orders_status ON "Shop".orders (status);
+
+CREATE FUNCTION "Shop".total(state bigint, value int)
+    CALLED ON NULL INPUT
+    RETURNS bigint
+    LANGUAGE java
+    AS $$return state + value;$$;
+
+CREATE AGGREGATE "Shop".sum_all(int)
+    SFUNC total
+    STYPE bigint
+    INITCOND 0;
+
+CREATE MATERIALIZED VIEW "Shop".orders_by_status AS
+    SELECT status, customer, "Placed"
+    FROM "Shop".orders
+    WHERE status IS NOT NULL AND customer IS NOT NULL AND "Placed" IS NOT NULL
+    PRIMARY KEY (status, customer, "Placed")
+    WITH CLUSTERING ORDER BY (customer ASC, "Placed" DESC)
+    AND bloom_filter_fp_chance = 0.01
+    AND caching = {'keys': 'ALL'}
+    AND comment = ''
+    AND compaction = {'class': 'SizeTieredCompactionStrategy'}
+    AND compression = {'chunk_length_in_kb': '64'}
+    AND crc_check_chance = 1.0
+    AND dclocal_read_repair_chance = 0.0
+    AND default_time_to_live = 0
+    AND gc_grace_seconds = 864000
+    AND max_index_interval = 2048
+    AND memtable_flush_period_in_ms = 0
+    AND min_index_interval = 128
+    AND read_repair_chance = 0.0
+    AND speculative_retry = '99PERCENTILE';
+`
+	if cql := keyspace.ToCQL(); cql != expected {
+		t.Errorf("expected the CQL of the keyspace to be:\n%s\ngot:\n%s", expected, cql)
+	}
+}
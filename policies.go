@@ -13,6 +13,7 @@ import (
 	"math"
 	"math/rand"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -122,6 +123,10 @@ var ErrUnknownRetryType = errors.New("unknown retry type returned by retry polic
 // users to implement their own logic to determine if a query can be attempted
 // again.
 //
+// The RetryableQuery passed to Attempt gives the number of attempts made so
+// far and the consistency level of the query, so that policies such as
+// ConsistencyAwareRetryPolicy can budget retries per consistency level.
+//
 // See SimpleRetryPolicy as an example of implementing and using a RetryPolicy
 // interface.
 type RetryPolicy interface {
@@ -152,6 +157,44 @@ func (s *SimpleRetryPolicy) GetRetryType(err error) RetryType {
 	return RetryNextHost
 }
 
+// ConsistencyAwareRetryPolicy attempts a query a number of times depending on
+// its consistency level, for example to give up sooner on QUORUM queries, whose
+// failure is more likely to denote a real problem, than on ONE queries.
+//
+//	cluster.RetryPolicy = &gocql.ConsistencyAwareRetryPolicy{
+//		NumRetries: map[gocql.Consistency]int{
+//			gocql.One:         3,
+//			gocql.LocalQuorum: 1,
+//			gocql.Quorum:      1,
+//		},
+//	}
+//
+// The consistency level is the one of the attempt which failed, which differs
+// from the level the query was created with if it was changed by the retries.
+type ConsistencyAwareRetryPolicy struct {
+	// NumRetries is the number of times to retry a query for each consistency
+	// level.
+	NumRetries map[Consistency]int
+
+	// DefaultNumRetries is the number of times to retry a query whose
+	// consistency level is not in NumRetries.
+	DefaultNumRetries int
+}
+
+// Attempt tells gocql to attempt the query again based on query.Attempts being
+// less than the number of retries of its consistency level.
+func (c *ConsistencyAwareRetryPolicy) Attempt(q RetryableQuery) bool {
+	numRetries, ok := c.NumRetries[q.GetConsistency()]
+	if !ok {
+		numRetries = c.DefaultNumRetries
+	}
+	return q.Attempts() <= numRetries
+}
+
+func (c *ConsistencyAwareRetryPolicy) GetRetryType(err error) RetryType {
+	return RetryNextHost
+}
+
 // ExponentialBackoffRetryPolicy sleeps between attempts
 type ExponentialBackoffRetryPolicy struct {
 	NumRetries int
@@ -243,6 +286,222 @@ func (d *DowngradingConsistencyRetryPolicy) GetRetryType(err error) RetryType {
 	}
 }
 
+// consistencyChainRetryPolicy attempts a query at the next of levels when it
+// failed because not enough replicas were available or responded in time, see
+// Query.ConsistencyChain. Other errors are handled by rt.
+type consistencyChainRetryPolicy struct {
+	levels []Consistency
+	rt     RetryPolicy
+}
+
+func (c *consistencyChainRetryPolicy) Attempt(q RetryableQuery) bool {
+	return c.rt != nil && c.rt.Attempt(q)
+}
+
+func (c *consistencyChainRetryPolicy) AttemptWithError(q RetryableQuery, err error) bool {
+	if !c.chained(q, err) {
+		if rtErr, ok := c.rt.(RetryPolicyWithError); ok {
+			return rtErr.AttemptWithError(q, err)
+		}
+		return c.Attempt(q)
+	}
+	for i, level := range c.levels[:len(c.levels)-1] {
+		if level == q.GetConsistency() {
+			q.SetConsistency(c.levels[i+1])
+			return true
+		}
+	}
+	return false
+}
+
+// chained reports whether err moves the query to the next level.
+func (c *consistencyChainRetryPolicy) chained(q RetryableQuery, err error) bool {
+	switch t := err.(type) {
+	case *RequestErrUnavailable, *RequestErrReadTimeout:
+		return true
+	case *RequestErrWriteTimeout:
+		idem, ok := q.(interface{ IsIdempotent() bool })
+		return ok && idem.IsIdempotent() && t.WriteType != "CAS"
+	}
+	return false
+}
+
+func (c *consistencyChainRetryPolicy) GetRetryType(err error) RetryType {
+	switch err.(type) {
+	case *RequestErrUnavailable, *RequestErrReadTimeout:
+		return Retry
+	}
+	if c.rt == nil {
+		// only write timeouts moving the query to the next level are retried
+		return Retry
+	}
+	return c.rt.GetRetryType(err)
+}
+
+// RetryPolicyWithError is an optional interface for retry policies which need
+// the error of the failed attempt to decide whether to retry. If a RetryPolicy
+// implements it, AttemptWithError is called instead of Attempt.
+type RetryPolicyWithError interface {
+	RetryPolicy
+	AttemptWithError(q RetryableQuery, err error) bool
+}
+
+// AdaptiveConsistencyRetryPolicy retries a query once at the highest
+// consistency level the cluster could satisfy when it failed because not
+// enough replicas were available or responded in time, for example a QUORUM
+// read is retried at ONE if only one replica is alive.
+//
+// The downgrade is based on the error returned by the coordinator:
+//
+// On an unavailable exception: the query is retried at the level matching the
+// number of alive replicas.
+//
+// On a read timeout: if fewer replicas responded than required, the query is
+// retried at the level matching the number of replicas that responded.
+//
+// On a write timeout: if fewer replicas acknowledged the write than required,
+// an idempotent SIMPLE, BATCH or UNLOGGED_BATCH write is retried at the level
+// matching the number of replicas that acknowledged it.
+//
+// Serial reads, lightweight transactions and counter writes are never
+// downgraded, nor is any other error retried. A query is treated as a
+// lightweight transaction if it has a serial consistency set or a statement
+// with an IF condition, whatever consistency the error reports. Since
+// lowering the consistency level weakens the guarantees of the query, the
+// policy is only used when set explicitly, Downgrades and OnDowngrade allow to
+// monitor how often it happens.
+//
+//	cluster.RetryPolicy = &gocql.AdaptiveConsistencyRetryPolicy{}
+type AdaptiveConsistencyRetryPolicy struct {
+	downgrades int64 // atomic, first for alignment
+
+	// OnDowngrade, if set, is called every time a query is retried at a lower
+	// consistency level, err is the error of the failed attempt.
+	OnDowngrade func(from, to Consistency, err error)
+}
+
+// Downgrades returns the number of queries retried at a lower consistency level.
+func (a *AdaptiveConsistencyRetryPolicy) Downgrades() int64 {
+	return atomic.LoadInt64(&a.downgrades)
+}
+
+// Attempt never retries, the policy needs the error of the failed attempt.
+func (a *AdaptiveConsistencyRetryPolicy) Attempt(q RetryableQuery) bool {
+	return false
+}
+
+func (a *AdaptiveConsistencyRetryPolicy) AttemptWithError(q RetryableQuery, err error) bool {
+	if q.Attempts() > 1 {
+		return false
+	}
+	from := q.GetConsistency()
+	to, ok := downgradedConsistency(q, from, err)
+	if !ok {
+		return false
+	}
+	q.SetConsistency(to)
+	atomic.AddInt64(&a.downgrades, 1)
+	if a.OnDowngrade != nil {
+		a.OnDowngrade(from, to, err)
+	}
+	return true
+}
+
+func (a *AdaptiveConsistencyRetryPolicy) GetRetryType(err error) RetryType {
+	return Retry
+}
+
+// isLightweightTransaction reports whether q has a serial consistency set or
+// a statement with an IF condition. The coordinator of a lightweight
+// transaction may report the consistency of its commit phase rather than the
+// serial one, so the error alone does not tell them apart.
+func isLightweightTransaction(q RetryableQuery) bool {
+	switch q := q.(type) {
+	case *Query:
+		if q.serialCons > 0 {
+			return true
+		}
+		if q.session != nil {
+			return q.session.conditionalStmts.isConditional(q.stmt)
+		}
+		return hasCondition(q.stmt)
+	case *Batch:
+		if q.serialCons > 0 {
+			return true
+		}
+		if q.session != nil {
+			return q.session.conditionalStmts.anyConditional(q.Entries)
+		}
+		for _, entry := range q.Entries {
+			if hasCondition(entry.Stmt) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// downgradedConsistency returns the highest consistency level lower than cons
+// that the replicas reported by err could satisfy.
+func downgradedConsistency(q RetryableQuery, cons Consistency, err error) (Consistency, bool) {
+	if isSerialConsistency(cons) || isLightweightTransaction(q) {
+		return 0, false
+	}
+	var replicas int
+	switch t := err.(type) {
+	case *RequestErrUnavailable:
+		if isSerialConsistency(t.Consistency) || t.Alive >= t.Required {
+			return 0, false
+		}
+		replicas = t.Alive
+	case *RequestErrReadTimeout:
+		if isSerialConsistency(t.Consistency) || t.Received >= t.BlockFor {
+			return 0, false
+		}
+		replicas = t.Received
+	case *RequestErrWriteTimeout:
+		if isSerialConsistency(t.Consistency) || t.Received >= t.BlockFor {
+			return 0, false
+		}
+		switch t.WriteType {
+		case "SIMPLE", "BATCH", "UNLOGGED_BATCH":
+		default:
+			// CAS, COUNTER, BATCH_LOG, VIEW and CDC writes are never downgraded
+			return 0, false
+		}
+		if idem, ok := q.(interface{ IsIdempotent() bool }); !ok || !idem.IsIdempotent() {
+			return 0, false
+		}
+		replicas = t.Received
+	default:
+		return 0, false
+	}
+
+	var to Consistency
+	switch {
+	case replicas >= 3:
+		to = Three
+	case replicas == 2:
+		to = Two
+	case replicas == 1 && (cons == LocalQuorum || cons == LocalOne):
+		to = LocalOne
+	case replicas == 1:
+		to = One
+	default:
+		return 0, false
+	}
+	if to == cons {
+		return 0, false
+	}
+	return to, true
+}
+
+// isSerialConsistency reports whether c is one of the serial levels used by
+// lightweight transactions.
+func isSerialConsistency(c Consistency) bool {
+	return c == Consistency(Serial) || c == Consistency(LocalSerial)
+}
+
 func (e *ExponentialBackoffRetryPolicy) napTime(attempts int) time.Duration {
 	return getExponentialTime(e.Min, e.Max, attempts)
 }
@@ -273,6 +532,20 @@ type HostTierer interface {
 	MaxHostTier() uint
 }
 
+// controlHostObserver is implemented by host selection policies which need to
+// know the host of the control connection.
+type controlHostObserver interface {
+	// controlHostChanged is called every time the control connection connects
+	// to host.
+	controlHostChanged(host *HostInfo)
+}
+
+// crossDCFallbackCounter is implemented by host selection policies which count
+// the queries falling back to remote datacenters, see Session.CrossDCFallbacks.
+type crossDCFallbackCounter interface {
+	crossDCFallbackCount() uint64
+}
+
 // HostSelectionPolicy is an interface for selecting
 // the most appropriate host to execute a given query.
 // HostSelectionPolicy instances cannot be shared between sessions.
@@ -376,6 +649,7 @@ func TokenAwareHostPolicy(fallback HostSelectionPolicy, opts ...func(*tokenAware
 type tokenAwareHostPolicy struct {
 	fallback                 HostSelectionPolicy
 	getMetadataReadOnly      func() *ClusterMetadata
+	addRoutingKeyspace       func(keyspace string)
 	shuffleReplicas          bool
 	nonLocalReplicasFallback bool
 }
@@ -387,6 +661,15 @@ func (t *tokenAwareHostPolicy) Init(s *Session) {
 		panic("sharing token aware host selection policy between sessions is not supported")
 	}
 	t.getMetadataReadOnly = s.metaMngr.getMetadataReadOnly
+	t.addRoutingKeyspace = s.metaMngr.addRoutingKeyspace
+}
+
+// crossDCFallbackCount implements crossDCFallbackCounter.
+func (t *tokenAwareHostPolicy) crossDCFallbackCount() uint64 {
+	if c, ok := t.fallback.(crossDCFallbackCounter); ok {
+		return c.crossDCFallbackCount()
+	}
+	return 0
 }
 
 func (t *tokenAwareHostPolicy) IsLocal(host *HostInfo) bool {
@@ -423,6 +706,13 @@ func (t *tokenAwareHostPolicy) HostDown(host *HostInfo) {
 	t.fallback.HostDown(host)
 }
 
+// controlHostChanged implements controlHostObserver.
+func (t *tokenAwareHostPolicy) controlHostChanged(host *HostInfo) {
+	if o, ok := t.fallback.(controlHostObserver); ok {
+		o.controlHostChanged(host)
+	}
+}
+
 func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 	if qry == nil {
 		return t.fallback.Pick(qry)
@@ -441,7 +731,15 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 	}
 
 	token := meta.tokenRing.partitioner.Hash(routingKey)
-	ht := meta.replicas[qry.Keyspace()].replicasFor(token)
+	keyspace := routingKeyspaceOf(qry)
+	ksReplicas, ok := meta.replicas[keyspace]
+	if !ok && t.addRoutingKeyspace != nil {
+		// the replicas of keyspaces other than the session keyspace are only
+		// known once a query was routed to them, pick the primary replica until
+		// they are computed
+		t.addRoutingKeyspace(keyspace)
+	}
+	ht := ksReplicas.replicasFor(token)
 
 	var replicas []*HostInfo
 	if ht == nil {
@@ -469,11 +767,17 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 		maxTier = 1
 	}
 
-	if t.nonLocalReplicasFallback {
+	// with CrossDCFallback the fallback policy tries the remote replicas
+	dcAware, _ := t.fallback.(*dcAwareRR)
+	crossDC := dcAware != nil && dcAware.limitCrossDC
+	var remoteReplicas []*HostInfo
+
+	if t.nonLocalReplicasFallback && !crossDC {
 		remote = make([][]*HostInfo, maxTier)
 	}
 
 	used := make(map[*HostInfo]bool, len(replicas))
+	fellBack := false
 	return func() SelectedHost {
 		for i < len(replicas) {
 			h := replicas[i]
@@ -489,7 +793,9 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 			}
 
 			if tier != 0 {
-				if t.nonLocalReplicasFallback {
+				if crossDC {
+					remoteReplicas = append(remoteReplicas, h)
+				} else if t.nonLocalReplicasFallback {
 					remote[tier-1] = append(remote[tier-1], h)
 				}
 				continue
@@ -501,7 +807,7 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 			}
 		}
 
-		if t.nonLocalReplicasFallback {
+		if remote != nil {
 			for j < len(remote) && k < len(remote[j]) {
 				h := remote[j][k]
 				k++
@@ -513,6 +819,9 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 
 				if h.IsUp() {
 					used[h] = true
+					if dcAware != nil {
+						dcAware.countCrossDCFallback(&fellBack)
+					}
 					return (*selectedHost)(h)
 				}
 			}
@@ -520,7 +829,11 @@ func (t *tokenAwareHostPolicy) Pick(qry ExecutableQuery) NextHost {
 
 		if fallbackIter == nil {
 			// fallback
-			fallbackIter = t.fallback.Pick(qry)
+			if dcAware != nil {
+				fallbackIter = dcAware.pick(qry, remoteReplicas, &fellBack)
+			} else {
+				fallbackIter = t.fallback.Pick(qry)
+			}
 		}
 
 		// filter the token aware selected hosts from the fallback hosts
@@ -681,24 +994,95 @@ type dcAwareRR struct {
 	localHosts      cowHostList
 	remoteHosts     cowHostList
 	lastUsedHostIdx uint64
+
+	// autoDetectLocalDC is set by AutoDetectLocalDC, detectedDC then holds the
+	// datacenter of the control connection host once it is known.
+	autoDetectLocalDC bool
+	detectedDC        atomic.Value
+	// mu serializes moving hosts between localHosts and remoteHosts.
+	mu     sync.Mutex
+	logger StdLogger
+
+	// limitCrossDC is set by CrossDCFallback, maxRemoteHosts is then the
+	// number of hosts of remote datacenters a query is sent to.
+	limitCrossDC          bool
+	maxRemoteHosts        int
+	allowRemoteForLocalCL bool
+	// crossDCFallbacks is the number of queries sent to remote datacenters,
+	// it is accessed atomically.
+	crossDCFallbacks uint64
 }
 
 // DCAwareRoundRobinPolicy is a host selection policies which will prioritize and
 // return hosts which are in the local datacentre before returning hosts in all
 // other datercentres
-func DCAwareRoundRobinPolicy(localDC string) HostSelectionPolicy {
-	return &dcAwareRR{local: localDC}
+func DCAwareRoundRobinPolicy(localDC string, opts ...func(*dcAwareRR)) HostSelectionPolicy {
+	d := &dcAwareRR{local: localDC}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// AutoDetectLocalDC makes DCAwareRoundRobinPolicy use the datacenter of the
+// control connection host as the local datacenter, instead of the one passed
+// to DCAwareRoundRobinPolicy which is only used until the control connection
+// is established. The local datacenter changes when the control connection
+// reconnects to a host in another datacenter.
+func AutoDetectLocalDC() func(*dcAwareRR) {
+	return func(d *dcAwareRR) {
+		d.autoDetectLocalDC = true
+	}
+}
+
+// CrossDCFallback makes DCAwareRoundRobinPolicy send a query to at most n hosts
+// of remote datacenters once no host of the local datacenter is up. Used as the
+// fallback of TokenAwareHostPolicy, replicas of remote datacenters are tried
+// before other remote hosts. Queries with LOCAL_ONE or LOCAL_QUORUM consistency
+// are not sent to remote datacenters unless
+// AllowRemoteDCsForLocalConsistencyLevel is given as well.
+//
+// Without CrossDCFallback all the hosts of remote datacenters are returned
+// after the local ones, whatever the consistency of the query.
+func CrossDCFallback(n int) func(*dcAwareRR) {
+	return func(d *dcAwareRR) {
+		if n < 0 {
+			n = 0
+		}
+		d.limitCrossDC = true
+		d.maxRemoteHosts = n
+	}
+}
+
+// AllowRemoteDCsForLocalConsistencyLevel lets queries with LOCAL_ONE or
+// LOCAL_QUORUM consistency fall back to remote datacenters, see CrossDCFallback.
+func AllowRemoteDCsForLocalConsistencyLevel() func(*dcAwareRR) {
+	return func(d *dcAwareRR) {
+		d.allowRemoteForLocalCL = true
+	}
+}
+
+func (d *dcAwareRR) Init(s *Session) {
+	d.logger = s.logger
 }
 
-func (d *dcAwareRR) Init(*Session)                       {}
 func (d *dcAwareRR) KeyspaceChanged(KeyspaceUpdateEvent) {}
 func (d *dcAwareRR) SetPartitioner(p string)             {}
 
+func (d *dcAwareRR) localDC() string {
+	if dc, ok := d.detectedDC.Load().(string); ok {
+		return dc
+	}
+	return d.local
+}
+
 func (d *dcAwareRR) IsLocal(host *HostInfo) bool {
-	return host.DataCenter() == d.local
+	return host.DataCenter() == d.localDC()
 }
 
 func (d *dcAwareRR) AddHost(host *HostInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.IsLocal(host) {
 		d.localHosts.add(host)
 	} else {
@@ -707,6 +1091,8 @@ func (d *dcAwareRR) AddHost(host *HostInfo) {
 }
 
 func (d *dcAwareRR) RemoveHost(host *HostInfo) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
 	if d.IsLocal(host) {
 		d.localHosts.remove(host.ConnectAddress())
 	} else {
@@ -714,6 +1100,38 @@ func (d *dcAwareRR) RemoveHost(host *HostInfo) {
 	}
 }
 
+// controlHostChanged implements controlHostObserver.
+func (d *dcAwareRR) controlHostChanged(host *HostInfo) {
+	dc := host.DataCenter()
+	if !d.autoDetectLocalDC || dc == "" {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if dc == d.localDC() {
+		return
+	}
+	d.detectedDC.Store(dc)
+
+	var hosts []*HostInfo
+	hosts = append(hosts, d.localHosts.get()...)
+	hosts = append(hosts, d.remoteHosts.get()...)
+	for _, h := range hosts {
+		if d.IsLocal(h) {
+			d.remoteHosts.remove(h.ConnectAddress())
+			d.localHosts.add(h)
+		} else {
+			d.localHosts.remove(h.ConnectAddress())
+			d.remoteHosts.add(h)
+		}
+	}
+
+	if d.logger != nil {
+		logf(d.logger, LogLevelInfo, "gocql: using datacenter %q of control connection host %v as local datacenter\n", dc, host.ConnectAddress())
+	}
+}
+
 func (d *dcAwareRR) HostUp(host *HostInfo)   { d.AddHost(host) }
 func (d *dcAwareRR) HostDown(host *HostInfo) { d.RemoveHost(host) }
 
@@ -760,8 +1178,75 @@ func roundRobbin(shift int, hosts ...[]*HostInfo) NextHost {
 }
 
 func (d *dcAwareRR) Pick(q ExecutableQuery) NextHost {
-	nextStartOffset := atomic.AddUint64(&d.lastUsedHostIdx, 1)
-	return roundRobbin(int(nextStartOffset), d.localHosts.get(), d.remoteHosts.get())
+	var fellBack bool
+	return d.pick(q, nil, &fellBack)
+}
+
+// pick returns the hosts of the local datacenter followed by the hosts of
+// remote datacenters the query may fall back to, remoteFirst are tried before
+// the other remote hosts. fellBack is set once the query fell back to a remote
+// host.
+func (d *dcAwareRR) pick(q ExecutableQuery, remoteFirst []*HostInfo, fellBack *bool) NextHost {
+	nextStartOffset := int(atomic.AddUint64(&d.lastUsedHostIdx, 1))
+	local := roundRobbin(nextStartOffset, d.localHosts.get())
+	remote := roundRobbin(nextStartOffset, remoteFirst, d.remoteHosts.get())
+	remaining := d.remoteHostsFor(q)
+
+	var seen map[*HostInfo]bool
+	if len(remoteFirst) > 0 {
+		seen = make(map[*HostInfo]bool, len(remoteFirst))
+	}
+	return func() SelectedHost {
+		if h := local(); h != nil {
+			return h
+		}
+		if remaining == 0 {
+			return nil
+		}
+		for h := remote(); h != nil; h = remote() {
+			if seen != nil {
+				if seen[h.Info()] {
+					continue
+				}
+				seen[h.Info()] = true
+			}
+			if remaining > 0 {
+				remaining--
+			}
+			d.countCrossDCFallback(fellBack)
+			return h
+		}
+		return nil
+	}
+}
+
+// remoteHostsFor returns the number of remote hosts q may be sent to, -1 if
+// there is no limit.
+func (d *dcAwareRR) remoteHostsFor(q ExecutableQuery) int {
+	if !d.limitCrossDC {
+		return -1
+	}
+	if q != nil && !d.allowRemoteForLocalCL {
+		switch q.GetConsistency() {
+		case LocalOne, LocalQuorum:
+			return 0
+		}
+	}
+	return d.maxRemoteHosts
+}
+
+// countCrossDCFallback counts the query falling back to a remote host unless it
+// was already counted.
+func (d *dcAwareRR) countCrossDCFallback(fellBack *bool) {
+	if !*fellBack {
+		*fellBack = true
+		atomic.AddUint64(&d.crossDCFallbacks, 1)
+	}
+}
+
+// crossDCFallbackCount implements crossDCFallbackCounter.
+func (d *dcAwareRR) crossDCFallbackCount() uint64 {
+	return atomic.LoadUint64(&d.crossDCFallbacks)
 }
 
 // RackAwareRoundRobinPolicy is a host selection policies which will prioritize and
@@ -871,6 +1356,62 @@ func (s *singleHostReadyPolicy) Ready() bool {
 	return true
 }
 
+// DeterministicOrderPolicy wraps a HostSelectionPolicy so that the order of
+// the hosts it picks is reproducible, for tests of retry and failover logic.
+// The hosts picked by inner for a query are ordered by host ID and shuffled by
+// a random source seeded with seed, so that the same sequence of picks of the
+// same hosts returns the same orders for the same seed. The order does not
+// depend on the order of inner, which is lost along with its preferences such
+// as the replicas first of TokenAwareHostPolicy.
+//
+// DeterministicOrderPolicy is intended for tests only.
+func DeterministicOrderPolicy(inner HostSelectionPolicy, seed int64) HostSelectionPolicy {
+	return &deterministicOrderPolicy{
+		HostSelectionPolicy: inner,
+		rand:                rand.New(rand.NewSource(seed)),
+	}
+}
+
+type deterministicOrderPolicy struct {
+	HostSelectionPolicy
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func (d *deterministicOrderPolicy) Pick(qry ExecutableQuery) NextHost {
+	var hosts []SelectedHost
+	next := d.HostSelectionPolicy.Pick(qry)
+	for host := next(); host != nil; host = next() {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		return hosts[i].Info().HostID() < hosts[j].Info().HostID()
+	})
+
+	d.mu.Lock()
+	d.rand.Shuffle(len(hosts), func(i, j int) {
+		hosts[i], hosts[j] = hosts[j], hosts[i]
+	})
+	d.mu.Unlock()
+
+	return func() SelectedHost {
+		if len(hosts) == 0 {
+			return nil
+		}
+		host := hosts[0]
+		hosts = hosts[1:]
+		return host
+	}
+}
+
+func (d *deterministicOrderPolicy) Ready() bool {
+	if rdy, ok := d.HostSelectionPolicy.(ReadyPolicy); ok {
+		return rdy.Ready()
+	}
+	return true
+}
+
 // ConvictionPolicy interface is used by gocql to determine if a host should be
 // marked as DOWN based on the error and host info
 type ConvictionPolicy interface {
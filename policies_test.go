@@ -7,11 +7,14 @@ package gocql
 import (
 	"fmt"
 	"net"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/gocql/gocql/internal/lru"
 	"github.com/hailocab/go-hostpool"
 )
 
@@ -278,6 +281,75 @@ func TestSimpleRetryPolicy(t *testing.T) {
 	}
 }
 
+func TestConsistencyAwareRetryPolicy(t *testing.T) {
+	rt := &ConsistencyAwareRetryPolicy{
+		NumRetries:        map[Consistency]int{One: 3, Quorum: 1},
+		DefaultNumRetries: 2,
+	}
+
+	cases := []struct {
+		cons     Consistency
+		attempts int
+		allow    bool
+	}{
+		{One, 3, true},
+		{One, 4, false},
+		{Quorum, 1, true},
+		{Quorum, 2, false},
+		{LocalQuorum, 2, true},
+		{LocalQuorum, 3, false},
+	}
+
+	for _, c := range cases {
+		q := &Query{cons: c.cons, routingInfo: &queryRoutingInfo{}}
+		q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: c.attempts}})
+		if allow := rt.Attempt(q); allow != c.allow {
+			t.Errorf("%v after %d attempts: expected retry allowed %v, got %v", c.cons, c.attempts, c.allow, allow)
+		}
+	}
+}
+
+func TestQueryConsistencyChain(t *testing.T) {
+	q := &Query{routingInfo: &queryRoutingInfo{}, rt: &SimpleRetryPolicy{NumRetries: 1}}
+	q.ConsistencyChain(LocalQuorum, LocalOne, One)
+	if q.GetConsistency() != LocalQuorum {
+		t.Fatalf("expected the query to start at LOCAL_QUORUM, got %v", q.GetConsistency())
+	}
+
+	rt, ok := q.retryPolicy().(RetryPolicyWithError)
+	if !ok {
+		t.Fatalf("expected a retry policy with error, got %T", q.retryPolicy())
+	}
+	unavailable := &RequestErrUnavailable{}
+	for _, next := range []Consistency{LocalOne, One} {
+		if !rt.AttemptWithError(q, unavailable) || rt.GetRetryType(unavailable) != Retry {
+			t.Fatalf("expected the query to be retried at %v", next)
+		}
+		if q.GetConsistency() != next {
+			t.Fatalf("expected the query to be retried at %v, got %v", next, q.GetConsistency())
+		}
+	}
+	if rt.AttemptWithError(q, &RequestErrReadTimeout{}) {
+		t.Fatal("expected the query not to be retried past the last level")
+	}
+
+	// non idempotent writes are handled by the retry policy of the query
+	q.SetConsistency(LocalQuorum)
+	q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 2}})
+	if rt.AttemptWithError(q, &RequestErrWriteTimeout{WriteType: "SIMPLE"}) || q.GetConsistency() != LocalQuorum {
+		t.Fatal("expected a non idempotent write not to be retried")
+	}
+	q.idempotent = true
+	if !rt.AttemptWithError(q, &RequestErrWriteTimeout{WriteType: "SIMPLE"}) || q.GetConsistency() != LocalOne {
+		t.Fatal("expected an idempotent write to be retried at the next level")
+	}
+
+	q.Consistency(Quorum)
+	if _, ok := q.retryPolicy().(*consistencyChainRetryPolicy); ok {
+		t.Fatal("expected Consistency to clear the consistency chain")
+	}
+}
+
 func TestExponentialBackoffPolicy(t *testing.T) {
 	// test with defaults
 	sut := &ExponentialBackoffRetryPolicy{NumRetries: 2}
@@ -365,6 +437,108 @@ func TestDowngradingConsistencyRetryPolicy(t *testing.T) {
 	}
 }
 
+func TestAdaptiveConsistencyRetryPolicy(t *testing.T) {
+	cases := []struct {
+		name       string
+		cons       Consistency
+		idempotent bool
+		attempts   int
+		err        error
+		allow      bool
+		expected   Consistency
+	}{
+		{"unavailable", Quorum, false, 1, &RequestErrUnavailable{Required: 2, Alive: 1}, true, One},
+		{"unavailable local", LocalQuorum, false, 1, &RequestErrUnavailable{Required: 3, Alive: 2}, true, Two},
+		{"unavailable local one", LocalQuorum, false, 1, &RequestErrUnavailable{Required: 2, Alive: 1}, true, LocalOne},
+		{"unavailable none alive", Quorum, false, 1, &RequestErrUnavailable{Required: 2, Alive: 0}, false, Quorum},
+		{"unavailable serial", Quorum, false, 1, &RequestErrUnavailable{Consistency: Consistency(Serial), Required: 2, Alive: 1}, false, Quorum},
+		{"serial read", Consistency(LocalSerial), false, 1, &RequestErrReadTimeout{Received: 1, BlockFor: 2}, false, Consistency(LocalSerial)},
+		{"read timeout", All, false, 1, &RequestErrReadTimeout{Received: 3, BlockFor: 5}, true, Three},
+		{"read timeout enough replicas", Quorum, false, 1, &RequestErrReadTimeout{Received: 2, BlockFor: 2}, false, Quorum},
+		{"write timeout", Quorum, true, 1, &RequestErrWriteTimeout{Received: 1, BlockFor: 2, WriteType: "SIMPLE"}, true, One},
+		{"write timeout not idempotent", Quorum, false, 1, &RequestErrWriteTimeout{Received: 1, BlockFor: 2, WriteType: "SIMPLE"}, false, Quorum},
+		{"write timeout cas", Quorum, true, 1, &RequestErrWriteTimeout{Received: 1, BlockFor: 2, WriteType: "CAS"}, false, Quorum},
+		{"write timeout counter", Quorum, true, 1, &RequestErrWriteTimeout{Received: 1, BlockFor: 2, WriteType: "COUNTER"}, false, Quorum},
+		{"already retried", One, false, 2, &RequestErrUnavailable{Required: 2, Alive: 1}, false, One},
+		{"other error", Quorum, true, 1, ErrTimeoutNoResponse, false, Quorum},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var downgrades []string
+			rt := &AdaptiveConsistencyRetryPolicy{
+				OnDowngrade: func(from, to Consistency, err error) {
+					downgrades = append(downgrades, from.String()+"->"+to.String())
+				},
+			}
+			q := &Query{cons: c.cons, idempotent: c.idempotent, routingInfo: &queryRoutingInfo{}}
+			q.metrics = preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: c.attempts}})
+
+			if rt.Attempt(q) {
+				t.Fatal("Attempt should not allow retries without the error")
+			}
+			if allow := rt.AttemptWithError(q, c.err); allow != c.allow {
+				t.Fatalf("expected retry to be allowed %v, got %v", c.allow, allow)
+			}
+			if q.GetConsistency() != c.expected {
+				t.Fatalf("expected consistency %v, got %v", c.expected, q.GetConsistency())
+			}
+
+			var expected int64
+			if c.allow {
+				expected = 1
+				if rt.GetRetryType(c.err) != Retry {
+					t.Fatalf("expected retry type %v, got %v", Retry, rt.GetRetryType(c.err))
+				}
+				if want := c.cons.String() + "->" + c.expected.String(); len(downgrades) != 1 || downgrades[0] != want {
+					t.Fatalf("expected downgrade %s to be reported, got %v", want, downgrades)
+				}
+			}
+			if rt.Downgrades() != expected {
+				t.Fatalf("expected %d downgrades, got %d", expected, rt.Downgrades())
+			}
+		})
+	}
+}
+
+func TestAdaptiveConsistencyRetryPolicyLightweightTransactions(t *testing.T) {
+	unavailable := &RequestErrUnavailable{Consistency: Quorum, Required: 2, Alive: 1}
+	session := &Session{conditionalStmts: conditionalStmtLRU{lru: lru.New(10)}}
+	metrics := func() *queryMetrics {
+		return preFilledQueryMetrics(map[string]*hostMetrics{"127.0.0.1": {Attempts: 1}})
+	}
+
+	cases := []struct {
+		name  string
+		q     RetryableQuery
+		allow bool
+	}{
+		{"query", &Query{stmt: "UPDATE t SET v = 1 WHERE k = 1", cons: Quorum, metrics: metrics()}, true},
+		{"conditional query", &Query{stmt: "UPDATE t SET v = 1 WHERE k = 1 IF v = 0", cons: Quorum, metrics: metrics()}, false},
+		{"conditional query of session", &Query{stmt: "INSERT INTO t (k) VALUES (1) IF NOT EXISTS", cons: Quorum, session: session, metrics: metrics()}, false},
+		{"query with serial consistency", &Query{stmt: "UPDATE t SET v = 1 WHERE k = 1", cons: Quorum, serialCons: Serial, metrics: metrics()}, false},
+		{"batch", &Batch{Entries: []BatchEntry{{Stmt: "UPDATE t SET v = 1 WHERE k = 1"}}, Cons: Quorum, metrics: metrics()}, true},
+		{"conditional batch", &Batch{Entries: []BatchEntry{{Stmt: "UPDATE t SET v = 1 WHERE k = 1"}, {Stmt: "UPDATE t SET v = 2 WHERE k = 1 IF v = 0"}}, Cons: Quorum, session: session, metrics: metrics()}, false},
+		{"batch with serial consistency", &Batch{Entries: []BatchEntry{{Stmt: "UPDATE t SET v = 1 WHERE k = 1"}}, Cons: Quorum, serialCons: LocalSerial, metrics: metrics()}, false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			rt := &AdaptiveConsistencyRetryPolicy{}
+			if allow := rt.AttemptWithError(c.q, unavailable); allow != c.allow {
+				t.Fatalf("expected retry to be allowed %v, got %v", c.allow, allow)
+			}
+			expected := Quorum
+			if c.allow {
+				expected = One
+			}
+			if cons := c.q.GetConsistency(); cons != expected {
+				t.Fatalf("expected consistency %v, got %v", expected, cons)
+			}
+		})
+	}
+}
+
 // expectHosts makes sure that the next len(hostIDs) returned from iter is a permutation of hostIDs.
 func expectHosts(t *testing.T, msg string, iter NextHost, hostIDs ...string) {
 	t.Helper()
@@ -457,6 +631,175 @@ func TestHostPolicy_DCAwareRR(t *testing.T) {
 
 }
 
+func TestHostPolicy_DCAwareRRAutoDetectLocalDC(t *testing.T) {
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.ParseIP("10.0.0.1"), dataCenter: "dc1"},
+		{hostId: "1", connectAddress: net.ParseIP("10.0.0.2"), dataCenter: "dc1"},
+		{hostId: "2", connectAddress: net.ParseIP("10.0.0.3"), dataCenter: "dc2"},
+		{hostId: "3", connectAddress: net.ParseIP("10.0.0.4"), dataCenter: "dc2"},
+	}
+
+	expectLocal := func(p HostSelectionPolicy, dc string) {
+		t.Helper()
+		var dcs []string
+		it := p.Pick(nil)
+		for h := it(); h != nil; h = it() {
+			dcs = append(dcs, h.Info().DataCenter())
+		}
+		if len(dcs) != len(hosts) || dcs[0] != dc || dcs[1] != dc {
+			t.Fatalf("expected hosts of %s first, got %v", dc, dcs)
+		}
+		for _, host := range hosts {
+			if p.IsLocal(host) != (host.DataCenter() == dc) {
+				t.Fatalf("expected %s to be the local datacenter", dc)
+			}
+		}
+	}
+
+	p := TokenAwareHostPolicy(DCAwareRoundRobinPolicy("dc1", AutoDetectLocalDC()))
+	for _, host := range hosts {
+		p.AddHost(host)
+	}
+	expectLocal(p, "dc1")
+
+	p.(controlHostObserver).controlHostChanged(hosts[2])
+	expectLocal(p, "dc2")
+
+	// the control connection moved back
+	p.(controlHostObserver).controlHostChanged(hosts[1])
+	expectLocal(p, "dc1")
+
+	p.RemoveHost(hosts[0])
+	p.AddHost(hosts[0])
+	expectLocal(p, "dc1")
+
+	// without AutoDetectLocalDC the configured datacenter is kept
+	p = DCAwareRoundRobinPolicy("dc1")
+	for _, host := range hosts {
+		p.AddHost(host)
+	}
+	p.(controlHostObserver).controlHostChanged(hosts[2])
+	expectLocal(p, "dc1")
+}
+
+func TestHostPolicy_DCAwareRRCrossDCFallback(t *testing.T) {
+	hosts := [...]*HostInfo{
+		{hostId: "0", connectAddress: net.ParseIP("10.0.0.1"), dataCenter: "local"},
+		{hostId: "1", connectAddress: net.ParseIP("10.0.0.2"), dataCenter: "local"},
+		{hostId: "2", connectAddress: net.ParseIP("10.0.0.3"), dataCenter: "remote"},
+		{hostId: "3", connectAddress: net.ParseIP("10.0.0.4"), dataCenter: "remote"},
+		{hostId: "4", connectAddress: net.ParseIP("10.0.0.5"), dataCenter: "remote"},
+	}
+	newPolicy := func(opts ...func(*dcAwareRR)) HostSelectionPolicy {
+		p := DCAwareRoundRobinPolicy("local", opts...)
+		for _, host := range hosts {
+			p.AddHost(host)
+		}
+		return p
+	}
+	pick := func(p HostSelectionPolicy, cons Consistency) (local, remote int) {
+		it := p.Pick(&Query{cons: cons})
+		for h := it(); h != nil; h = it() {
+			if p.IsLocal(h.Info()) {
+				local++
+			} else {
+				remote++
+			}
+		}
+		return local, remote
+	}
+	fallbacks := func(p HostSelectionPolicy) uint64 {
+		return (&Session{policy: p}).CrossDCFallbacks()
+	}
+
+	p := newPolicy(CrossDCFallback(2))
+	if local, remote := pick(p, Quorum); local != 2 || remote != 2 {
+		t.Fatalf("expected 2 local and 2 remote hosts, got %d and %d", local, remote)
+	}
+	if local, remote := pick(p, LocalQuorum); local != 2 || remote != 0 {
+		t.Fatalf("expected 2 local and no remote hosts for LOCAL_QUORUM, got %d and %d", local, remote)
+	}
+	if n := fallbacks(p); n != 1 {
+		t.Fatalf("expected 1 cross DC fallback, got %d", n)
+	}
+
+	p = newPolicy(CrossDCFallback(1), AllowRemoteDCsForLocalConsistencyLevel())
+	if local, remote := pick(p, LocalOne); local != 2 || remote != 1 {
+		t.Fatalf("expected 2 local and 1 remote hosts for LOCAL_ONE, got %d and %d", local, remote)
+	}
+
+	// without CrossDCFallback all the remote hosts are returned
+	p = newPolicy()
+	if local, remote := pick(p, LocalQuorum); local != 2 || remote != 3 {
+		t.Fatalf("expected 2 local and 3 remote hosts, got %d and %d", local, remote)
+	}
+	if n := fallbacks(p); n != 1 {
+		t.Fatalf("expected 1 cross DC fallback, got %d", n)
+	}
+	if n := fallbacks(RoundRobinHostPolicy()); n != 0 {
+		t.Fatalf("expected no cross DC fallbacks, got %d", n)
+	}
+}
+
+func TestHostPolicy_TokenAwareCrossDCFallback(t *testing.T) {
+	const keyspace = "myKeyspace"
+	const partitioner = "OrderedPartitioner"
+	policy := TokenAwareHostPolicy(DCAwareRoundRobinPolicy("local", CrossDCFallback(1)))
+	policyInternal := policy.(*tokenAwareHostPolicy)
+
+	hosts := []*HostInfo{
+		{hostId: "0", connectAddress: net.IPv4(10, 0, 0, 1), tokens: []string{"05"}, dataCenter: "local"},
+		{hostId: "1", connectAddress: net.IPv4(10, 0, 0, 2), tokens: []string{"10"}, dataCenter: "local"},
+		{hostId: "2", connectAddress: net.IPv4(10, 0, 0, 3), tokens: []string{"15"}, dataCenter: "remote1"},
+		{hostId: "3", connectAddress: net.IPv4(10, 0, 0, 4), tokens: []string{"20"}, dataCenter: "remote1"},
+		{hostId: "4", connectAddress: net.IPv4(10, 0, 0, 5), tokens: []string{"25"}, dataCenter: "remote2"},
+		{hostId: "5", connectAddress: net.IPv4(10, 0, 0, 6), tokens: []string{"30"}, dataCenter: "remote2"},
+	}
+	for _, host := range hosts {
+		policy.AddHost(host)
+	}
+	policy.SetPartitioner(partitioner)
+
+	// hosts 0, 2 and 4 are the replicas of every partition
+	policyInternal.getMetadataReadOnly = func() *ClusterMetadata {
+		replicas := []*HostInfo{hosts[0], hosts[2], hosts[4]}
+		meta := &ClusterMetadata{replicas: map[string]tokenRingReplicas{keyspace: {}}}
+		for _, host := range hosts {
+			meta.replicas[keyspace] = append(meta.replicas[keyspace], hostTokens{orderedToken(host.tokens[0]), replicas})
+		}
+		meta.resetTokenRing(partitioner, hosts, nil)
+		return meta
+	}
+
+	query := &Query{routingInfo: &queryRoutingInfo{}, cons: Quorum}
+	query.getKeyspace = func() string { return keyspace }
+	query.RoutingKey([]byte("12"))
+
+	expectRemoteReplica := func(iter NextHost) {
+		t.Helper()
+		h := iter()
+		if h == nil || (h.Info().HostID() != "2" && h.Info().HostID() != "4") {
+			t.Fatalf("expected a remote replica, got %v", h)
+		}
+	}
+
+	iter := policy.Pick(query)
+	expectHosts(t, "local replica", iter, "0")
+	expectHosts(t, "local host", iter, "1")
+	expectRemoteReplica(iter)
+	expectNoMoreHosts(t, iter)
+
+	hosts[0].setState(NodeDown)
+	hosts[1].setState(NodeDown)
+	iter = policy.Pick(query)
+	expectRemoteReplica(iter)
+	expectNoMoreHosts(t, iter)
+
+	if n := (&Session{policy: policy}).CrossDCFallbacks(); n != 2 {
+		t.Fatalf("expected 2 cross DC fallbacks, got %d", n)
+	}
+}
+
 // Tests of the token-aware host selection policy implementation with a
 // DC aware round-robin host selection policy fallback
 // with {"class": "NetworkTopologyStrategy", "a": 1, "b": 1, "c": 1} replication.
@@ -779,3 +1122,42 @@ func TestHostPolicy_TokenAware_RackAware(t *testing.T) {
 	expectHosts(t, "non-local DC", iter, "0", "1", "4", "5", "8", "9")
 	expectNoMoreHosts(t, iter)
 }
+
+func TestDeterministicOrderPolicy(t *testing.T) {
+	newPolicy := func(seed int64) HostSelectionPolicy {
+		policy := DeterministicOrderPolicy(RoundRobinHostPolicy(), seed)
+		for i := 0; i < 5; i++ {
+			policy.AddHost(&HostInfo{hostId: strconv.Itoa(i), connectAddress: net.IPv4(10, 0, 0, byte(i+1))})
+		}
+		return policy
+	}
+	picks := func(policy HostSelectionPolicy, n int) [][]string {
+		var orders [][]string
+		for i := 0; i < n; i++ {
+			var order []string
+			next := policy.Pick(nil)
+			for host := next(); host != nil; host = next() {
+				order = append(order, host.Info().HostID())
+			}
+			orders = append(orders, order)
+		}
+		return orders
+	}
+
+	// the round-robin position of the inner policy does not matter
+	advanced := newPolicy(42)
+	advanced.(*deterministicOrderPolicy).HostSelectionPolicy.Pick(nil)
+
+	expected := picks(newPolicy(42), 10)
+	if got := picks(advanced, 10); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected the same orders for the same seed, got %v and %v", expected, got)
+	}
+	for _, order := range expected {
+		if len(order) != 5 {
+			t.Fatalf("expected all 5 hosts to be picked, got %v", order)
+		}
+	}
+	if got := picks(newPolicy(7), 10); reflect.DeepEqual(got, expected) {
+		t.Fatalf("expected different orders for another seed, got %v", got)
+	}
+}
@@ -4,14 +4,186 @@ import (
 	"bytes"
 	"github.com/gocql/gocql/internal/lru"
 	"sync"
+	"sync/atomic"
 )
 
-const defaultMaxPreparedStmts = 1000
+const (
+	defaultMaxPreparedStmts             = 1000
+	defaultPrepareOnAllHostsConcurrency = 4
+)
+
+// PreparedCacheKey identifies a statement prepared on a host. The id of a
+// prepared statement is only valid on the host which prepared it, so it is
+// part of the key.
+type PreparedCacheKey struct {
+	HostID    string
+	Keyspace  string
+	Statement string
+}
+
+// PreparedStatement is a statement prepared on a host, as stored in a
+// PreparedCache. It must not be modified.
+type PreparedStatement struct {
+	stmt *preparedStatment
+}
+
+// ID returns the id the host assigned to the prepared statement.
+func (p *PreparedStatement) ID() []byte {
+	return p.stmt.id
+}
+
+// PreparedCache stores prepared statements. A PreparedCache can be shared by
+// sessions connected to the same cluster, see ClusterConfig.PreparedCache, so
+// that statements are prepared once rather than by every session.
+//
+// Implementations must be safe for concurrent use.
+type PreparedCache interface {
+	// Get returns the statement stored for key.
+	Get(key PreparedCacheKey) (*PreparedStatement, bool)
+	// Put stores stmt for key, replacing any previous statement.
+	Put(key PreparedCacheKey, stmt *PreparedStatement)
+	// Evict removes the statement stored for key, it is called when the host
+	// no longer knows the prepared statement.
+	Evict(key PreparedCacheKey)
+}
+
+// NewPreparedCache returns a PreparedCache holding up to size statements, the
+// least recently used statements are evicted first.
+func NewPreparedCache(size int) PreparedCache {
+	return &lruPreparedCache{lru: lru.New(size)}
+}
+
+type lruPreparedCache struct {
+	mu  sync.Mutex
+	lru *lru.Cache
+}
+
+func (k PreparedCacheKey) lruKey() string {
+	return k.HostID + "\x00" + k.Keyspace + "\x00" + k.Statement
+}
+
+func (c *lruPreparedCache) Get(key PreparedCacheKey) (*PreparedStatement, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	val, ok := c.lru.Get(key.lruKey())
+	if !ok {
+		return nil, false
+	}
+	return val.(*PreparedStatement), true
+}
+
+func (c *lruPreparedCache) Put(key PreparedCacheKey, stmt *PreparedStatement) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Add(key.lruKey(), stmt)
+}
+
+func (c *lruPreparedCache) Evict(key PreparedCacheKey) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lru.Remove(key.lruKey())
+}
 
 // preparedLRU is the prepared statement cache
 type preparedLRU struct {
+	// sent is the number of PREPARE requests sent, accessed atomically.
+	sent uint64
+
 	mu  sync.Mutex
 	lru *lru.Cache
+
+	// shared is ClusterConfig.PreparedCache, the session cache above is still
+	// used to deduplicate concurrent prepares.
+	shared PreparedCache
+
+	// normalize is set unless ClusterConfig.DisablePreparedStatementNormalization
+	// is, normalized caches the text of the statements used in cache keys.
+	normalize  bool
+	normalized *normalizedStatements
+
+	// unprepared holds the keys of the statements evicted because a host
+	// reported them as unprepared, until they are prepared again, at most
+	// ClusterConfig.MaxPreparedStmts of them. It is only tracked for
+	// ClusterConfig.PrepareObserver.
+	unprepared *lru.Cache
+}
+
+func newPreparedLRU(cfg *ClusterConfig) *preparedLRU {
+	p := &preparedLRU{
+		lru:        lru.New(cfg.MaxPreparedStmts),
+		shared:     cfg.PreparedCache,
+		normalize:  !cfg.DisablePreparedStatementNormalization,
+		normalized: &normalizedStatements{lru: lru.New(cfg.MaxPreparedStmts)},
+	}
+	if cfg.PrepareObserver != nil {
+		p.unprepared = lru.New(cfg.MaxPreparedStmts)
+	}
+	return p
+}
+
+// loadShared returns the statement stored in the shared cache for key, if any.
+func (p *preparedLRU) loadShared(key PreparedCacheKey) *preparedStatment {
+	if p.shared == nil {
+		return nil
+	}
+	if stmt, ok := p.shared.Get(key); ok && stmt != nil && stmt.stmt != nil {
+		return stmt.stmt
+	}
+	return nil
+}
+
+func (p *preparedLRU) storeShared(key PreparedCacheKey, stmt *preparedStatment) {
+	if p.shared != nil {
+		p.shared.Put(key, &PreparedStatement{stmt: stmt})
+	}
+}
+
+// evictShared evicts the statement stored in the shared cache for key if it
+// was prepared as id.
+func (p *preparedLRU) evictShared(key PreparedCacheKey, id []byte) {
+	if p.shared == nil {
+		return
+	}
+	if stmt, ok := p.shared.Get(key); ok && bytes.Equal(stmt.ID(), id) {
+		p.shared.Evict(key)
+	}
+}
+
+// prepareOnAllHosts prepares stmt on every host that is up other than
+// prepared, which already prepared it. At most
+// ClusterConfig.PrepareOnAllHostsConcurrency statements are being prepared this
+// way at any time, failures are ignored as the statement is prepared again
+// when it is used on the host.
+func (s *Session) prepareOnAllHosts(prepared *HostInfo, keyspace, stmt string) {
+	for _, host := range s.ring.allHosts() {
+		if host.HostID() == prepared.HostID() || !host.IsUp() {
+			continue
+		}
+		pool, ok := s.pool.getPool(host)
+		if !ok {
+			continue
+		}
+		conn := pool.Pick()
+		if conn == nil || conn.currentKeyspace != keyspace {
+			continue
+		}
+
+		select {
+		case s.prepareFanOut <- struct{}{}:
+		case <-s.ctx.Done():
+			return
+		}
+		go func() {
+			defer func() { <-s.prepareFanOut }()
+			conn.prepareStatementOnHost(s.ctx, stmt, nil, false)
+		}()
+	}
+}
+
+// PreparesSent returns the number of PREPARE requests sent by the session,
+// including the ones sent because of ClusterConfig.PrepareOnAllHosts.
+func (s *Session) PreparesSent() uint64 {
+	return atomic.LoadUint64(&s.stmtsLRU.sent)
 }
 
 func (p *preparedLRU) clear() {
@@ -49,7 +221,39 @@ func (p *preparedLRU) execIfMissing(key string, fn func(lru *lru.Cache) *infligh
 
 func (p *preparedLRU) keyFor(hostID, keyspace, statement string) string {
 	// TODO: we should just use a struct for the key in the map
-	return hostID + keyspace + statement
+	return hostID + keyspace + p.cacheStatement(statement)
+}
+
+// cacheStatement returns the text of statement used in cache keys, the
+// statement is normalized unless ClusterConfig.DisablePreparedStatementNormalization
+// is set. The statement sent to the server is never modified.
+func (p *preparedLRU) cacheStatement(statement string) string {
+	if !p.normalize {
+		return statement
+	}
+	return p.normalized.get(statement)
+}
+
+// normalizedStatements caches the normalized text of statements, keyed by
+// statement, so that a statement executed repeatedly is only normalized once.
+type normalizedStatements struct {
+	mu  sync.Mutex
+	lru *lru.Cache
+}
+
+func (n *normalizedStatements) get(stmt string) string {
+	n.mu.Lock()
+	val, ok := n.lru.Get(stmt)
+	n.mu.Unlock()
+	if ok {
+		return val.(string)
+	}
+
+	normalized := statementFingerprint(stmt, true)
+	n.mu.Lock()
+	n.lru.Add(stmt, normalized)
+	n.mu.Unlock()
+	return normalized
 }
 
 func (p *preparedLRU) evictPreparedID(key string, id []byte) {
@@ -68,10 +272,99 @@ func (p *preparedLRU) evictPreparedID(key string, id []byte) {
 
 	select {
 	case <-ifp.done:
-		if bytes.Equal(id, ifp.preparedStatment.id) {
+		if ifp.preparedStatment != nil && bytes.Equal(id, ifp.preparedStatment.id) {
 			p.lru.Remove(key)
+			p.evictShared(ifp.key, id)
+			if p.unprepared != nil {
+				p.unprepared.Add(key, struct{}{})
+			}
 		}
 	default:
 	}
 
 }
+
+// reprepared reports whether the statement of key was evicted because a host
+// reported it as unprepared, and forgets it.
+func (p *preparedLRU) reprepared(key string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.unprepared != nil && p.unprepared.Remove(key)
+}
+
+// updateResultMetadata replaces the result metadata of the statement prepared
+// as id with meta, as received in a response flagged with flagMetaDataChanged.
+func (p *preparedLRU) updateResultMetadata(key string, id []byte, meta resultMetadata) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	val, ok := p.lru.Get(key)
+	if !ok {
+		return
+	}
+
+	ifp, ok := val.(*inflightPrepare)
+	if !ok {
+		return
+	}
+
+	select {
+	case <-ifp.done:
+		if ifp.err != nil || !bytes.Equal(id, ifp.preparedStatment.id) {
+			return
+		}
+	default:
+		return
+	}
+
+	response := meta
+	response.pagingState = nil
+	response.newMetadataID = nil
+
+	updated := new(preparedStatment)
+	*updated = *ifp.preparedStatment
+	updated.resultMetadataID = meta.newMetadataID
+	updated.response = response
+
+	done := make(chan struct{})
+	close(done)
+	p.lru.Add(key, &inflightPrepare{
+		done:             done,
+		key:              ifp.key,
+		preparedStatment: updated,
+	})
+	p.storeShared(ifp.key, updated)
+}
+
+// stmtExecCounter counts the executions of statements which are not prepared
+// yet, keyed by normalized statement, see statementFingerprint. It is used for
+// AutoPrepareThreshold.
+type stmtExecCounter struct {
+	mu  sync.Mutex
+	lru *lru.Cache
+
+	// normalized is shared with the prepared statement cache, if nil statements
+	// are normalized on every execution.
+	normalized *normalizedStatements
+}
+
+// inc increments the execution count of stmt and returns the new count.
+func (c *stmtExecCounter) inc(stmt string) int {
+	var key string
+	if c.normalized != nil {
+		key = c.normalized.get(stmt)
+	} else {
+		key = statementFingerprint(stmt, true)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	count := 1
+	if val, ok := c.lru.Get(key); ok {
+		count += val.(int)
+	}
+	c.lru.Add(key, count)
+	return count
+}
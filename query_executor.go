@@ -17,6 +17,9 @@ type ExecutableQuery interface {
 	Keyspace() string
 	Table() string
 	IsIdempotent() bool
+	connectionPool() string
+	retriesDisabled() bool
+	knownRoutingKey() []byte
 
 	withContext(context.Context) ExecutableQuery
 
@@ -24,11 +27,15 @@ type ExecutableQuery interface {
 }
 
 type queryExecutor struct {
-	pool   *policyConnPool
-	policy HostSelectionPolicy
+	pool     *policyConnPool
+	policy   HostSelectionPolicy
+	inFlight *inFlightQueries
 }
 
 func (q *queryExecutor) attemptQuery(ctx context.Context, qry ExecutableQuery, conn *Conn) *Iter {
+	if q.inFlight != nil {
+		q.inFlight.setHost(ctx, conn.host)
+	}
 	start := time.Now()
 	iter := qry.execute(ctx, conn)
 	end := time.Now()
@@ -58,14 +65,96 @@ func (q *queryExecutor) speculate(ctx context.Context, qry ExecutableQuery, sp S
 	return nil
 }
 
-func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
-	hostIter := q.policy.Pick(qry)
+// hostPinnedQuery is implemented by queries which can be pinned to a single host,
+// bypassing the host selection policy.
+type hostPinnedQuery interface {
+	pinnedHost() *HostInfo
+}
+
+// replicaRequiringQuery is implemented by queries which must only be sent to
+// the replicas of their partition, see Query.RequireReplica.
+type replicaRequiringQuery interface {
+	requiredReplicas() []*HostInfo
+}
+
+// replicasOnlyIter returns a NextHost which yields the hosts of next which are
+// in replicas, followed by the replicas next did not yield.
+func replicasOnlyIter(next NextHost, replicas []*HostInfo) NextHost {
+	yielded := make([]bool, len(replicas))
+	return func() SelectedHost {
+		for next != nil {
+			selected := next()
+			if selected == nil {
+				next = nil
+				break
+			}
+			host := selected.Info()
+			if host == nil {
+				continue
+			}
+			for i, replica := range replicas {
+				if !yielded[i] && replica.Equal(host) {
+					yielded[i] = true
+					return selected
+				}
+			}
+		}
+		for i, replica := range replicas {
+			if !yielded[i] {
+				yielded[i] = true
+				return (*selectedHost)(replica)
+			}
+		}
+		return nil
+	}
+}
 
-	// check if the query is not marked as idempotent, if
-	// it is, we force the policy to NonSpeculative
+// singleHostIter returns a NextHost which only yields host.
+func singleHostIter(host *HostInfo) NextHost {
+	used := false
+	return func() SelectedHost {
+		if used {
+			return nil
+		}
+		used = true
+		return (*selectedHost)(host)
+	}
+}
+
+func (q *queryExecutor) executeQuery(qry ExecutableQuery) (iter *Iter, err error) {
+	var hostIter NextHost
+	affinity := coordinatorAffinityFrom(qry.Context(), q.pool.session)
+	if pinned, ok := qry.(hostPinnedQuery); ok && pinned.pinnedHost() != nil {
+		hostIter = singleHostIter(pinned.pinnedHost())
+		affinity = nil
+	} else if coordinator := affinity.pinned(); coordinator != nil {
+		hostIter = singleHostIter(coordinator)
+	} else {
+		hostIter = q.policy.Pick(qry)
+	}
+	if r, ok := qry.(replicaRequiringQuery); ok && r.requiredReplicas() != nil {
+		hostIter = replicasOnlyIter(hostIter, r.requiredReplicas())
+	}
+	if affinity != nil {
+		defer func() {
+			if iter != nil {
+				affinity.executed(iter.host)
+			}
+		}()
+	}
+
+	ctx := qry.Context()
+	if q.inFlight != nil {
+		var done func()
+		ctx, done = q.inFlight.add(ctx, qry)
+		defer done()
+	}
+
+	// check if the query is not marked as idempotent or retries are
+	// disabled, if it is, we force the policy to NonSpeculative
 	sp := qry.speculativeExecutionPolicy()
-	if !qry.IsIdempotent() || sp.Attempts() == 0 {
-		return q.do(qry.Context(), qry, hostIter), nil
+	if !qry.IsIdempotent() || qry.retriesDisabled() || sp.Attempts() == 0 {
+		return q.do(ctx, qry, hostIter), nil
 	}
 
 	// When speculative execution is enabled, we could be accessing the host iterator from multiple goroutines below.
@@ -78,7 +167,7 @@ func (q *queryExecutor) executeQuery(qry ExecutableQuery) (*Iter, error) {
 		return origHostIter()
 	}
 
-	ctx, cancel := context.WithCancel(qry.Context())
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	results := make(chan *Iter, 1)
@@ -116,12 +205,15 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 		}
 
 		pool, ok := q.pool.getPool(host)
+		if ok {
+			pool, ok = pool.named(qry.connectionPool())
+		}
 		if !ok {
 			selectedHost = hostIter()
 			continue
 		}
 
-		conn := pool.Pick()
+		conn := pool.pickFor(qry)
 		if conn == nil {
 			selectedHost = hostIter()
 			continue
@@ -142,7 +234,7 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 
 		// Exit if the query was successful
 		// or no retry policy defined or retry attempts were reached
-		if iter.err == nil || rt == nil || !rt.Attempt(qry) {
+		if iter.err == nil || rt == nil || !attemptRetry(rt, qry, iter.err) {
 			return iter
 		}
 		lastErr = iter.err
@@ -166,11 +258,22 @@ func (q *queryExecutor) do(ctx context.Context, qry ExecutableQuery, hostIter Ne
 
 	if lastErr != nil {
 		return &Iter{err: lastErr}
+	} else if r, ok := qry.(replicaRequiringQuery); ok && r.requiredReplicas() != nil {
+		return &Iter{err: ErrNoReplicaAvailable}
 	}
 
 	return &Iter{err: ErrNoConnections}
 }
 
+// attemptRetry asks rt whether the query failed with err should be attempted
+// again.
+func attemptRetry(rt RetryPolicy, qry ExecutableQuery, err error) bool {
+	if rtErr, ok := rt.(RetryPolicyWithError); ok {
+		return rtErr.AttemptWithError(qry, err)
+	}
+	return rt.Attempt(qry)
+}
+
 func (q *queryExecutor) run(ctx context.Context, qry ExecutableQuery, hostIter NextHost, results chan<- *Iter) {
 	select {
 	case results <- q.do(ctx, qry, hostIter):
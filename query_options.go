@@ -0,0 +1,103 @@
+package gocql
+
+import (
+	"context"
+)
+
+// QueryOption configures a query created by Session.QueryWith. Options are
+// plain values and can be stored and reused to build many queries with the
+// same settings, each option is equivalent to the corresponding Query method.
+type QueryOption func(q *Query)
+
+// QueryWith creates a new query for stmt configured by opts, which are applied
+// in order.
+//
+// Example:
+//
+//	defaults := []gocql.QueryOption{gocql.WithConsistency(gocql.Quorum), gocql.WithIdempotent(true)}
+//	qry := session.QueryWith(`SELECT name FROM users WHERE id = ?`,
+//		append(defaults, gocql.WithValues(id), gocql.WithPageSize(100))...)
+func (s *Session) QueryWith(stmt string, opts ...QueryOption) *Query {
+	qry := s.Query(stmt)
+	for _, opt := range opts {
+		opt(qry)
+	}
+	return qry
+}
+
+// WithValues sets the values bound to the query.
+func WithValues(values ...interface{}) QueryOption {
+	return func(q *Query) {
+		q.Bind(values...)
+	}
+}
+
+// WithConsistency sets the consistency level of the query.
+func WithConsistency(c Consistency) QueryOption {
+	return func(q *Query) {
+		q.Consistency(c)
+	}
+}
+
+// WithSerialConsistency sets the serial consistency level of the query.
+func WithSerialConsistency(cons SerialConsistency) QueryOption {
+	return func(q *Query) {
+		q.SerialConsistency(cons)
+	}
+}
+
+// WithIdempotent marks the query as idempotent or not.
+func WithIdempotent(value bool) QueryOption {
+	return func(q *Query) {
+		q.Idempotent(value)
+	}
+}
+
+// WithPageSize sets the page size of the query.
+func WithPageSize(n int) QueryOption {
+	return func(q *Query) {
+		q.PageSize(n)
+	}
+}
+
+// WithQueryTimestamp sets the default timestamp of the query, in microseconds.
+func WithQueryTimestamp(timestamp int64) QueryOption {
+	return func(q *Query) {
+		q.WithTimestamp(timestamp)
+	}
+}
+
+// WithQueryContext sets the context of the query.
+func WithQueryContext(ctx context.Context) QueryOption {
+	return func(q *Query) {
+		q.context = ctx
+	}
+}
+
+// WithRetryPolicy sets the retry policy of the query.
+func WithRetryPolicy(r RetryPolicy) QueryOption {
+	return func(q *Query) {
+		q.RetryPolicy(r)
+	}
+}
+
+// WithObserver sets the observer of the query.
+func WithObserver(observer QueryObserver) QueryOption {
+	return func(q *Query) {
+		q.Observer(observer)
+	}
+}
+
+// WithPriority sets the admission priority of the query.
+func WithPriority(priority int) QueryOption {
+	return func(q *Query) {
+		q.Priority(priority)
+	}
+}
+
+// WithMetricName sets the name of the query reported to observers.
+func WithMetricName(name string) QueryOption {
+	return func(q *Query) {
+		q.WithMetricName(name)
+	}
+}
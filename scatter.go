@@ -0,0 +1,208 @@
+package gocql
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+const defaultScatterConcurrency = 16
+
+// ScatterReadError is the error of the read of a partition of Session.ScatterRead.
+type ScatterReadError struct {
+	// Index is the index of the routing key in the routing keys passed to
+	// ScatterRead.
+	Index      int
+	RoutingKey []byte
+	Err        error
+}
+
+func (e *ScatterReadError) Error() string {
+	return fmt.Sprintf("gocql: scatter read of routing key %d: %v", e.Index, e.Err)
+}
+
+func (e *ScatterReadError) Unwrap() error {
+	return e.Err
+}
+
+// MergedIter iterates over the rows merged by Session.ScatterRead.
+type MergedIter struct {
+	rows   []map[string]interface{}
+	pos    int
+	errors []*ScatterReadError
+}
+
+// NumRows returns the number of merged rows.
+func (iter *MergedIter) NumRows() int {
+	return len(iter.rows)
+}
+
+// MapScan copies the values of the next row into m, keyed by column name. It
+// returns false once all the rows were read.
+func (iter *MergedIter) MapScan(m map[string]interface{}) bool {
+	if iter.pos >= len(iter.rows) {
+		return false
+	}
+	for column, value := range iter.rows[iter.pos] {
+		m[column] = value
+	}
+	iter.pos++
+	return true
+}
+
+// Errors returns the errors of the partitions which could not be read, ordered
+// by the index of their routing key. Their rows are missing from the results.
+func (iter *MergedIter) Errors() []*ScatterReadError {
+	return iter.errors
+}
+
+// Close returns the error of the first partition which could not be read, if
+// any, see Errors.
+func (iter *MergedIter) Close() error {
+	if len(iter.errors) == 0 {
+		return nil
+	}
+	return iter.errors[0]
+}
+
+// ScatterRead executes stmt once for the partition of every routing key of
+// routingKeys and merges the rows read. A routing key is the serialized
+// partition key, see Query.GetRoutingKey, whose components are bound to the
+// bind markers of stmt, which must only select the partition key columns:
+//
+//	SELECT * FROM events WHERE bucket = ? AND day = ?
+//
+// The reads are executed concurrently, 16 at a time, and routed to a replica of
+// their partition when the session uses a token aware host selection policy.
+// The rows are merged in the order of routingKeys, those of a partition in the
+// order they were read. If dedupKey is not nil, only the first row of the rows
+// with the same dedupKey, for example the primary key of the row, is kept.
+//
+// A partition failing does not stop the other partitions from being read, the
+// partitions which could not be read are reported by MergedIter.Errors. If ctx
+// is done the partitions which were not read yet fail with the context error,
+// which is returned along with the iterator.
+func (s *Session) ScatterRead(ctx context.Context, stmt string, routingKeys [][]byte, dedupKey func(row map[string]interface{}) string) (*MergedIter, error) {
+	if s.Closed() {
+		return nil, ErrSessionClosed
+	}
+
+	info, err := s.routingKeyInfo(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	if info == nil {
+		return nil, errors.New("gocql: scatter read statement has no partition key bind markers")
+	}
+	for i, index := range info.indexes {
+		if index != i {
+			return nil, errors.New("gocql: scatter read statement must only bind the partition key columns, in order")
+		}
+	}
+
+	results := make([][]map[string]interface{}, len(routingKeys))
+	errs := make([]error, len(routingKeys))
+	work := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < defaultScatterConcurrency && i < len(routingKeys); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range work {
+				results[i], errs[i] = s.scatterReadPartition(ctx, stmt, routingKeys[i], len(info.indexes))
+			}
+		}()
+	}
+
+	sent := 0
+feed:
+	for range routingKeys {
+		select {
+		case work <- sent:
+			sent++
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	for i := sent; i < len(routingKeys); i++ {
+		errs[i] = ctx.Err()
+	}
+
+	iter := &MergedIter{}
+	seen := make(map[string]struct{})
+	for i, rows := range results {
+		if errs[i] != nil {
+			iter.errors = append(iter.errors, &ScatterReadError{Index: i, RoutingKey: routingKeys[i], Err: errs[i]})
+			continue
+		}
+		for _, row := range rows {
+			if dedupKey != nil {
+				key := dedupKey(row)
+				if _, ok := seen[key]; ok {
+					continue
+				}
+				seen[key] = struct{}{}
+			}
+			iter.rows = append(iter.rows, row)
+		}
+	}
+	return iter, ctx.Err()
+}
+
+// scatterReadPartition reads the rows of the partition of routingKey, which
+// has n components.
+func (s *Session) scatterReadPartition(ctx context.Context, stmt string, routingKey []byte, n int) ([]map[string]interface{}, error) {
+	components, err := splitRoutingKey(routingKey, n)
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, n)
+	for i, component := range components {
+		values[i] = marshaledValue(component)
+	}
+
+	qry := s.Query(stmt, values...).WithContext(ctx).RoutingKey(routingKey)
+	defer qry.Release()
+	iter := qry.Iter()
+	rows, err := iter.SliceMap()
+	if closeErr := iter.Close(); err == nil {
+		err = closeErr
+	}
+	return rows, err
+}
+
+// splitRoutingKey returns the serialized values of the n partition key columns
+// of routingKey, see createRoutingKey.
+func splitRoutingKey(routingKey []byte, n int) ([][]byte, error) {
+	if n == 1 {
+		return [][]byte{routingKey}, nil
+	}
+
+	components := make([][]byte, 0, n)
+	for data := routingKey; len(data) > 0; {
+		if len(data) < 2 {
+			return nil, errors.New("gocql: malformed composite routing key")
+		}
+		size := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+size+1 {
+			return nil, errors.New("gocql: malformed composite routing key")
+		}
+		components = append(components, data[2:2+size])
+		data = data[2+size+1:]
+	}
+	if len(components) != n {
+		return nil, fmt.Errorf("gocql: composite routing key has %d components, expected %d", len(components), n)
+	}
+	return components, nil
+}
+
+// marshaledValue is a value which is already serialized.
+type marshaledValue []byte
+
+func (v marshaledValue) MarshalCQL(info TypeInfo) ([]byte, error) {
+	return v, nil
+}
@@ -0,0 +1,85 @@
+package gocql
+
+import (
+	"math/bits"
+	"strconv"
+)
+
+const (
+	scyllaShardingAlgorithm  = "biased-token-round-robin"
+	scyllaMurmur3Partitioner = "org.apache.cassandra.dht.Murmur3Partitioner"
+)
+
+// scyllaSharding is the shard of a connection to a Scylla host, as advertised
+// by the host in its SUPPORTED options.
+type scyllaSharding struct {
+	shard    int
+	nrShards int
+	// ignoreMSB is the number of most significant bits of the tokens ignored
+	// to compute their shard.
+	ignoreMSB uint
+}
+
+// parseScyllaSharding returns the sharding of a connection from the SUPPORTED
+// options of the host, its number of shards is 0 if the host doesn't advertise
+// it or uses a sharding algorithm or partitioner gocql doesn't know.
+func parseScyllaSharding(supported map[string][]string) scyllaSharding {
+	option := func(name string) string {
+		if values := supported[name]; len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+	if option("SCYLLA_SHARDING_ALGORITHM") != scyllaShardingAlgorithm {
+		return scyllaSharding{}
+	}
+	if partitioner := option("SCYLLA_PARTITIONER"); partitioner != "" && partitioner != scyllaMurmur3Partitioner {
+		return scyllaSharding{}
+	}
+	shard, err := strconv.Atoi(option("SCYLLA_SHARD"))
+	if err != nil {
+		return scyllaSharding{}
+	}
+	nrShards, err := strconv.Atoi(option("SCYLLA_NR_SHARDS"))
+	if err != nil || nrShards < 1 || shard < 0 || shard >= nrShards {
+		return scyllaSharding{}
+	}
+	ignoreMSB, err := strconv.ParseUint(option("SCYLLA_SHARDING_IGNORE_MSB"), 10, 8)
+	if err != nil || ignoreMSB >= 64 {
+		return scyllaSharding{}
+	}
+	return scyllaSharding{shard: shard, nrShards: nrShards, ignoreMSB: uint(ignoreMSB)}
+}
+
+// shardOf returns the shard owning the murmur3 token on a host with s.nrShards
+// shards, see the biased-token-round-robin algorithm of Scylla.
+func (s scyllaSharding) shardOf(token int64) int {
+	biased := uint64(token) + 1<<63
+	biased <<= s.ignoreMSB
+	hi, _ := bits.Mul64(biased, uint64(s.nrShards))
+	return int(hi)
+}
+
+// owns reports whether the connection of s is to the shard owning the murmur3
+// token.
+func (s scyllaSharding) owns(token int64) bool {
+	return s.nrShards > 1 && s.shardOf(token) == s.shard
+}
+
+// pickFor picks a connection of the pool for qry. On Scylla hosts the queries
+// whose routing key is already known, because it was set with RoutingKey or
+// computed by a token aware host selection policy, are sent to a connection to
+// the shard owning their partition when it has streams available. The shard is
+// computed with the number of shards reported by the connection. Other queries
+// are sent to the least busy connection, as with Pick.
+func (pool *hostConnPool) pickFor(qry ExecutableQuery) *Conn {
+	if pool.host.ScyllaShardCount() <= 1 {
+		return pool.Pick()
+	}
+	routingKey := qry.knownRoutingKey()
+	if routingKey == nil {
+		return pool.Pick()
+	}
+	token := int64(murmur3Partitioner{}.Hash(routingKey).(murmur3Token))
+	return pool.picked(pool.pick(token, true))
+}
@@ -12,6 +12,9 @@ import (
 	"fmt"
 	"io"
 	"net"
+	"reflect"
+	"regexp"
+	"sort"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -41,10 +44,16 @@ type Session struct {
 	batchObserver       BatchObserver
 	connectObserver     ConnectObserver
 	frameObserver       FrameHeaderObserver
+	rawFrameObserver    FrameObserver
 	streamObserver      StreamObserver
 	hostSource          *ringDescriber
 	ringRefresher       *refreshDebouncer
 	stmtsLRU            *preparedLRU
+	stmtExecCounts      *stmtExecCounter
+	conditionalStmts    conditionalStmtLRU
+	admission           *admissionController
+	connEvents          *connEventLog
+	prepareFanOut       chan struct{}
 
 	connCfg *ConnConfig
 
@@ -72,6 +81,20 @@ type Session struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// queryCtx is the context of queries and batches without one, derived from
+	// ClusterConfig.BaseContext, and canceled by queryCancel on Close.
+	queryCtx    context.Context
+	queryCancel context.CancelFunc
+
+	// inFlight tracks the queries and batches being executed.
+	inFlight inFlightQueries
+
+	// serverTimeoutWarning logs once that Query.ServerTimeout is not supported.
+	serverTimeoutWarning sync.Once
+	// compressionWarning logs once that a host does not support the
+	// configured compressor.
+	compressionWarning sync.Once
+
 	// sessionStateMu protects isClosed and isInitialized.
 	sessionStateMu sync.RWMutex
 	// isClosed is true once Session.Close is finished.
@@ -98,7 +121,8 @@ func addrsToHosts(addrs []string, defaultPort int, logger StdLogger) ([]*HostInf
 		if err != nil {
 			// Try other hosts if unable to resolve DNS name
 			if _, ok := err.(*net.DNSError); ok {
-				logger.Printf("gocql: dns error: %v\n", err)
+				logEvent(logger, LogLevelWarn, "dns error", []LogField{{"address", hostaddr}, {"error", err}},
+					"gocql: dns error: %v\n", err)
 				continue
 			}
 			return nil, err
@@ -124,6 +148,26 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		return nil, errors.New("Can't use both Authenticator and AuthProvider in cluster config.")
 	}
 
+	if cfg.ProtoVersionRange.isSet() {
+		if err := cfg.ProtoVersionRange.validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, size := range cfg.ConnectionPools {
+		if name == "" || size < 1 {
+			return nil, fmt.Errorf("gocql: connection pool %q must have a name and at least one connection", name)
+		}
+	}
+
+	var queryCtx context.Context
+	if cfg.BaseContext != nil {
+		queryCtx = cfg.BaseContext()
+		if queryCtx == nil {
+			return nil, errors.New("gocql: ClusterConfig.BaseContext returned a nil context")
+		}
+	}
+
 	// TODO: we should take a context in here at some point
 	ctx, cancel := context.WithCancel(context.TODO())
 
@@ -132,12 +176,33 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		prefetch:        0.25,
 		cfg:             cfg,
 		pageSize:        cfg.PageSize,
-		stmtsLRU:        &preparedLRU{lru: lru.New(cfg.MaxPreparedStmts)},
+		stmtsLRU:        newPreparedLRU(&cfg),
 		connectObserver: cfg.ConnectObserver,
 		ctx:             ctx,
 		cancel:          cancel,
 		logger:          cfg.logger(),
 	}
+	s.stmtExecCounts = &stmtExecCounter{
+		lru:        lru.New(cfg.MaxPreparedStmts),
+		normalized: s.stmtsLRU.normalized,
+	}
+
+	if queryCtx != nil {
+		s.queryCtx, s.queryCancel = context.WithCancel(queryCtx)
+	}
+	if cfg.MaxConcurrentQueries > 0 {
+		s.admission = newAdmissionController(cfg.MaxConcurrentQueries, cfg.QueryPriorityAging)
+	}
+	if cfg.ConnEventLogSize > 0 {
+		s.connEvents = newConnEventLog(cfg.ConnEventLogSize)
+	}
+	if cfg.PrepareOnAllHosts {
+		concurrency := cfg.PrepareOnAllHostsConcurrency
+		if concurrency < 1 {
+			concurrency = defaultPrepareOnAllHostsConcurrency
+		}
+		s.prepareFanOut = make(chan struct{}, concurrency)
+	}
 
 	s.schemaDescriber = newSchemaDescriber(s)
 
@@ -145,6 +210,7 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 	s.schemaEvents = newEventDebouncer("SchemaEvents", s.handleSchemaEvent, s.logger)
 
 	s.routingKeyInfoCache.lru = lru.New(cfg.MaxRoutingKeyInfo)
+	s.conditionalStmts.lru = lru.New(cfg.MaxRoutingKeyInfo)
 
 	s.hostSource = &ringDescriber{session: s}
 	s.ringRefresher = newRefreshDebouncer(ringRefreshDebounceTime, func() error { return refreshRing(s.hostSource) })
@@ -161,11 +227,15 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 		pool:   s.pool,
 		policy: cfg.PoolConfig.HostSelectionPolicy,
 	}
+	if cfg.TrackInFlightQueries {
+		s.executor.inFlight = &s.inFlight
+	}
 
 	s.queryObserver = cfg.QueryObserver
 	s.batchObserver = cfg.BatchObserver
 	s.connectObserver = cfg.ConnectObserver
 	s.frameObserver = cfg.FrameHeaderObserver
+	s.rawFrameObserver = cfg.FrameObserver
 	s.streamObserver = cfg.StreamObserver
 
 	//Check the TLS Config before trying to connect to anything external
@@ -184,7 +254,7 @@ func NewSession(cfg ClusterConfig) (*Session, error) {
 			return nil, ErrNoConnectionsStarted
 		} else {
 			// TODO(zariel): dont wrap this error in fmt.Errorf, return a typed error
-			return nil, fmt.Errorf("gocql: unable to create session: %v", err)
+			return nil, fmt.Errorf("gocql: unable to create session: %w", err)
 		}
 	}
 
@@ -202,23 +272,38 @@ func (s *Session) init() error {
 
 	if !s.cfg.disableControlConn {
 		s.control = createControlConn(s)
+		// the protocol version is discovered and the control connection opened
+		// trying the hosts in the same order
+		seeds := s.cfg.ControlConnectionSeedStrategy.order(hosts)
 		if s.cfg.ProtoVersion == 0 {
-			proto, err := s.control.discoverProtocol(hosts)
+			versions := s.cfg.ProtoVersionRange
+			if !versions.isSet() {
+				versions = ProtoVersionRange{Min: protoVersion1, Max: protoVersion4}
+			}
+			proto, err := s.control.discoverProtocol(seeds, versions)
 			if err != nil {
-				return fmt.Errorf("unable to discover protocol version: %v", err)
+				return fmt.Errorf("unable to discover protocol version: %w", err)
 			} else if proto == 0 {
 				return errors.New("unable to discovery protocol version")
 			}
+			logf(s.logger, LogLevelInfo, "gocql: negotiated protocol version %d from range [%d, %d]\n",
+				proto, versions.Min, versions.Max)
 
 			// TODO(zariel): we really only need this in 1 place
 			s.cfg.ProtoVersion = proto
 			s.connCfg.ProtoVersion = proto
 		}
 
-		if err := s.control.connect(hosts); err != nil {
+		if err := s.control.connect(seeds); err != nil {
 			return err
 		}
 
+		if s.cfg.VerifyKeyspaceOnConnect && s.cfg.Keyspace != "" {
+			if err := s.verifyKeyspace(s.cfg.Keyspace); err != nil {
+				return err
+			}
+		}
+
 		if !s.cfg.DisableInitialHostLookup {
 			var partitioner string
 			newHosts, partitioner, err := s.hostSource.GetHosts()
@@ -321,6 +406,10 @@ func (s *Session) init() error {
 		go s.reconnectDownedHosts(s.cfg.ReconnectInterval)
 	}
 
+	if s.cfg.DNSRefreshInterval > 0 {
+		go s.refreshSeedHosts(s.cfg.DNSRefreshInterval)
+	}
+
 	// If we disable the initial host lookup, we need to still check if the
 	// cluster is using the newer system schema or not... however, if control
 	// connection is disable, we really have no choice, so we just make our
@@ -347,6 +436,19 @@ func (s *Session) init() error {
 		s.policy.KeyspaceChanged(keyspaceUpdate)
 	}
 
+	if !s.cfg.disableControlConn && s.cfg.MaxSchemaAgreementWait > 0 {
+		err := s.control.withConn(func(conn *Conn) *Iter {
+			return &Iter{err: conn.awaitSchemaAgreementWithin(s.ctx, s.cfg.MaxSchemaAgreementWait)}
+		}).err
+		if err != nil {
+			if s.cfg.RequireSchemaAgreement {
+				return fmt.Errorf("gocql: schema agreement not reached on connect: %w", err)
+			}
+			logEvent(s.logger, LogLevelWarn, "schema agreement not reached on connect", []LogField{{"error", err}},
+				"gocql: schema agreement not reached on connect: %v\n", err)
+		}
+	}
+
 	s.sessionStateMu.Lock()
 	s.isInitialized = true
 	s.sessionStateMu.Unlock()
@@ -354,6 +456,23 @@ func (s *Session) init() error {
 	return nil
 }
 
+// verifyKeyspace checks that keyspace exists using the control connection.
+func (s *Session) verifyKeyspace(keyspace string) error {
+	keyspaces, err := getKeyspaceNames(s)
+	if err != nil {
+		return fmt.Errorf("unable to verify keyspace %q: %v", keyspace, err)
+	}
+
+	for _, name := range keyspaces {
+		if name == keyspace {
+			return nil
+		}
+	}
+
+	sort.Strings(keyspaces)
+	return &ErrKeyspaceNotFound{Keyspace: keyspace, Available: keyspaces}
+}
+
 // AwaitSchemaAgreement will wait until schema versions across all nodes in the
 // cluster are the same (as seen from the point of view of the control connection).
 // The maximum amount of time this takes is governed
@@ -369,6 +488,97 @@ func (s *Session) AwaitSchemaAgreement(ctx context.Context) error {
 	}).err
 }
 
+// SchemaAgreed reports whether all nodes in the cluster currently report the
+// same schema version, as seen from the point of view of the control
+// connection.
+func (s *Session) SchemaAgreed() (bool, error) {
+	if s.cfg.disableControlConn {
+		return false, errNoControl
+	}
+	var versions []string
+	err := s.control.withConn(func(conn *Conn) *Iter {
+		var err error
+		versions, err = conn.schemaVersions(context.TODO())
+		return &Iter{err: err}
+	}).err
+	if err != nil {
+		return false, err
+	}
+	return len(versions) <= 1, nil
+}
+
+// CheckSchemaAgreementAllHosts reads the schema version of every host which is
+// up from its own system.local table, in parallel, rather than from the tables
+// of the control connection host. versions maps the address of each host to its
+// schema version, agreed reports whether they are all the same. If the version
+// of a host can't be read the error is returned along with the versions of the
+// other hosts, and agreed is false.
+func (s *Session) CheckSchemaAgreementAllHosts(ctx context.Context) (agreed bool, versions map[string]string, err error) {
+	if s.Closed() {
+		return false, nil, ErrSessionClosed
+	}
+
+	var hosts []*HostInfo
+	for _, host := range s.ring.allHosts() {
+		if host.IsUp() {
+			hosts = append(hosts, host)
+		}
+	}
+	if len(hosts) == 0 {
+		return false, nil, ErrNoConnections
+	}
+	return checkSchemaAgreement(ctx, hosts, s.localSchemaVersion)
+}
+
+// localSchemaVersion reads the schema version of host from its system.local
+// table.
+func (s *Session) localSchemaVersion(ctx context.Context, host *HostInfo) (string, error) {
+	var version UUID
+	err := s.Query("SELECT schema_version FROM system.local WHERE key='local'").
+		WithContext(ctx).
+		Consistency(One).
+		RoutingToHost(host).
+		Idempotent(true).
+		Scan(&version)
+	if err != nil {
+		return "", err
+	}
+	return version.String(), nil
+}
+
+func checkSchemaAgreement(ctx context.Context, hosts []*HostInfo,
+	read func(ctx context.Context, host *HostInfo) (string, error)) (bool, map[string]string, error) {
+	type result struct {
+		host    *HostInfo
+		version string
+		err     error
+	}
+	results := make(chan result, len(hosts))
+	for _, host := range hosts {
+		go func(host *HostInfo) {
+			version, err := read(ctx, host)
+			results <- result{host: host, version: version, err: err}
+		}(host)
+	}
+
+	versions := make(map[string]string, len(hosts))
+	distinct := make(map[string]struct{})
+	var err error
+	for range hosts {
+		res := <-results
+		addr := res.host.ConnectAddress().String()
+		if res.err != nil {
+			if err == nil {
+				err = fmt.Errorf("gocql: reading the schema version of host %s: %w", addr, res.err)
+			}
+			continue
+		}
+		versions[addr] = res.version
+		distinct[res.version] = struct{}{}
+	}
+	return err == nil && len(distinct) == 1, versions, err
+}
+
 func (s *Session) reconnectDownedHosts(intv time.Duration) {
 	reconnectTicker := time.NewTicker(intv)
 	defer reconnectTicker.Stop()
@@ -384,7 +594,7 @@ func (s *Session) reconnectDownedHosts(intv time.Duration) {
 				for _, h := range hosts {
 					buf.WriteString("[" + h.ConnectAddress().String() + ":" + h.State().String() + "]")
 				}
-				s.logger.Println(buf.String())
+				logf(s.logger, LogLevelDebug, "%s\n", buf.String())
 			}
 
 			for _, h := range hosts {
@@ -392,7 +602,7 @@ func (s *Session) reconnectDownedHosts(intv time.Duration) {
 					continue
 				}
 				// we let the pool call handleNodeConnected to change the host state
-				s.pool.addHost(h)
+				s.staggerReconnect(h, s.pool.addHost)
 			}
 		case <-s.ctx.Done():
 			return
@@ -400,6 +610,105 @@ func (s *Session) reconnectDownedHosts(intv time.Duration) {
 	}
 }
 
+// refreshSeedHosts periodically re-resolves the configured contact points so
+// that seed hostnames whose backing addresses change keep working.
+func (s *Session) refreshSeedHosts(intv time.Duration) {
+	refreshTicker := time.NewTicker(intv)
+	defer refreshTicker.Stop()
+
+	for {
+		select {
+		case <-refreshTicker.C:
+			s.reconcileSeedHosts()
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// reconcileSeedHosts resolves cfg.Hosts again and replaces the ring endpoints
+// with the result. When the ring is made up only of the contact points (no host
+// discovery through the control connection), hosts for newly resolved
+// addresses are added and hosts whose addresses are no longer resolved are
+// removed. Otherwise the hosts are those the cluster reports, a contact point
+// may be any node of the cluster, so when the resolved addresses changed the
+// ring is refreshed from the control connection instead, which adds and
+// removes the hosts the same way.
+func (s *Session) reconcileSeedHosts() {
+	resolved, err := addrsToHosts(s.cfg.Hosts, s.cfg.Port, s.logger)
+	if err != nil {
+		logf(s.logger, LogLevelWarn, "gocql: unable to re-resolve contact points: %v\n", err)
+		return
+	}
+
+	s.ring.mu.Lock()
+	previous := s.ring.endpoints
+	s.ring.endpoints = resolved
+	s.ring.mu.Unlock()
+
+	known := make(map[string]*HostInfo)
+	for _, host := range s.ring.allHosts() {
+		known[host.ConnectAddressAndPort()] = host
+	}
+
+	if s.control != nil && !s.cfg.DisableInitialHostLookup {
+		if seedsChanged(previous, resolved) {
+			if err := s.refreshRing(); err != nil {
+				logf(s.logger, LogLevelWarn, "gocql: unable to refresh ring after re-resolving contact points: %v\n", err)
+			}
+		}
+		return
+	}
+
+	current := make(map[string]struct{}, len(resolved))
+	for _, host := range resolved {
+		addr := host.ConnectAddressAndPort()
+		current[addr] = struct{}{}
+		if _, ok := known[addr]; ok || s.cfg.filterHost(host) {
+			continue
+		}
+
+		if len(host.HostID()) == 0 {
+			host.SetHostID(MustRandomUUID().String())
+		}
+		if _, exists := s.ring.addHostIfMissing(host); !exists {
+			if gocqlDebug {
+				logf(s.logger, LogLevelInfo, "gocql: adding re-resolved contact point %s\n", addr)
+			}
+			s.startPoolFill(host)
+		}
+	}
+
+	for _, endpoint := range previous {
+		addr := endpoint.ConnectAddressAndPort()
+		if _, ok := current[addr]; ok {
+			continue
+		}
+		if host, ok := known[addr]; ok {
+			if gocqlDebug {
+				logf(s.logger, LogLevelInfo, "gocql: removing contact point %s which no longer resolves\n", addr)
+			}
+			s.removeHost(host)
+		}
+	}
+}
+
+// seedsChanged reports whether the addresses of previous and resolved differ.
+func seedsChanged(previous, resolved []*HostInfo) bool {
+	addrs := make(map[string]struct{}, len(previous))
+	for _, host := range previous {
+		addrs[host.ConnectAddressAndPort()] = struct{}{}
+	}
+	for _, host := range resolved {
+		addr := host.ConnectAddressAndPort()
+		if _, ok := addrs[addr]; !ok {
+			return true
+		}
+		delete(addrs, addr)
+	}
+	return len(addrs) > 0
+}
+
 // SetConsistency sets the default consistency level for this session. This
 // setting can also be changed on a per-query basis and the default value
 // is Quorum.
@@ -417,6 +726,47 @@ func (s *Session) SetPageSize(n int) {
 	s.mu.Unlock()
 }
 
+type preparedMode uint8
+
+const (
+	prepareAuto preparedMode = iota
+	prepareAlways
+	prepareNever
+)
+
+// Priority sets the priority of the query when waiting to be admitted because
+// ClusterConfig.MaxConcurrentQueries are executing. Queries with a higher
+// priority are admitted first, the default priority is 0.
+func (q *Query) Priority(priority int) *Query {
+	q.priority = priority
+	return q
+}
+
+// WithConnectionPool executes the query on the connections of the pool name of
+// ClusterConfig.ConnectionPools, the default pool is used if name is empty. The
+// query fails if there is no such pool.
+func (q *Query) WithConnectionPool(name string) *Query {
+	q.connPool = name
+	return q
+}
+
+func (q *Query) connectionPool() string {
+	return q.connPool
+}
+
+// Prepared forces (true) or skips (false) preparing the statement of this query,
+// overriding the statement type check and ClusterConfig.AutoPrepareThreshold.
+// Values can only be bound to prepared statements, so executing a query with
+// values that is not prepared returns an error.
+func (q *Query) Prepared(prepared bool) *Query {
+	if prepared {
+		q.prepared = prepareAlways
+	} else {
+		q.prepared = prepareNever
+	}
+	return q
+}
+
 // SetPrefetch sets the default threshold for pre-fetching new pages. If
 // there are only p*pageSize rows remaining, the next page will be requested
 // automatically. This value can also be changed on a per-query basis and
@@ -482,6 +832,11 @@ func (s *Session) Close() {
 	s.isClosing = true
 	s.sessionStateMu.Unlock()
 
+	if s.queryCancel != nil {
+		// abort the in flight queries
+		s.queryCancel()
+	}
+
 	if s.pool != nil {
 		s.pool.Close()
 	}
@@ -502,6 +857,8 @@ func (s *Session) Close() {
 		s.ringRefresher.stop()
 	}
 
+	s.metaMngr.stop()
+
 	if s.cancel != nil {
 		s.cancel()
 	}
@@ -511,6 +868,14 @@ func (s *Session) Close() {
 	s.sessionStateMu.Unlock()
 }
 
+// defaultContext returns the context of queries and batches without one.
+func (s *Session) defaultContext() context.Context {
+	if s == nil || s.queryCtx == nil {
+		return context.Background()
+	}
+	return s.queryCtx
+}
+
 func (s *Session) Closed() bool {
 	s.sessionStateMu.RLock()
 	closed := s.isClosed
@@ -518,6 +883,12 @@ func (s *Session) Closed() bool {
 	return closed
 }
 
+// ProtocolVersion returns the native protocol version used by the session's
+// connections, either as configured or as negotiated when the session was created.
+func (s *Session) ProtocolVersion() int {
+	return s.cfg.ProtoVersion
+}
+
 func (s *Session) initialized() bool {
 	s.sessionStateMu.RLock()
 	initialized := s.isInitialized
@@ -531,6 +902,47 @@ func (s *Session) executeQuery(qry *Query) (it *Iter) {
 		return &Iter{err: ErrSessionClosed}
 	}
 
+	if s.cfg.WarnOnFullTableAggregate && isFullTableAggregate(qry.stmt) {
+		logEvent(s.logger, LogLevelWarn, "aggregate query without a partition key restriction will scan the whole table",
+			[]LogField{{"keyspace", qry.Keyspace()}, {"statement", qry.stmt}},
+			"gocql: aggregate query without a partition key restriction will scan the whole table: %q\n", qry.stmt)
+	}
+
+	if qry.observer != nil && qry.metricName == "" && qry.fingerprint == "" {
+		// computed once rather than on every attempt and page
+		qry.fingerprint = statementFingerprint(qry.stmt, false)
+	}
+
+	if qry.strictRouting {
+		if err := qry.checkRoutingKeyBound(); err != nil {
+			return &Iter{err: err}
+		}
+	}
+
+	if qry.requireReplica {
+		replicas, err := s.upReplicasOf(qry)
+		if err != nil {
+			return &Iter{err: err}
+		}
+		qry.replicas = replicas
+	}
+
+	if err := s.checkConnectionPool(qry.connPool); err != nil {
+		return &Iter{err: err}
+	}
+
+	if len(qry.consistencyChain) > 0 {
+		// every execution starts at the first level of the chain
+		qry.cons = qry.consistencyChain[0]
+	}
+
+	if s.admission != nil {
+		if err := s.admission.acquire(qry.Context(), qry.priority); err != nil {
+			return &Iter{err: err}
+		}
+		defer s.admission.release()
+	}
+
 	iter, err := s.executor.executeQuery(qry)
 	if err != nil {
 		return &Iter{err: err}
@@ -542,6 +954,18 @@ func (s *Session) executeQuery(qry *Query) (it *Iter) {
 	return iter
 }
 
+// checkConnectionPool returns an error if name is not empty and not the name
+// of a pool of ClusterConfig.ConnectionPools.
+func (s *Session) checkConnectionPool(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := s.cfg.ConnectionPools[name]; !ok {
+		return fmt.Errorf("gocql: unknown connection pool %q", name)
+	}
+	return nil
+}
+
 func (s *Session) removeHost(h *HostInfo) {
 	s.metaMngr.removeHost(h)
 	s.policy.RemoveHost(h)
@@ -568,6 +992,257 @@ func (s *Session) ClusterMetadata() *ClusterMetadata {
 	return s.metaMngr.getMetadataReadOnly()
 }
 
+// RefreshMetadata reads again the hosts of the cluster with their tokens, the
+// partitioner and the schema of the keyspaces whose metadata is cached, then
+// rebuilds the token ring and the replicas of the keyspaces queries are routed
+// to. Unlike the refreshes triggered by events it is synchronous and returns
+// the errors encountered, it is meant to be used after changes the session was
+// not notified of, such as schema changes made by other tools, so that they
+// are seen immediately.
+func (s *Session) RefreshMetadata(ctx context.Context) error {
+	if s.Closed() {
+		return ErrSessionClosed
+	} else if s.cfg.disableControlConn {
+		return errors.New("gocql: metadata can't be refreshed without a control connection")
+	}
+
+	select {
+	case err, ok := <-s.ringRefresher.refreshNow():
+		if !ok {
+			return errors.New("gocql: could not refresh the hosts because the session is closing")
+		} else if err != nil {
+			return fmt.Errorf("gocql: refreshing the hosts: %w", err)
+		}
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	if err := s.schemaDescriber.refreshCached(ctx); err != nil {
+		return err
+	}
+	s.metaMngr.rebuild()
+	return nil
+}
+
+// upReplicasOf returns the replicas of the partition of qry which are up, it
+// fails with ErrNoReplicaAvailable if there are none.
+func (s *Session) upReplicasOf(qry *Query) ([]*HostInfo, error) {
+	routingKey, err := qry.GetRoutingKey()
+	if err != nil {
+		return nil, err
+	} else if routingKey == nil {
+		return nil, fmt.Errorf("%w: the routing key of the query is unknown", ErrNoReplicaAvailable)
+	}
+	replicas, err := s.ReplicasFor(routingKeyspaceOf(qry), routingKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoReplicaAvailable, err)
+	}
+
+	up := replicas[:0]
+	for _, host := range replicas {
+		if host.IsUp() {
+			up = append(up, host)
+		}
+	}
+	if len(up) == 0 {
+		return nil, ErrNoReplicaAvailable
+	}
+	return up, nil
+}
+
+// ReplicasFor returns the replicas of the partition with the given routing key
+// in keyspace, according to the token ring and the keyspace's replication strategy.
+func (s *Session) ReplicasFor(keyspace string, routingKey []byte) ([]*HostInfo, error) {
+	meta := s.metaMngr.getMetadataReadOnly()
+	if meta == nil || meta.tokenRing == nil {
+		return nil, errors.New("gocql: token ring is not available")
+	}
+
+	replicas, ok := meta.replicas[keyspace]
+	if !ok {
+		ks, err := s.KeyspaceMetadata(keyspace)
+		if err != nil {
+			return nil, err
+		}
+		strat := getStrategy(ks, s.logger)
+		if strat == nil {
+			return nil, fmt.Errorf("gocql: unsupported replication strategy %q for keyspace %q", ks.StrategyClass, keyspace)
+		}
+		replicas = strat.replicaMap(meta.tokenRing)
+	}
+
+	token := meta.tokenRing.partitioner.Hash(routingKey)
+	if ht := replicas.replicasFor(token); ht != nil {
+		hosts := make([]*HostInfo, len(ht.hosts))
+		copy(hosts, ht.hosts)
+		return hosts, nil
+	}
+
+	host, _ := meta.tokenRing.HostForToken(token)
+	if host == nil {
+		return nil, fmt.Errorf("gocql: no host owns token %v", token)
+	}
+	return []*HostInfo{host}, nil
+}
+
+// WriteThenRead executes write and then read on the same replica, so that the
+// read observes the write. Both queries must target the same partition, ie.
+// have routing keys with the same token, otherwise an error is returned; the
+// routing keys are only known for prepared statements unless set explicitly.
+//
+// Both queries are pinned to the first replica of the partition which is up.
+// If the consistency levels of write and read don't guarantee that the read
+// overlaps with the replicas which acknowledged the write they are raised:
+// write LOCAL_QUORUM or EACH_QUORUM is paired with a LOCAL_QUORUM read,
+// otherwise both use QUORUM.
+//
+// The returned iter is for read, errors of the write are returned directly.
+func (s *Session) WriteThenRead(ctx context.Context, write, read *Query) (*Iter, error) {
+	writeKey, err := write.GetRoutingKey()
+	if err != nil {
+		return nil, err
+	}
+	readKey, err := read.GetRoutingKey()
+	if err != nil {
+		return nil, err
+	}
+	if writeKey == nil || readKey == nil {
+		return nil, errors.New("gocql: routing key of the write and read queries is required")
+	}
+
+	keyspace := write.Keyspace()
+	if readKeyspace := read.Keyspace(); readKeyspace != keyspace {
+		return nil, fmt.Errorf("gocql: write and read queries use different keyspaces: %q and %q", keyspace, readKeyspace)
+	}
+
+	meta := s.metaMngr.getMetadataReadOnly()
+	if meta == nil || meta.tokenRing == nil {
+		return nil, errors.New("gocql: token ring is not available")
+	}
+	writeToken := meta.tokenRing.partitioner.Hash(writeKey)
+	readToken := meta.tokenRing.partitioner.Hash(readKey)
+	if writeToken.Less(readToken) || readToken.Less(writeToken) {
+		return nil, fmt.Errorf("gocql: write and read queries target different tokens: %v and %v", writeToken, readToken)
+	}
+
+	replicas, err := s.ReplicasFor(keyspace, writeKey)
+	if err != nil {
+		return nil, err
+	}
+	var host *HostInfo
+	for _, replica := range replicas {
+		if replica.IsUp() {
+			host = replica
+			break
+		}
+	}
+	if host == nil {
+		return nil, fmt.Errorf("gocql: no replica of token %v is up", writeToken)
+	}
+
+	writeCons, readCons := readYourWritesConsistency(write.GetConsistency(), read.GetConsistency())
+	if err := write.WithContext(ctx).Consistency(writeCons).RoutingToHost(host).Exec(); err != nil {
+		return nil, err
+	}
+
+	iter := read.WithContext(ctx).Consistency(readCons).RoutingToHost(host).Iter()
+	if iter.err != nil {
+		return nil, iter.Close()
+	}
+	return iter, nil
+}
+
+// readYourWritesConsistency returns the consistency levels of a write and a
+// following read on the same coordinator such that the replicas read overlap
+// with the replicas which acknowledged the write.
+func readYourWritesConsistency(write, read Consistency) (Consistency, Consistency) {
+	switch {
+	case write == All || read == All:
+		return write, read
+	case (write == Quorum || write == EachQuorum) && read == Quorum:
+		return write, read
+	case (write == LocalQuorum || write == EachQuorum) && read == LocalQuorum:
+		// the coordinator is the same, so is its datacenter
+		return write, read
+	case write == LocalQuorum || write == EachQuorum:
+		return write, LocalQuorum
+	default:
+		return Quorum, Quorum
+	}
+}
+
+// ReplicaErrors maps the host IDs of replicas which could not be queried to the reason.
+type ReplicaErrors map[string]error
+
+func (e ReplicaErrors) Error() string {
+	hostIDs := make([]string, 0, len(e))
+	for hostID := range e {
+		hostIDs = append(hostIDs, hostID)
+	}
+	sort.Strings(hostIDs)
+
+	var b strings.Builder
+	b.WriteString("gocql: unable to query replicas:")
+	for _, hostID := range hostIDs {
+		fmt.Fprintf(&b, " %s: %v;", hostID, e[hostID])
+	}
+	return b.String()
+}
+
+// ReadFromEachReplica executes stmt at consistency ONE once on every replica of the
+// partition identified by routingKey, which is useful to compare what each replica
+// returns when verifying or repairing data. The keyspace used to find the replicas is
+// taken from the prepared statement, or the session keyspace if it can not be determined.
+//
+// The returned map is keyed by host ID. Errors of individual queries are returned by
+// the iterators as usual. Replicas which are down are included with a nil iterator
+// and are reported in the returned ReplicaErrors.
+func (s *Session) ReadFromEachReplica(ctx context.Context, stmt string, routingKey []byte,
+	values ...interface{}) (map[string]*Iter, error) {
+	keyspace := s.cfg.Keyspace
+	if info, err := s.routingKeyInfo(ctx, stmt); err == nil && info != nil && info.keyspace != "" {
+		keyspace = info.keyspace
+	}
+
+	replicas, err := s.ReplicasFor(keyspace, routingKey)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results = make(map[string]*Iter, len(replicas))
+		errs    = make(ReplicaErrors)
+	)
+	for _, host := range replicas {
+		if !host.IsUp() {
+			mu.Lock()
+			results[host.HostID()] = nil
+			errs[host.HostID()] = fmt.Errorf("replica %s is down", host.ConnectAddress())
+			mu.Unlock()
+			continue
+		}
+
+		wg.Add(1)
+		go func(host *HostInfo) {
+			defer wg.Done()
+			iter := s.Query(stmt, values...).WithContext(ctx).Consistency(One).
+				RoutingKey(routingKey).RoutingToHost(host).Iter()
+
+			mu.Lock()
+			results[host.HostID()] = iter
+			mu.Unlock()
+		}(host)
+	}
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return results, errs
+	}
+	return results, nil
+}
+
 func (s *Session) getConn() *Conn {
 	hosts := s.ring.allHosts()
 	for _, host := range hosts {
@@ -651,13 +1326,16 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 	if len(info.request.pkeyColumns) > 0 {
 		// proto v4 dont need to calculate primary key columns
 		types := make([]TypeInfo, len(info.request.pkeyColumns))
+		columns := make([]string, len(info.request.pkeyColumns))
 		for i, col := range info.request.pkeyColumns {
 			types[i] = info.request.columns[col].TypeInfo
+			columns[i] = info.request.columns[col].Name
 		}
 
 		routingKeyInfo := &routingKeyInfo{
 			indexes:  info.request.pkeyColumns,
 			types:    types,
+			columns:  columns,
 			keyspace: keyspace,
 			table:    table,
 		}
@@ -691,6 +1369,7 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 	routingKeyInfo := &routingKeyInfo{
 		indexes:  make([]int, size),
 		types:    make([]TypeInfo, size),
+		columns:  make([]string, size),
 		keyspace: keyspace,
 		table:    table,
 	}
@@ -705,46 +1384,165 @@ func (s *Session) routingKeyInfo(ctx context.Context, stmt string) (*routingKeyI
 				// there may be many such bound columns, pick the first
 				routingKeyInfo.indexes[keyIndex] = argIndex
 				routingKeyInfo.types[keyIndex] = boundColumn.TypeInfo
+				routingKeyInfo.columns[keyIndex] = boundColumn.Name
 				break
 			}
 		}
 
-		if routingKeyInfo.indexes[keyIndex] == -1 {
-			// missing a routing key column mapping
-			// no routing key, and no error
-			return nil, nil
+		if routingKeyInfo.indexes[keyIndex] == -1 {
+			// missing a routing key column mapping
+			// no routing key, and no error
+			return nil, nil
+		}
+	}
+
+	// cache this result
+	inflight.value = routingKeyInfo
+
+	return routingKeyInfo, nil
+}
+
+func (b *Batch) execute(ctx context.Context, conn *Conn) *Iter {
+	return conn.executeBatch(ctx, b)
+}
+
+func (s *Session) executeBatch(batch *Batch) *Iter {
+	// fail fast
+	if s.Closed() {
+		return &Iter{err: ErrSessionClosed}
+	}
+
+	// Prevent the execution of the batch if greater than the limit
+	// Currently batches have a limit of 65536 queries.
+	// https://datastax-oss.atlassian.net/browse/JAVA-229
+	if batch.Size() > BatchSizeMaximum {
+		return &Iter{err: ErrTooManyStmts}
+	}
+
+	if err := s.checkConnectionPool(batch.connPool); err != nil {
+		return &Iter{err: err}
+	}
+
+	if err := s.checkConditionalBatch(batch); err != nil {
+		return &Iter{err: err}
+	}
+
+	if s.admission != nil {
+		if err := s.admission.acquire(batch.Context(), 0); err != nil {
+			return &Iter{err: err}
+		}
+		defer s.admission.release()
+	}
+
+	iter, err := s.executor.executeQuery(batch)
+	if err != nil {
+		return &Iter{err: err}
+	}
+
+	return iter
+}
+
+// checkConditionalBatch returns ErrLWTBatchMultiPartition if batch has a
+// statement with an IF condition and its statements are not all on the same
+// partition. Statements whose partition is unknown until the server executes
+// them, such as statements added with Batch.Bind or without bound partition key
+// values, are not checked.
+func (s *Session) checkConditionalBatch(batch *Batch) error {
+	if len(batch.Entries) < 2 || !s.conditionalStmts.anyConditional(batch.Entries) {
+		return nil
+	}
+
+	var (
+		partition    *routingKeyInfo
+		partitionKey []byte
+	)
+	for _, entry := range batch.Entries {
+		if entry.binding != nil {
+			continue
+		}
+		info, err := s.routingKeyInfo(batch.Context(), entry.Stmt)
+		if err != nil {
+			// the server reports the error of the statement
+			continue
+		}
+		if checkRoutingKeyValues(info, entry.Args) != nil {
+			continue
+		}
+		key, err := createRoutingKey(info, entry.Args)
+		if err != nil {
+			return err
+		}
+
+		if partition == nil {
+			partition, partitionKey = info, key
+		} else if info.keyspace != partition.keyspace || info.table != partition.table || !bytes.Equal(key, partitionKey) {
+			return ErrLWTBatchMultiPartition
 		}
 	}
+	return nil
+}
 
-	// cache this result
-	inflight.value = routingKeyInfo
-
-	return routingKeyInfo, nil
+// RecentConnectionEvents returns the most recent connection lifecycle events,
+// oldest first, for debugging intermittent connection issues. At most
+// ClusterConfig.ConnEventLogSize events are kept.
+func (s *Session) RecentConnectionEvents() []ConnEvent {
+	return s.connEvents.recent()
 }
 
-func (b *Batch) execute(ctx context.Context, conn *Conn) *Iter {
-	return conn.executeBatch(ctx, b)
+// ConnectionStats returns a snapshot of the open connections of the
+// connection pool, ordered by host ID, to debug connection leaks and the
+// distribution of connections and queries across hosts. The control
+// connection is not included.
+func (s *Session) ConnectionStats() []ConnStat {
+	return s.pool.connStats()
 }
 
-func (s *Session) executeBatch(batch *Batch) *Iter {
-	// fail fast
-	if s.Closed() {
-		return &Iter{err: ErrSessionClosed}
+// SpilloverConns returns the number of spillover connections open to all the
+// hosts, see ClusterConfig.MaxSpilloverConns.
+func (s *Session) SpilloverConns() int {
+	n := 0
+	for _, stat := range s.pool.connStats() {
+		if stat.Spillover {
+			n++
+		}
 	}
+	return n
+}
 
-	// Prevent the execution of the batch if greater than the limit
-	// Currently batches have a limit of 65536 queries.
-	// https://datastax-oss.atlassian.net/browse/JAVA-229
-	if batch.Size() > BatchSizeMaximum {
-		return &Iter{err: ErrTooManyStmts}
-	}
+// CompressionInUse returns the compression algorithm used by the connections
+// of the connection pool to each host, by host ID, or "none" if they are not
+// compressed. A host which does not support the algorithm of
+// ClusterConfig.Compressor is reported as "none".
+func (s *Session) CompressionInUse() map[string]string {
+	return s.pool.compression()
+}
 
-	iter, err := s.executor.executeQuery(batch)
-	if err != nil {
-		return &Iter{err: err}
+// AdmissionStats returns the number of running queries and the number of
+// queries waiting to execute by priority. It returns empty stats unless
+// ClusterConfig.MaxConcurrentQueries is set.
+func (s *Session) AdmissionStats() AdmissionStats {
+	if s.admission == nil {
+		return AdmissionStats{}
 	}
+	return s.admission.stats()
+}
 
-	return iter
+// MetadataRefreshStats returns the number of rebuilds of the token ring and of
+// the changes of the hosts coalesced into them, see
+// ClusterConfig.MetadataRefreshDebounce.
+func (s *Session) MetadataRefreshStats() MetadataRefreshStats {
+	return s.metaMngr.refreshStats()
+}
+
+// CrossDCFallbacks returns the number of queries the host selection policy sent
+// to hosts of remote datacenters because no host of the local datacenter could
+// serve them. It is 0 unless the policy is DCAwareRoundRobinPolicy, possibly
+// wrapped in TokenAwareHostPolicy, see CrossDCFallback.
+func (s *Session) CrossDCFallbacks() uint64 {
+	if c, ok := s.policy.(crossDCFallbackCounter); ok {
+		return c.crossDCFallbackCount()
+	}
+	return 0
 }
 
 // ExecuteBatch executes a batch operation and returns nil if successful
@@ -759,6 +1557,10 @@ func (s *Session) ExecuteBatch(batch *Batch) error {
 // was sent.
 // Further scans on the interator must also remember to include
 // the applied boolean as the first argument to *Iter.Scan
+//
+// The statements of a conditional batch must all be on the same partition,
+// ErrLWTBatchMultiPartition is returned without executing the batch if the
+// bound partition keys differ.
 func (s *Session) ExecuteBatchCAS(batch *Batch, dest ...interface{}) (applied bool, iter *Iter, err error) {
 	iter = s.executeBatch(batch)
 	if err := iter.checkErrAndNotFound(); err != nil {
@@ -898,13 +1700,17 @@ func (qm *queryMetrics) attempt(addAttempts int, addLatency time.Duration,
 type Query struct {
 	stmt                  string
 	values                []interface{}
+	redactedValues        []int
 	cons                  Consistency
 	pageSize              int
 	routingKey            []byte
 	pageState             []byte
+	page                  int // index of the page fetched by automatic paging
 	prefetch              float64
 	trace                 Tracer
 	observer              QueryObserver
+	metricName            string
+	fingerprint           string // of stmt, cached for MetricName before the query is executed
 	session               *Session
 	conn                  *Conn
 	rt                    RetryPolicy
@@ -913,6 +1719,10 @@ type Query struct {
 	serialCons            SerialConsistency
 	defaultTimestamp      bool
 	defaultTimestampValue int64
+	nowInSeconds          bool
+	nowInSecondsValue     int
+	pageSizeBytes         bool
+	timestampPrecision    TimestampPrecision
 	disableSkipMetadata   bool
 	context               context.Context
 	idempotent            bool
@@ -920,15 +1730,63 @@ type Query struct {
 	metrics               *queryMetrics
 	refCount              uint32
 
+	// requestID is set by Query.RequestID and sent in the custom payload of
+	// every request made to execute the query.
+	requestID string
+
 	disableAutoPage bool
 
 	// getKeyspace is field so that it can be overriden in tests
 	getKeyspace func() string
 
+	// routingKeyspace is set by Query.WithRoutingKeyspace.
+	routingKeyspace string
+
 	// used by control conn queries to prevent triggering a write to systems
 	// tables in AWS MCS see
 	skipPrepare bool
 
+	// prepared is set by Query.Prepared to override the automatic decision
+	// whether to prepare the statement.
+	prepared preparedMode
+
+	// routingHost is set by Query.RoutingToHost to execute the query on that host only.
+	routingHost *HostInfo
+
+	// routingKeyFunc is set by Query.WithRoutingKeyFunc to compute the routing key
+	// from the bound values.
+	routingKeyFunc RoutingKeyFunc
+
+	// routingIndexes is set by Query.WithRoutingIndexes to build the routing key
+	// from the values bound at those indexes.
+	routingIndexes []int
+
+	// strictRouting is set by Query.StrictRouting to fail the query if its
+	// partition key columns are not bound.
+	strictRouting bool
+
+	// requireReplica is set by Query.RequireReplica to only send the query to
+	// the replicas of its partition, replicas are those which are up when the
+	// query is executed.
+	requireReplica bool
+	replicas       []*HostInfo
+
+	// priority is set by Query.Priority to order admission when
+	// ClusterConfig.MaxConcurrentQueries is reached.
+	priority int
+
+	// serverTimeout is set by Query.ServerTimeout.
+	serverTimeout time.Duration
+
+	// connPool is set by Query.WithConnectionPool.
+	connPool string
+
+	// noRetry is set by Query.NoRetry.
+	noRetry bool
+
+	// consistencyChain is set by Query.ConsistencyChain.
+	consistencyChain []Consistency
+
 	// routingInfo is a pointer because Query can be copied and copyable struct can't hold a mutex.
 	routingInfo *queryRoutingInfo
 }
@@ -940,6 +1798,50 @@ type queryRoutingInfo struct {
 	keyspace string
 
 	table string
+
+	// routingKeyComputed is set once the host selection policy asked for the
+	// routing key, routingKey is the key computed if any and routingKeyErr
+	// holds the reason it was unavailable if any.
+	routingKeyComputed bool
+	routingKey         []byte
+	routingKeyErr      error
+}
+
+func (r *queryRoutingInfo) setRoutingKey(routingKey []byte, err error) {
+	r.mu.Lock()
+	r.routingKeyComputed = true
+	r.routingKey = routingKey
+	r.routingKeyErr = err
+	r.mu.Unlock()
+}
+
+// resetRoutingKey forgets the routing key computed for the previous values of
+// the query.
+func (r *queryRoutingInfo) resetRoutingKey() {
+	r.mu.Lock()
+	r.routingKeyComputed = false
+	r.routingKey = nil
+	r.routingKeyErr = nil
+	r.mu.Unlock()
+}
+
+// computedRoutingKey returns the routing key last computed by GetRoutingKey,
+// nil if it was not computed.
+func (r *queryRoutingInfo) computedRoutingKey() []byte {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.routingKey
+}
+
+// routingKeyStatus returns the reason the routing key was unavailable, or nil
+// if it was computed.
+func (r *queryRoutingInfo) routingKeyStatus() error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if !r.routingKeyComputed {
+		return ErrRoutingKeyNotComputed
+	}
+	return r.routingKeyErr
 }
 
 func (q *Query) defaultsFromSession() {
@@ -954,6 +1856,7 @@ func (q *Query) defaultsFromSession() {
 	q.rt = s.cfg.RetryPolicy
 	q.serialCons = s.cfg.SerialConsistency
 	q.defaultTimestamp = s.cfg.DefaultTimestamp
+	q.timestampPrecision = s.cfg.TimestampPrecision
 	q.idempotent = s.cfg.DefaultIdempotence
 	q.metrics = &queryMetrics{m: make(map[string]*hostMetrics)}
 
@@ -972,9 +1875,55 @@ func (q Query) Values() []interface{} {
 	return q.values
 }
 
+// BoundValues returns a copy of the values passed in via Bind, with those
+// marked as sensitive with RedactBoundValue replaced by RedactedValue{}. It is
+// meant for audit logging, the values are those observed by the QueryObserver.
+func (q *Query) BoundValues() []interface{} {
+	if q.values == nil {
+		return nil
+	}
+	values := make([]interface{}, len(q.values))
+	copy(values, q.values)
+	for _, idx := range q.redactedValues {
+		if idx < len(values) {
+			values[idx] = RedactedValue{}
+		}
+	}
+	return values
+}
+
+// RedactBoundValue marks the value bound at index as sensitive, it is replaced
+// by RedactedValue{} in BoundValues, in the values observed by the
+// QueryObserver and in String. The value itself is still sent to the server.
+// The mark applies to the index, it is kept when new values are bound.
+func (q *Query) RedactBoundValue(index int) *Query {
+	if index < 0 {
+		return q
+	}
+	// the query may be a copy sharing the indexes of another one
+	q.redactedValues = append(q.redactedValues[:len(q.redactedValues):len(q.redactedValues)], index)
+	return q
+}
+
+// observedValues are the values given to the QueryObserver.
+func (q *Query) observedValues() []interface{} {
+	if len(q.redactedValues) == 0 {
+		return q.values
+	}
+	return q.BoundValues()
+}
+
+// RedactedValue replaces the values marked as sensitive with
+// Query.RedactBoundValue.
+type RedactedValue struct{}
+
+func (RedactedValue) String() string {
+	return "<redacted>"
+}
+
 // String implements the stringer interface.
 func (q Query) String() string {
-	return fmt.Sprintf("[query statement=%q values=%+v consistency=%s]", q.stmt, q.values, q.cons)
+	return fmt.Sprintf("[query statement=%q values=%+v consistency=%s]", q.stmt, q.observedValues(), q.cons)
 }
 
 // Attempts returns the number of times the query was executed.
@@ -1000,6 +1949,28 @@ func (q *Query) AddLatency(l int64, host *HostInfo) {
 // is used.
 func (q *Query) Consistency(c Consistency) *Query {
 	q.cons = c
+	q.consistencyChain = nil
+	return q
+}
+
+// ConsistencyChain sets the consistency levels to execute the query at, in
+// order: every execution of the query starts at the first level and, when an
+// attempt fails because not enough replicas were available or responded in
+// time, the query is attempted again at the next level, until an attempt
+// succeeds or the levels are exhausted. Write timeouts only move to the next
+// level for idempotent queries, as the write may have been applied.
+//
+//	query.ConsistencyChain(gocql.LocalQuorum, gocql.LocalOne, gocql.One)
+//
+// Other errors are handled by the retry policy of the query, which does not
+// see the attempts made at the following levels.
+func (q *Query) ConsistencyChain(levels ...Consistency) *Query {
+	if len(levels) == 0 {
+		q.consistencyChain = nil
+		return q
+	}
+	q.cons = levels[0]
+	q.consistencyChain = levels
 	return q
 }
 
@@ -1020,9 +1991,41 @@ func (q *Query) CustomPayload(customPayload map[string][]byte) *Query {
 	return q
 }
 
+// RequestIDPayloadKey is the custom payload key of the request ID set with
+// Query.RequestID.
+const RequestIDPayloadKey = "request-id"
+
+// RequestID sets a logical ID for the query, sent under RequestIDPayloadKey in
+// the custom payload of every request made to execute it: the first attempt,
+// its retries, speculative executions and the fetch of the following pages.
+// Server side logs and traces of all the coordinators which ran the query can
+// then be correlated.
+//
+// The request ID requires protocol version 4 or above, it is not sent with
+// older protocol versions.
+func (q *Query) RequestID(id string) *Query {
+	q.requestID = id
+	return q
+}
+
+// payload returns the custom payload of the query with the request ID added.
+func (q *Query) payload(proto byte) map[string][]byte {
+	if q.requestID == "" || proto < protoVersion4 {
+		return q.customPayload
+	}
+	payload := make(map[string][]byte, len(q.customPayload)+1)
+	for k, v := range q.customPayload {
+		payload[k] = v
+	}
+	payload[RequestIDPayloadKey] = []byte(q.requestID)
+	return payload
+}
+
+// Context returns the context of the query set with WithContext, or else the
+// context derived from ClusterConfig.BaseContext if set.
 func (q *Query) Context() context.Context {
 	if q.context == nil {
-		return context.Background()
+		return q.session.defaultContext()
 	}
 	return q.context
 }
@@ -1041,12 +2044,46 @@ func (q *Query) Observer(observer QueryObserver) *Query {
 	return q
 }
 
+// WithMetricName sets the name reported to observers as ObservedQuery.MetricName,
+// a stable name such as "get_user" is better suited as a metric label than the
+// statement.
+func (q *Query) WithMetricName(name string) *Query {
+	q.metricName = name
+	return q
+}
+
+// MetricName returns the name set with WithMetricName, or else the fingerprint
+// of the statement which has its literals replaced by ?.
+func (q *Query) MetricName() string {
+	if q.metricName != "" {
+		return q.metricName
+	} else if q.fingerprint != "" {
+		return q.fingerprint
+	}
+	return statementFingerprint(q.stmt, false)
+}
+
 // PageSize will tell the iterator to fetch the result in pages of size n.
 // This is useful for iterating over large result sets, but setting the
 // page size too low might decrease the performance. This feature is only
 // available in Cassandra 2 and onwards.
 func (q *Query) PageSize(n int) *Query {
 	q.pageSize = n
+	q.pageSizeBytes = false
+	return q
+}
+
+// PageSizeBytes will tell the iterator to fetch the result in pages of about n
+// bytes rather than of a number of rows, which keeps the memory and latency of
+// the pages predictable when the size of rows varies a lot. It replaces the
+// page size in rows set with PageSize or ClusterConfig.PageSize, and PageSize
+// replaces it.
+//
+// Only available on protocol >= 5 with servers supporting the page size in
+// bytes extension of DataStax Enterprise, the query fails on lower protocols.
+func (q *Query) PageSizeBytes(n int) *Query {
+	q.pageSize = n
+	q.pageSizeBytes = true
 	return q
 }
 
@@ -1073,6 +2110,37 @@ func (q *Query) WithTimestamp(timestamp int64) *Query {
 	return q
 }
 
+// NowInSeconds sets the current time, in seconds since the epoch, the server
+// uses to evaluate TTLs and tombstones when executing the query. This allows
+// testing TTL based logic deterministically, eg. reading with a time in the
+// future treats rows whose TTL expired by then as deleted.
+//
+// Only available on protocol >= 5, the query fails on lower protocols.
+func (q *Query) NowInSeconds(now int) *Query {
+	q.nowInSeconds = true
+	q.nowInSecondsValue = now
+	return q
+}
+
+// TimestampPrecision sets how time.Time values bound to timestamp columns of
+// this query are converted to milliseconds. See ClusterConfig.TimestampPrecision.
+func (q *Query) TimestampPrecision(p TimestampPrecision) *Query {
+	q.timestampPrecision = p
+	return q
+}
+
+// RoutingToHost pins the query to host: it is only executed on that host,
+// bypassing the host selection policy, and fails if the host is down or not
+// connected. Retries are done on the same host.
+func (q *Query) RoutingToHost(host *HostInfo) *Query {
+	q.routingHost = host
+	return q
+}
+
+func (q *Query) pinnedHost() *HostInfo {
+	return q.routingHost
+}
+
 // RoutingKey sets the routing key to use when a token aware connection
 // pool is used to optimize the routing of this query.
 func (q *Query) RoutingKey(routingKey []byte) *Query {
@@ -1080,6 +2148,69 @@ func (q *Query) RoutingKey(routingKey []byte) *Query {
 	return q
 }
 
+// WithRoutingKeyspace sets the keyspace used to look up the replicas of the
+// query's routing key, for queries against a keyspace other than the session
+// keyspace whose keyspace is not known from the prepared statement metadata.
+// The replicas of a keyspace other than the session keyspace are computed in
+// the background the first time a query is routed to it, until then the query
+// is sent to the primary replica. If the metadata of the keyspace can not be
+// read, for example because it does not exist, it is read again by the first
+// query routed to it 30 seconds later.
+//
+// It only affects client side routing: the keyspace is not sent to the server
+// nor returned by Keyspace, the statement must still qualify its tables with
+// the keyspace. The replicas of at most 64 keyspaces other than the session
+// keyspace are kept up to date, queries routed to further keyspaces are always
+// sent to the primary replica.
+func (q *Query) WithRoutingKeyspace(keyspace string) *Query {
+	q.routingKeyspace = keyspace
+	return q
+}
+
+// routingKeyspaceOf returns the keyspace whose replicas qry is routed to, the
+// one set by Query.WithRoutingKeyspace or the keyspace of qry.
+func routingKeyspaceOf(qry ExecutableQuery) string {
+	if q, ok := qry.(*Query); ok && q.getKeyspace == nil && q.routingKeyspace != "" {
+		return q.routingKeyspace
+	}
+	return qry.Keyspace()
+}
+
+// RoutingKeyFunc computes the routing key of a statement from its bound values.
+type RoutingKeyFunc func(boundValues []interface{}) ([]byte, error)
+
+// WithRoutingKeyFunc sets a function which computes the routing key from the
+// values bound to the query. It is used instead of determining the partition
+// key columns from the prepared statement metadata, which is useful when the
+// metadata is incomplete or gocql can't infer the partition key. A routing key
+// set with RoutingKey takes precedence.
+func (q *Query) WithRoutingKeyFunc(fn RoutingKeyFunc) *Query {
+	q.routingKeyFunc = fn
+	return q
+}
+
+// WithRoutingIndexes sets the indexes of the bound values which form the
+// routing key, in the order of the partition key columns. The values are
+// marshaled to the types of their bind markers and composite encoded when
+// there are several, as the partition key columns would be. It is a lower
+// level alternative to WithRoutingKeyFunc for when gocql can't infer the
+// partition key from the statement metadata, for example when the partition
+// key columns are bound by a function call. A routing key set with RoutingKey
+// or WithRoutingKeyFunc takes precedence.
+//
+// The types of the bind markers are read from the metadata of the prepared
+// statement, the statement is prepared to route the query even if the query
+// itself is not executed as a prepared statement, see Prepared.
+//
+// If an index is out of the range of the bound values or a value can't be
+// marshaled to the type of its bind marker, GetRoutingKey returns the error
+// and the query is not routed token aware: it is executed on the hosts the
+// fallback policy of the token aware policy picks, which may not be replicas.
+func (q *Query) WithRoutingIndexes(indexes ...int) *Query {
+	q.routingIndexes = indexes
+	return q
+}
+
 func (q *Query) withContext(ctx context.Context) ExecutableQuery {
 	// I really wish go had covariant types
 	return q.WithContext(ctx)
@@ -1111,25 +2242,43 @@ func (q *Query) attempt(keyspace string, end, start time.Time, iter *Iter, host
 	attempt, metricsForHost := q.metrics.attempt(1, latency, host, q.observer != nil)
 
 	if q.observer != nil {
+		routingKeyErr := q.routingInfo.routingKeyStatus()
 		q.observer.ObserveQuery(q.Context(), ObservedQuery{
-			Keyspace:  keyspace,
-			Statement: q.stmt,
-			Values:    q.values,
-			Start:     start,
-			End:       end,
-			Rows:      iter.numRows,
-			Host:      host,
-			Metrics:   metricsForHost,
-			Err:       iter.err,
-			Attempt:   attempt,
+			Keyspace:    keyspace,
+			Statement:   q.stmt,
+			MetricName:  q.MetricName(),
+			Values:      q.observedValues(),
+			Start:       start,
+			End:         end,
+			Sent:        iter.sent(),
+			Rows:        iter.numRows,
+			Page:        q.page,
+			Host:        host,
+			Metrics:     metricsForHost,
+			Err:         iter.err,
+			Attempt:     attempt,
+			Consistency: q.cons,
+
+			RoutingKeyAvailable: routingKeyErr == nil,
+			RoutingKeyErr:       routingKeyErr,
 		})
 	}
 }
 
 func (q *Query) retryPolicy() RetryPolicy {
+	if q.noRetry {
+		return nil
+	}
+	if len(q.consistencyChain) > 0 {
+		return &consistencyChainRetryPolicy{levels: q.consistencyChain, rt: q.rt}
+	}
 	return q.rt
 }
 
+func (q *Query) retriesDisabled() bool {
+	return q.noRetry
+}
+
 // Keyspace returns the keyspace the query will be executed against.
 func (q *Query) Keyspace() string {
 	if q.getKeyspace != nil {
@@ -1159,19 +2308,155 @@ func (q *Query) Table() string {
 // then nil will be returned with no error. On any error condition,
 // an error description will be returned.
 func (q *Query) GetRoutingKey() ([]byte, error) {
+	routingKey, unavailable, err := q.getRoutingKey()
+	if err != nil {
+		q.routingInfo.setRoutingKey(nil, err)
+		return nil, err
+	}
+	q.routingInfo.setRoutingKey(routingKey, unavailable)
+	return routingKey, nil
+}
+
+// knownRoutingKey returns the routing key set with RoutingKey or computed by
+// the host selection policy, nil if it is not known yet.
+func (q *Query) knownRoutingKey() []byte {
+	if q.routingKey != nil {
+		return q.routingKey
+	}
+	return q.routingInfo.computedRoutingKey()
+}
+
+// StrictRouting, if enabled, fails the query with an *ErrRoutingKeyUnbound
+// before it is executed if values are not bound to all of its partition key
+// columns. Otherwise such a query can't be routed token aware and is silently
+// sent to any host, possibly in another datacenter.
+//
+// Statements whose partition key columns are unknown, such as statements which
+// are not prepared, and queries with a routing key set with RoutingKey,
+// WithRoutingKeyFunc or WithRoutingIndexes are not checked.
+func (q *Query) StrictRouting(strict bool) *Query {
+	q.strictRouting = strict
+	return q
+}
+
+// RequireReplica, if enabled, only sends the query to the replicas of its
+// partition, as returned by Session.ReplicasFor, instead of falling back to
+// other coordinators, so that it is always executed without an extra network
+// hop. The query fails with ErrNoReplicaAvailable if none of the replicas is up
+// or reachable, or if its routing key or the replicas are unknown.
+//
+// Replicas which are not returned by the host selection policy, for example
+// replicas in a remote datacenter, are attempted after those it returns.
+func (q *Query) RequireReplica(require bool) *Query {
+	q.requireReplica = require
+	return q
+}
+
+func (q *Query) requiredReplicas() []*HostInfo {
+	if !q.requireReplica {
+		return nil
+	}
+	return q.replicas
+}
+
+// ServerTimeout sets the timeout of the query on the server, overriding the
+// server wide timeouts such as read_request_timeout_in_ms for this query only.
+// It is rounded to milliseconds, ClusterConfig.Timeout or the query context
+// should leave the server enough time to answer.
+//
+// The timeout is only supported by Scylla, which receives it in a USING
+// TIMEOUT clause added to the statement, so it can only be set on SELECT,
+// INSERT, UPDATE and DELETE statements. Other servers run the query with their
+// default timeout, a warning is then logged once per session.
+func (q *Query) ServerTimeout(timeout time.Duration) *Query {
+	q.serverTimeout = timeout
+	return q
+}
+
+// checkRoutingKeyBound returns an *ErrRoutingKeyUnbound if values are not bound
+// to all the partition key columns of the query.
+func (q *Query) checkRoutingKeyBound() error {
+	if q.routingKey != nil || q.routingKeyFunc != nil || q.routingIndexes != nil || (q.binding != nil && len(q.values) == 0) {
+		return nil
+	}
+	info, err := q.session.routingKeyInfo(q.Context(), q.stmt)
+	if err != nil || info == nil {
+		return err
+	}
+
+	var unbound []string
+	for i, idx := range info.indexes {
+		if idx >= len(q.values) || isUnsetRoutingValue(q.values[idx]) {
+			unbound = append(unbound, info.columns[i])
+		}
+	}
+	if len(unbound) > 0 {
+		return &ErrRoutingKeyUnbound{Columns: unbound}
+	}
+	return nil
+}
+
+// ValidateBindTypes prepares the statement of the query, or uses its cached
+// metadata, and checks that values, as they would be passed to Bind, can be
+// marshaled to the types of its bind markers. The returned error lists every
+// value which can't, so that type bugs in hot path statements can be caught at
+// startup rather than under load. The query is not executed.
+func (q *Query) ValidateBindTypes(values ...interface{}) error {
+	conn := q.session.getConn()
+	if conn == nil {
+		return ErrNoConnections
+	}
+	info, err := conn.prepareStatement(q.Context(), q.stmt, q.trace)
+	if err != nil {
+		return err
+	}
+
+	columns := info.request.columns
+	if len(values) != len(columns) {
+		return fmt.Errorf("gocql: statement %q has %d bind markers, got %d values", q.stmt, len(columns), len(values))
+	}
+	var mismatches []string
+	for i, col := range columns {
+		var v queryValues
+		if err := marshalQueryValue(col.TypeInfo, values[i], &v, q.timestampPrecision); err != nil {
+			mismatches = append(mismatches, fmt.Sprintf("value %d (%s %s) of type %T: %v", i, col.Name, col.TypeInfo, values[i], err))
+		}
+	}
+	if len(mismatches) > 0 {
+		return fmt.Errorf("gocql: values do not match the bind markers of %q: %s", q.stmt, strings.Join(mismatches, "; "))
+	}
+	return nil
+}
+
+// getRoutingKey returns the routing key of the query, or the reason it is
+// unavailable if it can't be computed without that being an error.
+func (q *Query) getRoutingKey() (routingKey []byte, unavailable error, err error) {
 	if q.routingKey != nil {
-		return q.routingKey, nil
+		return q.routingKey, nil, nil
 	} else if q.binding != nil && len(q.values) == 0 {
 		// If this query was created using session.Bind we wont have the query
 		// values yet, so we have to pass down to the next policy.
 		// TODO: Remove this and handle this case
-		return nil, nil
+		return nil, ErrRoutingKeyValuesMismatch, nil
+	}
+
+	if q.routingKeyFunc != nil {
+		routingKey, err := q.routingKeyFunc(q.values)
+		if err == nil && routingKey == nil {
+			return nil, ErrRoutingKeyUnknown, nil
+		}
+		return routingKey, nil, err
+	}
+
+	if q.routingIndexes != nil {
+		routingKey, err := q.routingKeyFromIndexes()
+		return routingKey, nil, err
 	}
 
 	// try to determine the routing key
 	routingKeyInfo, err := q.session.routingKeyInfo(q.Context(), q.stmt)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	if routingKeyInfo != nil {
@@ -1180,7 +2465,53 @@ func (q *Query) GetRoutingKey() ([]byte, error) {
 		q.routingInfo.table = routingKeyInfo.table
 		q.routingInfo.mu.Unlock()
 	}
-	return createRoutingKey(routingKeyInfo, q.values)
+	if unavailable := checkRoutingKeyValues(routingKeyInfo, q.values); unavailable != nil {
+		return nil, unavailable, nil
+	}
+	routingKey, err = createRoutingKey(routingKeyInfo, q.values)
+	return routingKey, nil, err
+}
+
+// routingKeyFromIndexes builds the routing key from the values bound at the
+// indexes set by WithRoutingIndexes.
+func (q *Query) routingKeyFromIndexes() ([]byte, error) {
+	for _, idx := range q.routingIndexes {
+		if idx < 0 || idx >= len(q.values) {
+			return nil, fmt.Errorf("gocql: routing index %d is out of the range of the %d bound values", idx, len(q.values))
+		}
+	}
+
+	conn := q.session.getConn()
+	if conn == nil {
+		return nil, ErrNoConnections
+	}
+	info, err := conn.prepareStatement(q.Context(), q.stmt, nil)
+	if err != nil {
+		return nil, err
+	}
+	columns := info.request.columns
+	if len(columns) != len(q.values) {
+		return nil, fmt.Errorf("gocql: statement %q has %d bind markers, got %d values", q.stmt, len(columns), len(q.values))
+	}
+
+	components := make([][]byte, len(q.routingIndexes))
+	for i, idx := range q.routingIndexes {
+		encoded, err := Marshal(columns[idx].TypeInfo, q.values[idx])
+		if err != nil {
+			return nil, fmt.Errorf("gocql: routing value %d (%s %s) of type %T: %v", idx, columns[idx].Name, columns[idx].TypeInfo, q.values[idx], err)
+		}
+		components[i] = encoded
+	}
+
+	q.routingInfo.mu.Lock()
+	q.routingInfo.keyspace = info.request.keyspace
+	q.routingInfo.table = info.request.table
+	q.routingInfo.mu.Unlock()
+
+	if len(components) == 1 {
+		return components[0], nil
+	}
+	return compositeRoutingKey(components), nil
 }
 
 func (q *Query) shouldPrepare() bool {
@@ -1219,6 +2550,15 @@ func (q *Query) RetryPolicy(r RetryPolicy) *Query {
 	return q
 }
 
+// NoRetry executes the query at most once, the retry policy and speculative
+// execution policy of the query are ignored and the error of the attempt is
+// returned as is. Hosts are only skipped without being sent the query, if they
+// are down or have no connection available.
+func (q *Query) NoRetry() *Query {
+	q.noRetry = true
+	return q
+}
+
 // SetSpeculativeExecutionPolicy sets the execution policy
 func (q *Query) SetSpeculativeExecutionPolicy(sp SpeculativeExecutionPolicy) *Query {
 	q.spec = sp
@@ -1251,6 +2591,7 @@ func (q *Query) Idempotent(value bool) *Query {
 func (q *Query) Bind(v ...interface{}) *Query {
 	q.values = v
 	q.pageState = nil
+	q.routingInfo.resetRoutingKey()
 	return q
 }
 
@@ -1291,6 +2632,25 @@ func (q *Query) Exec() error {
 	return q.Iter().Close()
 }
 
+var (
+	selectStmtRe     = regexp.MustCompile(`(?is)^\s*select\s+(.*?)\s+from\s+(.*)$`)
+	aggregateFuncRe  = regexp.MustCompile(`(?i)\b(count|sum|avg|min|max)\s*\(`)
+	whereClauseRe    = regexp.MustCompile(`(?i)\bwhere\b`)
+	allowFilteringRe = regexp.MustCompile(`(?i)\ballow\s+filtering\b`)
+)
+
+// isFullTableAggregate reports whether stmt is a SELECT of an aggregate
+// function which is likely to scan the whole table, ie. it has no WHERE
+// clause or relies on ALLOW FILTERING. This is a textual heuristic, it does
+// not check the restrictions against the table's partition key.
+func isFullTableAggregate(stmt string) bool {
+	m := selectStmtRe.FindStringSubmatch(stmt)
+	if m == nil || !aggregateFuncRe.MatchString(m[1]) {
+		return false
+	}
+	return !whereClauseRe.MatchString(m[2]) || allowFilteringRe.MatchString(m[2])
+}
+
 func isUseStatement(stmt string) bool {
 	if len(stmt) < 3 {
 		return false
@@ -1381,6 +2741,24 @@ func (q *Query) MapScanCAS(dest map[string]interface{}) (applied bool, err error
 	return applied, iter.Close()
 }
 
+// ExecCAS executes a lightweight transaction (i.e. an UPDATE or INSERT
+// statement containing an IF clause) and reports whether it was applied.
+// Unlike ScanCAS, the previous values returned when the transaction was not
+// applied are discarded.
+func (q *Query) ExecCAS() (applied bool, err error) {
+	q.disableSkipMetadata = true
+	iter := q.Iter()
+	if err := iter.checkErrAndNotFound(); err != nil {
+		iter.Close()
+		return false, err
+	}
+	// [applied] is always the first column, skip the rest
+	dest := make([]interface{}, iter.meta.actualColCount)
+	dest[0] = &applied
+	iter.Scan(dest...)
+	return applied, iter.Close()
+}
+
 // Release releases a query back into a pool of queries. Released Queries
 // cannot be reused.
 //
@@ -1431,13 +2809,77 @@ type Iter struct {
 
 	framer *framer
 	closed int32
+
+	// row holds the columns of the last row read by Scan, backed by the framer
+	// buffer.
+	row [][]byte
+
+	// reuseBuffers is set by EnableBufferReuse to scan text and blob columns
+	// into values backed by the framer buffer.
+	reuseBuffers bool
+
+	// stats accumulates the statistics of the pages read so far.
+	stats IterStats
+}
+
+// IterStats are statistics of the pages read by an Iter, see Iter.Stats.
+type IterStats struct {
+	// Pages is the number of pages of rows fetched.
+	Pages int
+	// Rows is the number of rows of the pages.
+	Rows int
+	// Bytes is the number of bytes of the column values read.
+	Bytes int64
+	// WaitTime is the time spent waiting for the pages from the server.
+	WaitTime time.Duration
+	// DecodeTime is the time spent reading and unmarshaling rows in Scan.
+	DecodeTime time.Duration
+}
+
+func (s *IterStats) add(o IterStats) {
+	s.Pages += o.Pages
+	s.Rows += o.Rows
+	s.Bytes += o.Bytes
+	s.WaitTime += o.WaitTime
+	s.DecodeTime += o.DecodeTime
 }
 
-// Host returns the host which the query was sent to.
+// Stats returns the statistics of the pages read by iter so far, they are
+// final once the iterator is closed. Pages prefetched but not read yet are not
+// counted.
+//
+// Many pages of few rows hint that the page size is too small, a DecodeTime
+// close to WaitTime hints that the rows are expensive to unmarshal.
+func (iter *Iter) Stats() IterStats {
+	return iter.stats
+}
+
+// nextPage replaces iter by its next page, which it waits for, keeping the
+// statistics of the pages read so far.
+func (iter *Iter) nextPage() {
+	stats, reuseBuffers := iter.stats, iter.reuseBuffers
+	*iter = *iter.next.fetch()
+	iter.stats.add(stats)
+	iter.reuseBuffers = reuseBuffers
+}
+
+// Host returns the host which coordinated the most recently fetched page of
+// the results. It is updated as pages are fetched, retries or the host
+// selection policy may send each page to a different coordinator. It is nil if
+// the query wasn't sent to any host. Each attempt is also reported to the
+// QueryObserver with its ObservedQuery.Host and ObservedQuery.Page.
 func (iter *Iter) Host() *HostInfo {
 	return iter.host
 }
 
+// sent returns the time the request of iter was written to the connection.
+func (iter *Iter) sent() time.Time {
+	if iter.framer == nil {
+		return time.Time{}
+	}
+	return iter.framer.sent
+}
+
 // Columns returns the name and type of the selected columns.
 func (iter *Iter) Columns() []ColumnInfo {
 	return iter.meta.columns
@@ -1476,7 +2918,7 @@ func (is *iterScanner) Next() bool {
 
 	if iter.pos >= iter.numRows {
 		if iter.next != nil {
-			is.iter = iter.next.fetch()
+			iter.nextPage()
 			return is.Next()
 		}
 		return false
@@ -1491,33 +2933,39 @@ func (is *iterScanner) Next() bool {
 		is.cols[i] = col
 	}
 	iter.pos++
-	is.valid = true
-
-	return true
-}
-
-func scanColumn(p []byte, col ColumnInfo, dest []interface{}) (int, error) {
-	if dest[0] == nil {
-		return 1, nil
-	}
+	is.valid = true
 
-	if col.TypeInfo.Type() == TypeTuple {
-		// this will panic, actually a bug, please report
-		tuple := col.TypeInfo.(TupleTypeInfo)
+	return true
+}
 
+// scanColumn unmarshals p into dest. If alias is true, text and blob values
+// scanned into *string and *[]byte are backed by p instead of copied.
+func scanColumn(p []byte, col ColumnInfo, dest []interface{}, alias bool) (int, error) {
+	if tuple, ok := col.TypeInfo.(TupleTypeInfo); ok {
+		// the tuple is expanded into a dest for each of its elements, a nil
+		// dest skips its element
 		count := len(tuple.Elems)
-		// here we pass in a slice of the struct which has the number number of
-		// values as elements in the tuple
-		if err := Unmarshal(col.TypeInfo, p, dest[:count]); err != nil {
-			return 0, err
+		for _, d := range dest[:count] {
+			if d != nil {
+				if err := Unmarshal(col.TypeInfo, p, dest[:count]); err != nil {
+					return 0, err
+				}
+				break
+			}
 		}
 		return count, nil
-	} else {
-		if err := Unmarshal(col.TypeInfo, p, dest[0]); err != nil {
-			return 0, err
-		}
+	}
+
+	if dest[0] == nil {
+		return 1, nil
+	}
+	if alias && scanColumnAlias(p, col, dest[0]) {
 		return 1, nil
 	}
+	if err := Unmarshal(col.TypeInfo, p, dest[0]); err != nil {
+		return 0, err
+	}
+	return 1, nil
 }
 
 func (is *iterScanner) Scan(dest ...interface{}) error {
@@ -1532,13 +2980,18 @@ func (is *iterScanner) Scan(dest ...interface{}) error {
 		return fmt.Errorf("gocql: not enough columns to scan into: have %d want %d", len(dest), iter.meta.actualColCount)
 	}
 
+	start := time.Now()
+	defer func() {
+		iter.stats.DecodeTime += time.Since(start)
+	}()
+
 	// i is the current position in dest, could posible replace it and just use
 	// slices of dest
 	i := 0
 	var err error
 	for _, col := range iter.meta.columns {
 		var n int
-		n, err = scanColumn(is.cols[i], col, dest[i:])
+		n, err = scanColumn(is.cols[i], col, dest[i:], iter.reuseBuffers)
 		if err != nil {
 			break
 		}
@@ -1568,7 +3021,9 @@ func (iter *Iter) Scanner() Scanner {
 }
 
 func (iter *Iter) readColumn() ([]byte, error) {
-	return iter.framer.readBytesInternal()
+	b, err := iter.framer.readBytesInternal()
+	iter.stats.Bytes += int64(len(b))
+	return b, err
 }
 
 // Scan consumes the next row of the iterator and copies the columns of the
@@ -1579,15 +3034,46 @@ func (iter *Iter) readColumn() ([]byte, error) {
 // Scan returns true if the row was successfully unmarshaled or false if the
 // end of the result set was reached or if an error occurred. Close should
 // be called afterwards to retrieve any potential errors.
+//
+// If EnableBufferReuse was called, the text and blob values scanned into
+// *string and *[]byte are only valid until the next call to Scan.
 func (iter *Iter) Scan(dest ...interface{}) bool {
+	return iter.scan(dest, iter.reuseBuffers)
+}
+
+// ScanCopy is like Scan but always copies the values, for the rows whose
+// values must be retained after the next call to Scan when EnableBufferReuse
+// was called.
+func (iter *Iter) ScanCopy(dest ...interface{}) bool {
+	return iter.scan(dest, false)
+}
+
+// EnableBufferReuse makes Scan and Scanner set the text, varchar, ascii and
+// blob values scanned into *string and *[]byte to views of the buffer of the
+// received page instead of copies, saving an allocation and a copy per value.
+// It is meant for scans of many rows which process the values of a row before
+// scanning the next one.
+//
+// The caller must not retain such a value, or a slice of it, after the next
+// call to Scan, which may fetch the next page and release the buffer, nor
+// modify it: the string and the byte slice of the same value share their
+// memory. Values which are retained must be copied, or their rows scanned with
+// ScanCopy. Values of other types and values scanned into other Go types, for
+// example by MapScan and SliceMap, are always copied.
+func (iter *Iter) EnableBufferReuse() *Iter {
+	iter.reuseBuffers = true
+	return iter
+}
+
+func (iter *Iter) scan(dest []interface{}, alias bool) bool {
 	if iter.err != nil {
 		return false
 	}
 
 	if iter.pos >= iter.numRows {
 		if iter.next != nil {
-			*iter = *iter.next.fetch()
-			return iter.Scan(dest...)
+			iter.nextPage()
+			return iter.scan(dest, alias)
 		}
 		return false
 	}
@@ -1603,17 +3089,24 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 		return false
 	}
 
+	start := time.Now()
+	defer func() {
+		iter.stats.DecodeTime += time.Since(start)
+	}()
+
 	// i is the current position in dest, could posible replace it and just use
 	// slices of dest
 	i := 0
+	iter.row = iter.row[:0]
 	for _, col := range iter.meta.columns {
 		colBytes, err := iter.readColumn()
 		if err != nil {
 			iter.err = err
 			return false
 		}
+		iter.row = append(iter.row, colBytes)
 
-		n, err := scanColumn(colBytes, col, dest[i:])
+		n, err := scanColumn(colBytes, col, dest[i:], alias)
 		if err != nil {
 			iter.err = err
 			return false
@@ -1625,6 +3118,292 @@ func (iter *Iter) Scan(dest ...interface{}) bool {
 	return true
 }
 
+// ScanBlobReader returns a reader over the value of the blob column at colIndex,
+// an index into Columns, of the row read by the last successful call to Scan.
+// The reader reads directly from the buffer of the received page, so large
+// blobs can be consumed without copying them. Pass nil as the Scan dest of the
+// column to skip unmarshaling it. A null value reads as empty.
+//
+// The reader is only valid until the next call to Scan, which may fetch the
+// next page and reuse the buffer.
+func (iter *Iter) ScanBlobReader(colIndex int) (io.Reader, error) {
+	if err := iter.checkScannedColumn("ScanBlobReader", colIndex); err != nil {
+		return nil, err
+	}
+	if typ := iter.meta.columns[colIndex].TypeInfo.Type(); typ != TypeBlob {
+		return nil, fmt.Errorf("gocql: column %q is %s, not blob", iter.meta.columns[colIndex].Name, typ)
+	}
+	return bytes.NewReader(iter.row[colIndex]), nil
+}
+
+// CollectionElements returns a reader over the elements of the list, set or
+// map column at colIndex, an index into Columns, of the row read by the last
+// successful call to Scan. Elements are unmarshaled one at a time from the
+// buffer of the received page, so large collections can be consumed without
+// building the whole slice or map. Pass nil as the Scan dest of the column to
+// skip unmarshaling it. A null collection has no elements.
+//
+// Elements are read in the order they were sent by the server. The reader is
+// only valid until the next call to Scan, which may fetch the next page and
+// reuse the buffer.
+func (iter *Iter) CollectionElements(colIndex int) (CollectionReader, error) {
+	if err := iter.checkScannedColumn("CollectionElements", colIndex); err != nil {
+		return nil, err
+	}
+	col := iter.meta.columns[colIndex]
+	info, ok := col.TypeInfo.(CollectionType)
+	if !ok {
+		return nil, fmt.Errorf("gocql: column %q is %s, not a collection", col.Name, col.TypeInfo.Type())
+	}
+
+	r := &collectionReader{info: info, data: iter.row[colIndex]}
+	if r.data != nil {
+		n, p, err := readCollectionSize(info, r.data)
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("gocql: negative collection size %d", n)
+		}
+		r.n, r.data = n, r.data[p:]
+	}
+	return r, nil
+}
+
+// ScanMapOrdered unmarshals the entries of the map column at colIndex, an index
+// into Columns, of the row read by the last successful call to Scan into the
+// parallel slices pointed to by keys and values. Unlike unmarshaling into a Go
+// map, the entries keep the order in which they were sent by the server, which
+// for CQL maps is sorted by key as the map is stored. The entry at index i of
+// keys has its value at index i of values.
+//
+// Pass nil as the Scan dest of the column to skip unmarshaling it. A null map
+// sets both slices to nil.
+func (iter *Iter) ScanMapOrdered(colIndex int, keys, values interface{}) error {
+	keysPtr, valuesPtr := reflect.ValueOf(keys), reflect.ValueOf(values)
+	if keysPtr.Kind() != reflect.Ptr || keysPtr.IsNil() || keysPtr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("gocql: ScanMapOrdered keys must be a non nil pointer to a slice, got %T", keys)
+	}
+	if valuesPtr.Kind() != reflect.Ptr || valuesPtr.IsNil() || valuesPtr.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("gocql: ScanMapOrdered values must be a non nil pointer to a slice, got %T", values)
+	}
+	if err := iter.checkScannedColumn("ScanMapOrdered", colIndex); err != nil {
+		return err
+	}
+	if col := iter.meta.columns[colIndex]; col.TypeInfo.Type() != TypeMap {
+		return fmt.Errorf("gocql: column %q is %s, not map", col.Name, col.TypeInfo.Type())
+	}
+
+	r, err := iter.CollectionElements(colIndex)
+	if err != nil {
+		return err
+	}
+	keysSlice, valuesSlice := keysPtr.Elem(), valuesPtr.Elem()
+	if iter.row[colIndex] == nil {
+		keysSlice.Set(reflect.Zero(keysSlice.Type()))
+		valuesSlice.Set(reflect.Zero(valuesSlice.Type()))
+		return nil
+	}
+
+	keysSlice.Set(reflect.MakeSlice(keysSlice.Type(), r.Len(), r.Len()))
+	valuesSlice.Set(reflect.MakeSlice(valuesSlice.Type(), r.Len(), r.Len()))
+	for i := 0; r.Next(); i++ {
+		if err := r.Scan(keysSlice.Index(i).Addr().Interface(), valuesSlice.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// ScanTuple unmarshals the elements of the tuple column at colIndex, an index
+// into Columns, of the row read by the last successful call to Scan into dests,
+// one per element of the tuple, with the same conversions as Scan. Use nil as
+// a dest to skip the corresponding element. A single dest can also be a
+// pointer to a struct, array or slice receiving all the elements, see
+// Unmarshal.
+//
+// A null element, or every element of a null tuple, is unmarshaled as a null
+// value: dests which are pointers to pointers are set to nil, others to their
+// zero value. Pass nil as the Scan dests of the elements of the column to skip
+// unmarshaling it.
+func (iter *Iter) ScanTuple(colIndex int, dests ...interface{}) error {
+	if err := iter.checkScannedColumn("ScanTuple", colIndex); err != nil {
+		return err
+	}
+	col := iter.meta.columns[colIndex]
+	info, ok := col.TypeInfo.(TupleTypeInfo)
+	if !ok {
+		return fmt.Errorf("gocql: column %q is %s, not tuple", col.Name, col.TypeInfo.Type())
+	}
+
+	data := iter.row[colIndex]
+	if len(dests) == 1 && len(info.Elems) != 1 {
+		return Unmarshal(info, data, dests[0])
+	}
+	if len(dests) != len(info.Elems) {
+		return fmt.Errorf("gocql: tuple column %q has %d elements, got %d dests", col.Name, len(info.Elems), len(dests))
+	}
+
+	for i, elem := range info.Elems {
+		var p []byte
+		if len(data) > 0 {
+			if len(data) < 4 {
+				return unmarshalErrorf("unmarshal tuple element %d of column %q: unexpected eof", i, col.Name)
+			}
+			size := int(readInt(data))
+			data = data[4:]
+			if size >= 0 {
+				if len(data) < size {
+					return unmarshalErrorf("unmarshal tuple element %d of column %q: unexpected eof", i, col.Name)
+				}
+				p, data = data[:size], data[size:]
+			}
+		}
+		if dests[i] == nil {
+			continue
+		}
+		if err := Unmarshal(elem, p, dests[i]); err != nil {
+			return fmt.Errorf("gocql: unmarshal tuple element %d of column %q: %w", i, col.Name, err)
+		}
+	}
+	return nil
+}
+
+// ScanWriteTime returns the write time selected with WRITETIME(col) at
+// colIndex, an index into Columns, of the row read by the last successful call
+// to Scan. WRITETIME returns microseconds since the epoch, which are converted
+// to a time.Time in UTC without losing precision. The bool is false if the
+// cell was never written, or written with a null value, and has no write time.
+//
+// Pass nil as the Scan dest of the column to skip unmarshaling it.
+func (iter *Iter) ScanWriteTime(colIndex int) (time.Time, bool, error) {
+	if err := iter.checkScannedColumn("ScanWriteTime", colIndex); err != nil {
+		return time.Time{}, false, err
+	}
+	if typ := iter.meta.columns[colIndex].TypeInfo.Type(); typ != TypeBigInt {
+		return time.Time{}, false, fmt.Errorf("gocql: column %q is %s, not a bigint write time", iter.meta.columns[colIndex].Name, typ)
+	}
+
+	data := iter.row[colIndex]
+	if data == nil {
+		return time.Time{}, false, nil
+	}
+	if len(data) != 8 {
+		return time.Time{}, false, unmarshalErrorf("unmarshal write time: expected 8 bytes, got %d", len(data))
+	}
+	micros := decBigInt(data)
+	return time.Unix(micros/1e6, (micros%1e6)*1e3).In(time.UTC), true, nil
+}
+
+// checkScannedColumn returns an error if colIndex is not a column of the row
+// read by the last successful call to Scan.
+func (iter *Iter) checkScannedColumn(method string, colIndex int) error {
+	if iter.err != nil {
+		return iter.err
+	}
+	if len(iter.row) == 0 || len(iter.row) != len(iter.meta.columns) {
+		return fmt.Errorf("gocql: %s called without a scanned row", method)
+	}
+	if colIndex < 0 || colIndex >= len(iter.row) {
+		return fmt.Errorf("gocql: column index %d out of range, the row has %d columns", colIndex, len(iter.row))
+	}
+	return nil
+}
+
+// CollectionReader reads the elements of a collection one at a time, see
+// Iter.CollectionElements.
+type CollectionReader interface {
+	// Len returns the number of elements of the collection.
+	Len() int
+
+	// Next advances to the next element. It returns false once all the elements
+	// were read or if the collection is malformed, see Err.
+	Next() bool
+
+	// Scan unmarshals the current element into dest: the element of a list or
+	// a set, or the key and the value of a map entry. A nil dest skips
+	// unmarshaling. Next must be called before every call to Scan.
+	Scan(dest ...interface{}) error
+
+	// Err returns the error which stopped Next, if any.
+	Err() error
+}
+
+type collectionReader struct {
+	info CollectionType
+	data []byte
+	n    int
+	read int
+	// elem holds the current element, or the key and the value of the current
+	// map entry.
+	elem  [2][]byte
+	valid bool
+	err   error
+}
+
+func (r *collectionReader) Len() int {
+	return r.n
+}
+
+func (r *collectionReader) Next() bool {
+	r.valid = false
+	if r.err != nil || r.read >= r.n {
+		return false
+	}
+
+	parts := 1
+	if r.info.Type() == TypeMap {
+		parts = 2
+	}
+	for i := 0; i < parts; i++ {
+		m, p, err := readCollectionSize(r.info, r.data)
+		if err != nil {
+			r.err = err
+			return false
+		}
+		r.data = r.data[p:]
+		// In case m < 0, the element is null.
+		r.elem[i] = nil
+		if m >= 0 {
+			if len(r.data) < m {
+				r.err = unmarshalErrorf("unmarshal %s: unexpected eof", r.info.Type())
+				return false
+			}
+			r.elem[i], r.data = r.data[:m], r.data[m:]
+		}
+	}
+	r.read++
+	r.valid = true
+	return true
+}
+
+func (r *collectionReader) Scan(dest ...interface{}) error {
+	if !r.valid {
+		return errors.New("gocql: Scan called without calling Next")
+	}
+
+	types := []TypeInfo{r.info.Elem}
+	if r.info.Type() == TypeMap {
+		types = []TypeInfo{r.info.Key, r.info.Elem}
+	}
+	if len(dest) != len(types) {
+		return fmt.Errorf("gocql: %s elements scan into %d values, got %d", r.info.Type(), len(types), len(dest))
+	}
+	for i, typ := range types {
+		if dest[i] == nil {
+			continue
+		}
+		if err := Unmarshal(typ, r.elem[i], dest[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *collectionReader) Err() error {
+	return r.err
+}
+
 // GetCustomPayload returns any parsed custom payload results if given in the
 // response from Cassandra. Note that the result is not a copy.
 //
@@ -1683,6 +3462,23 @@ func (iter *Iter) PageState() []byte {
 	return iter.meta.pagingState
 }
 
+// HasMorePages reports whether the server has more pages of results after the
+// current page, in which case PageState returns the paging state to fetch the
+// next one. Unlike the false returned by Scan, it does not depend on the rows of
+// the current page being read.
+func (iter *Iter) HasMorePages() bool {
+	// the server only sends a paging state along with the has_more_pages flag,
+	// which is not kept when the result metadata is skipped
+	return len(iter.meta.pagingState) > 0
+}
+
+// WillPageAutomatically reports whether the iterator fetches the next page by
+// itself once the rows of the current page are read, that is the server has
+// more pages and paging was not taken over with Query.PageState.
+func (iter *Iter) WillPageAutomatically() bool {
+	return iter.next != nil
+}
+
 // NumRows returns the number of rows in this pagination, it will update when new
 // pages are fetched, it is not the value of the total number of rows this iter
 // will return unless there is only a single page returned.
@@ -1733,6 +3529,7 @@ type Batch struct {
 	serialCons            SerialConsistency
 	defaultTimestamp      bool
 	defaultTimestampValue int64
+	timestampPrecision    TimestampPrecision
 	context               context.Context
 	cancelBatch           func()
 	keyspace              string
@@ -1740,6 +3537,12 @@ type Batch struct {
 
 	// routingInfo is a pointer because Query can be copied and copyable struct can't hold a mutex.
 	routingInfo *queryRoutingInfo
+
+	// connPool is set by Batch.WithConnectionPool.
+	connPool string
+
+	// noRetry is set by Batch.NoRetry.
+	noRetry bool
 }
 
 // NewBatch creates a new batch operation without defaults from the cluster
@@ -1758,18 +3561,19 @@ func NewBatch(typ BatchType) *Batch {
 func (s *Session) NewBatch(typ BatchType) *Batch {
 	s.mu.RLock()
 	batch := &Batch{
-		Type:             typ,
-		rt:               s.cfg.RetryPolicy,
-		serialCons:       s.cfg.SerialConsistency,
-		trace:            s.trace,
-		observer:         s.batchObserver,
-		session:          s,
-		Cons:             s.cons,
-		defaultTimestamp: s.cfg.DefaultTimestamp,
-		keyspace:         s.cfg.Keyspace,
-		metrics:          &queryMetrics{m: make(map[string]*hostMetrics)},
-		spec:             &NonSpeculativeExecution{},
-		routingInfo:      &queryRoutingInfo{},
+		Type:               typ,
+		rt:                 s.cfg.RetryPolicy,
+		serialCons:         s.cfg.SerialConsistency,
+		trace:              s.trace,
+		observer:           s.batchObserver,
+		session:            s,
+		Cons:               s.cons,
+		defaultTimestamp:   s.cfg.DefaultTimestamp,
+		timestampPrecision: s.cfg.TimestampPrecision,
+		keyspace:           s.cfg.Keyspace,
+		metrics:            &queryMetrics{m: make(map[string]*hostMetrics)},
+		spec:               &NonSpeculativeExecution{},
+		routingInfo:        &queryRoutingInfo{},
 	}
 
 	s.mu.RUnlock()
@@ -1829,9 +3633,11 @@ func (b *Batch) SetConsistency(c Consistency) {
 	b.Cons = c
 }
 
+// Context returns the context of the batch set with WithContext, or else the
+// context derived from ClusterConfig.BaseContext if set.
 func (b *Batch) Context() context.Context {
 	if b.context == nil {
-		return context.Background()
+		return b.session.defaultContext()
 	}
 	return b.context
 }
@@ -1859,6 +3665,34 @@ func (b *Batch) Query(stmt string, args ...interface{}) {
 	b.Entries = append(b.Entries, BatchEntry{Stmt: stmt, Args: args})
 }
 
+// AddStmtWithTimestamp adds the INSERT, UPDATE or DELETE statement stmt to the
+// batch with its own write timestamp, in microseconds since the epoch unless
+// the table uses another unit. The protocol only has a timestamp for the whole
+// batch, so a USING TIMESTAMP ? clause is added to stmt and the timestamp is
+// bound to it, stmt must not already have a timestamp. The statement is
+// prepared once however many timestamps it is added with.
+//
+// The timestamp of the statement takes precedence over the default timestamp
+// of the batch, set with WithTimestamp or DefaultTimestamp, which applies to
+// the statements without their own timestamp. Conditional batches can't have
+// custom timestamps.
+func (b *Batch) AddStmtWithTimestamp(stmt string, timestamp int64, values ...interface{}) error {
+	stmt, marker, err := withTimestampMarker(stmt)
+	if err != nil {
+		return err
+	}
+	if marker > len(values) {
+		return fmt.Errorf("gocql: statement has at least %d bind markers before its timestamp, got %d values", marker, len(values))
+	}
+
+	args := make([]interface{}, 0, len(values)+1)
+	args = append(args, values[:marker]...)
+	args = append(args, timestamp)
+	args = append(args, values[marker:]...)
+	b.Entries = append(b.Entries, BatchEntry{Stmt: stmt, Args: args})
+	return nil
+}
+
 // Bind adds the query to the batch operation and correlates it with a binding callback
 // that will be invoked when the batch is executed. The binding callback allows the application
 // to define which query argument values will be marshalled as part of the batch execution.
@@ -1867,15 +3701,39 @@ func (b *Batch) Bind(stmt string, bind func(q *QueryInfo) ([]interface{}, error)
 }
 
 func (b *Batch) retryPolicy() RetryPolicy {
+	if b.noRetry {
+		return nil
+	}
 	return b.rt
 }
 
+func (b *Batch) retriesDisabled() bool {
+	return b.noRetry
+}
+
 // RetryPolicy sets the retry policy to use when executing the batch operation
 func (b *Batch) RetryPolicy(r RetryPolicy) *Batch {
 	b.rt = r
 	return b
 }
 
+// NoRetry executes the batch at most once, see Query.NoRetry.
+func (b *Batch) NoRetry() *Batch {
+	b.noRetry = true
+	return b
+}
+
+// WithConnectionPool executes the batch on the connections of the pool name of
+// ClusterConfig.ConnectionPools, see Query.WithConnectionPool.
+func (b *Batch) WithConnectionPool(name string) *Batch {
+	b.connPool = name
+	return b
+}
+
+func (b *Batch) connectionPool() string {
+	return b.connPool
+}
+
 func (b *Batch) withContext(ctx context.Context) ExecutableQuery {
 	return b.WithContext(ctx)
 }
@@ -1937,6 +3795,13 @@ func (b *Batch) WithTimestamp(timestamp int64) *Batch {
 	return b
 }
 
+// TimestampPrecision sets how time.Time values bound to timestamp columns of
+// this batch are converted to milliseconds. See ClusterConfig.TimestampPrecision.
+func (b *Batch) TimestampPrecision(p TimestampPrecision) *Batch {
+	b.timestampPrecision = p
+	return b
+}
+
 func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host *HostInfo) {
 	latency := end.Sub(start)
 	attempt, metricsForHost := b.metrics.attempt(1, latency, host, b.observer != nil)
@@ -1959,11 +3824,13 @@ func (b *Batch) attempt(keyspace string, end, start time.Time, iter *Iter, host
 		Values:     values,
 		Start:      start,
 		End:        end,
+		Sent:       iter.sent(),
 		// Rows not used in batch observations // TODO - might be able to support it when using BatchCAS
-		Host:    host,
-		Metrics: metricsForHost,
-		Err:     iter.err,
-		Attempt: attempt,
+		Host:        host,
+		Metrics:     metricsForHost,
+		Err:         iter.err,
+		Attempt:     attempt,
+		Consistency: b.Cons,
 	})
 }
 
@@ -1984,10 +3851,50 @@ func (b *Batch) GetRoutingKey() ([]byte, error) {
 	// try to determine the routing key
 	routingKeyInfo, err := b.session.routingKeyInfo(b.Context(), entry.Stmt)
 	if err != nil {
+		b.routingInfo.setRoutingKey(nil, err)
 		return nil, err
 	}
 
-	return createRoutingKey(routingKeyInfo, entry.Args)
+	routingKey, err := createRoutingKey(routingKeyInfo, entry.Args)
+	b.routingInfo.setRoutingKey(routingKey, err)
+	return routingKey, err
+}
+
+// knownRoutingKey returns the routing key set with RoutingKey or computed by
+// the host selection policy, nil if it is not known yet.
+func (b *Batch) knownRoutingKey() []byte {
+	if b.routingKey != nil {
+		return b.routingKey
+	}
+	return b.routingInfo.computedRoutingKey()
+}
+
+// checkRoutingKeyValues returns the reason a routing key can't be created from
+// values, or nil if it can.
+func checkRoutingKeyValues(routingKeyInfo *routingKeyInfo, values []interface{}) error {
+	if routingKeyInfo == nil {
+		return ErrRoutingKeyUnknown
+	}
+	for _, idx := range routingKeyInfo.indexes {
+		if idx >= len(values) {
+			return ErrRoutingKeyValuesMismatch
+		}
+		if isUnsetRoutingValue(values[idx]) {
+			return ErrRoutingKeyUnset
+		}
+	}
+	return nil
+}
+
+// isUnsetRoutingValue reports whether v leaves a partition key column unset.
+func isUnsetRoutingValue(v interface{}) bool {
+	switch v := v.(type) {
+	case nil, unsetColumn:
+		return true
+	default:
+		rv := reflect.ValueOf(v)
+		return rv.Kind() == reflect.Ptr && rv.IsNil()
+	}
 }
 
 func createRoutingKey(routingKeyInfo *routingKeyInfo, values []interface{}) ([]byte, error) {
@@ -2008,7 +3915,7 @@ func createRoutingKey(routingKeyInfo *routingKeyInfo, values []interface{}) ([]b
 	}
 
 	// composite routing key
-	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	components := make([][]byte, len(routingKeyInfo.indexes))
 	for i := range routingKeyInfo.indexes {
 		encoded, err := Marshal(
 			routingKeyInfo.types[i],
@@ -2017,14 +3924,23 @@ func createRoutingKey(routingKeyInfo *routingKeyInfo, values []interface{}) ([]b
 		if err != nil {
 			return nil, err
 		}
+		components[i] = encoded
+	}
+	return compositeRoutingKey(components), nil
+}
+
+// compositeRoutingKey encodes the marshaled values of the partition key
+// columns as a composite routing key.
+func compositeRoutingKey(components [][]byte) []byte {
+	buf := bytes.NewBuffer(make([]byte, 0, 256))
+	for _, encoded := range components {
 		lenBuf := []byte{0x00, 0x00}
 		binary.BigEndian.PutUint16(lenBuf, uint16(len(encoded)))
 		buf.Write(lenBuf)
 		buf.Write(encoded)
 		buf.WriteByte(0x00)
 	}
-	routingKey := buf.Bytes()
-	return routingKey, nil
+	return buf.Bytes()
 }
 
 func (b *Batch) borrowForExecution() {
@@ -2063,6 +3979,50 @@ func (c ColumnInfo) String() string {
 	return fmt.Sprintf("[column keyspace=%s table=%s name=%s type=%v]", c.Keyspace, c.Table, c.Name, c.TypeInfo)
 }
 
+// conditionalStmtLRU caches whether statements have an IF condition, keyed by
+// statement, so that the statements of batches are only parsed once.
+type conditionalStmtLRU struct {
+	lru *lru.Cache
+	mu  sync.Mutex
+}
+
+// anyConditional reports whether the statement of an entry has an IF condition.
+func (c *conditionalStmtLRU) anyConditional(entries []BatchEntry) bool {
+	for _, entry := range entries {
+		if c.isConditional(entry.Stmt) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *conditionalStmtLRU) isConditional(stmt string) bool {
+	c.mu.Lock()
+	val, ok := c.lru.Get(stmt)
+	c.mu.Unlock()
+	if ok {
+		return val.(bool)
+	}
+
+	conditional := hasCondition(stmt)
+	c.mu.Lock()
+	c.lru.Add(stmt, conditional)
+	c.mu.Unlock()
+	return conditional
+}
+
+// hasCondition reports whether stmt has an IF condition, which makes it a
+// lightweight transaction.
+func hasCondition(stmt string) bool {
+	words, _ := statementWords(stmt)
+	for _, w := range words {
+		if w.word == "IF" {
+			return true
+		}
+	}
+	return false
+}
+
 // routing key indexes LRU cache
 type routingKeyInfoLRU struct {
 	lru *lru.Cache
@@ -2070,8 +4030,10 @@ type routingKeyInfoLRU struct {
 }
 
 type routingKeyInfo struct {
-	indexes  []int
-	types    []TypeInfo
+	indexes []int
+	types   []TypeInfo
+	// columns are the names of the partition key columns.
+	columns  []string
 	keyspace string
 	table    string
 }
@@ -2173,6 +4135,10 @@ type ObservedQuery struct {
 	Keyspace  string
 	Statement string
 
+	// MetricName is a low cardinality name of the query for use as a metric
+	// label, see Query.MetricName.
+	MetricName string
+
 	// Values holds a slice of bound values for the query.
 	// Do not modify the values here, they are shared with multiple goroutines.
 	Values []interface{}
@@ -2180,12 +4146,27 @@ type ObservedQuery struct {
 	Start time.Time // time immediately before the query was called
 	End   time.Time // time immediately after the query returned
 
+	// Sent is the time the request was written to the connection, it is zero if
+	// no response was received. Sent.Sub(Start) is the time the query waited
+	// for the connection, including preparing the statement, and End.Sub(Sent)
+	// the time waiting for the response.
+	Sent time.Time
+
 	// Rows is the number of rows in the current iter.
 	// In paginated queries, rows from previous scans are not counted.
 	// Rows is not used in batch queries and remains at the default value
 	Rows int
 
-	// Host is the informations about the host that performed the query
+	// Page is the index of the page fetched by the query, the first page is
+	// number zero.
+	Page int
+
+	// Consistency is the consistency level of the attempt, a retry policy may
+	// have changed it since the previous attempt.
+	Consistency Consistency
+
+	// Host is the informations about the host that performed the query, the
+	// coordinator of the attempt, see Iter.Host.
 	Host *HostInfo
 
 	// The metrics per this host
@@ -2198,6 +4179,15 @@ type ObservedQuery struct {
 	// Attempt is the index of attempt at executing this query.
 	// The first attempt is number zero and any retries have non-zero attempt number.
 	Attempt int
+
+	// RoutingKeyAvailable is true when the host selection policy computed the
+	// routing key of the query, i.e. the query could be routed token aware.
+	RoutingKeyAvailable bool
+
+	// RoutingKeyErr is the reason the routing key was unavailable, either one of
+	// ErrRoutingKeyNotComputed, ErrRoutingKeyUnknown, ErrRoutingKeyValuesMismatch,
+	// ErrRoutingKeyUnset or the error returned while computing it.
+	RoutingKeyErr error
 }
 
 // QueryObserver is the interface implemented by query observers / stat collectors.
@@ -2207,6 +4197,8 @@ type QueryObserver interface {
 	// ObserveQuery gets called on every query to cassandra, including all queries in an iterator when paging is enabled.
 	// It doesn't get called if there is no query because the session is closed or there are no connections available.
 	// The error reported only shows query errors, i.e. if a SELECT is valid but finds no matches it will be nil.
+	// The context is the one of the query, see Query.WithContext, so that values of the caller such as a tracing
+	// span are available to the observer.
 	ObserveQuery(context.Context, ObservedQuery)
 }
 
@@ -2222,6 +4214,13 @@ type ObservedBatch struct {
 	Start time.Time // time immediately before the batch query was called
 	End   time.Time // time immediately after the batch query returned
 
+	// Sent is the time the batch was written to the connection, see
+	// ObservedQuery.Sent.
+	Sent time.Time
+
+	// Consistency is the consistency level of the attempt.
+	Consistency Consistency
+
 	// Host is the informations about the host that performed the batch
 	Host *HostInfo
 
@@ -2244,6 +4243,7 @@ type BatchObserver interface {
 	// It doesn't get called if there is no query because the session is closed or there are no connections available.
 	// The error reported only shows query errors, i.e. if a SELECT is valid but finds no matches it will be nil.
 	// Unlike QueryObserver.ObserveQuery it does no reporting on rows read.
+	// The context is the one of the batch, see Batch.WithContext.
 	ObserveBatch(context.Context, ObservedBatch)
 }
 
@@ -2264,6 +4264,75 @@ type ConnectObserver interface {
 	ObserveConnect(ObservedConnect)
 }
 
+// ObservedPrepare describes a PREPARE request, see PrepareObserver.
+type ObservedPrepare struct {
+	// Keyspace is the keyspace the statement was prepared in.
+	Keyspace  string
+	Statement string
+
+	// Host is the host the statement was prepared on.
+	Host *HostInfo
+
+	Start time.Time // time immediately before the request was sent
+	End   time.Time // time immediately after the response was received
+
+	// Reprepare is set if the statement is prepared again because the host
+	// reported it as unprepared, for example after it restarted.
+	Reprepare bool
+
+	// Err is the error of the request, if any.
+	Err error
+}
+
+// PrepareObserver is the interface implemented by prepared statement observers
+// / stat collectors.
+type PrepareObserver interface {
+	// ObservePrepare gets called when a PREPARE request is answered, or fails.
+	// Statements found in the prepared statement cache are not observed.
+	ObservePrepare(ObservedPrepare)
+}
+
+// ObservedPoolSaturation describes a change of the saturation of the
+// connection pool of a host, see PoolObserver.
+type ObservedPoolSaturation struct {
+	// Host is the host of the pool.
+	Host *HostInfo
+
+	// HostID is the host ID of Host.
+	HostID string
+
+	// Pool is the name of the pool in ClusterConfig.ConnectionPools, it is empty
+	// for the default pool of the host.
+	Pool string
+
+	// Saturated reports whether the pool became saturated, that is every one of
+	// its connections has all of its streams in flight, or stopped being
+	// saturated.
+	Saturated bool
+
+	// Since is when the pool became saturated or stopped being saturated, the
+	// observer is notified PoolSaturationDebounce after it.
+	Since time.Time
+
+	// Conns is the number of connections of the pool.
+	Conns int
+
+	// InFlight is the number of streams in flight over all the connections of
+	// the pool.
+	InFlight int
+}
+
+// PoolObserver is the interface implemented by connection pool observers /
+// stat collectors.
+type PoolObserver interface {
+	// ObservePoolSaturation gets called when the connection pool of a host
+	// becomes saturated or stops being saturated. The saturation of a pool is
+	// checked when a connection is picked from it, and once a change lasted
+	// ClusterConfig.PoolSaturationDebounce. It is called without any lock of
+	// the pool held.
+	ObservePoolSaturation(ObservedPoolSaturation)
+}
+
 type Error struct {
 	Code    int
 	Message string
@@ -2284,8 +4353,58 @@ var (
 	ErrNoKeyspace           = errors.New("no keyspace provided")
 	ErrKeyspaceDoesNotExist = errors.New("keyspace does not exist")
 	ErrNoMetadata           = errors.New("no metadata available")
+	// ErrNoReplicaAvailable is returned when executing a query with
+	// RequireReplica enabled if none of the replicas of its partition can be
+	// attempted.
+	ErrNoReplicaAvailable = errors.New("gocql: no replica of the partition is available")
+	// ErrLWTBatchMultiPartition is returned before executing a conditional
+	// batch whose statements are not all on the same partition of a table,
+	// which the server requires.
+	ErrLWTBatchMultiPartition = errors.New("gocql: conditional batch statements must all be on the same partition")
 )
 
+// Reasons a routing key is unavailable and the query is not routed token aware,
+// reported in ObservedQuery.RoutingKeyErr.
+var (
+	ErrRoutingKeyNotComputed    = errors.New("gocql: routing key was not requested by the host selection policy")
+	ErrRoutingKeyUnknown        = errors.New("gocql: partition key columns of the statement are unknown")
+	ErrRoutingKeyValuesMismatch = errors.New("gocql: bound values do not match the partition key columns")
+	ErrRoutingKeyUnset          = errors.New("gocql: partition key column value is unset")
+)
+
+// ErrRoutingKeyUnbound is returned when executing a query with StrictRouting
+// enabled whose partition key columns are not all bound. It matches
+// ErrRoutingKeyUnset with errors.Is.
+type ErrRoutingKeyUnbound struct {
+	// Columns are the partition key columns which are not bound.
+	Columns []string
+}
+
+func (e *ErrRoutingKeyUnbound) Error() string {
+	return fmt.Sprintf("gocql: partition key columns are not bound: %s", strings.Join(e.Columns, ", "))
+}
+
+func (e *ErrRoutingKeyUnbound) Is(target error) bool {
+	return target == ErrRoutingKeyUnset
+}
+
+// ErrKeyspaceNotFound is returned when creating a session with VerifyKeyspaceOnConnect
+// set and the configured keyspace does not exist. It matches ErrKeyspaceDoesNotExist
+// with errors.Is.
+type ErrKeyspaceNotFound struct {
+	Keyspace  string
+	Available []string
+}
+
+func (e *ErrKeyspaceNotFound) Error() string {
+	return fmt.Sprintf("gocql: keyspace %q does not exist, available keyspaces: %s",
+		e.Keyspace, strings.Join(e.Available, ", "))
+}
+
+func (e *ErrKeyspaceNotFound) Is(target error) bool {
+	return target == ErrKeyspaceDoesNotExist
+}
+
 type ErrProtocol struct{ error }
 
 func NewErrProtocol(format string, args ...interface{}) error {
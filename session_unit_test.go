@@ -4,8 +4,20 @@
 package gocql
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"github.com/gocql/gocql/internal/lru"
 )
 
 func TestAsyncSessionInit(t *testing.T) {
@@ -34,3 +46,1644 @@ func TestAsyncSessionInit(t *testing.T) {
 		t.Fatalf("unexpected error from void")
 	}
 }
+
+func TestErrKeyspaceNotFound(t *testing.T) {
+	var err error = &ErrKeyspaceNotFound{
+		Keyspace:  "exmaple",
+		Available: []string{"example", "system"},
+	}
+
+	if !errors.Is(err, ErrKeyspaceDoesNotExist) {
+		t.Fatal("expected ErrKeyspaceNotFound to match ErrKeyspaceDoesNotExist")
+	}
+
+	exp := `gocql: keyspace "exmaple" does not exist, available keyspaces: example, system`
+	if err.Error() != exp {
+		t.Fatalf("expected %q, got %q", exp, err.Error())
+	}
+}
+
+func TestReadFromEachReplica(t *testing.T) {
+	var addrs []string
+	var servers []*TestServer
+	for i := 0; i < 2; i++ {
+		srv := NewTestServer(t, defaultProto, context.Background())
+		defer srv.Stop()
+		servers = append(servers, srv)
+		addrs = append(addrs, srv.Address)
+	}
+
+	db, err := testCluster(defaultProto, addrs...).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	hosts := db.ring.allHosts()
+	if len(hosts) != 2 {
+		t.Fatalf("expected 2 hosts, got %d", len(hosts))
+	}
+
+	// a third replica which the session never connected to
+	down := &HostInfo{
+		hostId:         MustRandomUUID().String(),
+		connectAddress: net.IPv4(127, 0, 0, 3),
+		port:           9042,
+		state:          NodeDown,
+	}
+	replicas := append(hosts, down)
+	for i, host := range replicas {
+		host.mu.Lock()
+		host.tokens = []string{strconv.Itoa((i - 1) * 1000000)}
+		host.mu.Unlock()
+	}
+	ring, err := newTokenRing("Murmur3Partitioner", replicas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.metaMngr.metadata.Store(&ClusterMetadata{
+		tokenRing: ring,
+		replicas:  map[string]tokenRingReplicas{"": (&simpleStrategy{rf: 3}).replicaMap(ring)},
+	})
+
+	results, err := db.ReadFromEachReplica(context.Background(), "kill", []byte("key"))
+	var replicaErrs ReplicaErrors
+	if !errors.As(err, &replicaErrs) {
+		t.Fatalf("expected ReplicaErrors, got %v", err)
+	}
+	if len(replicaErrs) != 1 || replicaErrs[down.HostID()] == nil {
+		t.Fatalf("expected only the down replica to be reported, got %v", replicaErrs)
+	}
+
+	if len(results) != 3 {
+		t.Fatalf("expected a result for each of the 3 replicas, got %d", len(results))
+	}
+	if iter, ok := results[down.HostID()]; !ok || iter != nil {
+		t.Fatalf("expected the down replica to have a nil iter, got %v", iter)
+	}
+	for _, host := range hosts {
+		iter := results[host.HostID()]
+		if iter == nil {
+			t.Fatalf("missing iter for replica %s", host.HostID())
+		}
+		if iter.Host() != host {
+			t.Fatalf("expected query to be executed on %v, got %v", host, iter.Host())
+		}
+		if err := iter.Close(); err == nil {
+			t.Fatal("expected the killed query to return an error")
+		}
+	}
+
+	for _, srv := range servers {
+		if n := atomic.LoadInt64(&srv.nKillReq); n != 1 {
+			t.Fatalf("expected each replica to be queried once, %s got %d queries", srv.Address, n)
+		}
+	}
+}
+
+func TestReconcileSeedHosts(t *testing.T) {
+	srv1 := NewTestServer(t, defaultProto, context.Background())
+	defer srv1.Stop()
+	// policies key hosts by IP, so the new address must differ from the old one
+	srv2 := NewTestServerWithAddress("127.0.0.2:0", t, defaultProto, context.Background())
+	defer srv2.Stop()
+
+	cluster := testCluster(defaultProto, srv1.Address)
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// the seed now resolves to a different address
+	db.cfg.Hosts = []string{srv2.Address}
+	db.reconcileSeedHosts()
+
+	hosts := db.ring.allHosts()
+	if len(hosts) != 1 {
+		t.Fatalf("expected 1 host after reconciling, got %d", len(hosts))
+	}
+	if addr := hosts[0].ConnectAddressAndPort(); addr != srv2.Address {
+		t.Fatalf("expected host %s, got %s", srv2.Address, addr)
+	}
+	if len(db.ring.endpoints) != 1 || db.ring.endpoints[0].ConnectAddressAndPort() != srv2.Address {
+		t.Fatalf("expected endpoints to be replaced, got %v", db.ring.endpoints)
+	}
+	if pool, ok := db.pool.getPool(hosts[0]); !ok || pool == nil {
+		t.Fatal("expected a connection pool for the new host")
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !hosts[0].IsUp() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the new host to come up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := db.Query("void").Exec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReconcileSeedHostsRefreshesRing(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// hosts are discovered from the cluster by default, the ring is refreshed
+	// from the control connection rather than made of the contact points
+	var refreshes int32
+	db.ringRefresher.stop()
+	db.ringRefresher = newRefreshDebouncer(time.Second, func() error {
+		atomic.AddInt32(&refreshes, 1)
+		return nil
+	})
+	db.control = &controlConn{}
+	defer func() { db.control = nil }()
+
+	db.reconcileSeedHosts()
+	if n := atomic.LoadInt32(&refreshes); n != 0 {
+		t.Fatalf("expected no refresh while the contact points resolve the same, got %d", n)
+	}
+
+	db.cfg.Hosts = []string{"127.0.0.2:9042"}
+	db.reconcileSeedHosts()
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Fatalf("expected the ring to be refreshed once the contact points changed, got %d", n)
+	}
+	hosts := db.ring.allHosts()
+	if len(hosts) != 1 || hosts[0].ConnectAddressAndPort() != srv.Address {
+		t.Fatalf("expected the hosts not to be replaced by the contact points, got %v", hosts)
+	}
+	if len(db.ring.endpoints) != 1 || db.ring.endpoints[0].ConnectAddressAndPort() != "127.0.0.2:9042" {
+		t.Fatalf("expected endpoints to be replaced, got %v", db.ring.endpoints)
+	}
+}
+
+func TestIsFullTableAggregate(t *testing.T) {
+	testCases := []struct {
+		input string
+		exp   bool
+	}{
+		{"SELECT COUNT(*) FROM ks.tbl", true},
+		{"select count(1) from tbl", true},
+		{"SELECT max(ts), min(ts) FROM tbl", true},
+		{"SELECT avg(v) FROM tbl WHERE v > 1 ALLOW FILTERING", true},
+		{"  SELECT\n\tsum (v)\nFROM tbl;", true},
+		{"SELECT COUNT(*) FROM tbl WHERE id = ?", false},
+		{"SELECT * FROM tbl", false},
+		{"SELECT counter FROM tbl", false},
+		{"UPDATE tbl SET v = 1 WHERE id = ?", false},
+		{"", false},
+	}
+
+	for _, tc := range testCases {
+		v := isFullTableAggregate(tc.input)
+		if v != tc.exp {
+			t.Fatalf("expected %v but got %v for statement %q", tc.exp, v, tc.input)
+		}
+	}
+}
+
+func TestQueryWithRoutingKeyFunc(t *testing.T) {
+	var got []interface{}
+	qry := &Query{routingInfo: &queryRoutingInfo{}, values: []interface{}{"a", 1}}
+	qry.WithRoutingKeyFunc(func(values []interface{}) ([]byte, error) {
+		got = values
+		return []byte("key"), nil
+	})
+
+	key, err := qry.GetRoutingKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key) != "key" {
+		t.Fatalf("expected routing key %q, got %q", "key", key)
+	}
+	if len(got) != 2 || got[0] != "a" || got[1] != 1 {
+		t.Fatalf("expected the bound values to be passed, got %v", got)
+	}
+
+	qry.RoutingKey([]byte("explicit"))
+	if key, err := qry.GetRoutingKey(); err != nil || string(key) != "explicit" {
+		t.Fatalf("expected the explicit routing key to take precedence, got %q, %v", key, err)
+	}
+
+	errRouting := errors.New("no routing key")
+	qry = &Query{routingInfo: &queryRoutingInfo{}}
+	qry.WithRoutingKeyFunc(func([]interface{}) ([]byte, error) {
+		return nil, errRouting
+	})
+	if _, err := qry.GetRoutingKey(); err != errRouting {
+		t.Fatalf("expected %v, got %v", errRouting, err)
+	}
+}
+
+type observedQueries []ObservedQuery
+
+func (o *observedQueries) ObserveQuery(ctx context.Context, q ObservedQuery) {
+	*o = append(*o, q)
+}
+
+func TestObservedQueryRoutingKey(t *testing.T) {
+	var observed observedQueries
+	qry := &Query{
+		routingInfo: &queryRoutingInfo{},
+		metrics:     &queryMetrics{m: make(map[string]*hostMetrics)},
+		observer:    &observed,
+	}
+	host := &HostInfo{connectAddress: net.IPv4(127, 0, 0, 1), port: 9042}
+
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+	qry.RoutingKey([]byte("key"))
+	if _, err := qry.GetRoutingKey(); err != nil {
+		t.Fatal(err)
+	}
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+
+	if len(observed) != 2 {
+		t.Fatalf("expected 2 observed queries, got %d", len(observed))
+	}
+	if observed[0].RoutingKeyAvailable || observed[0].RoutingKeyErr != ErrRoutingKeyNotComputed {
+		t.Fatalf("expected the routing key not to be computed, got %v", observed[0].RoutingKeyErr)
+	}
+	if !observed[1].RoutingKeyAvailable || observed[1].RoutingKeyErr != nil {
+		t.Fatalf("expected the routing key to be available, got %v", observed[1].RoutingKeyErr)
+	}
+}
+
+func TestObservedQueryMetricName(t *testing.T) {
+	var observed observedQueries
+	qry := &Query{
+		stmt:        "SELECT * FROM users WHERE id = 42",
+		routingInfo: &queryRoutingInfo{},
+		metrics:     &queryMetrics{m: make(map[string]*hostMetrics)},
+		observer:    &observed,
+	}
+	host := &HostInfo{connectAddress: net.IPv4(127, 0, 0, 1), port: 9042}
+
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+	qry.WithMetricName("get_user")
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+
+	if len(observed) != 2 {
+		t.Fatalf("expected 2 observed queries, got %d", len(observed))
+	}
+	if name := observed[0].MetricName; name != "SELECT * FROM users WHERE id = ?" {
+		t.Fatalf("expected the statement fingerprint, got %q", name)
+	}
+	if name := observed[1].MetricName; name != "get_user" {
+		t.Fatalf("expected get_user, got %q", name)
+	}
+}
+
+func TestQueryBoundValues(t *testing.T) {
+	var observed observedQueries
+	qry := &Query{
+		stmt:        "INSERT INTO users (id, password) VALUES (?, ?)",
+		routingInfo: &queryRoutingInfo{},
+		metrics:     &queryMetrics{m: make(map[string]*hostMetrics)},
+		observer:    &observed,
+	}
+	host := &HostInfo{connectAddress: net.IPv4(127, 0, 0, 1), port: 9042}
+
+	if values := qry.BoundValues(); values != nil {
+		t.Fatalf("expected no values, got %v", values)
+	}
+
+	qry.Bind(42, "secret").RedactBoundValue(1).RedactBoundValue(5)
+	values := qry.BoundValues()
+	if exp := []interface{}{42, RedactedValue{}}; !reflect.DeepEqual(values, exp) {
+		t.Fatalf("expected %v, got %v", exp, values)
+	}
+	values[0] = 43
+	if qry.values[0] != 42 || qry.values[1] != "secret" {
+		t.Fatalf("expected the bound values not to be modified, got %v", qry.values)
+	}
+	if s := qry.String(); strings.Contains(s, "secret") || !strings.Contains(s, "<redacted>") {
+		t.Fatalf("expected the value to be redacted, got %s", s)
+	}
+
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+	qry.Bind(43, "other")
+	qry.attempt("", time.Now(), time.Now(), &Iter{}, host)
+	if len(observed) != 2 {
+		t.Fatalf("expected 2 observed queries, got %d", len(observed))
+	}
+	if exp := []interface{}{42, RedactedValue{}}; !reflect.DeepEqual(observed[0].Values, exp) {
+		t.Fatalf("expected %v to be observed, got %v", exp, observed[0].Values)
+	}
+	if exp := []interface{}{43, RedactedValue{}}; !reflect.DeepEqual(observed[1].Values, exp) {
+		t.Fatalf("expected %v to be observed, got %v", exp, observed[1].Values)
+	}
+}
+
+func TestCheckRoutingKeyValues(t *testing.T) {
+	info := &routingKeyInfo{indexes: []int{0, 1}}
+	var nilPtr *int
+
+	testCases := []struct {
+		info   *routingKeyInfo
+		values []interface{}
+		exp    error
+	}{
+		{nil, []interface{}{1}, ErrRoutingKeyUnknown},
+		{info, []interface{}{1}, ErrRoutingKeyValuesMismatch},
+		{info, []interface{}{1, nil}, ErrRoutingKeyUnset},
+		{info, []interface{}{UnsetValue, 1}, ErrRoutingKeyUnset},
+		{info, []interface{}{1, nilPtr}, ErrRoutingKeyUnset},
+		{info, []interface{}{1, 2}, nil},
+	}
+
+	for _, tc := range testCases {
+		if err := checkRoutingKeyValues(tc.info, tc.values); err != tc.exp {
+			t.Errorf("expected %v for values %v, got %v", tc.exp, tc.values, err)
+		}
+	}
+}
+
+func TestSessionQueryWith(t *testing.T) {
+	s := &Session{cons: One, pageSize: 5000}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	defaults := []QueryOption{WithConsistency(Quorum), WithIdempotent(true)}
+	qry := s.QueryWith("SELECT * FROM t WHERE id = ?",
+		append(defaults, WithValues(1), WithPageSize(100), WithSerialConsistency(LocalSerial),
+			WithQueryTimestamp(42), WithQueryContext(ctx), WithPriority(3))...)
+
+	if qry.Statement() != "SELECT * FROM t WHERE id = ?" {
+		t.Fatalf("unexpected statement %q", qry.Statement())
+	}
+	if values := qry.Values(); len(values) != 1 || values[0] != 1 {
+		t.Fatalf("expected values [1], got %v", values)
+	}
+	if qry.GetConsistency() != Quorum {
+		t.Fatalf("expected consistency %v, got %v", Quorum, qry.GetConsistency())
+	}
+	if !qry.IsIdempotent() {
+		t.Fatal("expected the query to be idempotent")
+	}
+	if qry.pageSize != 100 || qry.serialCons != LocalSerial || qry.defaultTimestampValue != 42 || qry.priority != 3 {
+		t.Fatalf("options not applied: page size %d, serial consistency %v, timestamp %d, priority %d",
+			qry.pageSize, qry.serialCons, qry.defaultTimestampValue, qry.priority)
+	}
+	if qry.Context() != ctx {
+		t.Fatal("expected the query context to be set")
+	}
+
+	// the options are reusable and don't leak between queries
+	qry = s.QueryWith("SELECT * FROM t", defaults...)
+	if qry.GetConsistency() != Quorum || !qry.IsIdempotent() || qry.pageSize != 5000 || len(qry.Values()) != 0 {
+		t.Fatalf("unexpected query %+v", qry)
+	}
+}
+
+func TestReadYourWritesConsistency(t *testing.T) {
+	tests := []struct {
+		write, read       Consistency
+		expWrite, expRead Consistency
+	}{
+		{Quorum, Quorum, Quorum, Quorum},
+		{All, One, All, One},
+		{One, All, One, All},
+		{EachQuorum, Quorum, EachQuorum, Quorum},
+		{LocalQuorum, LocalQuorum, LocalQuorum, LocalQuorum},
+		{LocalQuorum, One, LocalQuorum, LocalQuorum},
+		{EachQuorum, LocalOne, EachQuorum, LocalQuorum},
+		{Quorum, LocalQuorum, Quorum, Quorum},
+		{One, One, Quorum, Quorum},
+		{LocalOne, Quorum, Quorum, Quorum},
+	}
+	for _, test := range tests {
+		write, read := readYourWritesConsistency(test.write, test.read)
+		if write != test.expWrite || read != test.expRead {
+			t.Errorf("write %v read %v: expected %v and %v, got %v and %v",
+				test.write, test.read, test.expWrite, test.expRead, write, read)
+		}
+	}
+}
+
+func TestIterScanBlobReader(t *testing.T) {
+	f := newFramer(nil, protoVersion4)
+	blobs := [][]byte{[]byte("first blob"), nil}
+	for i, blob := range blobs {
+		f.writeBytes(encInt(int32(i)))
+		f.writeBytes(blob)
+	}
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       2,
+			actualColCount: 2,
+			columns: []ColumnInfo{
+				{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+				{Name: "data", TypeInfo: NativeType{proto: protoVersion4, typ: TypeBlob}},
+			},
+		},
+		numRows: len(blobs),
+		framer:  f,
+	}
+
+	if _, err := iter.ScanBlobReader(1); err == nil {
+		t.Fatal("expected an error before scanning a row")
+	}
+
+	var id int
+	for i, blob := range blobs {
+		if !iter.Scan(&id, nil) {
+			t.Fatal(iter.Close())
+		}
+		r, err := iter.ScanBlobReader(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != i || !bytes.Equal(data, blob) {
+			t.Fatalf("row %d: expected %q, got id %d and %q", i, blob, id, data)
+		}
+	}
+
+	if _, err := iter.ScanBlobReader(0); err == nil {
+		t.Fatal("expected an error for a column which is not a blob")
+	}
+	if _, err := iter.ScanBlobReader(2); err == nil {
+		t.Fatal("expected an error for a column index out of range")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIterCollectionElements(t *testing.T) {
+	mapType := CollectionType{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeMap},
+		Key:        NativeType{proto: protoVersion4, typ: TypeVarchar},
+		Elem:       NativeType{proto: protoVersion4, typ: TypeInt},
+	}
+	listType := CollectionType{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeList},
+		Elem:       NativeType{proto: protoVersion4, typ: TypeInt},
+	}
+	m, err := Marshal(mapType, map[string]int{"a": 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	list, err := Marshal(listType, []int{3, 1, 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := newFramer(nil, protoVersion4)
+	f.writeBytes(m)
+	f.writeBytes(list)
+	f.writeBytes(nil)
+	f.writeBytes(nil)
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       2,
+			actualColCount: 2,
+			columns: []ColumnInfo{
+				{Name: "attrs", TypeInfo: mapType},
+				{Name: "scores", TypeInfo: listType},
+			},
+		},
+		numRows: 2,
+		framer:  f,
+	}
+
+	if _, err := iter.CollectionElements(0); err == nil {
+		t.Fatal("expected an error before scanning a row")
+	}
+	if !iter.Scan(nil, nil) {
+		t.Fatal(iter.Close())
+	}
+
+	r, err := iter.CollectionElements(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		key   string
+		value int
+	)
+	if r.Len() != 1 || !r.Next() {
+		t.Fatalf("expected 1 map entry, got %d: %v", r.Len(), r.Err())
+	}
+	if err := r.Scan(&key); err == nil {
+		t.Fatal("expected an error scanning a map entry into a single value")
+	}
+	if err := r.Scan(&key, &value); err != nil {
+		t.Fatal(err)
+	}
+	if key != "a" || value != 1 || r.Next() {
+		t.Fatalf("expected the single entry a=1, got %s=%d", key, value)
+	}
+
+	r, err = iter.CollectionElements(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []int
+	for r.Next() {
+		if err := r.Scan(&value); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, value)
+	}
+	if r.Err() != nil || !reflect.DeepEqual(got, []int{3, 1, 2}) {
+		t.Fatalf("expected the elements in wire order, got %v: %v", got, r.Err())
+	}
+	if err := r.Scan(&value); err == nil {
+		t.Fatal("expected an error scanning past the last element")
+	}
+
+	// null collections have no elements
+	if !iter.Scan(nil, nil) {
+		t.Fatal(iter.Close())
+	}
+	r, err = iter.CollectionElements(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Len() != 0 || r.Next() {
+		t.Fatal("expected a null list to have no elements")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIterScanTuple(t *testing.T) {
+	tupleType := TupleTypeInfo{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeTuple},
+		Elems: []TypeInfo{
+			NativeType{proto: protoVersion4, typ: TypeVarchar},
+			NativeType{proto: protoVersion4, typ: TypeInt},
+		},
+	}
+	tuple := func(elems ...[]byte) []byte {
+		var b []byte
+		for _, elem := range elems {
+			if elem == nil {
+				b = append(b, encInt(-1)...)
+				continue
+			}
+			b = append(b, encInt(int32(len(elem)))...)
+			b = append(b, elem...)
+		}
+		return b
+	}
+
+	f := newFramer(nil, protoVersion4)
+	f.writeBytes(tuple([]byte("a"), encInt(1)))
+	f.writeBytes(encInt(10))
+	f.writeBytes(tuple([]byte("b"), nil))
+	f.writeBytes(encInt(20))
+	f.writeBytes(nil)
+	f.writeBytes(encInt(30))
+	f.writeBytes(tuple([]byte("c"), encInt(3)))
+	f.writeBytes(encInt(40))
+	f.writeBytes(tuple([]byte("d"), encInt(4)))
+	f.writeBytes(encInt(50))
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       2,
+			actualColCount: 3,
+			columns: []ColumnInfo{
+				{Name: "pair", TypeInfo: tupleType},
+				{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+			},
+		},
+		numRows: 5,
+		framer:  f,
+	}
+
+	var (
+		name string
+		n    *int
+		id   int
+	)
+	if err := iter.ScanTuple(0, &name, &n); err == nil {
+		t.Fatal("expected an error before scanning a row")
+	}
+	if !iter.Scan(nil, nil, &id) || id != 10 {
+		t.Fatalf("expected the tuple to be skipped and id 10, got %d: %v", id, iter.Close())
+	}
+	if err := iter.ScanTuple(1, &name, &n); err == nil {
+		t.Fatal("expected an error for a column which is not a tuple")
+	}
+	if err := iter.ScanTuple(0, &name); err == nil {
+		t.Fatal("expected an error for a missing dest")
+	}
+	if err := iter.ScanTuple(0, &id, &n); err == nil {
+		t.Fatal("expected an error for a dest of the wrong type")
+	}
+	if err := iter.ScanTuple(0, &name, &n); err != nil {
+		t.Fatal(err)
+	}
+	if name != "a" || n == nil || *n != 1 {
+		t.Fatalf("expected (a, 1), got (%q, %v)", name, n)
+	}
+
+	if !iter.Scan(nil, nil, &id) {
+		t.Fatal(iter.Close())
+	}
+	var count int
+	if err := iter.ScanTuple(0, nil, &count); err != nil {
+		t.Fatal(err)
+	}
+	if err := iter.ScanTuple(0, &name, &n); err != nil {
+		t.Fatal(err)
+	}
+	if name != "b" || n != nil || count != 0 {
+		t.Fatalf("expected (b, nil), got (%q, %v) and %d", name, n, count)
+	}
+	var pair struct {
+		Name  string
+		Count *int
+	}
+	if err := iter.ScanTuple(0, &pair); err != nil {
+		t.Fatal(err)
+	}
+	if pair.Name != "b" || pair.Count != nil {
+		t.Fatalf("expected the struct (b, nil), got %+v", pair)
+	}
+
+	// a null tuple
+	if !iter.Scan(nil, nil, &id) {
+		t.Fatal(iter.Close())
+	}
+	if err := iter.ScanTuple(0, &name, &n); err != nil {
+		t.Fatal(err)
+	}
+	if name != "" || n != nil {
+		t.Fatalf("expected a null tuple to have null elements, got (%q, %v)", name, n)
+	}
+
+	// a nil dest skips only its element
+	if !iter.Scan(nil, &n, &id) || n == nil || *n != 3 || id != 40 {
+		t.Fatalf("expected the first element to be skipped, got %v and %d: %v", n, id, iter.Close())
+	}
+	n = nil
+	if !iter.Scan(&name, nil, &id) || name != "d" || n != nil || id != 50 {
+		t.Fatalf("expected the second element to be skipped, got %q and %d: %v", name, id, iter.Close())
+	}
+}
+
+func TestIterScanMapOrdered(t *testing.T) {
+	mapType := CollectionType{
+		NativeType: NativeType{proto: protoVersion4, typ: TypeMap},
+		Key:        NativeType{proto: protoVersion4, typ: TypeVarchar},
+		Elem:       NativeType{proto: protoVersion4, typ: TypeInt},
+	}
+	// the entries in wire order, marshaling a Go map would not keep any order
+	entries := []struct {
+		key   string
+		value int32
+	}{{"c", 3}, {"a", 1}, {"b", 2}}
+	m := encInt(int32(len(entries)))
+	for _, e := range entries {
+		m = append(m, encInt(int32(len(e.key)))...)
+		m = append(m, e.key...)
+		m = append(m, encInt(4)...)
+		m = append(m, encInt(e.value)...)
+	}
+
+	f := newFramer(nil, protoVersion4)
+	f.writeBytes(m)
+	f.writeBytes([]byte{0, 0, 0, 1})
+	f.writeBytes(nil)
+	f.writeBytes(nil)
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       2,
+			actualColCount: 2,
+			columns: []ColumnInfo{
+				{Name: "attrs", TypeInfo: mapType},
+				{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+			},
+		},
+		numRows: 2,
+		framer:  f,
+	}
+
+	var (
+		keys   []string
+		values []int
+	)
+	if err := iter.ScanMapOrdered(0, &keys, &values); err == nil {
+		t.Fatal("expected an error before scanning a row")
+	}
+	if !iter.Scan(nil, nil) {
+		t.Fatal(iter.Close())
+	}
+	if err := iter.ScanMapOrdered(0, keys, &values); err == nil {
+		t.Fatal("expected an error for keys which are not a pointer to a slice")
+	}
+	if err := iter.ScanMapOrdered(1, &keys, &values); err == nil {
+		t.Fatal("expected an error for a column which is not a map")
+	}
+	if err := iter.ScanMapOrdered(0, &keys, &values); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(keys, []string{"c", "a", "b"}) || !reflect.DeepEqual(values, []int{3, 1, 2}) {
+		t.Fatalf("expected the entries in wire order, got %v %v", keys, values)
+	}
+
+	// a null map sets the slices to nil
+	if !iter.Scan(nil, nil) {
+		t.Fatal(iter.Close())
+	}
+	if err := iter.ScanMapOrdered(0, &keys, &values); err != nil {
+		t.Fatal(err)
+	}
+	if keys != nil || values != nil {
+		t.Fatalf("expected nil slices for a null map, got %v %v", keys, values)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestQueryStrictRouting(t *testing.T) {
+	const stmt = "SELECT * FROM events WHERE bucket = ? AND day = ? AND ts > ?"
+	s := &Session{routingKeyInfoCache: routingKeyInfoLRU{lru: lru.New(10)}}
+	s.routingKeyInfoCache.lru.Add(stmt, &inflightCachedEntry{value: &routingKeyInfo{
+		indexes: []int{0, 1},
+		types:   []TypeInfo{NativeType{proto: protoVersion4, typ: TypeInt}, NativeType{proto: protoVersion4, typ: TypeDate}},
+		columns: []string{"bucket", "day"},
+	}})
+	newQuery := func(values ...interface{}) *Query {
+		return &Query{session: s, stmt: stmt, values: values, routingInfo: &queryRoutingInfo{}, strictRouting: true}
+	}
+
+	var day *time.Time
+	err := s.executeQuery(newQuery(1, day)).Close()
+	var unbound *ErrRoutingKeyUnbound
+	if !errors.As(err, &unbound) || !reflect.DeepEqual(unbound.Columns, []string{"day"}) {
+		t.Fatalf("expected the day column to be unbound, got %v", err)
+	}
+	if !errors.Is(err, ErrRoutingKeyUnset) {
+		t.Fatalf("expected %v to match %v", err, ErrRoutingKeyUnset)
+	}
+
+	err = newQuery(UnsetValue).checkRoutingKeyBound()
+	if !errors.As(err, &unbound) || !reflect.DeepEqual(unbound.Columns, []string{"bucket", "day"}) {
+		t.Fatalf("expected the bucket and day columns to be unbound, got %v", err)
+	}
+
+	if err := newQuery(1, time.Now(), time.Now()).checkRoutingKeyBound(); err != nil {
+		t.Fatalf("expected the partition key to be bound, got %v", err)
+	}
+	if err := newQuery().RoutingKey([]byte{1}).checkRoutingKeyBound(); err != nil {
+		t.Fatalf("expected a query with a routing key not to be checked, got %v", err)
+	}
+}
+
+func TestQueryRequireReplica(t *testing.T) {
+	replica1 := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 1), state: NodeUp}
+	replica2 := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 2), state: NodeDown}
+	other := &HostInfo{connectAddress: net.IPv4(10, 0, 0, 3), state: NodeUp}
+
+	s := &Session{}
+	newQuery := func() *Query {
+		return &Query{session: s, stmt: "SELECT * FROM t WHERE id = ?", routingInfo: &queryRoutingInfo{}, routingKeyspace: "ks"}
+	}
+
+	_, err := s.upReplicasOf(newQuery().RoutingKey([]byte{1}))
+	if !errors.Is(err, ErrNoReplicaAvailable) {
+		t.Fatalf("expected %v without a token ring, got %v", ErrNoReplicaAvailable, err)
+	}
+
+	s.metaMngr.metadata.Store(&ClusterMetadata{
+		tokenRing: &TokenRing{partitioner: murmur3Partitioner{}},
+		replicas: map[string]tokenRingReplicas{
+			"ks": {{token: murmur3Token(0), hosts: []*HostInfo{replica1, replica2}}},
+		},
+	})
+	replicas, err := s.upReplicasOf(newQuery().RoutingKey([]byte{1}))
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(replicas, []*HostInfo{replica1}) {
+		t.Fatalf("expected the replica which is up, got %v", replicas)
+	}
+
+	replica1.setState(NodeDown)
+	err = s.executeQuery(newQuery().RoutingKey([]byte{1}).RequireReplica(true)).Close()
+	if err != ErrNoReplicaAvailable {
+		t.Fatalf("expected %v when no replica is up, got %v", ErrNoReplicaAvailable, err)
+	}
+
+	replica2.setState(NodeUp)
+	policyHosts := []*HostInfo{other, replica2, nil, replica1}
+	next := replicasOnlyIter(func() SelectedHost {
+		if len(policyHosts) == 0 {
+			return nil
+		}
+		host := policyHosts[0]
+		policyHosts = policyHosts[1:]
+		return (*selectedHost)(host)
+	}, []*HostInfo{replica1, replica2})
+
+	var picked []*HostInfo
+	for host := next(); host != nil; host = next() {
+		picked = append(picked, host.Info())
+	}
+	if !reflect.DeepEqual(picked, []*HostInfo{replica2, replica1}) {
+		t.Fatalf("expected the replicas in the order of the policy, got %v", picked)
+	}
+}
+
+func TestIterScanWriteTime(t *testing.T) {
+	written := time.Date(2024, 3, 1, 12, 30, 15, 123456000, time.UTC)
+	f := newFramer(nil, protoVersion4)
+	f.writeBytes(encBigInt(written.UnixNano() / 1e3))
+	f.writeBytes(nil)
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       1,
+			actualColCount: 1,
+			columns: []ColumnInfo{
+				{Name: "writetime(val)", TypeInfo: NativeType{proto: protoVersion4, typ: TypeBigInt}},
+			},
+		},
+		numRows: 2,
+		framer:  f,
+	}
+
+	if !iter.Scan(nil) {
+		t.Fatal(iter.Close())
+	}
+	ts, ok, err := iter.ScanWriteTime(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok || !ts.Equal(written) || ts.Location() != time.UTC {
+		t.Fatalf("expected write time %v, got %v (%v)", written, ts, ok)
+	}
+
+	// never written
+	if !iter.Scan(nil) {
+		t.Fatal(iter.Close())
+	}
+	ts, ok, err = iter.ScanWriteTime(0)
+	if err != nil || ok || !ts.IsZero() {
+		t.Fatalf("expected no write time, got %v, %v, %v", ts, ok, err)
+	}
+	if _, _, err := iter.ScanWriteTime(1); err == nil {
+		t.Fatal("expected an error for a column index out of range")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIterStats(t *testing.T) {
+	page := func(values ...int32) *Iter {
+		f := newFramer(nil, protoVersion4)
+		for _, v := range values {
+			f.writeBytes(encInt(v))
+		}
+		return &Iter{
+			meta: resultMetadata{
+				colCount:       1,
+				actualColCount: 1,
+				columns:        []ColumnInfo{{Name: "val", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}}},
+			},
+			numRows: len(values),
+			framer:  f,
+			stats:   IterStats{Pages: 1, Rows: len(values), WaitTime: time.Millisecond},
+		}
+	}
+
+	iter := page(1, 2)
+	iter.next = &nextIter{pos: 1, next: page(3)}
+	// the next page was already fetched
+	iter.next.once.Do(func() {})
+
+	var got []int32
+	var v int32
+	for iter.Scan(&v) {
+		got = append(got, v)
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []int32{1, 2, 3}) {
+		t.Fatalf("expected rows 1, 2, 3, got %v", got)
+	}
+
+	stats := iter.Stats()
+	if stats.Pages != 2 || stats.Rows != 3 || stats.Bytes != 12 || stats.WaitTime != 2*time.Millisecond {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIterNextColumns(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "id", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}},
+		{Name: "name", TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}},
+		{Name: "score", TypeInfo: NativeType{proto: protoVersion4, typ: TypeDouble}},
+	}
+	page := func(rows ...[][]byte) *Iter {
+		f := newFramer(nil, protoVersion4)
+		for _, row := range rows {
+			for _, col := range row {
+				f.writeBytes(col)
+			}
+		}
+		return &Iter{
+			meta:    resultMetadata{colCount: 3, actualColCount: 3, columns: columns},
+			numRows: len(rows),
+			framer:  f,
+			stats:   IterStats{Pages: 1, Rows: len(rows)},
+		}
+	}
+	double := func(v float64) []byte {
+		data, err := Marshal(columns[2].TypeInfo, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+
+	iter := page(
+		[][]byte{encInt(1), []byte("a"), double(0.5)},
+		[][]byte{encInt(2), nil, double(1.5)},
+		[][]byte{encInt(3), []byte("c"), nil},
+	)
+	iter.next = &nextIter{pos: 3, next: page([][]byte{encInt(4), []byte("d"), double(2)})}
+	// the next page was already fetched
+	iter.next.once.Do(func() {})
+
+	// rows left after Scan are read by column
+	var (
+		id    int
+		name  string
+		score float64
+	)
+	if !iter.Scan(&id, &name, &score) || id != 1 {
+		t.Fatalf("expected to scan row 1, got %d: %v", id, iter.Close())
+	}
+
+	cols, ok := iter.NextColumns()
+	if !ok {
+		t.Fatal(iter.Close())
+	}
+	if len(cols) != 3 || cols[0].Info.Name != "id" {
+		t.Fatalf("unexpected columns %+v", cols)
+	}
+	if ids := cols[0].Values.([]int32); !reflect.DeepEqual(ids, []int32{2, 3}) {
+		t.Errorf("expected ids 2, 3, got %v", ids)
+	}
+	if names := cols[1].Values.([]string); !reflect.DeepEqual(names, []string{"", "c"}) {
+		t.Errorf("expected names \"\", c, got %q", names)
+	}
+	if !reflect.DeepEqual(cols[1].Nulls, []bool{true, false}) {
+		t.Errorf("expected the first name to be null, got %v", cols[1].Nulls)
+	}
+	if !reflect.DeepEqual(cols[2].Nulls, []bool{false, true}) {
+		t.Errorf("expected the second score to be null, got %v", cols[2].Nulls)
+	}
+
+	cols, ok = iter.NextColumns()
+	if !ok {
+		t.Fatal(iter.Close())
+	}
+	if scores := cols[2].Values.([]float64); !reflect.DeepEqual(scores, []float64{2}) {
+		t.Errorf("expected score 2, got %v", scores)
+	}
+
+	if _, ok := iter.NextColumns(); ok {
+		t.Fatal("expected the end of the results")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := iter.Stats(); stats.Pages != 2 || stats.Rows != 4 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestIterHasMorePages(t *testing.T) {
+	page := func(pagingState []byte, values ...int32) *Iter {
+		f := newFramer(nil, protoVersion4)
+		for _, v := range values {
+			f.writeBytes(encInt(v))
+		}
+		return &Iter{
+			meta: resultMetadata{
+				colCount:       1,
+				actualColCount: 1,
+				columns:        []ColumnInfo{{Name: "val", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}}},
+				pagingState:    pagingState,
+			},
+			numRows: len(values),
+			framer:  f,
+		}
+	}
+
+	iter := page([]byte{1}, 1)
+	iter.next = &nextIter{pos: 1, next: page(nil, 2)}
+	iter.next.once.Do(func() {})
+	if !iter.HasMorePages() || !iter.WillPageAutomatically() {
+		t.Fatal("expected the first page to have more pages fetched automatically")
+	}
+	var v int32
+	if !iter.Scan(&v) || !iter.Scan(&v) || v != 2 {
+		t.Fatalf("expected to scan both pages, got %d: %v", v, iter.Close())
+	}
+	if iter.HasMorePages() || iter.WillPageAutomatically() {
+		t.Fatal("expected the last page to have no more pages")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// pages are not fetched automatically when paging manually with PageState
+	iter = page([]byte{1}, 1)
+	if !iter.HasMorePages() || iter.WillPageAutomatically() {
+		t.Fatal("expected more pages to be fetched manually")
+	}
+}
+
+func TestIterBufferReuse(t *testing.T) {
+	columns := []ColumnInfo{
+		{Name: "name", TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}},
+		{Name: "data", TypeInfo: NativeType{proto: protoVersion4, typ: TypeBlob}},
+	}
+	page := func(rows ...string) *Iter {
+		f := newFramer(nil, protoVersion4)
+		for _, row := range rows {
+			f.writeBytes([]byte(row))
+			f.writeBytes([]byte("data-" + row))
+		}
+		return &Iter{
+			meta:    resultMetadata{colCount: 2, actualColCount: 2, columns: columns},
+			numRows: len(rows),
+			framer:  f,
+		}
+	}
+
+	iter := page("a", "b").EnableBufferReuse()
+	iter.next = &nextIter{pos: 2, next: page("c")}
+	iter.next.once.Do(func() {})
+
+	var (
+		name string
+		data []byte
+	)
+	buf := iter.framer.buf
+	if !iter.Scan(&name, &data) || name != "a" || string(data) != "data-a" {
+		t.Fatalf("expected row a, got %q %q: %v", name, data, iter.Close())
+	}
+	if &data[0] != &buf[4+1+4] {
+		t.Fatal("expected the blob to be backed by the page buffer")
+	}
+	data = append(data, 'x')
+	if !iter.ScanCopy(&name, &data) || name != "b" || string(data) != "data-b" {
+		t.Fatalf("expected row b, got %q %q: %v", name, data, iter.Close())
+	}
+	if &data[0] == &buf[4*3+1+6+1] {
+		t.Fatal("expected ScanCopy to copy the blob")
+	}
+
+	// the next page reuses the buffers too
+	buf = iter.next.next.framer.buf
+	if !iter.Scan(&name, &data) || name != "c" || string(data) != "data-c" {
+		t.Fatalf("expected row c, got %q %q: %v", name, data, iter.Close())
+	}
+	if &data[0] != &buf[4+1+4] {
+		t.Fatal("expected the blob of the next page to be backed by its buffer")
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// values scanned for MapScan are retained and always copied
+	iter = page("a").EnableBufferReuse()
+	buf = iter.framer.buf
+	row := make(map[string]interface{})
+	if !iter.MapScan(row) {
+		t.Fatal(iter.Close())
+	}
+	if data := row["data"].([]byte); string(data) != "data-a" || &data[0] == &buf[4+1+4] {
+		t.Fatalf("expected MapScan to copy the blob, got %q", data)
+	}
+}
+
+// BenchmarkIterScanWideRows scans 1M rows of 10 text and 10 blob columns.
+func BenchmarkIterScanWideRows(b *testing.B) {
+	const (
+		pages       = 1000
+		rowsPerPage = 1000
+		textColumns = 10
+		blobColumns = 10
+	)
+	var columns []ColumnInfo
+	for i := 0; i < textColumns; i++ {
+		columns = append(columns, ColumnInfo{Name: "text" + strconv.Itoa(i), TypeInfo: NativeType{proto: protoVersion4, typ: TypeVarchar}})
+	}
+	for i := 0; i < blobColumns; i++ {
+		columns = append(columns, ColumnInfo{Name: "blob" + strconv.Itoa(i), TypeInfo: NativeType{proto: protoVersion4, typ: TypeBlob}})
+	}
+	f := newFramer(nil, protoVersion4)
+	value := bytes.Repeat([]byte("v"), 32)
+	for i := 0; i < rowsPerPage; i++ {
+		for range columns {
+			f.writeBytes(value)
+		}
+	}
+	body := f.buf
+
+	texts := make([]string, textColumns)
+	blobs := make([][]byte, blobColumns)
+	dest := make([]interface{}, 0, len(columns))
+	for i := range texts {
+		dest = append(dest, &texts[i])
+	}
+	for i := range blobs {
+		dest = append(dest, &blobs[i])
+	}
+
+	for _, reuse := range []bool{false, true} {
+		name := "copy"
+		if reuse {
+			name = "reuse"
+		}
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for n := 0; n < b.N; n++ {
+				for p := 0; p < pages; p++ {
+					iter := &Iter{
+						meta:    resultMetadata{colCount: len(columns), actualColCount: len(columns), columns: columns},
+						numRows: rowsPerPage,
+						framer:  &framer{proto: protoVersion4, buf: body},
+					}
+					if reuse {
+						iter.EnableBufferReuse()
+					}
+					for iter.Scan(dest...) {
+					}
+					if err := iter.Close(); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIterHostFollowsPages(t *testing.T) {
+	page := func(host *HostInfo, values ...int32) *Iter {
+		f := newFramer(nil, protoVersion4)
+		for _, v := range values {
+			f.writeBytes(encInt(v))
+		}
+		return &Iter{
+			meta: resultMetadata{
+				colCount:       1,
+				actualColCount: 1,
+				columns:        []ColumnInfo{{Name: "val", TypeInfo: NativeType{proto: protoVersion4, typ: TypeInt}}},
+			},
+			numRows: len(values),
+			framer:  f,
+			host:    host,
+		}
+	}
+	host1 := &HostInfo{hostId: "host1"}
+	host2 := &HostInfo{hostId: "host2"}
+
+	iter := page(host1, 1, 2)
+	iter.next = &nextIter{pos: 2, next: page(host2, 3)}
+	// the next page was already fetched
+	iter.next.once.Do(func() {})
+
+	expected := []*HostInfo{host1, host1, host2}
+	var v int32
+	for i := 0; iter.Scan(&v); i++ {
+		if got := iter.Host(); got != expected[i] {
+			t.Errorf("row %d: expected coordinator %s, got %s", i, expected[i].HostID(), got.HostID())
+		}
+	}
+	if err := iter.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSessionRefreshMetadata(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+
+	ctx := context.Background()
+	// the test cluster has no control connection to read the metadata from
+	if err := db.RefreshMetadata(ctx); err == nil {
+		t.Fatal("expected an error without a control connection")
+	}
+
+	db.Close()
+	if err := db.RefreshMetadata(ctx); err != ErrSessionClosed {
+		t.Fatalf("expected %v after the session is closed, got %v", ErrSessionClosed, err)
+	}
+}
+
+func TestSessionRefreshMetadataRefreshes(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	db, err := testCluster(defaultProto, srv.Address).CreateSession()
+	if err != nil {
+		t.Fatalf("NewCluster: %v", err)
+	}
+	defer db.Close()
+
+	// the hosts are re-read from the control connection
+	var refreshes int32
+	db.ringRefresher.stop()
+	db.ringRefresher = newRefreshDebouncer(time.Second, func() error {
+		atomic.AddInt32(&refreshes, 1)
+		return nil
+	})
+	host := db.ring.allHosts()[0]
+	pool, ok := db.pool.getPool(host)
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	control := createControlConn(db)
+	control.conn.Store(&connHost{conn: pool.Pick(), host: host})
+	db.control = control
+	db.cfg.disableControlConn = false
+	defer func() {
+		db.control = nil
+		db.cfg.disableControlConn = true
+	}()
+
+	// the cached keyspace is read again, the server knows no keyspace
+	db.schemaDescriber.mu.Lock()
+	db.schemaDescriber.cache["gone"] = &KeyspaceMetadata{Name: "gone"}
+	db.schemaDescriber.mu.Unlock()
+	applied := db.MetadataRefreshStats().Applied
+	prepares := db.PreparesSent()
+
+	if err := db.RefreshMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := atomic.LoadInt32(&refreshes); n != 1 {
+		t.Fatalf("expected the hosts to be refreshed once, got %d", n)
+	}
+	db.schemaDescriber.mu.Lock()
+	_, cached := db.schemaDescriber.cache["gone"]
+	db.schemaDescriber.mu.Unlock()
+	if cached {
+		t.Fatal("expected the keyspace which no longer exists to be removed from the cache")
+	}
+	// the schema query is prepared as it has a bound value
+	if db.PreparesSent() == prepares {
+		t.Fatal("expected the schema of the keyspace to be queried")
+	}
+	if n := db.MetadataRefreshStats().Applied; n != applied+1 {
+		t.Fatalf("expected the token ring to be rebuilt once, got %d rebuilds", n-applied)
+	}
+}
+
+func TestSchemaDescriptionReadsAreBestEffort(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+
+	logger := &testLogger{}
+	cluster := testCluster(defaultProto, srv.Address)
+	cluster.Logger = logger
+	db, err := cluster.CreateSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	host := db.ring.allHosts()[0]
+	pool, ok := db.pool.getPool(host)
+	if !ok {
+		t.Fatal("no pool for host")
+	}
+	control := createControlConn(db)
+	control.conn.Store(&connHost{conn: pool.Pick(), host: host})
+	db.control = control
+	defer func() { db.control = nil }()
+	db.useSystemSchema = true
+
+	// the test server fails to prepare the queries, which have bound values
+	if indexes := getIndexesMetadata(db, "ks", ""); indexes != nil {
+		t.Fatalf("expected no indexes, got %v", indexes)
+	}
+	if options := getTablesOptions(db, "ks", "tbl"); options != nil {
+		t.Fatalf("expected no table options, got %v", options)
+	}
+	for _, msg := range []string{
+		`unable to read the secondary indexes of keyspace "ks"`,
+		`unable to read the options of the tables of keyspace "ks"`,
+	} {
+		if !strings.Contains(logger.String(), msg) {
+			t.Fatalf("expected %q to be logged, got %q", msg, logger.String())
+		}
+	}
+}
+
+type recordingStructuredLogger struct {
+	levels []LogLevel
+	msgs   []string
+	fields [][]LogField
+}
+
+func (l *recordingStructuredLogger) Log(level LogLevel, msg string, fields ...LogField) {
+	l.levels = append(l.levels, level)
+	l.msgs = append(l.msgs, msg)
+	l.fields = append(l.fields, fields)
+}
+
+func TestStructuredLogger(t *testing.T) {
+	rec := &recordingStructuredLogger{}
+	cfg := NewCluster()
+	cfg.StructuredLogger = rec
+	logger := cfg.logger()
+
+	err := errors.New("connection refused")
+	logEvent(logger, LogLevelWarn, "unable to dial", []LogField{{"host", "10.0.0.1"}, {"error", err}},
+		"gocql: unable to dial %q: %v\n", "10.0.0.1", err)
+	logger.Printf("gocql: negotiated protocol version %d\n", 4)
+
+	if !reflect.DeepEqual(rec.levels, []LogLevel{LogLevelWarn, LogLevelInfo}) {
+		t.Fatalf("unexpected levels %v", rec.levels)
+	}
+	if !reflect.DeepEqual(rec.msgs, []string{"unable to dial", "negotiated protocol version 4"}) {
+		t.Fatalf("unexpected messages %q", rec.msgs)
+	}
+	if exp := []LogField{{"host", "10.0.0.1"}, {"error", err}}; !reflect.DeepEqual(rec.fields[0], exp) {
+		t.Fatalf("expected fields %v, got %v", exp, rec.fields[0])
+	}
+	if len(rec.fields[1]) != 0 {
+		t.Fatalf("expected no fields, got %v", rec.fields[1])
+	}
+
+	std := &testLogger{}
+	// a StdLogger gets the text of the message
+	logEvent(std, LogLevelWarn, "unable to dial", []LogField{{"host", "10.0.0.1"}, {"error", err}},
+		"gocql: unable to dial %q: %v\n", "10.0.0.1", err)
+	NewStdStructuredLogger(std).Log(LogLevelError, "failed", LogField{"keyspace", "ks"})
+	if exp := "gocql: unable to dial \"10.0.0.1\": connection refused\ngocql: [error] failed keyspace=ks\n"; std.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, std.String())
+	}
+}
+
+// assertLoggedInSync fails if the text log prints to a StdLogger lacks the
+// message or the value of a field it logs to a StructuredLogger.
+func assertLoggedInSync(t *testing.T, log func(logger StdLogger)) {
+	t.Helper()
+	rec := &recordingStructuredLogger{}
+	cfg := NewCluster()
+	cfg.StructuredLogger = rec
+	log(cfg.logger())
+	std := &testLogger{}
+	log(std)
+
+	lines := strings.Split(strings.TrimSpace(std.String()), "\n")
+	if len(rec.msgs) == 0 || len(lines) != len(rec.msgs) {
+		t.Fatalf("expected the same messages to be logged, got %q and %q", rec.msgs, std.String())
+	}
+	for i, msg := range rec.msgs {
+		if !strings.Contains(lines[i], msg) {
+			t.Errorf("expected %q to contain the message %q", lines[i], msg)
+		}
+		for _, field := range rec.fields[i] {
+			if value := fmt.Sprint(field.Value); !strings.Contains(lines[i], value) {
+				t.Errorf("expected %q to contain the %s field %q", lines[i], field.Key, value)
+			}
+		}
+	}
+}
+
+func TestConnectionErrorsLoggedInSync(t *testing.T) {
+	srv := NewTestServer(t, defaultProto, context.Background())
+	defer srv.Stop()
+	db, err := newTestSession(defaultProto, srv.Address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	// a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+	down := &HostInfo{connectAddress: net.IPv4(127, 0, 0, 1), port: port, hostId: "host-1"}
+
+	assertLoggedInSync(t, func(logger StdLogger) {
+		pool := &hostConnPool{logger: logger, host: down}
+		pool.logConnectErr(errors.New("handshake failed"))
+	})
+	assertLoggedInSync(t, func(logger StdLogger) {
+		db.logger = logger
+		if err := createControlConn(db).connect([]*HostInfo{down}); err == nil {
+			t.Fatal("expected the control connection to fail")
+		}
+	})
+}
+
+type formatCounter struct{ n *int }
+
+func (f formatCounter) String() string {
+	*f.n++
+	return "formatted"
+}
+
+func TestLogLevel(t *testing.T) {
+	std := &testLogger{}
+	cfg := NewCluster()
+	cfg.Logger = std
+	cfg.LogLevel = LogLevelWarn
+	logger := cfg.logger()
+
+	var formatted int
+	logf(logger, LogLevelDebug, "gocql: handling frame: %v\n", formatCounter{&formatted})
+	logEvent(logger, LogLevelInfo, "host moved", []LogField{{"host", formatCounter{&formatted}}},
+		"gocql: host %v moved\n", formatCounter{&formatted})
+	logger.Printf("gocql: %v\n", formatCounter{&formatted})
+	if std.String() != "" || formatted != 0 {
+		t.Fatalf("expected the messages below the level to be dropped unformatted, got %q formatted %d times", std.String(), formatted)
+	}
+	if logEnabled(logger, LogLevelInfo) || !logEnabled(logger, LogLevelWarn) || !logEnabled(std, LogLevelDebug) {
+		t.Fatal("expected only the messages at or above the level to be enabled")
+	}
+
+	logf(logger, LogLevelWarn, "gocql: unable to parse event frame: %v\n", formatCounter{&formatted})
+	logEvent(logger, LogLevelError, "failed to connect", []LogField{{"error", "refused"}},
+		"error: failed to connect due to error: %v", "refused")
+	if exp := "gocql: unable to parse event frame: formatted\nerror: failed to connect due to error: refused"; std.String() != exp {
+		t.Fatalf("expected %q, got %q", exp, std.String())
+	}
+
+	rec := &recordingStructuredLogger{}
+	cfg = NewCluster()
+	cfg.StructuredLogger = rec
+	cfg.LogLevel = LogLevelInfo
+	logger = cfg.logger()
+	logf(logger, LogLevelDebug, "gocql: handling frame: %v\n", "frame")
+	logf(logger, LogLevelInfo, "gocql: negotiated protocol version %d\n", 4)
+	if !reflect.DeepEqual(rec.levels, []LogLevel{LogLevelInfo}) || rec.msgs[0] != "negotiated protocol version 4" {
+		t.Fatalf("unexpected messages %q at levels %v", rec.msgs, rec.levels)
+	}
+}
+
+func TestCheckSchemaAgreement(t *testing.T) {
+	hosts := []*HostInfo{
+		{connectAddress: net.IPv4(10, 0, 0, 1)},
+		{connectAddress: net.IPv4(10, 0, 0, 2)},
+		{connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	readVersions := func(versions map[string]string, failing string) func(context.Context, *HostInfo) (string, error) {
+		return func(_ context.Context, host *HostInfo) (string, error) {
+			addr := host.ConnectAddress().String()
+			if addr == failing {
+				return "", errors.New("timeout")
+			}
+			return versions[addr], nil
+		}
+	}
+
+	same := map[string]string{"10.0.0.1": "v1", "10.0.0.2": "v1", "10.0.0.3": "v1"}
+	agreed, versions, err := checkSchemaAgreement(context.Background(), hosts, readVersions(same, ""))
+	if err != nil || !agreed || !reflect.DeepEqual(versions, same) {
+		t.Fatalf("expected the hosts to agree on %v, got %t %v %v", same, agreed, versions, err)
+	}
+
+	lagging := map[string]string{"10.0.0.1": "v2", "10.0.0.2": "v1", "10.0.0.3": "v2"}
+	agreed, versions, err = checkSchemaAgreement(context.Background(), hosts, readVersions(lagging, ""))
+	if err != nil || agreed || !reflect.DeepEqual(versions, lagging) {
+		t.Fatalf("expected the hosts to disagree with %v, got %t %v %v", lagging, agreed, versions, err)
+	}
+
+	agreed, versions, err = checkSchemaAgreement(context.Background(), hosts, readVersions(same, "10.0.0.2"))
+	if err == nil || !strings.Contains(err.Error(), "10.0.0.2") || agreed {
+		t.Fatalf("expected the error of host 10.0.0.2, got %t %v", agreed, err)
+	}
+	if exp := map[string]string{"10.0.0.1": "v1", "10.0.0.3": "v1"}; !reflect.DeepEqual(versions, exp) {
+		t.Fatalf("expected the versions of the other hosts %v, got %v", exp, versions)
+	}
+}
+
+func TestControlConnectionSeedStrategy(t *testing.T) {
+	hosts := []*HostInfo{
+		{connectAddress: net.IPv4(10, 0, 0, 1)},
+		{connectAddress: net.IPv4(10, 0, 0, 2)},
+		{connectAddress: net.IPv4(10, 0, 0, 3)},
+	}
+	addrs := func(hosts []*HostInfo) []string {
+		var addrs []string
+		for _, host := range hosts {
+			addrs = append(addrs, host.ConnectAddress().String())
+		}
+		return addrs
+	}
+
+	if ordered := addrs(SeedStrategyInOrder.order(hosts)); !reflect.DeepEqual(ordered, addrs(hosts)) {
+		t.Fatalf("expected the hosts in order, got %v", ordered)
+	}
+	if ordered := SeedStrategyRandom.order(hosts); len(ordered) != len(hosts) {
+		t.Fatalf("expected all the hosts, got %v", addrs(ordered))
+	}
+
+	atomic.StoreUint32(&seedRoundRobinOffset, 0)
+	for _, exp := range [][]string{
+		{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+		{"10.0.0.2", "10.0.0.3", "10.0.0.1"},
+		{"10.0.0.3", "10.0.0.1", "10.0.0.2"},
+		{"10.0.0.1", "10.0.0.2", "10.0.0.3"},
+	} {
+		if ordered := addrs(SeedStrategyRoundRobin.order(hosts)); !reflect.DeepEqual(ordered, exp) {
+			t.Fatalf("expected %v, got %v", exp, ordered)
+		}
+	}
+}
+
+func TestControlConnErrorAllSeeds(t *testing.T) {
+	// the errors are the same whether the protocol version is discovered or
+	// the control connection opened
+	for _, proto := range []int{0, int(defaultProto)} {
+		cluster := NewCluster("127.0.0.1:1", "127.0.0.2:1")
+		cluster.ProtoVersion = proto
+		cluster.ConnectTimeout = time.Second
+		cluster.Logger = &testLogger{}
+		cluster.ControlConnectionSeedStrategy = SeedStrategyInOrder
+
+		_, err := cluster.CreateSession()
+		var connErr *ControlConnError
+		if !errors.As(err, &connErr) {
+			t.Fatalf("expected a *ControlConnError with protocol version %d, got %v", proto, err)
+		}
+		if len(connErr.Errors) != 2 {
+			t.Fatalf("expected the errors of the 2 hosts, got %v", connErr)
+		}
+		for i, exp := range []string{"127.0.0.1", "127.0.0.2"} {
+			if seedErr := connErr.Errors[i]; seedErr.Host.ConnectAddress().String() != exp || seedErr.Err == nil {
+				t.Fatalf("expected the error of host %s, got %v: %v", exp, seedErr.Host.ConnectAddress(), seedErr.Err)
+			}
+		}
+		if !strings.Contains(err.Error(), "127.0.0.1:1: ") || !strings.Contains(err.Error(), "127.0.0.2:1: ") {
+			t.Fatalf("expected the error of each host in %q", err.Error())
+		}
+		if !errors.Is(err, connErr.Errors[1].Err) {
+			t.Fatalf("expected %v to unwrap to the error of the last host", err)
+		}
+
+		cluster.ControlConnectionSeedStrategy = SeedStrategyRoundRobin
+		atomic.StoreUint32(&seedRoundRobinOffset, 0)
+		for _, exp := range [][]string{
+			{"127.0.0.1", "127.0.0.2"},
+			{"127.0.0.2", "127.0.0.1"},
+			{"127.0.0.1", "127.0.0.2"},
+		} {
+			_, err := cluster.CreateSession()
+			if !errors.As(err, &connErr) {
+				t.Fatalf("expected a *ControlConnError with protocol version %d, got %v", proto, err)
+			}
+			var tried []string
+			for _, seedErr := range connErr.Errors {
+				tried = append(tried, seedErr.Host.ConnectAddress().String())
+			}
+			if !reflect.DeepEqual(tried, exp) {
+				t.Fatalf("expected the hosts to be tried in the order %v, got %v", exp, tried)
+			}
+		}
+	}
+}
+
+func TestControlConnErrorString(t *testing.T) {
+	err1, err2 := errors.New("refused"), errors.New("timeout")
+	connErr := &ControlConnError{Errors: []SeedError{
+		{Host: &HostInfo{connectAddress: net.IPv4(10, 0, 0, 1), port: 9042}, Err: err1},
+		{Host: &HostInfo{connectAddress: net.IPv4(10, 0, 0, 2), port: 9042}, Err: err2},
+	}}
+	if exp := "unable to connect to initial hosts: 10.0.0.1:9042: refused; 10.0.0.2:9042: timeout"; connErr.Error() != exp {
+		t.Fatalf("expected %q, got %q", exp, connErr.Error())
+	}
+	if !errors.Is(connErr, err2) || errors.Is(connErr, err1) {
+		t.Fatalf("expected %v to unwrap to the error of the last host only", connErr)
+	}
+	if err := (&ControlConnError{}).Unwrap(); err != nil {
+		t.Fatalf("expected no error to unwrap without hosts, got %v", err)
+	}
+}
@@ -0,0 +1,92 @@
+package gocql
+
+import (
+	"context"
+	"fmt"
+)
+
+// SizeEstimate is the estimated size of the partitions of a table within a
+// token range, as computed periodically by a host for the ranges it owns, see
+// Session.SizeEstimates.
+type SizeEstimate struct {
+	// Host is the host which computed the estimate.
+	Host *HostInfo
+
+	// RangeStart and RangeEnd are the tokens of the start (exclusive) and end
+	// (inclusive) of the token range.
+	RangeStart string
+	RangeEnd   string
+
+	PartitionsCount int64
+	// MeanPartitionSize is the mean size of the partitions, in bytes.
+	MeanPartitionSize int64
+}
+
+// Size returns the estimated size of the partitions of the range, in bytes.
+func (e SizeEstimate) Size() int64 {
+	return e.PartitionsCount * e.MeanPartitionSize
+}
+
+const sizeEstimatesStmt = `SELECT range_start, range_end, partitions_count, mean_partition_size
+		FROM system.size_estimates
+		WHERE keyspace_name = ? AND table_name = ?`
+
+// SizeEstimates reads the size estimates of the table of keyspace computed by
+// the host of the control connection from system.size_estimates, one per token
+// range the host owns. The estimates are only computed for the primary ranges
+// of the host by some versions, and are empty until they are first computed,
+// by default 5 minutes after the host started.
+func (s *Session) SizeEstimates(keyspace, table string) ([]SizeEstimate, error) {
+	var host *HostInfo
+	if ch := s.control.getConn(); ch != nil {
+		host = ch.host
+	}
+	return scanSizeEstimates(s.control.query(sizeEstimatesStmt, keyspace, table), host)
+}
+
+// SizeEstimatesAllHosts reads the size estimates of the table of keyspace
+// computed by every host which is up, see SizeEstimates. A range is estimated
+// by each of its replicas, the total of the estimates of all the hosts counts
+// the data of every replica, see SumSizeEstimates.
+func (s *Session) SizeEstimatesAllHosts(ctx context.Context, keyspace, table string) ([]SizeEstimate, error) {
+	var estimates []SizeEstimate
+	for _, host := range s.ring.allHosts() {
+		if !host.IsUp() {
+			continue
+		}
+		iter := s.Query(sizeEstimatesStmt, keyspace, table).
+			WithContext(ctx).
+			Consistency(One).
+			RoutingToHost(host).
+			Iter()
+		hostEstimates, err := scanSizeEstimates(iter, host)
+		if err != nil {
+			return nil, fmt.Errorf("gocql: reading the size estimates of host %s: %w", host.ConnectAddress(), err)
+		}
+		estimates = append(estimates, hostEstimates...)
+	}
+	return estimates, nil
+}
+
+func scanSizeEstimates(iter *Iter, host *HostInfo) ([]SizeEstimate, error) {
+	var estimates []SizeEstimate
+	estimate := SizeEstimate{Host: host}
+	for iter.Scan(&estimate.RangeStart, &estimate.RangeEnd, &estimate.PartitionsCount, &estimate.MeanPartitionSize) {
+		estimates = append(estimates, estimate)
+		estimate = SizeEstimate{Host: host}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+	return estimates, nil
+}
+
+// SumSizeEstimates returns the total number of partitions and size, in bytes,
+// of the estimates.
+func SumSizeEstimates(estimates []SizeEstimate) (partitions, size int64) {
+	for _, e := range estimates {
+		partitions += e.PartitionsCount
+		size += e.Size()
+	}
+	return partitions, size
+}
@@ -0,0 +1,60 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScanSizeEstimates(t *testing.T) {
+	text := NativeType{proto: protoVersion4, typ: TypeVarchar}
+	bigint := NativeType{proto: protoVersion4, typ: TypeBigInt}
+
+	f := newFramer(nil, protoVersion4)
+	for _, row := range [][4]interface{}{
+		{"-9223372036854775808", "-3074457345618258603", int64(1000), int64(512)},
+		{"-3074457345618258603", "3074457345618258602", int64(2000), int64(1024)},
+	} {
+		f.writeBytes([]byte(row[0].(string)))
+		f.writeBytes([]byte(row[1].(string)))
+		f.writeBytes(encBigInt(row[2].(int64)))
+		f.writeBytes(encBigInt(row[3].(int64)))
+	}
+	iter := &Iter{
+		meta: resultMetadata{
+			colCount:       4,
+			actualColCount: 4,
+			columns: []ColumnInfo{
+				{Name: "range_start", TypeInfo: text},
+				{Name: "range_end", TypeInfo: text},
+				{Name: "partitions_count", TypeInfo: bigint},
+				{Name: "mean_partition_size", TypeInfo: bigint},
+			},
+		},
+		numRows: 2,
+		framer:  f,
+	}
+
+	host := &HostInfo{hostId: "host-1"}
+	estimates, err := scanSizeEstimates(iter, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []SizeEstimate{
+		{Host: host, RangeStart: "-9223372036854775808", RangeEnd: "-3074457345618258603", PartitionsCount: 1000, MeanPartitionSize: 512},
+		{Host: host, RangeStart: "-3074457345618258603", RangeEnd: "3074457345618258602", PartitionsCount: 2000, MeanPartitionSize: 1024},
+	}
+	assertDeepEqual(t, "size estimates", expected, estimates)
+
+	partitions, size := SumSizeEstimates(estimates)
+	if partitions != 3000 || size != 1000*512+2000*1024 {
+		t.Fatalf("expected 3000 partitions of %d bytes, got %d partitions of %d bytes", 1000*512+2000*1024, partitions, size)
+	}
+
+	queryErr := errors.New("unavailable")
+	if _, err := scanSizeEstimates(&Iter{err: queryErr}, host); err != queryErr {
+		t.Fatalf("expected the error of the query, got %v", err)
+	}
+}
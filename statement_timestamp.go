@@ -0,0 +1,164 @@
+package gocql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// statementWord is a word of a statement outside of parentheses, quotes and
+// comments.
+type statementWord struct {
+	word       string // upper case
+	start, end int
+	// markers is the number of ? bind markers before the word.
+	markers int
+}
+
+// statementWords returns the top level words of stmt and its number of ? bind
+// markers.
+func statementWords(stmt string) (words []statementWord, markers int) {
+	depth := 0
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case strings.HasPrefix(stmt[i:], "--"), strings.HasPrefix(stmt[i:], "//"):
+			end := strings.IndexByte(stmt[i:], '\n')
+			if end < 0 {
+				end = len(stmt) - i
+			}
+			i += end
+		case strings.HasPrefix(stmt[i:], "/*"):
+			i = skipPast(stmt, i+2, "*/")
+		case strings.HasPrefix(stmt[i:], "$$"):
+			i = skipPast(stmt, i+2, "$$")
+		case c == '\'' || c == '"':
+			i = skipQuoted(stmt, i, c)
+		case c == '?':
+			markers++
+			i++
+		case c == '(' || c == '[' || c == '{':
+			depth++
+			i++
+		case c == ')' || c == ']' || c == '}':
+			depth--
+			i++
+		case isWordByte(c):
+			end := i + 1
+			for end < len(stmt) && isWordByte(stmt[end]) {
+				end++
+			}
+			if depth == 0 {
+				words = append(words, statementWord{word: strings.ToUpper(stmt[i:end]), start: i, end: end, markers: markers})
+			}
+			i = end
+		default:
+			i++
+		}
+	}
+	return words, markers
+}
+
+// trimStatementEnd returns stmt without its trailing whitespace, comments and
+// semicolons, so that a clause can be appended to it.
+func trimStatementEnd(stmt string) string {
+	end := 0
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ';':
+			i++
+		case strings.HasPrefix(stmt[i:], "--"), strings.HasPrefix(stmt[i:], "//"):
+			n := strings.IndexByte(stmt[i:], '\n')
+			if n < 0 {
+				n = len(stmt) - i
+			}
+			i += n
+		case strings.HasPrefix(stmt[i:], "/*"):
+			i = skipPast(stmt, i+2, "*/")
+		case strings.HasPrefix(stmt[i:], "$$"):
+			i = skipPast(stmt, i+2, "$$")
+			end = i
+		case c == '\'' || c == '"':
+			i = skipQuoted(stmt, i, c)
+			end = i
+		default:
+			i++
+			end = i
+		}
+	}
+	return stmt[:end]
+}
+
+// withTimestampMarker adds a USING TIMESTAMP ? clause to the INSERT, UPDATE or
+// DELETE statement stmt. It returns the statement and the index of the
+// timestamp among its bind markers.
+func withTimestampMarker(stmt string) (string, int, error) {
+	return withUsingOption(stmt, "TIMESTAMP", "?", false)
+}
+
+// withTimeout adds a USING TIMEOUT clause, a Scylla extension, to the SELECT,
+// INSERT, UPDATE or DELETE statement stmt.
+func withTimeout(stmt string, timeout time.Duration) (string, error) {
+	ms := timeout.Milliseconds()
+	if ms < 1 {
+		ms = 1
+	}
+	stmt, _, err := withUsingOption(stmt, "TIMEOUT", strconv.FormatInt(ms, 10)+"ms", true)
+	return stmt, err
+}
+
+// withUsingOption adds the option name with value to the USING clause of stmt,
+// adding the clause if there is none. SELECT statements are only accepted if
+// selectable is set. It returns the statement and the number of bind markers
+// before the option.
+func withUsingOption(stmt, name, value string, selectable bool) (string, int, error) {
+	lower := strings.ToLower(name)
+	words, markers := statementWords(stmt)
+	if len(words) == 0 {
+		return "", 0, fmt.Errorf("gocql: can not set the %s of an empty statement", lower)
+	}
+
+	for i, w := range words {
+		if w.word != "USING" {
+			continue
+		}
+		for _, next := range words[i+1:] {
+			if next.word == name {
+				return "", 0, fmt.Errorf("gocql: statement already has a %s: %q", lower, stmt)
+			}
+		}
+		// USING TTL ? becomes USING TIMESTAMP ? AND TTL ?
+		return stmt[:w.end] + " " + name + " " + value + " AND" + stmt[w.end:], w.markers, nil
+	}
+
+	// the clause goes before the first of these words
+	var before string
+	switch words[0].word {
+	case "SELECT":
+		if !selectable {
+			break
+		}
+		fallthrough
+	case "INSERT":
+		return trimStatementEnd(stmt) + " USING " + name + " " + value, markers, nil
+	case "UPDATE":
+		before = "SET"
+	case "DELETE":
+		before = "WHERE"
+	}
+	if before == "" {
+		kinds := "INSERT, UPDATE and DELETE"
+		if selectable {
+			kinds = "SELECT, " + kinds
+		}
+		return "", 0, fmt.Errorf("gocql: the %s can only be set on %s statements, got %q", lower, kinds, stmt)
+	}
+	for _, w := range words[1:] {
+		if w.word == before {
+			return stmt[:w.start] + "USING " + name + " " + value + " " + stmt[w.start:], w.markers, nil
+		}
+	}
+	return "", 0, fmt.Errorf("gocql: statement has no %s clause: %q", before, stmt)
+}
@@ -0,0 +1,97 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithTimestampMarker(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		expected string
+		marker   int
+	}{
+		{"INSERT INTO t (a, b) VALUES (?, ?)", "INSERT INTO t (a, b) VALUES (?, ?) USING TIMESTAMP ?", 2},
+		{"insert into t (a) values (?) if not exists;", "insert into t (a) values (?) if not exists USING TIMESTAMP ?", 1},
+		{"INSERT INTO t (a) VALUES (?) USING TTL ?", "INSERT INTO t (a) VALUES (?) USING TIMESTAMP ? AND TTL ?", 1},
+		{"INSERT INTO t (a) VALUES (?) -- new row", "INSERT INTO t (a) VALUES (?) USING TIMESTAMP ?", 1},
+		{"INSERT INTO t (a) VALUES ('--'); // done\n/* end */", "INSERT INTO t (a) VALUES ('--') USING TIMESTAMP ?", 0},
+		{"UPDATE t SET m = {'set': ?} WHERE id = ?", "UPDATE t USING TIMESTAMP ? SET m = {'set': ?} WHERE id = ?", 0},
+		{"UPDATE t USING TTL 10 SET a = ? WHERE id = ?", "UPDATE t USING TIMESTAMP ? AND TTL 10 SET a = ? WHERE id = ?", 0},
+		{"DELETE m[?] FROM t WHERE id = ?", "DELETE m[?] FROM t USING TIMESTAMP ? WHERE id = ?", 1},
+		{"DELETE FROM \"where\" WHERE id = ?", "DELETE FROM \"where\" USING TIMESTAMP ? WHERE id = ?", 0},
+	}
+	for _, test := range tests {
+		stmt, marker, err := withTimestampMarker(test.stmt)
+		if err != nil {
+			t.Errorf("%q: %v", test.stmt, err)
+			continue
+		}
+		if stmt != test.expected || marker != test.marker {
+			t.Errorf("%q: expected %q with the timestamp marker %d, got %q and %d", test.stmt, test.expected, test.marker, stmt, marker)
+		}
+	}
+
+	for _, stmt := range []string{
+		"SELECT * FROM t",
+		"INSERT INTO t (a) VALUES (?) USING TTL 1 AND TIMESTAMP 2",
+		"UPDATE t",
+		"",
+	} {
+		if _, _, err := withTimestampMarker(stmt); err == nil {
+			t.Errorf("%q: expected an error", stmt)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	tests := []struct {
+		stmt     string
+		timeout  time.Duration
+		expected string
+	}{
+		{"SELECT * FROM t WHERE id = ? ALLOW FILTERING;", time.Second, "SELECT * FROM t WHERE id = ? ALLOW FILTERING USING TIMEOUT 1000ms"},
+		{"INSERT INTO t (a) VALUES (?) USING TTL ?", 2500 * time.Millisecond, "INSERT INTO t (a) VALUES (?) USING TIMEOUT 2500ms AND TTL ?"},
+		{"DELETE FROM t WHERE id = ?", time.Microsecond, "DELETE FROM t USING TIMEOUT 1ms WHERE id = ?"},
+	}
+	for _, test := range tests {
+		stmt, err := withTimeout(test.stmt, test.timeout)
+		if err != nil {
+			t.Errorf("%q: %v", test.stmt, err)
+			continue
+		}
+		if stmt != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.stmt, test.expected, stmt)
+		}
+	}
+
+	for _, stmt := range []string{
+		"SELECT * FROM t USING TIMEOUT 1s",
+		"CREATE TABLE t (id int PRIMARY KEY)",
+	} {
+		if _, err := withTimeout(stmt, time.Second); err == nil {
+			t.Errorf("%q: expected an error", stmt)
+		}
+	}
+}
+
+func TestBatchAddStmtWithTimestamp(t *testing.T) {
+	b := &Batch{}
+	if err := b.AddStmtWithTimestamp("UPDATE t SET a = ? WHERE id = ?", 42, "a", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.AddStmtWithTimestamp("DELETE m[?] FROM t WHERE id = ?", 43); err == nil {
+		t.Fatal("expected an error for missing values")
+	}
+	if len(b.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(b.Entries))
+	}
+	entry := b.Entries[0]
+	if entry.Stmt != "UPDATE t USING TIMESTAMP ? SET a = ? WHERE id = ?" || !reflect.DeepEqual(entry.Args, []interface{}{int64(42), "a", 1}) {
+		t.Fatalf("unexpected entry %q %v", entry.Stmt, entry.Args)
+	}
+}
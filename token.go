@@ -154,11 +154,15 @@ type TokenRing struct {
 	tokens []hostToken
 
 	hosts []*HostInfo
+
+	// tokensPerHost is the number of tokens owned by each host, by host ID.
+	tokensPerHost map[string]int
 }
 
 func newTokenRing(partitioner string, hosts []*HostInfo) (*TokenRing, error) {
 	tokenRing := &TokenRing{
-		hosts: hosts,
+		hosts:         hosts,
+		tokensPerHost: make(map[string]int, len(hosts)),
 	}
 
 	if strings.HasSuffix(partitioner, "Murmur3Partitioner") {
@@ -175,6 +179,7 @@ func newTokenRing(partitioner string, hosts []*HostInfo) (*TokenRing, error) {
 		for _, strToken := range host.Tokens() {
 			token := tokenRing.partitioner.ParseString(strToken)
 			tokenRing.tokens = append(tokenRing.tokens, hostToken{token, host})
+			tokenRing.tokensPerHost[host.HostID()]++
 		}
 	}
 
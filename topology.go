@@ -71,7 +71,7 @@ func getStrategy(ks *KeyspaceMetadata, logger StdLogger) placementStrategy {
 	case strings.Contains(ks.StrategyClass, "SimpleStrategy"):
 		rf, err := getReplicationFactorFromOpts(ks.StrategyOptions["replication_factor"])
 		if err != nil {
-			logger.Printf("parse rf for keyspace %q: %v", ks.Name, err)
+			logf(logger, LogLevelWarn, "parse rf for keyspace %q: %v", ks.Name, err)
 			return nil
 		}
 		return &simpleStrategy{rf: rf}
@@ -84,7 +84,7 @@ func getStrategy(ks *KeyspaceMetadata, logger StdLogger) placementStrategy {
 
 			rf, err := getReplicationFactorFromOpts(rf)
 			if err != nil {
-				logger.Println("parse rf for keyspace %q, dc %q: %v", err)
+				logf(logger, LogLevelWarn, "parse rf for keyspace %q, dc %q: %v", ks.Name, dc, err)
 				// skip DC if the rf is invalid/unsupported, so that we can at least work with other working DCs.
 				continue
 			}
@@ -95,11 +95,50 @@ func getStrategy(ks *KeyspaceMetadata, logger StdLogger) placementStrategy {
 	case strings.Contains(ks.StrategyClass, "LocalStrategy"):
 		return nil
 	default:
-		logger.Printf("parse rf for keyspace %q: unsupported strategy class: %v", ks.StrategyClass)
+		logf(logger, LogLevelWarn, "parse rf for keyspace %q: unsupported strategy class: %v", ks.Name, ks.StrategyClass)
 		return nil
 	}
 }
 
+// ReplicationClass returns the name of the replication strategy of the
+// keyspace without its package, eg. "NetworkTopologyStrategy".
+func (ks *KeyspaceMetadata) ReplicationClass() string {
+	return ks.StrategyClass[strings.LastIndex(ks.StrategyClass, ".")+1:]
+}
+
+// ReplicationFactor returns the replication factor of the keyspace in dc. For
+// SimpleStrategy the replication factor is the same in every datacenter and
+// LocalStrategy keyspaces are stored on every node only. ok is false if dc is
+// not replicated by a NetworkTopologyStrategy or the strategy is unknown.
+func (ks *KeyspaceMetadata) ReplicationFactor(dc string) (rf int, ok bool) {
+	switch strategy := getStrategy(ks, nopLogger{}).(type) {
+	case *simpleStrategy:
+		return strategy.rf, true
+	case *networkTopology:
+		rf, ok = strategy.dcs[dc]
+		return rf, ok
+	}
+	if strings.Contains(ks.StrategyClass, "LocalStrategy") {
+		return 1, true
+	}
+	return 0, false
+}
+
+// ReplicationFactors returns the replication factor of each datacenter of a
+// NetworkTopologyStrategy keyspace, or nil for other strategies. Datacenters
+// with an invalid replication factor are left out.
+func (ks *KeyspaceMetadata) ReplicationFactors() map[string]int {
+	strategy, ok := getStrategy(ks, nopLogger{}).(*networkTopology)
+	if !ok {
+		return nil
+	}
+	rfs := make(map[string]int, len(strategy.dcs))
+	for dc, rf := range strategy.dcs {
+		rfs[dc] = rf
+	}
+	return rfs
+}
+
 type simpleStrategy struct {
 	rf int
 }
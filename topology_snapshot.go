@@ -0,0 +1,125 @@
+package gocql
+
+import (
+	"net"
+	"sort"
+	"time"
+)
+
+// TopologyHost is a host of a TopologySnapshot.
+type TopologyHost struct {
+	HostID         string
+	ConnectAddress net.IP
+	Port           int
+	DataCenter     string
+	Rack           string
+	Tokens         []string
+	Up             bool
+
+	// ReleaseVersion is the Cassandra version of the host, formatted as
+	// "v4.0.11", or "" if it is unknown.
+	ReleaseVersion string
+	// DSEVersion is the DSE version of the host, or "" if it is not DSE.
+	DSEVersion string
+	// SchemaVersion is the schema version of the host as of the last read of
+	// system.local and system.peers.
+	SchemaVersion string
+}
+
+// TopologySnapshot is a snapshot of the hosts of the cluster known to the
+// session, see Session.Topology. It is not updated afterwards.
+type TopologySnapshot struct {
+	// Taken is when the snapshot was taken.
+	Taken       time.Time
+	ClusterName string
+	Partitioner string
+
+	// ControlHostID is the host ID of the host of the control connection, or ""
+	// if it is not connected.
+	ControlHostID string
+
+	// Hosts are the hosts ordered by datacenter, rack and host ID.
+	Hosts []TopologyHost
+}
+
+// SchemaVersions returns the host IDs of the hosts by schema version. The
+// schema is agreed on if there is a single version.
+func (t *TopologySnapshot) SchemaVersions() map[string][]string {
+	versions := make(map[string][]string)
+	for _, host := range t.Hosts {
+		versions[host.SchemaVersion] = append(versions[host.SchemaVersion], host.HostID)
+	}
+	return versions
+}
+
+// ReleaseVersions returns the host IDs of the hosts by release version, for
+// example to follow a rolling upgrade.
+func (t *TopologySnapshot) ReleaseVersions() map[string][]string {
+	versions := make(map[string][]string)
+	for _, host := range t.Hosts {
+		versions[host.ReleaseVersion] = append(versions[host.ReleaseVersion], host.HostID)
+	}
+	return versions
+}
+
+// Topology returns a snapshot of the hosts of the cluster known to the
+// session: their location, tokens, state and versions as of the last read of
+// system.local and system.peers by the control connection, and their state as
+// tracked by the session since. It is meant for operational tooling such as
+// monitoring rolling upgrades or schema agreement.
+//
+// The snapshot is consistent, each host is read at once, and is a copy which
+// is safe to retain and is not updated afterwards.
+func (s *Session) Topology() *TopologySnapshot {
+	t := &TopologySnapshot{Taken: time.Now()}
+	if s.control != nil {
+		if ch := s.control.getConn(); ch != nil {
+			t.ControlHostID = ch.host.HostID()
+		}
+	}
+
+	for _, host := range s.ring.allHosts() {
+		th, clusterName, partitioner := host.topology()
+		if t.ClusterName == "" {
+			t.ClusterName = clusterName
+		}
+		if t.Partitioner == "" {
+			t.Partitioner = partitioner
+		}
+		t.Hosts = append(t.Hosts, th)
+	}
+	sort.Slice(t.Hosts, func(i, j int) bool {
+		a, b := t.Hosts[i], t.Hosts[j]
+		if a.DataCenter != b.DataCenter {
+			return a.DataCenter < b.DataCenter
+		}
+		if a.Rack != b.Rack {
+			return a.Rack < b.Rack
+		}
+		return a.HostID < b.HostID
+	})
+	return t
+}
+
+// topology returns a copy of the host as a TopologyHost, along with its
+// cluster name and partitioner.
+func (h *HostInfo) topology() (TopologyHost, string, string) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	th := TopologyHost{
+		HostID:         h.hostId,
+		ConnectAddress: append(net.IP(nil), h.connectAddress...),
+		Port:           h.port,
+		DataCenter:     h.dataCenter,
+		Rack:           h.rack,
+		Tokens:         append([]string(nil), h.tokens...),
+		Up:             h.state == NodeUp,
+		DSEVersion:     h.dseVersion,
+		SchemaVersion:  h.schemaVersion,
+	}
+	if h.version != (cassVersion{}) {
+		th.ReleaseVersion = h.version.String()
+	}
+	return th, h.clusterName, h.partitioner
+}
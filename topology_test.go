@@ -2,6 +2,7 @@ package gocql
 
 import (
 	"fmt"
+	"reflect"
 	"sort"
 	"testing"
 )
@@ -203,3 +204,51 @@ func TestPlacementStrategy_NetworkStrategy(t *testing.T) {
 		})
 	}
 }
+
+func TestKeyspaceMetadataReplication(t *testing.T) {
+	simple := &KeyspaceMetadata{
+		StrategyClass:   "org.apache.cassandra.locator.SimpleStrategy",
+		StrategyOptions: map[string]interface{}{"replication_factor": "3"},
+	}
+	if class := simple.ReplicationClass(); class != "SimpleStrategy" {
+		t.Errorf("expected SimpleStrategy, got %q", class)
+	}
+	if rf, ok := simple.ReplicationFactor("dc1"); !ok || rf != 3 {
+		t.Errorf("expected rf 3, got %d (ok=%v)", rf, ok)
+	}
+	if rfs := simple.ReplicationFactors(); rfs != nil {
+		t.Errorf("expected no per datacenter replication factors, got %v", rfs)
+	}
+
+	network := &KeyspaceMetadata{
+		StrategyClass: "org.apache.cassandra.locator.NetworkTopologyStrategy",
+		StrategyOptions: map[string]interface{}{
+			"class": "org.apache.cassandra.locator.NetworkTopologyStrategy",
+			"dc1":   "3",
+			"dc2":   2,
+			"dc3":   "invalid",
+		},
+	}
+	if class := network.ReplicationClass(); class != "NetworkTopologyStrategy" {
+		t.Errorf("expected NetworkTopologyStrategy, got %q", class)
+	}
+	if rf, ok := network.ReplicationFactor("dc2"); !ok || rf != 2 {
+		t.Errorf("expected rf 2 in dc2, got %d (ok=%v)", rf, ok)
+	}
+	if rf, ok := network.ReplicationFactor("dc4"); ok {
+		t.Errorf("expected dc4 not to be replicated, got %d", rf)
+	}
+	if rfs, expected := network.ReplicationFactors(), map[string]int{"dc1": 3, "dc2": 2}; !reflect.DeepEqual(rfs, expected) {
+		t.Errorf("expected %v, got %v", expected, rfs)
+	}
+
+	local := &KeyspaceMetadata{StrategyClass: "org.apache.cassandra.locator.LocalStrategy"}
+	if rf, ok := local.ReplicationFactor("dc1"); !ok || rf != 1 {
+		t.Errorf("expected rf 1, got %d (ok=%v)", rf, ok)
+	}
+
+	unknown := &KeyspaceMetadata{StrategyClass: "EverywhereStrategy"}
+	if rf, ok := unknown.ReplicationFactor("dc1"); ok {
+		t.Errorf("expected no replication factor for an unknown strategy, got %d", rf)
+	}
+}
@@ -0,0 +1,156 @@
+package gocql
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TraceSummary summarizes the participation of the hosts in a traced request,
+// see Session.TraceSummary.
+type TraceSummary struct {
+	Coordinator net.IP
+	Duration    time.Duration
+
+	// Hosts are the hosts which recorded events, the coordinator first and
+	// then ordered by address.
+	Hosts []TraceHost
+}
+
+// TraceHost is the participation of a host in a traced request.
+type TraceHost struct {
+	Address net.IP
+	Events  int
+
+	// Elapsed is the time elapsed on the host between the start of the
+	// request and its last event.
+	Elapsed time.Duration
+
+	// Replica is true if the host read or wrote the data of the request,
+	// according to the activities of its events.
+	Replica bool
+
+	// LiveRows and Tombstones are the number of live rows and tombstone cells
+	// read by the host.
+	LiveRows   int
+	Tombstones int
+}
+
+// Replicas returns the hosts which read or wrote the data of the request.
+func (s *TraceSummary) Replicas() []TraceHost {
+	var replicas []TraceHost
+	for _, host := range s.Hosts {
+		if host.Replica {
+			replicas = append(replicas, host)
+		}
+	}
+	return replicas
+}
+
+// replicaActivities are parts of the activities of the trace events which are
+// only recorded by the hosts accessing data.
+var replicaActivities = []string{"single-partition query", "live rows", "commitlog", "memtable", "sstable"}
+
+type traceEvent struct {
+	activity string
+	source   net.IP
+	elapsed  int
+}
+
+// TraceSummary reads the events of the tracing session traceID, as passed to
+// Tracer.Trace, and summarizes which hosts participated in the request, for
+// example to compare the replicas which responded to a read with the number
+// required by its consistency level. The events are written asynchronously by
+// the hosts, the summary of a request which just finished may be incomplete.
+func (s *Session) TraceSummary(traceID []byte) (*TraceSummary, error) {
+	var (
+		coordinator net.IP
+		duration    int
+	)
+	iter := s.control.query(`SELECT coordinator, duration
+			FROM system_traces.sessions
+			WHERE session_id = ?`, traceID)
+	iter.Scan(&coordinator, &duration)
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	var (
+		events []traceEvent
+		event  traceEvent
+	)
+	iter = s.control.query(`SELECT activity, source, source_elapsed
+			FROM system_traces.events
+			WHERE session_id = ?`, traceID)
+	for iter.Scan(&event.activity, &event.source, &event.elapsed) {
+		events = append(events, event)
+		event = traceEvent{}
+	}
+	if err := iter.Close(); err != nil {
+		return nil, err
+	}
+
+	return summarizeTrace(coordinator, duration, events), nil
+}
+
+func summarizeTrace(coordinator net.IP, duration int, events []traceEvent) *TraceSummary {
+	summary := &TraceSummary{
+		Coordinator: coordinator,
+		Duration:    time.Duration(duration) * time.Microsecond,
+	}
+
+	hosts := make(map[string]*TraceHost)
+	for _, event := range events {
+		host, ok := hosts[event.source.String()]
+		if !ok {
+			host = &TraceHost{Address: event.source}
+			hosts[event.source.String()] = host
+		}
+		host.Events++
+		if elapsed := time.Duration(event.elapsed) * time.Microsecond; elapsed > host.Elapsed {
+			host.Elapsed = elapsed
+		}
+		for _, activity := range replicaActivities {
+			if strings.Contains(event.activity, activity) {
+				host.Replica = true
+				break
+			}
+		}
+		var live, tombstones int
+		if _, err := fmt.Sscanf(event.activity, "Read %d live rows and %d tombstone cells", &live, &tombstones); err == nil {
+			host.LiveRows += live
+			host.Tombstones += tombstones
+		}
+	}
+
+	for _, host := range hosts {
+		summary.Hosts = append(summary.Hosts, *host)
+	}
+	sort.Slice(summary.Hosts, func(i, j int) bool {
+		a, b := summary.Hosts[i].Address, summary.Hosts[j].Address
+		if a.Equal(coordinator) != b.Equal(coordinator) {
+			return a.Equal(coordinator)
+		}
+		return bytes.Compare(a.To16(), b.To16()) < 0
+	})
+	return summary
+}
+
+type traceSummaryTracer struct {
+	session *Session
+	fn      func(traceID []byte, summary *TraceSummary, err error)
+}
+
+// NewTraceSummaryTracer returns a Tracer which calls fn with the summary of the
+// participation of the hosts in each traced request, see Session.TraceSummary.
+func NewTraceSummaryTracer(session *Session, fn func(traceID []byte, summary *TraceSummary, err error)) Tracer {
+	return &traceSummaryTracer{session: session, fn: fn}
+}
+
+func (t *traceSummaryTracer) Trace(traceID []byte) {
+	summary, err := t.session.TraceSummary(traceID)
+	t.fn(traceID, summary, err)
+}
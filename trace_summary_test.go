@@ -0,0 +1,67 @@
+//go:build all || unit
+// +build all unit
+
+package gocql
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSummarizeTrace(t *testing.T) {
+	coordinator := net.IPv4(10, 0, 0, 2)
+	replica1 := net.IPv4(10, 0, 0, 1)
+	replica3 := net.IPv4(10, 0, 0, 3)
+	events := []traceEvent{
+		{activity: "Parsing SELECT * FROM ks.tbl WHERE id = 1", source: coordinator, elapsed: 100},
+		{activity: "reading data from /10.0.0.1", source: coordinator, elapsed: 300},
+		{activity: "reading digest from /10.0.0.3", source: coordinator, elapsed: 310},
+		{activity: "READ message received from /10.0.0.2", source: replica1, elapsed: 20},
+		{activity: "Executing single-partition query on tbl", source: replica1, elapsed: 60},
+		{activity: "Read 2 live rows and 1 tombstone cells", source: replica1, elapsed: 250},
+		{activity: "READ message received from /10.0.0.2", source: replica3, elapsed: 15},
+		{activity: "Read 2 live rows and 0 tombstone cells", source: replica3, elapsed: 180},
+		{activity: "Processing response from /10.0.0.1", source: coordinator, elapsed: 900},
+	}
+
+	summary := summarizeTrace(coordinator, 1200, events)
+	if summary.Duration != 1200*time.Microsecond {
+		t.Fatalf("unexpected duration %v", summary.Duration)
+	}
+	assertDeepEqual(t, "hosts", []TraceHost{
+		{Address: coordinator, Events: 4, Elapsed: 900 * time.Microsecond},
+		{Address: replica1, Events: 3, Elapsed: 250 * time.Microsecond, Replica: true, LiveRows: 2, Tombstones: 1},
+		{Address: replica3, Events: 2, Elapsed: 180 * time.Microsecond, Replica: true, LiveRows: 2},
+	}, summary.Hosts)
+	if replicas := summary.Replicas(); len(replicas) != 2 || !replicas[0].Address.Equal(replica1) || !replicas[1].Address.Equal(replica3) {
+		t.Fatalf("expected the replicas 10.0.0.1 and 10.0.0.3, got %v", replicas)
+	}
+}
+
+func TestRequestErrReplicaResponses(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected ReplicaResponses
+	}{
+		{&RequestErrReadTimeout{Consistency: Quorum, Received: 1, BlockFor: 2}, ReplicaResponses{Consistency: Quorum, Received: 1, BlockFor: 2}},
+		{&RequestErrWriteTimeout{Consistency: LocalQuorum, Received: 2, BlockFor: 3}, ReplicaResponses{Consistency: LocalQuorum, Received: 2, BlockFor: 3}},
+		{&RequestErrReadFailure{Consistency: All, Received: 1, BlockFor: 3, NumFailures: 1}, ReplicaResponses{Consistency: All, Received: 1, BlockFor: 3, Failures: 1}},
+		{&RequestErrWriteFailure{Consistency: One, BlockFor: 1, NumFailures: 2}, ReplicaResponses{Consistency: One, BlockFor: 1, Failures: 2}},
+		{&RequestErrCASWriteUnknown{Consistency: Quorum, Received: 1, BlockFor: 2}, ReplicaResponses{Consistency: Quorum, Received: 1, BlockFor: 2}},
+	}
+	for _, test := range tests {
+		responses, ok := RequestErrReplicaResponses(fmt.Errorf("query failed: %w", test.err))
+		if !ok || responses != test.expected {
+			t.Errorf("expected %v for %T, got %v (%v)", test.expected, test.err, responses, ok)
+		}
+	}
+
+	if _, ok := RequestErrReplicaResponses(&RequestErrUnavailable{}); ok {
+		t.Error("expected no replica responses for an unavailable error")
+	}
+	if _, ok := RequestErrReplicaResponses(ErrTimeoutNoResponse); ok {
+		t.Error("expected no replica responses for a client side timeout")
+	}
+}
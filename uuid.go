@@ -294,6 +294,15 @@ func (u UUID) Time() time.Time {
 	return time.Unix(sec+timeBase, nsec).UTC()
 }
 
+// EmbeddedTime returns the time embedded in a time based UUID (version 1), as
+// stored in a timeuuid column. ok is false for any other UUID version.
+func (u UUID) EmbeddedTime() (t time.Time, ok bool) {
+	if u.Version() != 1 {
+		return time.Time{}, false
+	}
+	return u.Time(), true
+}
+
 // Marshaling for JSON
 func (u UUID) MarshalJSON() ([]byte, error) {
 	return []byte(`"` + u.String() + `"`), nil
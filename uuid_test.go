@@ -143,6 +143,21 @@ func TestUUIDFromTime(t *testing.T) {
 	}
 }
 
+func TestUUIDEmbeddedTime(t *testing.T) {
+	date := time.Date(1982, 5, 5, 12, 34, 56, 400, time.UTC)
+	if got, ok := UUIDFromTime(date).EmbeddedTime(); !ok || got != date {
+		t.Errorf("expected embedded time %v, got %v (ok=%v)", date, got, ok)
+	}
+
+	random, err := RandomUUID()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := random.EmbeddedTime(); ok || !got.IsZero() {
+		t.Errorf("expected no embedded time in a version 4 UUID, got %v (ok=%v)", got, ok)
+	}
+}
+
 func TestTimeUUIDWith(t *testing.T) {
 	utcTime := time.Date(1982, 5, 5, 12, 34, 56, 400, time.UTC)
 	ts := int64(utcTime.Unix()-timeBase)*10000000 + int64(utcTime.Nanosecond()/100)